@@ -183,7 +183,7 @@ overrides:
 		require.NoError(t, err)
 
 		output, err := runMimirtoolBackfill(tmpDir, compactor, b)
-		require.Contains(t, output, "unsupported external label: ext")
+		require.Contains(t, output, "unsupported_external_labels")
 		require.Error(t, err)
 	}
 }
@@ -5,13 +5,20 @@ package compactor
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,7 +28,10 @@ import (
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	"github.com/thanos-io/objstore"
+	"golang.org/x/exp/slices"
 
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/concurrency"
 	"github.com/grafana/dskit/tenant"
 	"github.com/grafana/regexp"
 
@@ -29,6 +39,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
 	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
@@ -36,20 +47,41 @@ import (
 
 const (
 	uploadingMetaFilename       = "uploading-meta.json" // Name of the file that stores a block's meta file while it's being uploaded
+	uploadingPartsDirname       = "uploading-parts"     // Name of the directory storing the parts of the block files uploaded in parts
+	uploadingHashesDirname      = "uploading-hashes"    // Name of the directory storing the hashes computed while uploading the block files
 	validationFilename          = "validation.json"     // Name of the file that stores a heartbeat time and possibly an error message
 	validationHeartbeatInterval = 1 * time.Minute       // Duration of time between heartbeats of an in-progress block upload validation
 	validationHeartbeatTimeout  = 5 * time.Minute       // Maximum duration of time to wait until a validation is able to be restarted
 	maximumMetaSizeBytes        = 1 * 1024 * 1024       // 1 MiB, maximum allowed size of an uploaded block's meta.json file
+	maximumFinishBatchSize      = 1000                  // Maximum number of blocks whose upload can be finished in a single request
+	blockFilesCheckConcurrency  = 16                    // Maximum number of block files concurrently checked for existence when completing an upload
+	maximumListedBlockUploads   = 1000                  // Maximum number of in-progress block uploads returned when listing them
+	blockUploadsListConcurrency = 16                    // Maximum number of blocks concurrently checked when listing the in-progress block uploads
+	idempotentUploadHeader      = "X-Upload-Idempotent" // Response header set when a block file has already been uploaded, and the request body is ignored
 )
 
 var maxBlockUploadSizeBytesFormat = "block exceeds the maximum block size limit of %d bytes"
-var rePath = regexp.MustCompile(`^(index|chunks/\d{6})$`)
+
+// defaultBlockUploadAllowedFilePaths are the regular expressions matching the paths of the block files which can
+// be uploaded by default.
+var defaultBlockUploadAllowedFilePaths = []string{`index`, `chunks/\d{6}`, `tombstones`}
+var defaultBlockUploadFilePathRegexp = mustCompileBlockUploadAllowedFilePaths(defaultBlockUploadAllowedFilePaths)
+var reContentRange = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+
+// BlockUploadValidator validates the metadata of a block whose upload is being started, enforcing rules
+// which are specific to some tenants. Validators are registered by name in Config.BlockUploadValidators
+// and enabled per tenant.
+type BlockUploadValidator interface {
+	// ValidateBlockUpload returns an error, reported to the client, if the block must not be uploaded.
+	ValidateBlockUpload(ctx context.Context, tenantID string, meta *metadata.Meta) error
+}
 
 // StartBlockUpload handles request for starting block upload.
 //
 // Starting the uploading of a block means to upload a meta file and verify that the upload can
 // go ahead. In practice this means to check that the (complete) block isn't already in block
-// storage, and that the meta file is valid.
+// storage, and that the meta file is valid. Blocks whose data is older than the tenant's retention period
+// are rejected, unless the optional query parameter "allow-outside-retention" is true.
 func (c *MultitenantCompactor) StartBlockUpload(w http.ResponseWriter, r *http.Request) {
 	blockID, tenantID, err := c.parseBlockUploadParameters(r)
 	if err != nil {
@@ -57,6 +89,12 @@ func (c *MultitenantCompactor) StartBlockUpload(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	allowOutsideRetention, err := parseBoolQueryParam(r, "allow-outside-retention")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx := r.Context()
 	logger := log.With(util_log.WithContext(ctx, c.logger), "block", blockID)
 
@@ -90,7 +128,7 @@ func (c *MultitenantCompactor) StartBlockUpload(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := c.createBlockUpload(ctx, &meta, logger, userBkt, tenantID, blockID); err != nil {
+	if err := c.createBlockUpload(ctx, &meta, logger, userBkt, tenantID, blockID, allowOutsideRetention, blockUploadSource(r)); err != nil {
 		writeBlockUploadError(err, op, "", logger, w)
 		return
 	}
@@ -101,7 +139,11 @@ func (c *MultitenantCompactor) StartBlockUpload(w http.ResponseWriter, r *http.R
 // FinishBlockUpload handles request for finishing block upload.
 //
 // Finishing block upload performs block validation, and if all checks pass, marks block as finished
-// by uploading meta.json file.
+// by uploading meta.json file. Blocks whose data is older than the tenant's retention period are
+// rejected, unless the optional query parameter "allow-outside-retention" is true.
+//
+// If the optional query parameter "validate-only" is true, the checks done before completing the upload are
+// run, and a summary of the block is returned, but the upload isn't completed.
 func (c *MultitenantCompactor) FinishBlockUpload(w http.ResponseWriter, r *http.Request) {
 	blockID, tenantID, err := c.parseBlockUploadParameters(r)
 	if err != nil {
@@ -109,26 +151,170 @@ func (c *MultitenantCompactor) FinishBlockUpload(w http.ResponseWriter, r *http.
 		return
 	}
 
+	allowOutsideRetention, err := parseBoolQueryParam(r, "allow-outside-retention")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	validateOnly, err := parseBoolQueryParam(r, "validate-only")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx := r.Context()
 	logger := log.With(util_log.WithContext(ctx, c.logger), "block", blockID)
 
 	const op = "complete block upload"
 
 	userBkt := bucket.NewUserBucketClient(tenantID, c.bucketClient, c.cfgProvider)
-	m, _, err := c.checkBlockState(ctx, userBkt, blockID, true)
+
+	if validateOnly {
+		m, _, err := c.checkBlockUploadCompletion(ctx, logger, userBkt, tenantID, blockID, allowOutsideRetention)
+		if err != nil {
+			writeBlockUploadError(err, "validate block upload", "", logger, w)
+			return
+		}
+
+		res := blockUploadValidationResult{Block: blockID.String(), Files: len(m.Thanos.Files), MinTime: m.MinTime, MaxTime: m.MaxTime}
+		for _, f := range m.Thanos.Files {
+			res.SizeBytes += f.SizeBytes
+		}
+		util.WriteJSONResponse(w, res)
+		return
+	}
+	if err := c.completeBlockUpload(ctx, logger, userBkt, tenantID, blockID, allowOutsideRetention, blockUploadSource(r)); err != nil {
+		writeBlockUploadError(err, op, "", logger, w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// FinishBlockUploads handles request for finishing the upload of multiple blocks at once.
+//
+// The request body is a JSON object with the list of IDs of the blocks to finish. Each block is
+// finished like in FinishBlockUpload, and the outcome for each block is returned in the response.
+func (c *MultitenantCompactor) FinishBlockUploads(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := c.parseBlockUploadTenant(r)
 	if err != nil {
-		writeBlockUploadError(err, op, "while checking for complete block", logger, w)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// This should not happen, as checkBlockState with requireUploadInProgress=true returns nil error
-	// only if uploading-meta.json file exists.
-	if m == nil {
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	allowOutsideRetention, err := parseBoolQueryParam(r, "allow-outside-retention")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	logger := util_log.WithContext(ctx, c.logger)
+
+	const op = "complete block uploads"
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maximumMetaSizeBytes))
+	if err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			err = httpError{
+				message:    fmt.Sprintf("The request body was too large (maximum size allowed is %d bytes)", maximumMetaSizeBytes),
+				statusCode: http.StatusRequestEntityTooLarge,
+			}
+		}
+		writeBlockUploadError(err, op, "", logger, w)
+		return
+	}
+
+	var req finishBlockUploadsRequest
+	if err := json.Unmarshal(content, &req); err != nil {
+		http.Error(w, "malformed request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Blocks) == 0 {
+		http.Error(w, "no blocks to finish", http.StatusBadRequest)
+		return
+	}
+	if len(req.Blocks) > maximumFinishBatchSize {
+		http.Error(w, fmt.Sprintf("too many blocks to finish (maximum allowed is %d)", maximumFinishBatchSize), http.StatusBadRequest)
 		return
 	}
 
-	if c.cfgProvider.CompactorBlockUploadValidationEnabled(tenantID) {
+	userBkt := bucket.NewUserBucketClient(tenantID, c.bucketClient, c.cfgProvider)
+	source := blockUploadSource(r)
+	res := finishBlockUploadsResult{Results: make([]finishBlockUploadResult, 0, len(req.Blocks))}
+
+	for _, id := range req.Blocks {
+		result := finishBlockUploadResult{Block: id, Status: http.StatusOK}
+
+		if blockID, err := ulid.Parse(id); err != nil {
+			result.Status = http.StatusBadRequest
+			result.Error = "invalid block ID"
+		} else {
+			blockLogger := log.With(logger, "block", blockID)
+			if err := c.completeBlockUpload(ctx, blockLogger, userBkt, tenantID, blockID, allowOutsideRetention, source); err != nil {
+				var httpErr httpError
+				if errors.As(err, &httpErr) {
+					level.Warn(blockLogger).Log("msg", httpErr.message, "operation", op)
+					result.Status = httpErr.statusCode
+					result.Error = httpErr.message
+				} else {
+					level.Error(blockLogger).Log("msg", "an unexpected error occurred", "operation", op, "err", err)
+					result.Status = http.StatusInternalServerError
+					result.Error = "internal server error"
+				}
+			}
+		}
+
+		res.Results = append(res.Results, result)
+	}
+
+	util.WriteJSONResponse(w, res)
+}
+
+// blockUploadValidationResult is the summary of a block returned when validating the completion of its upload.
+type blockUploadValidationResult struct {
+	Block     string `json:"block"`
+	Files     int    `json:"files"`
+	SizeBytes int64  `json:"size_bytes"`
+	MinTime   int64  `json:"min_time"`
+	MaxTime   int64  `json:"max_time"`
+}
+
+type finishBlockUploadsRequest struct {
+	Blocks []string `json:"blocks"`
+}
+
+type finishBlockUploadsResult struct {
+	Results []finishBlockUploadResult `json:"results"`
+}
+
+type finishBlockUploadResult struct {
+	Block  string `json:"block"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// completeBlockUpload finishes the upload of a single block, starting its validation in the background
+// if enabled for the tenant. Errors that should be reported to the client are returned as httpError.
+func (c *MultitenantCompactor) completeBlockUpload(ctx context.Context, logger log.Logger, userBkt objstore.Bucket, tenantID string, blockID ulid.ULID, allowOutsideRetention bool, source string) error {
+	m, partsByFile, err := c.checkBlockUploadCompletion(ctx, logger, userBkt, tenantID, blockID, allowOutsideRetention)
+	if err != nil {
+		return err
+	}
+
+	// The in-flight meta file is deleted once the block is complete, so its creation time is read beforehand.
+	var startedAt time.Time
+	if c.blockUploadDuration != nil {
+		if startedAt, err = blockUploadStartTime(ctx, userBkt, blockID); err != nil {
+			level.Warn(logger).Log("msg", "failed to read the start time of the block upload", "err", err)
+		}
+	}
+
+	// Assembling the files uploaded in parts reads and writes them whole, so it's done in the background
+	// like the validation of the block, rather than while the client waits for the response.
+	validationEnabled := c.cfgProvider.CompactorBlockUploadValidationEnabled(tenantID)
+	if validationEnabled || len(partsByFile) > 0 {
 		maxConcurrency := int64(c.compactorCfg.MaxBlockUploadValidationConcurrency)
 		currentValidations := c.blockUploadValidations.Inc()
 		decreaseActiveValidationsInDefer := true
@@ -138,32 +324,523 @@ func (c *MultitenantCompactor) FinishBlockUpload(w http.ResponseWriter, r *http.
 			}
 		}()
 		if maxConcurrency > 0 && currentValidations > maxConcurrency {
-			err := httpError{
+			return httpError{
 				message:    fmt.Sprintf("too many block upload validations in progress, limit is %d", maxConcurrency),
 				statusCode: http.StatusTooManyRequests,
 			}
-			writeBlockUploadError(err, op, "", logger, w)
-			return
 		}
-		// create validation file to signal that block validation has started
-		if err := c.uploadValidation(ctx, blockID, userBkt); err != nil {
-			writeBlockUploadError(err, op, "while creating validation file", logger, w)
-			return
+		// create validation file to signal that block validation has started
+		if err := c.uploadValidation(ctx, blockID, userBkt); err != nil {
+			return errors.Wrap(err, "while creating validation file")
+		}
+		decreaseActiveValidationsInDefer = false
+		// The hashes of the files assembled in the background are recorded in the meta, so it's audited beforehand.
+		c.auditBlockUpload(ctx, "complete", tenantID, blockID, m, source)
+		go c.validateAndCompleteBlockUpload(logger, userBkt, blockID, m, startedAt, func(ctx context.Context) error {
+			defer c.blockUploadValidations.Dec()
+			if err := assembleBlockFileParts(ctx, logger, userBkt, blockID, m, partsByFile); err != nil {
+				return err
+			}
+			if !validationEnabled {
+				return nil
+			}
+			return c.validateBlock(ctx, logger, blockID, m, userBkt, tenantID)
+		})
+	} else {
+		if err := c.markBlockComplete(ctx, logger, userBkt, blockID, m); err != nil {
+			return errors.Wrap(err, "uploading meta file")
+		}
+		level.Debug(logger).Log("msg", "successfully completed block upload")
+		c.observeBlockUploadDuration(startedAt)
+		c.auditBlockUpload(ctx, "complete", tenantID, blockID, m, source)
+	}
+	return nil
+}
+
+// checkBlockUploadCompletion runs the checks done before completing the upload of a block, without modifying
+// the block. It returns the in-flight meta file, with the hashes of the block files not uploaded in parts, and
+// the parts of the block files uploaded in parts, by file path.
+// Errors that should be reported to the client are returned as httpError.
+func (c *MultitenantCompactor) checkBlockUploadCompletion(ctx context.Context, logger log.Logger, userBkt objstore.Bucket, tenantID string, blockID ulid.ULID, allowOutsideRetention bool) (*metadata.Meta, map[string][]string, error) {
+	m, _, err := c.checkBlockState(ctx, userBkt, blockID, true)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "while checking for complete block")
+	}
+
+	// This should not happen, as checkBlockState with requireUploadInProgress=true returns nil error
+	// only if uploading-meta.json file exists.
+	if m == nil {
+		return nil, nil, errors.New("missing in-flight meta file")
+	}
+
+	// The meta file has been sanitized when the upload has been started, but the tenant's limits may have
+	// changed since then.
+	if err := c.sanitizeMeta(logger, tenantID, blockID, m); err != nil {
+		return nil, nil, httpError{
+			message:    err.Error(),
+			statusCode: http.StatusBadRequest,
+		}
+	}
+
+	if err := c.checkBlockUploadMinAge(ctx, userBkt, tenantID, blockID); err != nil {
+		return nil, nil, err
+	}
+
+	// The retention period may have elapsed since the upload has been started, or been lowered meanwhile.
+	if !allowOutsideRetention {
+		if err := c.checkBlockRetention(tenantID, m); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	partsByFile, err := listBlockFileParts(ctx, userBkt, blockID, m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := checkBlockFilesUploaded(ctx, userBkt, blockID, m, partsByFile); err != nil {
+		return nil, nil, err
+	}
+
+	if err := verifyBlockFileHashes(ctx, userBkt, blockID, m, partsByFile); err != nil {
+		return nil, nil, err
+	}
+
+	return m, partsByFile, nil
+}
+
+// auditBlockUpload emits an audit log line for a block upload event. Audit lines always have the
+// same set of fields, so that they can be collected and parsed regardless of the log level.
+func (c *MultitenantCompactor) auditBlockUpload(ctx context.Context, event, tenantID string, blockID ulid.ULID, meta *metadata.Meta, source string) {
+	var size int64
+	for _, f := range meta.Thanos.Files {
+		size += f.SizeBytes
+	}
+
+	logger := util_log.WithContext(ctx, c.logger)
+	level.Info(logger).Log(
+		"msg", "block upload audit",
+		"audit", "block-upload",
+		"event", event,
+		"user", tenantID,
+		"block", blockID,
+		"files", len(meta.Thanos.Files),
+		"size_bytes", size,
+		"source", source,
+		"timestamp", c.now().UTC().Format(time.RFC3339Nano),
+	)
+}
+
+// blockUploadSource returns the identifier of the client performing a block upload request.
+func blockUploadSource(r *http.Request) string {
+	if ua := r.UserAgent(); ua != "" {
+		return fmt.Sprintf("%s (%s)", r.RemoteAddr, ua)
+	}
+	return r.RemoteAddr
+}
+
+// checkBlockFilesUploaded checks that the index and all the files listed in the block metadata have been
+// uploaded, so that an upload can't be completed before all its files are in the bucket.
+func checkBlockFilesUploaded(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID, meta *metadata.Meta, partsByFile map[string][]string) error {
+	// The index is always checked, since the block can't be queried without it, even if the meta file doesn't list it.
+	// The files uploaded in parts are assembled when the block upload is completed.
+	var toCheck []string
+	if len(partsByFile[block.IndexFilename]) == 0 {
+		toCheck = append(toCheck, block.IndexFilename)
+	}
+	for _, f := range meta.Thanos.Files {
+		if f.RelPath == block.MetaFilename || f.RelPath == block.IndexFilename || len(partsByFile[f.RelPath]) > 0 {
+			continue
+		}
+		toCheck = append(toCheck, f.RelPath)
+	}
+
+	uploaded := make([]bool, len(toCheck))
+	err := concurrency.ForEachJob(ctx, len(toCheck), blockFilesCheckConcurrency, func(ctx context.Context, idx int) error {
+		exists, err := userBkt.Exists(ctx, path.Join(blockID.String(), toCheck[idx]))
+		if err != nil {
+			return errors.Wrapf(err, "while checking for block file %s", toCheck[idx])
+		}
+		uploaded[idx] = exists
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for idx, exists := range uploaded {
+		if !exists {
+			missing = append(missing, toCheck[idx])
+		}
+	}
+
+	if len(missing) > 0 {
+		return httpError{
+			message:    fmt.Sprintf("block files not uploaded yet: %s", strings.Join(missing, ", ")),
+			statusCode: http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// verifyBlockFileHashes verifies the hashes computed while uploading the block files against the ones declared
+// in the block metadata, if any, and records the computed hashes in the block metadata. The hashes of the files
+// uploaded in parts are verified when the parts are assembled.
+func verifyBlockFileHashes(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID, meta *metadata.Meta, partsByFile map[string][]string) error {
+	var toVerify []*metadata.File
+	for i := range meta.Thanos.Files {
+		f := &meta.Thanos.Files[i]
+		if f.RelPath == block.MetaFilename || len(partsByFile[f.RelPath]) > 0 {
+			continue
+		}
+		toVerify = append(toVerify, f)
+	}
+
+	hashes := make([]string, len(toVerify))
+	err := concurrency.ForEachJob(ctx, len(toVerify), blockFilesCheckConcurrency, func(ctx context.Context, idx int) error {
+		var err error
+		hashes[idx], err = readBlockFileHash(ctx, userBkt, blockID, toVerify[idx].RelPath)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for idx, f := range toVerify {
+		if err := checkBlockFileHash(f, hashes[idx]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlockFileHash returns the SHA-256 hash of a block file computed while uploading it. The file isn't hashed
+// again if the hash hasn't been recorded, since that would read the whole file while the client waits: the file
+// has to be uploaded again instead.
+func readBlockFileHash(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID, relPath string) (string, error) {
+	r, err := userBkt.Get(ctx, blockFileHashPath(blockID, relPath))
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			return "", httpError{
+				message:    fmt.Sprintf("the hash of block file %s hasn't been recorded: upload the file again", relPath),
+				statusCode: http.StatusBadRequest,
+			}
+		}
+		return "", errors.Wrapf(err, "while reading the hash of block file %s", relPath)
+	}
+	defer func() { _ = r.Close() }()
+
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return "", errors.Wrapf(err, "while reading the hash of block file %s", relPath)
+	}
+	return string(value), nil
+}
+
+// isBlockFileUploaded returns whether a block file has already been uploaded with the size declared in the block
+// metadata. The file is considered uploaded only once its hash has been recorded, and the recorded hash must match
+// the one declared in the block metadata, if any.
+func isBlockFileUploaded(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID, f *metadata.File) (bool, error) {
+	attrs, err := userBkt.Attributes(ctx, path.Join(blockID.String(), f.RelPath))
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "while reading the attributes of block file %s", f.RelPath)
+	}
+	if attrs.Size != f.SizeBytes {
+		return false, nil
+	}
+
+	r, err := userBkt.Get(ctx, blockFileHashPath(blockID, f.RelPath))
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "while reading the hash of block file %s", f.RelPath)
+	}
+	defer func() { _ = r.Close() }()
+
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return false, errors.Wrapf(err, "while reading the hash of block file %s", f.RelPath)
+	}
+	if f.Hash != nil && f.Hash.Func == metadata.SHA256Func && f.Hash.Value != string(value) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkBlockFileHash checks that the SHA-256 hash computed for a block file matches the one declared in the block
+// metadata, if any, and records the computed hash in the block metadata.
+func checkBlockFileHash(f *metadata.File, computed string) error {
+	if f.Hash != nil && f.Hash.Func == metadata.SHA256Func && f.Hash.Value != computed {
+		return httpError{
+			message:    fmt.Sprintf("block file %s is corrupted: its SHA256 hash is %s, but %s declares %s", f.RelPath, computed, block.MetaFilename, f.Hash.Value),
+			statusCode: http.StatusBadRequest,
+		}
+	}
+
+	f.Hash = &metadata.ObjectHash{Func: metadata.SHA256Func, Value: computed}
+	return nil
+}
+
+// blockFileHashPath returns the path in the bucket of the SHA-256 hash of a block file computed while uploading it.
+func blockFileHashPath(blockID ulid.ULID, relPath string) string {
+	return path.Join(blockID.String(), uploadingHashesDirname, relPath)
+}
+
+// compileBlockUploadAllowedFilePaths compiles the regular expressions matching the paths of the block files
+// which can be uploaded into a single one, which matches a path if any of them matches the whole path.
+func compileBlockUploadAllowedFilePaths(patterns []string) (*regexp.Regexp, error) {
+	wrapped := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, errors.Wrapf(err, "invalid block upload allowed file path %q", p)
+		}
+		wrapped = append(wrapped, "(?:"+p+")")
+	}
+	return regexp.Compile("^(?:" + strings.Join(wrapped, "|") + ")$")
+}
+
+func mustCompileBlockUploadAllowedFilePaths(patterns []string) *regexp.Regexp {
+	re, err := compileBlockUploadAllowedFilePaths(patterns)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// isAllowedBlockFilePath returns whether a block file with the given path, relative to the block directory,
+// can be uploaded.
+func (c *MultitenantCompactor) isAllowedBlockFilePath(pth string) bool {
+	// The configured patterns may be loose, so we make sure that files can't be written outside
+	// the block directory, or over the files used to track the block upload.
+	if pth != path.Clean(pth) || path.IsAbs(pth) || pth == ".." || strings.HasPrefix(pth, "../") {
+		return false
+	}
+	switch strings.SplitN(pth, "/", 2)[0] {
+	case block.MetaFilename, uploadingMetaFilename, validationFilename, uploadingPartsDirname, uploadingHashesDirname:
+		return false
+	}
+
+	re := c.compactorCfg.blockUploadFilePathRegexp
+	if re == nil {
+		re = defaultBlockUploadFilePathRegexp
+	}
+	return re.MatchString(pth)
+}
+
+// isWithinBlockDir returns whether the object with the given path in the bucket is within the directory of the block.
+func isWithinBlockDir(blockID ulid.ULID, pth string) bool {
+	return pth == path.Clean(pth) && strings.SplitN(pth, "/", 2)[0] == blockID.String() && pth != blockID.String()
+}
+
+// parseBlockFileContentRange parses the Content-Range header of a block file part upload, returning
+// the first and last byte offsets of the part.
+func parseBlockFileContentRange(contentRange string, fileSize int64) (start, end int64, _ error) {
+	match := reContentRange.FindStringSubmatch(contentRange)
+	if match == nil {
+		return 0, 0, httpError{statusCode: http.StatusBadRequest, message: fmt.Sprintf("invalid Content-Range: %q", contentRange)}
+	}
+
+	// The regular expression only matches digits, so parsing can only fail on overflow.
+	var total int64
+	var err error
+	if start, err = strconv.ParseInt(match[1], 10, 64); err == nil {
+		if end, err = strconv.ParseInt(match[2], 10, 64); err == nil {
+			total, err = strconv.ParseInt(match[3], 10, 64)
+		}
+	}
+	if err != nil || start > end || end >= total {
+		return 0, 0, httpError{statusCode: http.StatusBadRequest, message: fmt.Sprintf("invalid Content-Range: %q", contentRange)}
+	}
+
+	if total != fileSize {
+		return 0, 0, httpError{statusCode: http.StatusBadRequest, message: fmt.Sprintf("file size doesn't match %s", block.MetaFilename)}
+	}
+	return start, end, nil
+}
+
+// blockFilePartPath returns the path in the bucket of the part of a block file starting at the given offset.
+// Offsets are zero-padded so that the parts of a file are listed in order.
+func blockFilePartPath(blockID ulid.ULID, relPath string, start int64) string {
+	return path.Join(blockFilePartsDir(blockID, relPath), fmt.Sprintf("%020d", start))
+}
+
+func blockFilePartsDir(blockID ulid.ULID, relPath string) string {
+	return path.Join(blockID.String(), uploadingPartsDirname, relPath)
+}
+
+// checkBlockFilePartOverlap returns an error if the part of the block file from byte start to byte end overlaps
+// another part of the file already uploaded. A part starting at the same offset isn't checked, since it gets replaced.
+// Concurrent requests can still store overlapping parts, in which case finishing the block upload fails.
+func checkBlockFilePartOverlap(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID, relPath string, start, end int64) error {
+	var prev string
+	prevStart, nextStart := int64(-1), int64(math.MaxInt64)
+	if err := userBkt.Iter(ctx, blockFilePartsDir(blockID, relPath)+objstore.DirDelim, func(name string) error {
+		offset, err := strconv.ParseInt(path.Base(name), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "while parsing the offset of block file part %s", name)
+		}
+		if offset < start && offset > prevStart {
+			prev, prevStart = name, offset
+		} else if offset > start && offset < nextStart {
+			nextStart = offset
+		}
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "while listing the parts of block file %s", relPath)
+	}
+
+	overlapping := int64(-1)
+	if end >= nextStart {
+		overlapping = nextStart
+	} else if prev != "" {
+		attrs, err := userBkt.Attributes(ctx, prev)
+		if err != nil && !userBkt.IsObjNotFoundErr(err) {
+			return errors.Wrapf(err, "while reading the size of block file part %s", prev)
+		}
+		if err == nil && prevStart+attrs.Size > start {
+			overlapping = prevStart
+		}
+	}
+	if overlapping >= 0 {
+		return httpError{
+			message:    fmt.Sprintf("part overlaps the part of block file %s uploaded at byte %d", relPath, overlapping),
+			statusCode: http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// listBlockFileParts returns the parts of the block files which have been uploaded in parts, by file path.
+// It checks that the parts of each file are contiguous and cover the whole file.
+func listBlockFileParts(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID, meta *metadata.Meta) (map[string][]string, error) {
+	partsByFile := map[string][]string{}
+	for _, f := range meta.Thanos.Files {
+		if f.RelPath == block.MetaFilename {
+			continue
+		}
+
+		var parts []string
+		if err := userBkt.Iter(ctx, blockFilePartsDir(blockID, f.RelPath)+objstore.DirDelim, func(name string) error {
+			parts = append(parts, name)
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "while listing the parts of block file %s", f.RelPath)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		sort.Strings(parts)
+
+		var next int64
+		for _, part := range parts {
+			start, err := strconv.ParseInt(path.Base(part), 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "while parsing the offset of block file part %s", part)
+			}
+			if start < next {
+				return nil, httpError{
+					message:    fmt.Sprintf("block file %s uploaded in overlapping parts at byte %d", f.RelPath, start),
+					statusCode: http.StatusBadRequest,
+				}
+			}
+			if start > next {
+				return nil, httpError{
+					message:    fmt.Sprintf("block file %s not uploaded completely: bytes %d-%d are missing", f.RelPath, next, start-1),
+					statusCode: http.StatusBadRequest,
+				}
+			}
+
+			attrs, err := userBkt.Attributes(ctx, part)
+			if err != nil {
+				return nil, errors.Wrapf(err, "while reading the size of block file part %s", part)
+			}
+			next = start + attrs.Size
+		}
+		if next != f.SizeBytes {
+			return nil, httpError{
+				message:    fmt.Sprintf("block file %s not uploaded completely: bytes %d-%d are missing", f.RelPath, next, f.SizeBytes-1),
+				statusCode: http.StatusBadRequest,
+			}
+		}
+
+		partsByFile[f.RelPath] = parts
+	}
+	return partsByFile, nil
+}
+
+// assembleBlockFileParts assembles the block files which have been uploaded in parts, and deletes the parts.
+func assembleBlockFileParts(ctx context.Context, logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID, meta *metadata.Meta, partsByFile map[string][]string) error {
+	for i := range meta.Thanos.Files {
+		f := &meta.Thanos.Files[i]
+		parts := partsByFile[f.RelPath]
+		if len(parts) == 0 {
+			continue
+		}
+
+		// The parts are opened before uploading the assembled file, since some bucket clients don't support
+		// reading an object while an upload is in progress.
+		readers := make([]io.Reader, 0, len(parts))
+		closers := make([]io.Closer, 0, len(parts))
+		closeParts := func() {
+			for _, c := range closers {
+				_ = c.Close()
+			}
+		}
+		for _, part := range parts {
+			rdr, err := userBkt.Get(ctx, part)
+			if err != nil {
+				closeParts()
+				return errors.Wrapf(err, "while reading block file part %s", part)
+			}
+			readers = append(readers, rdr)
+			closers = append(closers, rdr)
 		}
-		decreaseActiveValidationsInDefer = false
-		go c.validateAndCompleteBlockUpload(logger, userBkt, blockID, m, func(ctx context.Context) error {
-			defer c.blockUploadValidations.Dec()
-			return c.validateBlock(ctx, logger, blockID, m, userBkt, tenantID)
-		})
-	} else {
-		if err := c.markBlockComplete(ctx, logger, userBkt, blockID, m); err != nil {
-			writeBlockUploadError(err, op, "uploading meta file", logger, w)
-			return
+
+		dst := path.Join(blockID.String(), f.RelPath)
+		hasher := sha256.New()
+		err := userBkt.Upload(ctx, dst, partsReader{r: io.TeeReader(io.MultiReader(readers...), hasher), size: f.SizeBytes})
+		closeParts()
+		if err != nil {
+			return errors.Wrapf(err, "while assembling the parts of block file %s", f.RelPath)
+		}
+
+		if err := checkBlockFileHash(f, hex.EncodeToString(hasher.Sum(nil))); err != nil {
+			if err := userBkt.Delete(ctx, dst); err != nil && !userBkt.IsObjNotFoundErr(err) {
+				level.Warn(logger).Log("msg", "failed to delete corrupted block file", "path", f.RelPath, "err", err)
+			}
+			return err
+		}
+		level.Debug(logger).Log("msg", "assembled block file uploaded in parts", "path", f.RelPath, "parts", len(parts))
+
+		// The assembled file is complete, so failing to delete the parts only leaves garbage in the block.
+		for _, part := range parts {
+			if err := userBkt.Delete(ctx, part); err != nil {
+				level.Warn(logger).Log("msg", "failed to delete block file part", "part", part, "err", err)
+			}
 		}
-		level.Debug(logger).Log("msg", "successfully completed block upload")
 	}
+	return nil
+}
 
-	w.WriteHeader(http.StatusOK)
+// partsReader reads the parts of a block file, one after the other.
+type partsReader struct {
+	r    io.Reader
+	size int64
+}
+
+// ObjectSize implements thanos.ObjectSizer.
+func (r partsReader) ObjectSize() (int64, error) {
+	return r.size, nil
+}
+
+// Read implements io.Reader.
+func (r partsReader) Read(b []byte) (int, error) {
+	return r.r.Read(b)
 }
 
 // parseBlockUploadParameters parses common parameters from the request: block ID, tenant and checks if tenant has uploads enabled.
@@ -173,23 +850,54 @@ func (c *MultitenantCompactor) parseBlockUploadParameters(r *http.Request) (ulid
 		return ulid.ULID{}, "", errors.New("invalid block ID")
 	}
 
-	ctx := r.Context()
-	tenantID, err := tenant.TenantID(ctx)
+	tenantID, err := c.parseBlockUploadTenant(r)
+	if err != nil {
+		return ulid.ULID{}, "", err
+	}
+
+	return blockID, tenantID, nil
+}
+
+// parseBoolQueryParam parses an optional boolean query parameter, which is false if not set.
+func parseBoolQueryParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s parameter", name)
+	}
+	return v, nil
+}
+
+// parseBlockUploadTenant parses the tenant from the request and checks if tenant has uploads enabled.
+func (c *MultitenantCompactor) parseBlockUploadTenant(r *http.Request) (string, error) {
+	tenantID, err := tenant.TenantID(r.Context())
 	if err != nil {
-		return ulid.ULID{}, "", errors.New("invalid tenant ID")
+		return "", errors.New("invalid tenant ID")
 	}
 
 	if !c.cfgProvider.CompactorBlockUploadEnabled(tenantID) {
-		return ulid.ULID{}, "", errors.New("block upload is disabled")
+		return "", errors.New("block upload is disabled")
 	}
 
-	return blockID, tenantID, nil
+	return tenantID, nil
 }
 
 func writeBlockUploadError(err error, op, extra string, logger log.Logger, w http.ResponseWriter) {
 	var httpErr httpError
 	if errors.As(err, &httpErr) {
 		level.Warn(logger).Log("msg", httpErr.message, "operation", op)
+		if httpErr.retryAfter > 0 {
+			// Round up, so that the request isn't retried too early.
+			w.Header().Set("Retry-After", strconv.FormatInt(int64((httpErr.retryAfter+time.Second-1)/time.Second), 10))
+		}
+		if httpErr.body != nil {
+			writeBlockUploadErrorBody(w, httpErr.statusCode, httpErr.body, logger)
+			return
+		}
 		http.Error(w, httpErr.message, httpErr.statusCode)
 		return
 	}
@@ -202,34 +910,155 @@ func writeBlockUploadError(err error, op, extra string, logger log.Logger, w htt
 }
 
 func (c *MultitenantCompactor) createBlockUpload(ctx context.Context, meta *metadata.Meta,
-	logger log.Logger, userBkt objstore.Bucket, tenantID string, blockID ulid.ULID) error {
+	logger log.Logger, userBkt objstore.Bucket, tenantID string, blockID ulid.ULID, allowOutsideRetention bool, source string) error {
 	level.Debug(logger).Log("msg", "starting block upload")
 
-	if msg := c.sanitizeMeta(logger, tenantID, blockID, meta); msg != "" {
-		return httpError{
-			message:    msg,
+	if err := c.sanitizeMeta(logger, tenantID, blockID, meta); err != nil {
+		httpErr := httpError{
+			message:    err.Error(),
 			statusCode: http.StatusBadRequest,
 		}
+		var labelsErr unsupportedExternalLabelsError
+		if errors.As(err, &labelsErr) {
+			httpErr.body = &blockUploadErrorBody{Error: unsupportedExternalLabelsErrorType, Labels: labelsErr.labels}
+		}
+		return httpErr
 	}
 
-	// validate data is within the retention period
-	retention := c.cfgProvider.CompactorBlocksRetentionPeriod(tenantID)
-	if retention > 0 {
-		threshold := time.Now().Add(-retention)
-		if time.UnixMilli(meta.MaxTime).Before(threshold) {
-			maxTimeStr := util.FormatTimeMillis(meta.MaxTime)
+	for _, name := range c.cfgProvider.CompactorBlockUploadValidators(tenantID) {
+		validator, ok := c.compactorCfg.BlockUploadValidators[name]
+		if !ok {
+			return errors.Errorf("unknown block upload validator %q", name)
+		}
+
+		if err := validator.ValidateBlockUpload(ctx, tenantID, meta); err != nil {
 			return httpError{
-				message:    fmt.Sprintf("block max time (%s) older than retention period", maxTimeStr),
-				statusCode: http.StatusUnprocessableEntity,
+				message:    err.Error(),
+				statusCode: http.StatusBadRequest,
 			}
 		}
 	}
 
-	return c.uploadMeta(ctx, logger, meta, blockID, uploadingMetaFilename, userBkt)
+	if maxBlocks := c.cfgProvider.CompactorBlockUploadMaxUncompactedBlocks(tenantID); maxBlocks > 0 {
+		count, err := c.countUncompactedBlocks(ctx, logger, tenantID)
+		if err != nil {
+			return err
+		}
+		if count > maxBlocks {
+			return httpError{
+				message:    fmt.Sprintf("too many blocks not compacted yet (%d), limit is %d: retry later", count, maxBlocks),
+				statusCode: http.StatusServiceUnavailable,
+			}
+		}
+	}
+
+	if !allowOutsideRetention {
+		if err := c.checkBlockRetention(tenantID, meta); err != nil {
+			return err
+		}
+	}
+
+	if err := c.uploadMeta(ctx, logger, meta, blockID, uploadingMetaFilename, userBkt); err != nil {
+		return err
+	}
+
+	c.auditBlockUpload(ctx, "create", tenantID, blockID, meta, source)
+	return nil
+}
+
+// countUncompactedBlocks returns the number of blocks of the tenant which haven't been compacted yet, and aren't
+// marked for deletion, according to the tenant's bucket index. The bucket index can be read by every compactor,
+// whether it compacts the tenant or not. If the bucket index doesn't exist yet, or has been written by an older
+// version without the compaction levels, 0 is returned.
+func (c *MultitenantCompactor) countUncompactedBlocks(ctx context.Context, logger log.Logger, tenantID string) (int, error) {
+	idx, err := bucketindex.ReadIndex(ctx, c.bucketClient, tenantID, c.cfgProvider, logger)
+	if errors.Is(err, bucketindex.ErrIndexNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "while reading the bucket index")
+	}
+
+	deleted := make(map[ulid.ULID]struct{}, len(idx.BlockDeletionMarks))
+	for _, m := range idx.BlockDeletionMarks {
+		deleted[m.ID] = struct{}{}
+	}
+
+	count := 0
+	for _, b := range idx.Blocks {
+		if _, ok := deleted[b.ID]; !ok && b.CompactionLevel == 1 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// checkBlockRetention checks that the block's data is within the tenant's retention period.
+func (c *MultitenantCompactor) checkBlockRetention(tenantID string, meta *metadata.Meta) error {
+	retention := c.cfgProvider.CompactorBlocksRetentionPeriod(tenantID)
+	if retention <= 0 {
+		return nil
+	}
+
+	threshold := c.now().Add(-retention)
+	if time.UnixMilli(meta.MaxTime).Before(threshold) {
+		maxTimeStr := util.FormatTimeMillis(meta.MaxTime)
+		return httpError{
+			message:    fmt.Sprintf("block max time (%s) older than retention period", maxTimeStr),
+			statusCode: http.StatusUnprocessableEntity,
+		}
+	}
+	return nil
+}
+
+// checkBlockUploadMinAge checks that the upload of the block has been started for at least the tenant's
+// minimum block upload age. The upload start time is the creation time of the in-flight meta file.
+func (c *MultitenantCompactor) checkBlockUploadMinAge(ctx context.Context, userBkt objstore.Bucket, tenantID string, blockID ulid.ULID) error {
+	minAge := c.cfgProvider.CompactorBlockUploadMinAge(tenantID)
+	if minAge <= 0 {
+		return nil
+	}
+
+	startedAt, err := blockUploadStartTime(ctx, userBkt, blockID)
+	if err != nil {
+		return err
+	}
+
+	if wait := startedAt.Add(minAge).Sub(c.now()); wait > 0 {
+		return httpError{
+			message:    fmt.Sprintf("block upload started less than %s ago: retry in %s", minAge, wait.Round(time.Second)),
+			statusCode: http.StatusServiceUnavailable,
+			retryAfter: wait,
+		}
+	}
+	return nil
+}
+
+// blockUploadStartTime returns the time the upload of the block has been started, which is the creation time
+// of its in-flight meta file.
+func blockUploadStartTime(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID) (time.Time, error) {
+	attrs, err := userBkt.Attributes(ctx, path.Join(blockID.String(), uploadingMetaFilename))
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "while reading the in-flight meta file attributes")
+	}
+	return attrs.LastModified, nil
 }
 
 // UploadBlockFile handles requests for uploading block files.
 // It takes the mandatory query parameter "path", specifying the file's destination path.
+//
+// A file can be uploaded in a single request, or in parts to be able to resume the upload of a large
+// file after a failure. To upload a part, the client sets the Content-Range header to the byte range
+// of the file in the request body, for example "bytes 0-1048575/3145728", where the total must be the
+// size of the file in the block metadata. Parts are stored under the uploading-parts directory of the
+// block, named by their first byte offset, so uploading the same range again replaces the part: a
+// client resumes an upload by sending again the parts whose requests failed. Finishing the block upload
+// fails if the parts of a file don't cover the whole file, and otherwise assembles them in the background.
+//
+// If a whole file, sent with its Content-Length, has already been uploaded with the size declared in the block
+// metadata, for example because the response to a previous request got lost, the request body isn't read and
+// the response has the X-Upload-Idempotent header set to true. A client sending the Expect: 100-continue header
+// can therefore avoid sending the file again.
 func (c *MultitenantCompactor) UploadBlockFile(w http.ResponseWriter, r *http.Request) {
 	blockID, tenantID, err := c.parseBlockUploadParameters(r)
 	if err != nil {
@@ -254,7 +1083,7 @@ func (c *MultitenantCompactor) UploadBlockFile(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if !rePath.MatchString(pth) {
+	if !c.isAllowedBlockFilePath(pth) {
 		err := httpError{statusCode: http.StatusBadRequest, message: fmt.Sprintf("invalid path: %q", pth)}
 		writeBlockUploadError(err, op, "", logger, w)
 		return
@@ -282,29 +1111,96 @@ func (c *MultitenantCompactor) UploadBlockFile(w http.ResponseWriter, r *http.Re
 	}
 
 	// Check if file was specified in meta.json, and if it has expected size.
-	found := false
-	for _, f := range m.Thanos.Files {
-		if pth == f.RelPath {
-			found = true
-
-			if r.ContentLength >= 0 && r.ContentLength != f.SizeBytes {
-				err := httpError{statusCode: http.StatusBadRequest, message: fmt.Sprintf("file size doesn't match %s", block.MetaFilename)}
-				writeBlockUploadError(err, op, "", logger, w)
-				return
-			}
+	var file *metadata.File
+	for i := range m.Thanos.Files {
+		if pth == m.Thanos.Files[i].RelPath {
+			file = &m.Thanos.Files[i]
+			break
 		}
 	}
-	if !found {
+	if file == nil {
 		err := httpError{statusCode: http.StatusBadRequest, message: "unexpected file"}
 		writeBlockUploadError(err, op, "", logger, w)
 		return
 	}
 
+	if maxSize := c.cfgProvider.CompactorBlockUploadMaxFileSizeBytes(tenantID); maxSize > 0 && file.SizeBytes > maxSize {
+		err := fileTooLargeError(fmt.Sprintf("file size %d bytes exceeds the limit of %d bytes", file.SizeBytes, maxSize), maxSize)
+		writeBlockUploadError(err, op, "", logger, w)
+		return
+	}
+
 	dst := path.Join(blockID.String(), pth)
+	expectedSize := file.SizeBytes
+
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		start, end, err := parseBlockFileContentRange(contentRange, file.SizeBytes)
+		if err != nil {
+			writeBlockUploadError(err, op, "", logger, w)
+			return
+		}
+
+		expectedSize = end - start + 1
+		if r.ContentLength >= 0 && r.ContentLength != expectedSize {
+			err := httpError{statusCode: http.StatusBadRequest, message: "part size doesn't match Content-Range"}
+			writeBlockUploadError(err, op, "", logger, w)
+			return
+		}
+
+		// The parts of a file can't overlap, so that the bytes stored for the file, uploaded as a whole or in
+		// parts, stay within twice the size declared in the block metadata.
+		if err := checkBlockFilePartOverlap(ctx, userBkt, blockID, pth, start, end); err != nil {
+			writeBlockUploadError(err, op, "while checking the uploaded parts of the block file", logger, w)
+			return
+		}
+
+		dst = blockFilePartPath(blockID, pth, start)
+	} else if r.ContentLength >= 0 && r.ContentLength != expectedSize {
+		err := httpError{statusCode: http.StatusBadRequest, message: fmt.Sprintf("file size doesn't match %s", block.MetaFilename)}
+		writeBlockUploadError(err, op, "", logger, w)
+		return
+	}
+
+	// The path has already been validated, but we check again that the file is written within the block
+	// directory, so that loosening the path validation can never allow a directory traversal.
+	if !isWithinBlockDir(blockID, dst) {
+		err := httpError{statusCode: http.StatusBadRequest, message: fmt.Sprintf("invalid path: %q", pth)}
+		writeBlockUploadError(err, op, "", logger, w)
+		return
+	}
+
+	// Only a request declaring the size of a whole file can be answered without reading its body.
+	if dst == path.Join(blockID.String(), pth) && r.ContentLength >= 0 {
+		uploaded, err := isBlockFileUploaded(ctx, userBkt, blockID, file)
+		if err != nil {
+			// Not a reason to fail the request, since the file can be uploaded again.
+			level.Warn(logger).Log("msg", "failed to check if block file has already been uploaded", "path", pth, "err", err)
+		} else if uploaded {
+			level.Debug(logger).Log("msg", "block file has already been uploaded", "path", pth)
+			w.Header().Set(idempotentUploadHeader, "true")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	// The size of the body isn't known in advance if it's sent with chunked encoding, so we stop reading it
+	// once it exceeds the expected size.
+	r.Body = http.MaxBytesReader(w, r.Body, expectedSize)
 
 	level.Debug(logger).Log("msg", "uploading block file to bucket", "destination", dst, "size", r.ContentLength)
-	reader := bodyReader{r: r}
+	hasher := sha256.New()
+	reader := bodyReader{r: r, hash: hasher}
 	if err := userBkt.Upload(ctx, dst, reader); err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			// Don't leave a truncated file behind, in case the bucket client has stored it anyway.
+			if err := userBkt.Delete(ctx, dst); err != nil && !userBkt.IsObjNotFoundErr(err) {
+				level.Warn(logger).Log("msg", "failed to delete block file exceeding the expected size", "destination", dst, "err", err)
+			}
+			err := fileTooLargeError(fmt.Sprintf("file size exceeds the size declared in %s", block.MetaFilename), expectedSize)
+			writeBlockUploadError(err, op, "", logger, w)
+			return
+		}
+
 		level.Error(logger).Log("msg", "failed uploading block file to bucket", "operation", op, "destination", dst, "err", err)
 		// We don't know what caused the error; it could be the client's fault (e.g. killed
 		// connection), but internal server error is the safe choice here.
@@ -312,12 +1208,23 @@ func (c *MultitenantCompactor) UploadBlockFile(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	// Record the hash of the file, to verify it when the block upload is completed. The file isn't considered
+	// uploaded until its hash is recorded, since a stale hash of a previous upload of the file could be left.
+	if dst == path.Join(blockID.String(), pth) {
+		hashPath := blockFileHashPath(blockID, pth)
+		if err := userBkt.Upload(ctx, hashPath, strings.NewReader(hex.EncodeToString(hasher.Sum(nil)))); err != nil {
+			level.Error(logger).Log("msg", "failed uploading block file hash to bucket", "operation", op, "destination", hashPath, "err", err)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	level.Debug(logger).Log("msg", "finished uploading block file to bucket", "path", pth)
 
 	w.WriteHeader(http.StatusOK)
 }
 
-func (c *MultitenantCompactor) validateAndCompleteBlockUpload(logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID, meta *metadata.Meta, validation func(context.Context) error) {
+func (c *MultitenantCompactor) validateAndCompleteBlockUpload(logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID, meta *metadata.Meta, startedAt time.Time, validation func(context.Context) error) {
 	level.Debug(logger).Log("msg", "completing block upload", "files", len(meta.Thanos.Files))
 
 	{
@@ -354,6 +1261,7 @@ func (c *MultitenantCompactor) validateAndCompleteBlockUpload(logger log.Logger,
 		}
 		return
 	}
+	c.observeBlockUploadDuration(startedAt)
 
 	if err := userBkt.Delete(ctx, path.Join(blockID.String(), validationFilename)); err != nil {
 		level.Warn(logger).Log("msg", fmt.Sprintf(
@@ -364,33 +1272,85 @@ func (c *MultitenantCompactor) validateAndCompleteBlockUpload(logger log.Logger,
 	level.Debug(logger).Log("msg", "successfully completed block upload")
 }
 
+// observeBlockUploadDuration observes the duration of a block upload which has just been completed, if the time
+// it has been started at is known.
+func (c *MultitenantCompactor) observeBlockUploadDuration(startedAt time.Time) {
+	if !startedAt.IsZero() {
+		c.blockUploadDuration.Observe(c.now().Sub(startedAt).Seconds())
+	}
+}
+
 func (c *MultitenantCompactor) markBlockComplete(ctx context.Context, logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID, meta *metadata.Meta) error {
 	if err := c.uploadMeta(ctx, logger, meta, blockID, block.MetaFilename, userBkt); err != nil {
 		level.Error(logger).Log("msg", "error uploading block metadata file", "err", err)
 		return err
 	}
 
-	if err := userBkt.Delete(ctx, path.Join(blockID.String(), uploadingMetaFilename)); err != nil {
-		// Not returning an error since the temporary meta file persisting is a harmless side effect
-		level.Warn(logger).Log("msg", fmt.Sprintf("failed to delete %s from block in object storage", uploadingMetaFilename), "err", err)
+	c.deleteUploadingMeta(ctx, logger, userBkt, blockID)
+	deleteBlockFileHashes(ctx, logger, userBkt, blockID)
+	return nil
+}
+
+// deleteBlockFileHashes deletes the hashes recorded while uploading the block files. They're recorded in the
+// meta file once the block upload is completed, so failing to delete them only leaves garbage in the block.
+func deleteBlockFileHashes(ctx context.Context, logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID) {
+	var hashes []string
+	if err := userBkt.Iter(ctx, path.Join(blockID.String(), uploadingHashesDirname)+objstore.DirDelim, func(name string) error {
+		hashes = append(hashes, name)
+		return nil
+	}, objstore.WithRecursiveIter); err != nil {
+		level.Warn(logger).Log("msg", "failed to list block file hashes", "err", err)
+		return
+	}
+
+	for _, name := range hashes {
+		if err := userBkt.Delete(ctx, name); err != nil && !userBkt.IsObjNotFoundErr(err) {
+			level.Warn(logger).Log("msg", "failed to delete block file hash", "path", name, "err", err)
+		}
 	}
+}
 
-	return nil
+// deleteUploadingMeta deletes the temporary meta file of a block whose upload has completed, retrying on failure.
+func (c *MultitenantCompactor) deleteUploadingMeta(ctx context.Context, logger log.Logger, userBkt objstore.Bucket, blockID ulid.ULID) {
+	retries := backoff.New(ctx, backoff.Config{
+		MinBackoff: c.compactorCfg.blockUploadCleanupMinBackoff,
+		MaxBackoff: c.compactorCfg.blockUploadCleanupMaxBackoff,
+		MaxRetries: c.compactorCfg.BlockUploadCleanupRetries + 1,
+	})
+
+	var err error
+	for retries.Ongoing() {
+		err = userBkt.Delete(ctx, path.Join(blockID.String(), uploadingMetaFilename))
+		if err == nil || userBkt.IsObjNotFoundErr(err) {
+			return
+		}
+		retries.Wait()
+	}
+
+	// Not returning an error since the block is complete, and the temporary meta file persisting is a harmless side effect
+	level.Warn(logger).Log("msg", fmt.Sprintf("failed to delete %s from block in object storage", uploadingMetaFilename), "err", err)
+	c.blockUploadTempCleanupFailures.Inc()
 }
 
-// sanitizeMeta sanitizes and validates a metadata.Meta object. If a validation error occurs, an error
-// message gets returned, otherwise an empty string.
-func (c *MultitenantCompactor) sanitizeMeta(logger log.Logger, userID string, blockID ulid.ULID, meta *metadata.Meta) string {
+// reservedExternalLabelPrefix is the prefix of the external labels used internally by Mimir, which can't
+// be set by the uploaded blocks, except for the compactor shard ID label.
+const reservedExternalLabelPrefix = "__"
+
+// sanitizeMeta sanitizes and validates a metadata.Meta object. If a validation error occurs, it gets
+// returned, otherwise nil.
+func (c *MultitenantCompactor) sanitizeMeta(logger log.Logger, userID string, blockID ulid.ULID, meta *metadata.Meta) error {
 	if meta == nil {
-		return "missing block metadata"
+		return errors.New("missing block metadata")
 	}
 
 	// check that the blocks doesn't contain down-sampled data
 	if meta.Thanos.Downsample.Resolution > 0 {
-		return "block contains downsampled data"
+		return errors.New("block contains downsampled data")
 	}
 
 	meta.ULID = blockID
+	allowedLabels := c.cfgProvider.CompactorBlockUploadAllowedLabels(userID)
+	var reservedLabels, unsupportedLabels []string
 	for l, v := range meta.Thanos.Labels {
 		switch l {
 		// Preserve this label
@@ -403,61 +1363,95 @@ func (c *MultitenantCompactor) sanitizeMeta(logger log.Logger, userID string, bl
 			}
 
 			if _, _, err := sharding.ParseShardIDLabelValue(v); err != nil {
-				return fmt.Sprintf("invalid %s external label: %q",
+				return fmt.Errorf("invalid %s external label: %q",
 					mimir_tsdb.CompactorShardIDExternalLabel, v)
 			}
-		// Remove unused labels
+		// Remove unused labels. They're removed even if allowed by the tenant's configuration, so that
+		// the tenant ID label can never differ from the tenant uploading the block.
 		case mimir_tsdb.DeprecatedTenantIDExternalLabel, mimir_tsdb.DeprecatedIngesterIDExternalLabel, mimir_tsdb.DeprecatedShardIDExternalLabel:
 			level.Debug(logger).Log("msg", "removing unused external label",
 				"label", l, "value", v)
 			delete(meta.Thanos.Labels, l)
 		default:
-			return fmt.Sprintf("unsupported external label: %s", l)
+			// Reject the labels with the reserved prefix, which are used internally, even if allowed by
+			// the tenant's configuration.
+			if strings.HasPrefix(l, reservedExternalLabelPrefix) {
+				reservedLabels = append(reservedLabels, l)
+				continue
+			}
+
+			// Preserve the labels allowed by the tenant's configuration
+			if slices.Contains(allowedLabels, l) {
+				if v == "" {
+					level.Debug(logger).Log("msg", "removing empty external label",
+						"label", l)
+					delete(meta.Thanos.Labels, l)
+				}
+				continue
+			}
+			unsupportedLabels = append(unsupportedLabels, l)
 		}
 	}
+	if len(reservedLabels) > 0 {
+		sort.Strings(reservedLabels)
+		return fmt.Errorf("block has external labels with the reserved prefix %q: %s",
+			reservedExternalLabelPrefix, strings.Join(reservedLabels, ", "))
+	}
+	if len(unsupportedLabels) > 0 {
+		sort.Strings(unsupportedLabels)
+		return unsupportedExternalLabelsError{labels: unsupportedLabels}
+	}
 
 	meta.Compaction.Parents = nil
 	meta.Compaction.Sources = []ulid.ULID{blockID}
 
+	if maxFiles := c.cfgProvider.CompactorBlockUploadMaxFiles(userID); maxFiles > 0 && len(meta.Thanos.Files) > maxFiles {
+		return fmt.Errorf("block has too many files (%d), limit is %d", len(meta.Thanos.Files), maxFiles)
+	}
+
 	for _, f := range meta.Thanos.Files {
 		if f.RelPath == block.MetaFilename {
 			continue
 		}
 
-		if !rePath.MatchString(f.RelPath) {
-			return fmt.Sprintf("file with invalid path: %s", f.RelPath)
+		if !c.isAllowedBlockFilePath(f.RelPath) {
+			return fmt.Errorf("file with invalid path: %s", f.RelPath)
 		}
 
 		if f.SizeBytes <= 0 {
-			return fmt.Sprintf("file with invalid size: %s", f.RelPath)
+			return fmt.Errorf("file with invalid size: %s", f.RelPath)
+		}
+
+		if f.Hash != nil && f.Hash.Func != "" && f.Hash.Func != metadata.SHA256Func {
+			return fmt.Errorf("file with unsupported hash function %q: %s", f.Hash.Func, f.RelPath)
 		}
 	}
 
 	if err := c.validateMaximumBlockSize(logger, meta.Thanos.Files, userID); err != nil {
-		return err.Error()
+		return err
 	}
 
 	if meta.Version != metadata.TSDBVersion1 {
-		return fmt.Sprintf("version must be %d", metadata.TSDBVersion1)
+		return fmt.Errorf("version must be %d", metadata.TSDBVersion1)
 	}
 
 	// validate minTime/maxTime
 	// basic sanity check
 	if meta.MinTime < 0 || meta.MaxTime < 0 || meta.MaxTime < meta.MinTime {
-		return fmt.Sprintf("invalid minTime/maxTime: minTime=%d, maxTime=%d",
+		return fmt.Errorf("invalid minTime/maxTime: minTime=%d, maxTime=%d",
 			meta.MinTime, meta.MaxTime)
 	}
 	// validate that times are in the past
-	now := time.Now()
+	now := c.now()
 	if meta.MinTime > now.UnixMilli() || meta.MaxTime > now.UnixMilli() {
-		return fmt.Sprintf("block time(s) greater than the present: minTime=%d, maxTime=%d",
+		return fmt.Errorf("block time(s) greater than the present: minTime=%d, maxTime=%d",
 			meta.MinTime, meta.MaxTime)
 	}
 
 	// Mark block source
-	meta.Thanos.Source = "upload"
+	meta.Thanos.Source = metadata.UploadSource
 
-	return ""
+	return nil
 }
 
 func (c *MultitenantCompactor) uploadMeta(ctx context.Context, logger log.Logger, meta *metadata.Meta, blockID ulid.ULID, name string, userBkt objstore.Bucket) error {
@@ -585,14 +1579,64 @@ func (c *MultitenantCompactor) validateMaximumBlockSize(logger log.Logger, files
 type httpError struct {
 	message    string
 	statusCode int
+
+	// Optional machine-readable body, sent instead of the message if set.
+	body *blockUploadErrorBody
+
+	// Optional time after which the request can be retried, sent in the Retry-After header if set.
+	retryAfter time.Duration
 }
 
 func (e httpError) Error() string {
 	return e.message
 }
 
+// unsupportedExternalLabelsErrorType is the error type of block uploads rejected because of unsupported external labels.
+const unsupportedExternalLabelsErrorType = "unsupported_external_labels"
+
+// fileTooLargeErrorType is the error type of block file uploads rejected because the file is too large.
+const fileTooLargeErrorType = "file_too_large"
+
+// blockUploadErrorBody is the JSON body of the errors that clients are expected to handle programmatically.
+type blockUploadErrorBody struct {
+	Error        string   `json:"error"`
+	Message      string   `json:"message,omitempty"`
+	Labels       []string `json:"labels,omitempty"`
+	MaxSizeBytes int64    `json:"max_size_bytes,omitempty"`
+}
+
+// fileTooLargeError returns the error of a block file upload rejected because the file is larger
+// than maxSizeBytes. Retrying the upload of the same file can't succeed.
+func fileTooLargeError(message string, maxSizeBytes int64) httpError {
+	return httpError{
+		message:    message,
+		statusCode: http.StatusRequestEntityTooLarge,
+		body:       &blockUploadErrorBody{Error: fileTooLargeErrorType, Message: message, MaxSizeBytes: maxSizeBytes},
+	}
+}
+
+// writeBlockUploadErrorBody writes body as JSON with the given status code.
+func writeBlockUploadErrorBody(w http.ResponseWriter, statusCode int, body *blockUploadErrorBody, logger log.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		level.Warn(logger).Log("msg", "failed to write block upload error response", "err", err)
+	}
+}
+
+// unsupportedExternalLabelsError is returned when a block has external labels not supported by Mimir.
+type unsupportedExternalLabelsError struct {
+	labels []string
+}
+
+func (e unsupportedExternalLabelsError) Error() string {
+	return fmt.Sprintf("unsupported external labels: %s", strings.Join(e.labels, ", "))
+}
+
 type bodyReader struct {
-	r *http.Request
+	r    *http.Request
+	hash hash.Hash // Optional, computes the hash of the body as it's read.
 }
 
 // ObjectSize implements thanos.ObjectSizer.
@@ -606,7 +1650,11 @@ func (r bodyReader) ObjectSize() (int64, error) {
 
 // Read implements io.Reader.
 func (r bodyReader) Read(b []byte) (int, error) {
-	return r.r.Body.Read(b)
+	n, err := r.r.Body.Read(b)
+	if r.hash != nil {
+		_, _ = r.hash.Write(b[:n])
+	}
+	return n, err
 }
 
 type validationFile struct {
@@ -614,6 +1662,126 @@ type validationFile struct {
 	Error      string // Error message if validation failed.
 }
 
+// ListBlockUploads handles requests for listing the tenant's blocks whose upload is in progress, that is
+// the blocks with an in-flight meta file but no meta file. The blocks of the tenant are listed once, and
+// checked concurrently in batches, in ID order, until more than maximumListedBlockUploads uploads have been
+// found; the response includes at most maximumListedBlockUploads blocks, sorted by ID.
+func (c *MultitenantCompactor) ListBlockUploads(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := c.parseBlockUploadTenant(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	logger := util_log.WithContext(ctx, c.logger)
+	userBkt := bucket.NewUserBucketClient(tenantID, c.bucketClient, c.cfgProvider)
+
+	var blockIDs []ulid.ULID
+	err = userBkt.Iter(ctx, "", func(name string) error {
+		if blockID, ok := block.IsBlockDir(name); ok {
+			blockIDs = append(blockIDs, blockID)
+		}
+		return nil
+	})
+	if err != nil {
+		writeBlockUploadError(err, "list block uploads", "while listing blocks", logger, w)
+		return
+	}
+	sort.Slice(blockIDs, func(i, j int) bool {
+		return blockIDs[i].Compare(blockIDs[j]) < 0
+	})
+
+	res := blockUploadsListResult{Uploads: []blockUploadInfo{}}
+	for start := 0; start < len(blockIDs) && !res.Truncated; start += blockUploadsListConcurrency {
+		batch := blockIDs[start:]
+		if len(batch) > blockUploadsListConcurrency {
+			batch = batch[:blockUploadsListConcurrency]
+		}
+
+		uploads := make([]*blockUploadInfo, len(batch))
+		err = concurrency.ForEachJob(ctx, len(batch), blockUploadsListConcurrency, func(ctx context.Context, idx int) error {
+			info, err := getBlockUploadInfo(ctx, userBkt, batch[idx])
+			if err != nil {
+				return errors.Wrapf(err, "block %s", batch[idx])
+			}
+			uploads[idx] = info
+			return nil
+		})
+		if err != nil {
+			writeBlockUploadError(err, "list block uploads", "while checking blocks", logger, w)
+			return
+		}
+
+		for _, info := range uploads {
+			if info == nil {
+				continue
+			}
+			if len(res.Uploads) == maximumListedBlockUploads {
+				res.Truncated = true
+				break
+			}
+			res.Uploads = append(res.Uploads, *info)
+		}
+	}
+
+	util.WriteJSONResponse(w, res)
+}
+
+// getBlockUploadInfo returns the information about the upload of the block, or nil if the block
+// upload isn't in progress. The files of the block are only listed if its upload is in progress.
+func getBlockUploadInfo(ctx context.Context, userBkt objstore.Bucket, blockID ulid.ULID) (*blockUploadInfo, error) {
+	complete, err := userBkt.Exists(ctx, path.Join(blockID.String(), block.MetaFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "while checking the meta file existence")
+	}
+	if complete {
+		return nil, nil
+	}
+
+	attrs, err := userBkt.Attributes(ctx, path.Join(blockID.String(), uploadingMetaFilename))
+	if err != nil {
+		if userBkt.IsObjNotFoundErr(err) {
+			// The upload hasn't been started, or has been completed or aborted in the meantime.
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "while reading the in-flight meta file attributes")
+	}
+
+	files := 0
+	err = userBkt.Iter(ctx, blockID.String(), func(name string) error {
+		switch strings.SplitN(strings.TrimPrefix(name, blockID.String()+"/"), "/", 2)[0] {
+		case block.MetaFilename, uploadingMetaFilename, validationFilename, uploadingPartsDirname, uploadingHashesDirname:
+		default:
+			files++
+		}
+		return nil
+	}, objstore.WithRecursiveIter)
+	if err != nil {
+		return nil, errors.Wrap(err, "while listing the block files")
+	}
+
+	return &blockUploadInfo{
+		Block:         blockID.String(),
+		StartedAt:     attrs.LastModified,
+		FilesUploaded: files,
+	}, nil
+}
+
+type blockUploadsListResult struct {
+	Uploads   []blockUploadInfo `json:"uploads"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+// blockUploadInfo describes a block whose upload is in progress.
+type blockUploadInfo struct {
+	Block     string    `json:"block"`
+	StartedAt time.Time `json:"started_at"`
+	// FilesUploaded is the number of block files uploaded, not counting the files uploaded in parts
+	// which haven't been assembled yet.
+	FilesUploaded int `json:"files_uploaded"`
+}
+
 type blockUploadStateResult struct {
 	State string `json:"result"`
 	Error string `json:"error,omitempty"`
@@ -731,7 +1899,7 @@ func (c *MultitenantCompactor) getBlockUploadState(ctx context.Context, userBkt
 	if v.Error != "" {
 		return blockValidationFailed, meta, v, err
 	}
-	if time.Since(time.UnixMilli(v.LastUpdate)) < validationHeartbeatTimeout {
+	if c.now().Sub(time.UnixMilli(v.LastUpdate)) < validationHeartbeatTimeout {
 		return blockValidationInProgress, meta, v, nil
 	}
 	return blockValidationStale, meta, v, nil
@@ -778,7 +1946,7 @@ func (c *MultitenantCompactor) loadValidation(ctx context.Context, userBkt objst
 func (c *MultitenantCompactor) uploadValidationWithError(ctx context.Context, blockID ulid.ULID,
 	userBkt objstore.Bucket, errorStr string) error {
 	val := validationFile{
-		LastUpdate: time.Now().UnixMilli(),
+		LastUpdate: c.now().UnixMilli(),
 		Error:      errorStr,
 	}
 	dst := path.Join(blockID.String(), validationFilename)
@@ -5,6 +5,8 @@ package compactor
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,9 +24,14 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/dskit/test"
 	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/stretchr/testify/assert"
@@ -36,6 +43,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/bucket"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
 	"github.com/grafana/mimir/pkg/storegateway/testhelper"
 )
@@ -100,6 +108,25 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 		bkt.MockUpload(uploadingMetaPath, nil)
 	}
 
+	// setUpBucketIndex mocks a bucket index with the given number of blocks not compacted yet, besides a
+	// compacted block and a block not compacted yet but marked for deletion, which aren't counted.
+	setUpBucketIndex := func(bkt *bucket.ClientMock, uncompactedBlocks int) {
+		idx := &bucketindex.Index{Version: bucketindex.IndexVersion3}
+		for i := 0; i < uncompactedBlocks+2; i++ {
+			idx.Blocks = append(idx.Blocks, &bucketindex.Block{ID: ulid.MustNew(uint64(i), nil), CompactionLevel: 1})
+		}
+		idx.Blocks[0].CompactionLevel = 2
+		idx.BlockDeletionMarks = bucketindex.BlockDeletionMarks{{ID: idx.Blocks[1].ID}}
+
+		inMemBkt := objstore.NewInMemBucket()
+		require.NoError(t, bucketindex.WriteIndex(context.Background(), inMemBkt, tenantID, nil, idx))
+		content, err := inMemBkt.Get(context.Background(), path.Join(tenantID, bucketindex.IndexCompressedFilename))
+		require.NoError(t, err)
+		b, err := io.ReadAll(content)
+		require.NoError(t, err)
+		setUpGet(bkt, path.Join(tenantID, bucketindex.IndexCompressedFilename), b, nil)
+	}
+
 	verifyUpload := func(t *testing.T, bkt *bucket.ClientMock, labels map[string]string) {
 		t.Helper()
 
@@ -118,15 +145,22 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 		body                    string
 		meta                    *metadata.Meta
 		retention               time.Duration
+		query                   string
 		disableBlockUpload      bool
 		expBadRequest           string
+		expBadRequestJSON       string
 		expConflict             string
 		expUnprocessableEntity  string
 		expEntityTooLarge       string
+		expServiceUnavailable   string
 		expInternalServerError  bool
 		setUpBucketMock         func(bkt *bucket.ClientMock)
 		verifyUpload            func(*testing.T, *bucket.ClientMock)
 		maxBlockUploadSizeBytes int64
+		blockUploadValidators   []string
+		maxUncompactedBlocks    int
+		maxFiles                int
+		allowedLabels           []string
 	}{
 		{
 			name:          "missing tenant ID",
@@ -227,6 +261,27 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 			},
 			expBadRequest: "file with invalid size: chunks/000001",
 		},
+		{
+			name:            "unsupported file hash function",
+			tenantID:        tenantID,
+			blockID:         blockID,
+			setUpBucketMock: setUpPartialBlock,
+			meta: &metadata.Meta{
+				Thanos: metadata.Thanos{
+					Files: []metadata.File{
+						{
+							RelPath: block.MetaFilename,
+						},
+						{
+							RelPath:   "index",
+							SizeBytes: 1,
+							Hash:      &metadata.ObjectHash{Func: "MD5", Value: "d41d8cd98f00b204e9800998ecf8427e"},
+						},
+					},
+				},
+			},
+			expBadRequest: `file with unsupported hash function "MD5": index`,
+		},
 		{
 			name:            "invalid minTime",
 			tenantID:        tenantID,
@@ -288,6 +343,47 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 			},
 			expUnprocessableEntity: "block max time (1970-01-01 00:00:01 +0000 UTC) older than retention period",
 		},
+		{
+			name:          "invalid allow-outside-retention parameter",
+			tenantID:      tenantID,
+			blockID:       blockID,
+			query:         "?allow-outside-retention=maybe",
+			expBadRequest: "invalid allow-outside-retention parameter",
+		},
+		{
+			name:            "block before retention period, allowed by the request",
+			tenantID:        tenantID,
+			blockID:         blockID,
+			retention:       10 * time.Second,
+			query:           "?allow-outside-retention=true",
+			setUpBucketMock: setUpUpload,
+			meta: &metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    bULID,
+					Version: metadata.TSDBVersion1,
+					MinTime: 0,
+					MaxTime: 1000,
+				},
+				Thanos: metadata.Thanos{
+					Labels: map[string]string{
+						mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+					},
+					Files: []metadata.File{
+						{
+							RelPath: block.MetaFilename,
+						},
+						{
+							RelPath:   "index",
+							SizeBytes: 1,
+						},
+						{
+							RelPath:   "chunks/000001",
+							SizeBytes: 1024,
+						},
+					},
+				},
+			},
+		},
 		{
 			name:            "invalid version",
 			tenantID:        tenantID,
@@ -385,6 +481,94 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 			},
 			expBadRequest: fmt.Sprintf(`invalid %s external label: "test"`, mimir_tsdb.CompactorShardIDExternalLabel),
 		},
+		{
+			name:            "unsupported external labels",
+			tenantID:        tenantID,
+			blockID:         blockID,
+			setUpBucketMock: setUpPartialBlock,
+			meta: &metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    bULID,
+					Version: metadata.TSDBVersion1,
+				},
+				Thanos: metadata.Thanos{
+					Labels: map[string]string{
+						"foo":                                    "1",
+						"bar":                                    "2",
+						mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+					},
+				},
+			},
+			expBadRequestJSON: `{"error":"unsupported_external_labels","labels":["bar","foo"]}`,
+		},
+		{
+			name:            "reserved external labels",
+			tenantID:        tenantID,
+			blockID:         blockID,
+			setUpBucketMock: setUpPartialBlock,
+			// Reserved labels are rejected even if allowed by the tenant's configuration.
+			allowedLabels: []string{"__block_id"},
+			meta: &metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    bULID,
+					Version: metadata.TSDBVersion1,
+				},
+				Thanos: metadata.Thanos{
+					Labels: map[string]string{
+						"__block_id":                             "1",
+						"__foo":                                  "2",
+						"bar":                                    "3",
+						mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+					},
+				},
+			},
+			expBadRequest: `block has external labels with the reserved prefix "__": __block_id, __foo`,
+		},
+		{
+			name:            "external labels not allowed by the tenant's configuration",
+			tenantID:        tenantID,
+			blockID:         blockID,
+			setUpBucketMock: setUpPartialBlock,
+			allowedLabels:   []string{"region"},
+			meta: &metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    bULID,
+					Version: metadata.TSDBVersion1,
+				},
+				Thanos: metadata.Thanos{
+					Labels: map[string]string{
+						"region":                                 "eu",
+						"foo":                                    "1",
+						mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+					},
+				},
+			},
+			expBadRequestJSON: `{"error":"unsupported_external_labels","labels":["foo"]}`,
+		},
+		{
+			name:            "external labels allowed by the tenant's configuration",
+			tenantID:        tenantID,
+			blockID:         blockID,
+			setUpBucketMock: setUpUpload,
+			// The tenant ID label is removed even if allowed, since it must match the tenant uploading the block.
+			allowedLabels: []string{"region", "empty", mimir_tsdb.DeprecatedTenantIDExternalLabel},
+			meta: func() *metadata.Meta {
+				meta := validMeta
+				meta.Thanos.Labels = map[string]string{
+					"region": "eu",
+					"empty":  "",
+					mimir_tsdb.DeprecatedTenantIDExternalLabel: "another-tenant",
+					mimir_tsdb.CompactorShardIDExternalLabel:   "1_of_3",
+				}
+				return &meta
+			}(),
+			verifyUpload: func(t *testing.T, bkt *bucket.ClientMock) {
+				verifyUpload(t, bkt, map[string]string{
+					"region":                                 "eu",
+					mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+				})
+			},
+		},
 		{
 			name:     "failure checking for complete block",
 			tenantID: tenantID,
@@ -438,6 +622,15 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 			maxBlockUploadSizeBytes: 1,
 			expBadRequest:           fmt.Sprintf(maxBlockUploadSizeBytesFormat, 1),
 		},
+		{
+			name:            "max number of files exceeded",
+			tenantID:        tenantID,
+			blockID:         blockID,
+			setUpBucketMock: setUpPartialBlock,
+			meta:            &validMeta,
+			maxFiles:        2,
+			expBadRequest:   "block has too many files (3), limit is 2",
+		},
 		{
 			name:            "valid request",
 			tenantID:        tenantID,
@@ -517,6 +710,109 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 				verifyUpload(t, bkt, nil)
 			},
 		},
+		{
+			name:                  "block rejected by tenant validator",
+			tenantID:              tenantID,
+			blockID:               blockID,
+			setUpBucketMock:       setUpPartialBlock,
+			blockUploadValidators: []string{"require-shard"},
+			meta: &metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    bULID,
+					Version: metadata.TSDBVersion1,
+					MinTime: now - 1000,
+					MaxTime: now,
+				},
+				Thanos: metadata.Thanos{
+					Files: []metadata.File{
+						{
+							RelPath:   "index",
+							SizeBytes: 1,
+						},
+					},
+				},
+			},
+			expBadRequest: fmt.Sprintf("block must have the %s external label", mimir_tsdb.CompactorShardIDExternalLabel),
+		},
+		{
+			name:                  "block accepted by tenant validator",
+			tenantID:              tenantID,
+			blockID:               blockID,
+			setUpBucketMock:       setUpUpload,
+			blockUploadValidators: []string{"require-shard"},
+			meta:                  &validMeta,
+			verifyUpload: func(t *testing.T, bkt *bucket.ClientMock) {
+				verifyUpload(t, bkt, map[string]string{
+					mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+				})
+			},
+		},
+		{
+			name:                   "unknown tenant validator",
+			tenantID:               tenantID,
+			blockID:                blockID,
+			setUpBucketMock:        setUpPartialBlock,
+			blockUploadValidators:  []string{"unknown"},
+			meta:                   &validMeta,
+			expInternalServerError: true,
+		},
+		{
+			// The bucket index is read by every compactor, even by the ones not compacting the tenant.
+			name:     "too many blocks not compacted yet",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucketMock: func(bkt *bucket.ClientMock) {
+				setUpPartialBlock(bkt)
+				setUpBucketIndex(bkt, 11)
+			},
+			meta:                  &validMeta,
+			maxUncompactedBlocks:  10,
+			expServiceUnavailable: "too many blocks not compacted yet (11), limit is 10: retry later",
+		},
+		{
+			name:     "blocks not compacted yet within limit",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucketMock: func(bkt *bucket.ClientMock) {
+				setUpUpload(bkt)
+				setUpBucketIndex(bkt, 10)
+			},
+			meta:                 &validMeta,
+			maxUncompactedBlocks: 10,
+			verifyUpload: func(t *testing.T, bkt *bucket.ClientMock) {
+				verifyUpload(t, bkt, map[string]string{
+					mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+				})
+			},
+		},
+		{
+			name:     "blocks not compacted yet unknown",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucketMock: func(bkt *bucket.ClientMock) {
+				setUpUpload(bkt)
+				setUpGet(bkt, path.Join(tenantID, bucketindex.IndexCompressedFilename), nil, bucket.ErrObjectDoesNotExist)
+			},
+			meta:                 &validMeta,
+			maxUncompactedBlocks: 1,
+			verifyUpload: func(t *testing.T, bkt *bucket.ClientMock) {
+				verifyUpload(t, bkt, map[string]string{
+					mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+				})
+			},
+		},
+		{
+			name:     "failure reading the bucket index",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucketMock: func(bkt *bucket.ClientMock) {
+				setUpPartialBlock(bkt)
+				setUpGet(bkt, path.Join(tenantID, bucketindex.IndexCompressedFilename), nil, fmt.Errorf("test"))
+			},
+			meta:                   &validMeta,
+			maxUncompactedBlocks:   1,
+			expInternalServerError: true,
+		},
 		{
 			name:            "valid request with different block ID in meta file",
 			tenantID:        tenantID,
@@ -561,11 +857,18 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 			cfgProvider.userRetentionPeriods[tenantID] = tc.retention
 			cfgProvider.blockUploadEnabled[tenantID] = !tc.disableBlockUpload
 			cfgProvider.blockUploadMaxBlockSizeBytes[tenantID] = tc.maxBlockUploadSizeBytes
+			cfgProvider.blockUploadValidators[tenantID] = tc.blockUploadValidators
+			cfgProvider.blockUploadMaxUncompacted[tenantID] = tc.maxUncompactedBlocks
+			cfgProvider.blockUploadMaxFiles[tenantID] = tc.maxFiles
+			cfgProvider.blockUploadAllowedLabels[tenantID] = tc.allowedLabels
 			c := &MultitenantCompactor{
 				logger:       log.NewNopLogger(),
 				bucketClient: &bkt,
 				cfgProvider:  cfgProvider,
 			}
+			c.compactorCfg.BlockUploadValidators = map[string]BlockUploadValidator{
+				"require-shard": requireShardValidator{},
+			}
 			var rdr io.Reader
 			if tc.body != "" {
 				rdr = strings.NewReader(tc.body)
@@ -574,7 +877,7 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 				require.NoError(t, json.NewEncoder(buf).Encode(tc.meta))
 				rdr = buf
 			}
-			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/start", tc.blockID), rdr)
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/start%s", tc.blockID, tc.query), rdr)
 			if tc.tenantID != "" {
 				r = r.WithContext(user.InjectOrgID(r.Context(), tc.tenantID))
 			}
@@ -595,6 +898,10 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 			case tc.expBadRequest != "":
 				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 				assert.Equal(t, fmt.Sprintf("%s\n", tc.expBadRequest), string(body))
+			case tc.expBadRequestJSON != "":
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+				assert.JSONEq(t, tc.expBadRequestJSON, string(body))
 			case tc.expConflict != "":
 				assert.Equal(t, http.StatusConflict, resp.StatusCode)
 				assert.Equal(t, fmt.Sprintf("%s\n", tc.expConflict), string(body))
@@ -604,6 +911,9 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 			case tc.expEntityTooLarge != "":
 				assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
 				assert.Equal(t, fmt.Sprintf("%s\n", tc.expEntityTooLarge), string(body))
+			case tc.expServiceUnavailable != "":
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				assert.Equal(t, fmt.Sprintf("%s\n", tc.expServiceUnavailable), string(body))
 			default:
 				assert.Equal(t, http.StatusOK, resp.StatusCode)
 				assert.Empty(t, string(body))
@@ -738,6 +1048,16 @@ func TestMultitenantCompactor_StartBlockUpload(t *testing.T) {
 }
 
 // Test MultitenantCompactor.UploadBlockFile
+// requireShardValidator is a BlockUploadValidator rejecting blocks which haven't been split by the compactor.
+type requireShardValidator struct{}
+
+func (requireShardValidator) ValidateBlockUpload(_ context.Context, _ string, meta *metadata.Meta) error {
+	if meta.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel] == "" {
+		return fmt.Errorf("block must have the %s external label", mimir_tsdb.CompactorShardIDExternalLabel)
+	}
+	return nil
+}
+
 func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 	const tenantID = "test"
 	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
@@ -774,7 +1094,10 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 		setUpGet(bkt, path.Join(tenantID, blockID, uploadingMetaFilename), b, err)
 		setUpGet(bkt, path.Join(tenantID, blockID, validationFilename), nil, bucket.ErrObjectDoesNotExist)
 
+		// The file isn't checked for a previous upload when its size is unknown.
+		bkt.On("Attributes", mock.Anything, path.Join(tenantID, blockID, "chunks/000001")).Return(objstore.ObjectAttributes{}, bucket.ErrObjectDoesNotExist).Maybe()
 		bkt.MockUpload(path.Join(tenantID, blockID, "chunks/000001"), nil)
+		bkt.MockUpload(path.Join(tenantID, blockID, uploadingHashesDirname, "chunks/000001"), nil)
 	}
 
 	verifyFuncForValidRequest := func(t *testing.T, bkt *bucket.ClientMock, expContent string) {
@@ -839,6 +1162,20 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 			path:          "../chunks/000001",
 			expBadRequest: `invalid path: "../chunks/000001"`,
 		},
+		{
+			name:          "directory traversal out of the block",
+			tenantID:      tenantID,
+			blockID:       blockID,
+			path:          "chunks/../../../etc",
+			expBadRequest: `invalid path: "chunks/../../../etc"`,
+		},
+		{
+			name:          "directory traversal to the block metadata file",
+			tenantID:      tenantID,
+			blockID:       blockID,
+			path:          "index/../meta.json",
+			expBadRequest: fmt.Sprintf("%s is not allowed", block.MetaFilename),
+		},
 		{
 			name:          "empty file",
 			tenantID:      tenantID,
@@ -929,6 +1266,7 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 				setUpGet(bkt, path.Join(tenantID, blockID, uploadingMetaFilename), b, err)
 				setUpGet(bkt, path.Join(tenantID, blockID, validationFilename), nil, bucket.ErrObjectDoesNotExist)
 
+				bkt.MockAttributes(path.Join(tenantID, blockID, "chunks/000001"), objstore.ObjectAttributes{}, bucket.ErrObjectDoesNotExist)
 				bkt.MockUpload(path.Join(tenantID, blockID, "chunks/000001"), fmt.Errorf("test"))
 			},
 			expInternalServerError: true,
@@ -1048,8 +1386,10 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 	}
 
 	type file struct {
-		path    string
-		content string
+		path          string
+		content       string
+		unknownSize   bool // Whether to send the file without its size, like with chunked encoding.
+		expIdempotent bool
 	}
 
 	// Additional test cases using an in-memory bucket for state testing
@@ -1060,15 +1400,16 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 		verifyBucket func(*testing.T, *objstore.InMemBucket, []file)
 	}{
 		{
-			name: "multiple sequential uploads of same file",
+			name: "same file uploaded again with its size",
 			files: []file{
 				{
 					path:    "chunks/000001",
 					content: strings.Repeat("a", len(chunkBodyContent)),
 				},
 				{
-					path:    "chunks/000001",
-					content: strings.Repeat("b", len(chunkBodyContent)),
+					path:          "chunks/000001",
+					content:       strings.Repeat("b", len(chunkBodyContent)),
+					expIdempotent: true,
 				},
 			},
 			setUpBucket: func(t *testing.T, bkt *objstore.InMemBucket) {
@@ -1077,16 +1418,30 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 			verifyBucket: func(t *testing.T, bkt *objstore.InMemBucket, files []file) {
 				t.Helper()
 
-				ctx := context.Background()
-				rdr, err := bkt.Get(ctx, path.Join(tenantID, blockID, files[1].path))
-				require.NoError(t, err)
-				t.Cleanup(func() {
-					_ = rdr.Close()
-				})
+				// The file has already been uploaded, so the body of the second request isn't read.
+				verifyBucketContent(t, bkt, path.Join(tenantID, blockID, files[0].path), files[0].content)
+			},
+		},
+		{
+			name: "same file uploaded again without its size",
+			files: []file{
+				{
+					path:    "chunks/000001",
+					content: strings.Repeat("a", len(chunkBodyContent)),
+				},
+				{
+					path:        "chunks/000001",
+					content:     strings.Repeat("b", len(chunkBodyContent)),
+					unknownSize: true,
+				},
+			},
+			setUpBucket: func(t *testing.T, bkt *objstore.InMemBucket) {
+				marshalAndUploadJSON(t, bkt, uploadingMetaPath, validMeta)
+			},
+			verifyBucket: func(t *testing.T, bkt *objstore.InMemBucket, files []file) {
+				t.Helper()
 
-				content, err := io.ReadAll(rdr)
-				require.NoError(t, err)
-				assert.Equal(t, files[1].content, string(content))
+				verifyBucketContent(t, bkt, path.Join(tenantID, blockID, files[1].path), files[1].content)
 			},
 		},
 	}
@@ -1110,6 +1465,9 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 				}
 				r = mux.SetURLVars(r, urlVars)
 				r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+				if f.unknownSize {
+					r.ContentLength = -1
+				}
 				w := httptest.NewRecorder()
 				c.UploadBlockFile(w, r)
 
@@ -1118,6 +1476,11 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 				require.NoError(t, err)
 				require.Equal(t, http.StatusOK, resp.StatusCode)
 				require.Empty(t, body)
+				if f.expIdempotent {
+					assert.Equal(t, "true", resp.Header.Get(idempotentUploadHeader))
+				} else {
+					assert.Empty(t, resp.Header.Get(idempotentUploadHeader))
+				}
 			}
 
 			tc.verifyBucket(t, bkt, tc.files)
@@ -1125,12 +1488,33 @@ func TestMultitenantCompactor_UploadBlockFile(t *testing.T) {
 	}
 }
 
+func verifyBucketContent(t *testing.T, bkt objstore.Bucket, pth, expContent string) {
+	t.Helper()
+
+	rdr, err := bkt.Get(context.Background(), pth)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = rdr.Close()
+	})
+
+	content, err := io.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, expContent, string(content))
+}
+
 func setUpGet(bkt *bucket.ClientMock, pth string, content []byte, err error) {
 	bkt.On("Get", mock.Anything, pth).Return(func(_ context.Context, _ string) (io.ReadCloser, error) {
 		return io.NopCloser(bytes.NewReader(content)), err
 	})
 }
 
+// uploadBlockFile uploads a whole block file to the bucket, and records its hash like UploadBlockFile does.
+func uploadBlockFile(t *testing.T, bkt objstore.Bucket, tenantID, blockID, relPath string, content []byte) {
+	hash := sha256.Sum256(content)
+	require.NoError(t, bkt.Upload(context.Background(), path.Join(tenantID, blockID, relPath), bytes.NewReader(content)))
+	require.NoError(t, bkt.Upload(context.Background(), path.Join(tenantID, blockFileHashPath(ulid.MustParse(blockID), relPath)), strings.NewReader(hex.EncodeToString(hash[:]))))
+}
+
 // Test MultitenantCompactor.FinishBlockUpload
 func TestMultitenantCompactor_FinishBlockUpload(t *testing.T) {
 	const tenantID = "test"
@@ -1164,9 +1548,7 @@ func TestMultitenantCompactor_FinishBlockUpload(t *testing.T) {
 		err := marshalAndUploadToBucket(context.Background(), bkt, uploadingMetaPath, validMeta)
 		require.NoError(t, err)
 		for _, file := range validMeta.Thanos.Files {
-			content := bytes.NewReader(make([]byte, file.SizeBytes))
-			err = bkt.Upload(context.Background(), path.Join(tenantID, blockID, file.RelPath), content)
-			require.NoError(t, err)
+			uploadBlockFile(t, bkt, tenantID, blockID, file.RelPath, make([]byte, file.SizeBytes))
 		}
 	}
 
@@ -1180,9 +1562,12 @@ func TestMultitenantCompactor_FinishBlockUpload(t *testing.T) {
 		enableValidation       bool // should only be set to true for tests that fail before validation is started
 		maxConcurrency         int
 		setConcurrency         int64
+		retention              time.Duration
+		query                  string
 		expBadRequest          string
 		expConflict            string
 		expNotFound            string
+		expUnprocessableEntity string
 		expTooManyRequests     bool
 		expInternalServerError bool
 	}{
@@ -1254,12 +1639,67 @@ func TestMultitenantCompactor_FinishBlockUpload(t *testing.T) {
 			expInternalServerError: true,
 		},
 		{
-			name:                   "uploading meta file fails",
-			tenantID:               tenantID,
-			blockID:                blockID,
-			setUpBucket:            validSetup,
-			errorInjector:          bucket.InjectErrorOn(bucket.OpUpload, metaPath, injectedError),
-			expInternalServerError: true,
+			name:     "block files not uploaded",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucket: func(t *testing.T, bkt objstore.Bucket) {
+				err := marshalAndUploadToBucket(context.Background(), bkt, uploadingMetaPath, validMeta)
+				require.NoError(t, err)
+			},
+			expBadRequest: "block files not uploaded yet: index, chunks/000001",
+		},
+		{
+			name:     "some block files not uploaded",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucket: func(t *testing.T, bkt objstore.Bucket) {
+				err := marshalAndUploadToBucket(context.Background(), bkt, uploadingMetaPath, validMeta)
+				require.NoError(t, err)
+				uploadBlockFile(t, bkt, tenantID, blockID, "index", []byte{0})
+			},
+			expBadRequest: "block files not uploaded yet: chunks/000001",
+		},
+		{
+			name:     "index not listed in meta file and not uploaded",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucket: func(t *testing.T, bkt objstore.Bucket) {
+				meta := validMeta
+				meta.Thanos.Files = validMeta.Thanos.Files[1:]
+				err := marshalAndUploadToBucket(context.Background(), bkt, uploadingMetaPath, meta)
+				require.NoError(t, err)
+				uploadBlockFile(t, bkt, tenantID, blockID, "chunks/000001", []byte{0, 0})
+			},
+			expBadRequest: "block files not uploaded yet: index",
+		},
+		{
+			name:     "block file hash not recorded",
+			tenantID: tenantID,
+			blockID:  blockID,
+			setUpBucket: func(t *testing.T, bkt objstore.Bucket) {
+				err := marshalAndUploadToBucket(context.Background(), bkt, uploadingMetaPath, validMeta)
+				require.NoError(t, err)
+				uploadBlockFile(t, bkt, tenantID, blockID, "index", []byte{0})
+				err = bkt.Upload(context.Background(), path.Join(tenantID, blockID, "chunks/000001"), bytes.NewReader([]byte{0, 0}))
+				require.NoError(t, err)
+			},
+			expBadRequest: "the hash of block file chunks/000001 hasn't been recorded: upload the file again",
+		},
+		{
+			name:                   "checking for block files fails",
+			tenantID:               tenantID,
+			blockID:                blockID,
+			setUpBucket:            validSetup,
+			errorInjector:          bucket.InjectErrorOn(bucket.OpExists, path.Join(tenantID, blockID, "index"), injectedError),
+			expInternalServerError: true,
+		},
+		{
+			name:                   "uploading meta file fails",
+			tenantID:               tenantID,
+			blockID:                blockID,
+			setUpBucket:            validSetup,
+			errorInjector:          bucket.InjectErrorOn(bucket.OpUpload, metaPath, injectedError),
+			expInternalServerError: true,
 		},
 		{
 			name:               "too many concurrent validations",
@@ -1271,70 +1711,1046 @@ func TestMultitenantCompactor_FinishBlockUpload(t *testing.T) {
 			setConcurrency:     2,
 			expTooManyRequests: true,
 		},
+		{
+			name:          "invalid allow-outside-retention parameter",
+			tenantID:      tenantID,
+			blockID:       blockID,
+			setUpBucket:   validSetup,
+			query:         "?allow-outside-retention=maybe",
+			expBadRequest: "invalid allow-outside-retention parameter",
+		},
+		{
+			name:        "block within retention period",
+			tenantID:    tenantID,
+			blockID:     blockID,
+			setUpBucket: validSetup,
+			retention:   time.Since(time.UnixMilli(0)) + time.Hour,
+		},
+		{
+			name:                   "block before retention period",
+			tenantID:               tenantID,
+			blockID:                blockID,
+			setUpBucket:            validSetup,
+			retention:              time.Hour,
+			expUnprocessableEntity: "block max time (1970-01-01 00:00:00 +0000 UTC) older than retention period",
+		},
+		{
+			name:        "block before retention period, allowed by the request",
+			tenantID:    tenantID,
+			blockID:     blockID,
+			setUpBucket: validSetup,
+			retention:   time.Hour,
+			query:       "?allow-outside-retention=true",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			injectedBkt := bucket.ErrorInjectedBucketClient{
+				Bucket:   bkt,
+				Injector: tc.errorInjector,
+			}
+			if tc.setUpBucket != nil {
+				tc.setUpBucket(t, bkt)
+			}
+
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadEnabled[tc.tenantID] = !tc.disableBlockUpload
+			cfgProvider.blockUploadValidationEnabled[tc.tenantID] = tc.enableValidation
+			cfgProvider.userRetentionPeriods[tc.tenantID] = tc.retention
+			c := &MultitenantCompactor{
+				logger:       log.NewNopLogger(),
+				bucketClient: &injectedBkt,
+				cfgProvider:  cfgProvider,
+			}
+			c.compactorCfg.MaxBlockUploadValidationConcurrency = tc.maxConcurrency
+			if tc.setConcurrency > 0 {
+				c.blockUploadValidations.Add(tc.setConcurrency)
+			}
+
+			c.compactorCfg.DataDir = t.TempDir()
+
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/finish%s", tc.blockID, tc.query), nil)
+			if tc.tenantID != "" {
+				r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			}
+			if tc.blockID != "" {
+				r = mux.SetURLVars(r, map[string]string{"block": tc.blockID})
+			}
+			w := httptest.NewRecorder()
+			c.FinishBlockUpload(w, r)
+
+			resp := w.Result()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			switch {
+			case tc.expBadRequest != "":
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				assert.Equal(t, fmt.Sprintf("%s\n", tc.expBadRequest), string(body))
+			case tc.expConflict != "":
+				assert.Equal(t, http.StatusConflict, resp.StatusCode)
+				assert.Equal(t, fmt.Sprintf("%s\n", tc.expConflict), string(body))
+			case tc.expNotFound != "":
+				assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+				assert.Equal(t, fmt.Sprintf("%s\n", tc.expNotFound), string(body))
+			case tc.expUnprocessableEntity != "":
+				assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+				assert.Equal(t, fmt.Sprintf("%s\n", tc.expUnprocessableEntity), string(body))
+			case tc.expInternalServerError:
+				assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+				assert.Equal(t, "internal server error\n", string(body))
+			case tc.expTooManyRequests:
+				assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+				assert.Equal(t, "too many block upload validations in progress, limit is 2\n", string(body))
+			default:
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Empty(t, string(body))
+				exists, err := bkt.Exists(context.Background(), metaPath)
+				require.NoError(t, err)
+				require.True(t, exists)
+			}
+		})
+	}
+}
+
+func TestMultitenantCompactor_CheckBlockRetention(t *testing.T) {
+	const tenantID = "test"
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	meta := &metadata.Meta{BlockMeta: tsdb.BlockMeta{
+		MinTime: now.Add(-26 * time.Hour).UnixMilli(),
+		MaxTime: now.Add(-24 * time.Hour).UnixMilli(),
+	}}
+
+	for name, tc := range map[string]struct {
+		retention time.Duration
+		expErr    string
+	}{
+		"retention disabled": {
+			retention: 0,
+		},
+		"block within retention period": {
+			retention: 25 * time.Hour,
+		},
+		"block ending at the retention threshold": {
+			retention: 24 * time.Hour,
+		},
+		"block before retention period": {
+			retention: 23 * time.Hour,
+			expErr:    "block max time (2023-05-31 12:00:00 +0000 UTC) older than retention period",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.userRetentionPeriods[tenantID] = tc.retention
+			c := &MultitenantCompactor{cfgProvider: cfgProvider, nowFunc: func() time.Time { return now }}
+
+			err := c.checkBlockRetention(tenantID, meta)
+			if tc.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var httpErr httpError
+			require.ErrorAs(t, err, &httpErr)
+			assert.Equal(t, http.StatusUnprocessableEntity, httpErr.statusCode)
+			assert.Equal(t, tc.expErr, httpErr.message)
+		})
+	}
+}
+
+func TestMultitenantCompactor_CheckBlockUploadMinAge(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, bkt.Upload(context.Background(), path.Join(blockID, uploadingMetaFilename), strings.NewReader("{}")))
+	attrs, err := bkt.Attributes(context.Background(), path.Join(blockID, uploadingMetaFilename))
+	require.NoError(t, err)
+	started := attrs.LastModified
+
+	for name, tc := range map[string]struct {
+		minAge        time.Duration
+		now           time.Time
+		expErr        string
+		expRetryAfter time.Duration
+	}{
+		"min age disabled": {
+			now: started,
+		},
+		"completed too early": {
+			minAge:        5 * time.Minute,
+			now:           started.Add(time.Minute),
+			expErr:        "block upload started less than 5m0s ago: retry in 4m0s",
+			expRetryAfter: 4 * time.Minute,
+		},
+		"completed after the min age": {
+			minAge: 5 * time.Minute,
+			now:    started.Add(5 * time.Minute),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadMinAge[tenantID] = tc.minAge
+			c := &MultitenantCompactor{cfgProvider: cfgProvider, nowFunc: func() time.Time { return tc.now }}
+
+			err := c.checkBlockUploadMinAge(context.Background(), bkt, tenantID, ulid.MustParse(blockID))
+			if tc.expErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			var httpErr httpError
+			require.ErrorAs(t, err, &httpErr)
+			assert.Equal(t, http.StatusServiceUnavailable, httpErr.statusCode)
+			assert.Equal(t, tc.expErr, httpErr.message)
+			assert.Equal(t, tc.expRetryAfter, httpErr.retryAfter)
+		})
+	}
+
+	t.Run("finishing the upload too early is rejected with Retry-After", func(t *testing.T) {
+		bkt := objstore.NewInMemBucket()
+		meta := metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{Version: metadata.TSDBVersion1, ULID: ulid.MustParse(blockID)},
+			Thanos:    metadata.Thanos{Files: []metadata.File{{RelPath: "index", SizeBytes: 1}}},
+		}
+		require.NoError(t, marshalAndUploadToBucket(context.Background(), bkt, path.Join(tenantID, blockID, uploadingMetaFilename), meta))
+		uploadBlockFile(t, bkt, tenantID, blockID, "index", []byte{0})
+
+		cfgProvider := newMockConfigProvider()
+		cfgProvider.blockUploadEnabled[tenantID] = true
+		cfgProvider.blockUploadMinAge[tenantID] = time.Hour
+		c := &MultitenantCompactor{
+			logger:       log.NewNopLogger(),
+			bucketClient: bkt,
+			cfgProvider:  cfgProvider,
+		}
+
+		r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/finish", blockID), nil)
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		r = mux.SetURLVars(r, map[string]string{"block": blockID})
+		w := httptest.NewRecorder()
+		c.FinishBlockUpload(w, r)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), "block upload started less than 1h0m0s ago")
+		assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+
+		exists, err := bkt.Exists(context.Background(), path.Join(tenantID, blockID, block.MetaFilename))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestMultitenantCompactor_FinishBlockUploadValidateOnly(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	uploadingMetaPath := path.Join(tenantID, blockID, uploadingMetaFilename)
+	meta := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			Version: metadata.TSDBVersion1,
+			ULID:    ulid.MustParse(blockID),
+			MinTime: 1000,
+			MaxTime: 2000,
+		},
+		Thanos: metadata.Thanos{
+			Files: []metadata.File{
+				{RelPath: block.MetaFilename},
+				{RelPath: "index", SizeBytes: 1},
+				{RelPath: "chunks/000001", SizeBytes: 2},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		setUpBucket   func(*testing.T, objstore.Bucket)
+		maxFiles      int
+		expBadRequest string
+		expResult     blockUploadValidationResult
+	}{
+		"block files not uploaded": {
+			setUpBucket: func(t *testing.T, bkt objstore.Bucket) {
+				uploadBlockFile(t, bkt, tenantID, blockID, "index", []byte{0})
+			},
+			expBadRequest: "block files not uploaded yet: chunks/000001",
+		},
+		"max number of files lowered since the upload has been started": {
+			setUpBucket: func(t *testing.T, bkt objstore.Bucket) {
+				uploadBlockFile(t, bkt, tenantID, blockID, "index", []byte{0})
+				uploadBlockFile(t, bkt, tenantID, blockID, "chunks/000001", []byte{0, 0})
+			},
+			maxFiles:      2,
+			expBadRequest: "block has too many files (3), limit is 2",
+		},
+		"block files uploaded, including in parts": {
+			setUpBucket: func(t *testing.T, bkt objstore.Bucket) {
+				uploadBlockFile(t, bkt, tenantID, blockID, "index", []byte{0})
+				require.NoError(t, bkt.Upload(context.Background(), path.Join(tenantID, blockFilePartPath(ulid.MustParse(blockID), "chunks/000001", 0)), bytes.NewReader([]byte{0})))
+				require.NoError(t, bkt.Upload(context.Background(), path.Join(tenantID, blockFilePartPath(ulid.MustParse(blockID), "chunks/000001", 1)), bytes.NewReader([]byte{0})))
+			},
+			expResult: blockUploadValidationResult{Block: blockID, Files: 3, SizeBytes: 3, MinTime: 1000, MaxTime: 2000},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			require.NoError(t, marshalAndUploadToBucket(context.Background(), bkt, uploadingMetaPath, meta))
+			tc.setUpBucket(t, bkt)
+			objectsBefore := bkt.Objects()
+
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadEnabled[tenantID] = true
+			cfgProvider.blockUploadMaxFiles[tenantID] = tc.maxFiles
+			c := &MultitenantCompactor{
+				logger:       log.NewNopLogger(),
+				bucketClient: bkt,
+				cfgProvider:  cfgProvider,
+			}
+
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/finish?validate-only=true", blockID), nil)
+			r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			r = mux.SetURLVars(r, map[string]string{"block": blockID})
+			w := httptest.NewRecorder()
+			c.FinishBlockUpload(w, r)
+
+			if tc.expBadRequest != "" {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				assert.Equal(t, tc.expBadRequest+"\n", w.Body.String())
+			} else {
+				require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				var res blockUploadValidationResult
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+				assert.Equal(t, tc.expResult, res)
+			}
+
+			// The bucket hasn't been modified.
+			assert.Equal(t, objectsBefore, bkt.Objects())
+		})
+	}
+}
+
+func TestMultitenantCompactor_FinishBlockUploads(t *testing.T) {
+	const tenantID = "test"
+	const uploadingBlockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	const completeBlockID = "01G3FZ0JWJYJC0ZM6Y9778P6KE"
+	const notStartedBlockID = "01G3FZ0JWJYJC0ZM6Y9778P6KF"
+
+	newMeta := func(blockID string) metadata.Meta {
+		return metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				Version: metadata.TSDBVersion1,
+				ULID:    ulid.MustParse(blockID),
+			},
+			Thanos: metadata.Thanos{
+				Files: []metadata.File{{RelPath: "index", SizeBytes: 1}},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		tenantID           string
+		disableBlockUpload bool
+		body               string
+		expBadRequest      string
+		expResults         []finishBlockUploadResult
+	}{
+		{
+			name:          "without tenant ID",
+			body:          `{"blocks": ["` + uploadingBlockID + `"]}`,
+			expBadRequest: "invalid tenant ID",
+		},
+		{
+			name:               "block upload disabled",
+			tenantID:           tenantID,
+			disableBlockUpload: true,
+			body:               `{"blocks": ["` + uploadingBlockID + `"]}`,
+			expBadRequest:      "block upload is disabled",
+		},
+		{
+			name:          "malformed request body",
+			tenantID:      tenantID,
+			body:          `{"blocks": `,
+			expBadRequest: "malformed request body",
+		},
+		{
+			name:          "no blocks",
+			tenantID:      tenantID,
+			body:          `{"blocks": []}`,
+			expBadRequest: "no blocks to finish",
+		},
+		{
+			name:     "mix of valid and invalid blocks",
+			tenantID: tenantID,
+			body:     `{"blocks": ["` + uploadingBlockID + `", "` + completeBlockID + `", "` + notStartedBlockID + `", "1234"]}`,
+			expResults: []finishBlockUploadResult{
+				{Block: uploadingBlockID, Status: http.StatusOK},
+				{Block: completeBlockID, Status: http.StatusConflict, Error: "block already exists"},
+				{Block: notStartedBlockID, Status: http.StatusNotFound, Error: "block upload not started"},
+				{Block: "1234", Status: http.StatusBadRequest, Error: "invalid block ID"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			require.NoError(t, marshalAndUploadToBucket(context.Background(), bkt, path.Join(tenantID, uploadingBlockID, uploadingMetaFilename), newMeta(uploadingBlockID)))
+			uploadBlockFile(t, bkt, tenantID, uploadingBlockID, "index", []byte{0})
+			require.NoError(t, marshalAndUploadToBucket(context.Background(), bkt, path.Join(tenantID, completeBlockID, block.MetaFilename), newMeta(completeBlockID)))
+
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadEnabled[tc.tenantID] = !tc.disableBlockUpload
+			c := &MultitenantCompactor{
+				logger:       log.NewNopLogger(),
+				bucketClient: bkt,
+				cfgProvider:  cfgProvider,
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/upload/blocks/finish", strings.NewReader(tc.body))
+			if tc.tenantID != "" {
+				r = r.WithContext(user.InjectOrgID(r.Context(), tc.tenantID))
+			}
+			w := httptest.NewRecorder()
+			c.FinishBlockUploads(w, r)
+
+			resp := w.Result()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			if tc.expBadRequest != "" {
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+				assert.Equal(t, fmt.Sprintf("%s\n", tc.expBadRequest), string(body))
+				return
+			}
+
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			var res finishBlockUploadsResult
+			require.NoError(t, json.Unmarshal(body, &res))
+			assert.Equal(t, tc.expResults, res.Results)
+
+			// Only the block whose upload was in progress has been completed.
+			exists, err := bkt.Exists(context.Background(), path.Join(tenantID, uploadingBlockID, block.MetaFilename))
+			require.NoError(t, err)
+			assert.True(t, exists)
+
+			exists, err = bkt.Exists(context.Background(), path.Join(tenantID, notStartedBlockID, block.MetaFilename))
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestMultitenantCompactor_BlockUploadAuditLog(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	now := time.Now().UnixMilli()
+	meta := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustParse(blockID),
+			Version: metadata.TSDBVersion1,
+			MinTime: now - 1000,
+			MaxTime: now,
+		},
+		Thanos: metadata.Thanos{
+			Files: []metadata.File{
+				{RelPath: block.MetaFilename},
+				{RelPath: "index", SizeBytes: 10},
+				{RelPath: "chunks/000001", SizeBytes: 1024},
+			},
+		},
+	}
+
+	bkt := objstore.NewInMemBucket()
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockUploadEnabled[tenantID] = true
+
+	logs := &bytes.Buffer{}
+	c := &MultitenantCompactor{
+		logger:       log.NewLogfmtLogger(logs),
+		bucketClient: bkt,
+		cfgProvider:  cfgProvider,
+	}
+
+	newRequest := func(op string, body io.Reader) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/%s", blockID, op), body)
+		r.Header.Set("User-Agent", "mimirtool")
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		return mux.SetURLVars(r, map[string]string{"block": blockID})
+	}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, json.NewEncoder(buf).Encode(meta))
+	w := httptest.NewRecorder()
+	c.StartBlockUpload(w, newRequest("start", buf))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for _, f := range meta.Thanos.Files[1:] {
+		uploadBlockFile(t, bkt, tenantID, blockID, f.RelPath, make([]byte, f.SizeBytes))
+	}
+
+	w = httptest.NewRecorder()
+	c.FinishBlockUpload(w, newRequest("finish", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var auditLines []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		if strings.Contains(line, "audit=block-upload") {
+			auditLines = append(auditLines, line)
+		}
+	}
+	require.Len(t, auditLines, 2)
+
+	for i, event := range []string{"create", "complete"} {
+		line := auditLines[i]
+		assert.Contains(t, line, "level=info")
+		assert.Contains(t, line, "event="+event)
+		assert.Contains(t, line, "user="+tenantID)
+		assert.Contains(t, line, "block="+blockID)
+		assert.Contains(t, line, "files=3")
+		assert.Contains(t, line, "size_bytes=1034")
+		assert.Contains(t, line, `source="192.0.2.1:1234 (mimirtool)"`)
+		assert.Regexp(t, `timestamp=\S+`, line)
+	}
+}
+
+func TestMultitenantCompactor_BlockUploadDuration(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	now := time.Now().UnixMilli()
+	meta := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustParse(blockID),
+			Version: metadata.TSDBVersion1,
+			MinTime: now - 1000,
+			MaxTime: now,
+		},
+		Thanos: metadata.Thanos{
+			Files: []metadata.File{
+				{RelPath: block.MetaFilename},
+				{RelPath: "index", SizeBytes: 10},
+				{RelPath: "chunks/000001", SizeBytes: 1024},
+			},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		uploadChunksInParts bool
+	}{
+		"upload completed synchronously": {},
+		// The parts are assembled in the background, so the upload is completed after the response.
+		"upload completed in the background": {uploadChunksInParts: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadEnabled[tenantID] = true
+
+			c := &MultitenantCompactor{
+				logger:       log.NewNopLogger(),
+				bucketClient: bkt,
+				cfgProvider:  cfgProvider,
+				blockUploadDuration: promauto.With(nil).NewHistogram(prometheus.HistogramOpts{
+					Name: "cortex_compactor_block_upload_duration_seconds",
+				}),
+			}
+
+			newRequest := func(op string, body io.Reader) *http.Request {
+				r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/%s", blockID, op), body)
+				r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+				return mux.SetURLVars(r, map[string]string{"block": blockID})
+			}
+
+			buf := bytes.NewBuffer(nil)
+			require.NoError(t, json.NewEncoder(buf).Encode(meta))
+			w := httptest.NewRecorder()
+			c.StartBlockUpload(w, newRequest("start", buf))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			uploadBlockFile(t, bkt, tenantID, blockID, "index", make([]byte, 10))
+			if tc.uploadChunksInParts {
+				for _, start := range []int64{0, 512} {
+					require.NoError(t, bkt.Upload(context.Background(), path.Join(tenantID, blockFilePartPath(ulid.MustParse(blockID), "chunks/000001", start)), bytes.NewReader(make([]byte, 512))))
+				}
+			} else {
+				uploadBlockFile(t, bkt, tenantID, blockID, "chunks/000001", make([]byte, 1024))
+			}
+
+			// The upload of the block is timed from the creation of the in-flight meta file.
+			attrs, err := bkt.Attributes(context.Background(), path.Join(tenantID, blockID, uploadingMetaFilename))
+			require.NoError(t, err)
+			c.nowFunc = func() time.Time { return attrs.LastModified.Add(90 * time.Second) }
+
+			w = httptest.NewRecorder()
+			c.FinishBlockUpload(w, newRequest("finish", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			m := &dto.Metric{}
+			test.Poll(t, time.Second, uint64(1), func() interface{} {
+				require.NoError(t, c.blockUploadDuration.Write(m))
+				return m.GetHistogram().GetSampleCount()
+			})
+			assert.Equal(t, 90.0, m.GetHistogram().GetSampleSum())
+
+			exists, err := bkt.Exists(context.Background(), path.Join(tenantID, blockID, block.MetaFilename))
+			require.NoError(t, err)
+			assert.True(t, exists)
+		})
+	}
+}
+
+func TestMultitenantCompactor_ResumableBlockFileUpload(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	now := time.Now().UnixMilli()
+	meta := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustParse(blockID),
+			Version: metadata.TSDBVersion1,
+			MinTime: now - 1000,
+			MaxTime: now,
+		},
+		Thanos: metadata.Thanos{
+			Files: []metadata.File{
+				{RelPath: block.MetaFilename},
+				{RelPath: "index", SizeBytes: 10},
+				{RelPath: "chunks/000001", SizeBytes: 30},
+			},
+		},
+	}
+	chunks := "aaaaaaaaaabbbbbbbbbbcccccccccc"
+
+	bkt := objstore.NewInMemBucket()
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockUploadEnabled[tenantID] = true
+	c := &MultitenantCompactor{
+		logger:       log.NewNopLogger(),
+		bucketClient: bkt,
+		cfgProvider:  cfgProvider,
+	}
+
+	newRequest := func(op string, body io.Reader) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/%s", blockID, op), body)
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		return mux.SetURLVars(r, map[string]string{"block": blockID})
+	}
+	uploadFile := func(pth, contentRange, content string) *httptest.ResponseRecorder {
+		r := newRequest("files?path="+url.QueryEscape(pth), strings.NewReader(content))
+		if contentRange != "" {
+			r.Header.Set("Content-Range", contentRange)
+		}
+		w := httptest.NewRecorder()
+		c.UploadBlockFile(w, r)
+		return w
+	}
+	finish := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c.FinishBlockUpload(w, newRequest("finish", nil))
+		return w
+	}
+
+	buf := bytes.NewBuffer(nil)
+	require.NoError(t, json.NewEncoder(buf).Encode(meta))
+	w := httptest.NewRecorder()
+	c.StartBlockUpload(w, newRequest("start", buf))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	t.Run("invalid Content-Range", func(t *testing.T) {
+		for contentRange, expErr := range map[string]string{
+			"bytes=0-9/30":  `invalid Content-Range: "bytes=0-9/30"`,
+			"bytes 9-0/30":  `invalid Content-Range: "bytes 9-0/30"`,
+			"bytes 0-30/30": `invalid Content-Range: "bytes 0-30/30"`,
+			"bytes 0-9/31":  "file size doesn't match meta.json",
+		} {
+			w := uploadFile("chunks/000001", contentRange, chunks[:10])
+			assert.Equal(t, http.StatusBadRequest, w.Code, contentRange)
+			assert.Equal(t, expErr+"\n", w.Body.String(), contentRange)
+		}
+
+		w := uploadFile("chunks/000001", "bytes 0-19/30", chunks[:10])
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "part size doesn't match Content-Range\n", w.Body.String())
+	})
+
+	// The index is uploaded in a single request, while the chunks are uploaded in parts.
+	require.Equal(t, http.StatusOK, uploadFile("index", "", strings.Repeat("i", 10)).Code)
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 0-9/30", chunks[0:10]).Code)
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 10-19/30", "xxxxxxxxxx").Code)
+
+	// Finishing the upload fails while a part is missing.
+	w = finish()
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "block file chunks/000001 not uploaded completely: bytes 20-29 are missing\n", w.Body.String())
+
+	// Resume the upload, sending again a part which was corrupted and the missing one.
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 10-19/30", chunks[10:20]).Code)
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 20-29/30", chunks[20:30]).Code)
+
+	w = finish()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The parts are assembled in the background.
+	test.Poll(t, time.Second, true, func() interface{} {
+		exists, err := bkt.Exists(context.Background(), path.Join(tenantID, blockID, block.MetaFilename))
+		require.NoError(t, err)
+		return exists
+	})
+
+	rdr, err := bkt.Get(context.Background(), path.Join(tenantID, blockID, "chunks/000001"))
+	require.NoError(t, err)
+	content, err := io.ReadAll(rdr)
+	require.NoError(t, err)
+	assert.Equal(t, chunks, string(content))
+
+	// The parts have been deleted.
+	var parts []string
+	require.NoError(t, bkt.Iter(context.Background(), path.Join(tenantID, blockID, uploadingPartsDirname), func(name string) error {
+		parts = append(parts, name)
+		return nil
+	}, objstore.WithRecursiveIter))
+	assert.Empty(t, parts)
+}
+
+func TestMultitenantCompactor_VerifyBlockFileHashes(t *testing.T) {
+	const tenantID = "test"
+	sha256Hex := func(content string) string {
+		sum := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(sum[:])
+	}
+
+	index := strings.Repeat("i", 10)
+	chunks1 := "aaaaaaaaaabbbbbbbbbb"
+	chunks2 := strings.Repeat("c", 10)
+	now := time.Now().UnixMilli()
+	newMeta := func(blockID string) metadata.Meta {
+		return metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID:    ulid.MustParse(blockID),
+				Version: metadata.TSDBVersion1,
+				MinTime: now - 1000,
+				MaxTime: now,
+			},
+			Thanos: metadata.Thanos{
+				Files: []metadata.File{
+					{RelPath: block.MetaFilename},
+					{RelPath: "index", SizeBytes: 10, Hash: &metadata.ObjectHash{Func: metadata.SHA256Func, Value: sha256Hex(index)}},
+					{RelPath: "chunks/000001", SizeBytes: 20, Hash: &metadata.ObjectHash{Func: metadata.SHA256Func, Value: sha256Hex(chunks1)}},
+					{RelPath: "chunks/000002", SizeBytes: 10},
+				},
+			},
+		}
+	}
+
+	bkt := objstore.NewInMemBucket()
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockUploadEnabled[tenantID] = true
+	c := &MultitenantCompactor{
+		logger:       log.NewNopLogger(),
+		bucketClient: bkt,
+		cfgProvider:  cfgProvider,
+	}
+
+	newRequest := func(blockID, op string, body io.Reader) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/%s", blockID, op), body)
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		return mux.SetURLVars(r, map[string]string{"block": blockID})
+	}
+	start := func(blockID string) {
+		buf := bytes.NewBuffer(nil)
+		require.NoError(t, json.NewEncoder(buf).Encode(newMeta(blockID)))
+		w := httptest.NewRecorder()
+		c.StartBlockUpload(w, newRequest(blockID, "start", buf))
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	uploadFile := func(blockID, pth, contentRange, content string) {
+		r := newRequest(blockID, "files?path="+url.QueryEscape(pth), strings.NewReader(content))
+		if contentRange != "" {
+			r.Header.Set("Content-Range", contentRange)
+		}
+		w := httptest.NewRecorder()
+		c.UploadBlockFile(w, r)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+	finish := func(blockID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c.FinishBlockUpload(w, newRequest(blockID, "finish", nil))
+		return w
+	}
+	waitUploadState := func(blockID string, expected blockUploadState) *validationFile {
+		var v *validationFile
+		test.Poll(t, time.Second, expected, func() interface{} {
+			var s blockUploadState
+			var err error
+			s, _, v, err = c.getBlockUploadState(context.Background(), bucket.NewUserBucketClient(tenantID, bkt, nil), ulid.MustParse(blockID))
+			require.NoError(t, err)
+			return s
+		})
+		return v
+	}
+
+	t.Run("corrupted files", func(t *testing.T) {
+		const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+		start(blockID)
+
+		// The index is corrupted while uploading it in a single request.
+		uploadFile(blockID, "index", "", strings.Repeat("x", 10))
+		uploadFile(blockID, "chunks/000001", "bytes 0-9/20", chunks1[:10])
+		uploadFile(blockID, "chunks/000001", "bytes 10-19/20", strings.Repeat("x", 10))
+		uploadFile(blockID, "chunks/000002", "", chunks2)
+
+		w := finish(blockID)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, fmt.Sprintf("block file index is corrupted: its SHA256 hash is %s, but meta.json declares %s\n", sha256Hex(strings.Repeat("x", 10)), sha256Hex(index)), w.Body.String())
+
+		// Once the index is uploaded again, a part of the chunks file is found to be corrupted when assembling it
+		// in the background, which fails the block upload.
+		uploadFile(blockID, "index", "", index)
+
+		w = finish(blockID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		v := waitUploadState(blockID, blockValidationFailed)
+		assert.Equal(t, fmt.Sprintf("block file chunks/000001 is corrupted: its SHA256 hash is %s, but meta.json declares %s", sha256Hex(chunks1[:10]+strings.Repeat("x", 10)), sha256Hex(chunks1)), v.Error)
+
+		exists, err := bkt.Exists(context.Background(), path.Join(tenantID, blockID, "chunks/000001"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("valid files", func(t *testing.T) {
+		const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KE"
+		start(blockID)
+
+		uploadFile(blockID, "index", "", index)
+		uploadFile(blockID, "chunks/000001", "bytes 0-9/20", chunks1[:10])
+		uploadFile(blockID, "chunks/000001", "bytes 10-19/20", chunks1[10:])
+		uploadFile(blockID, "chunks/000002", "", chunks2)
+
+		w := finish(blockID)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		waitUploadState(blockID, blockIsComplete)
+
+		// The hashes of all the files are recorded in the meta file, including the ones not declared by the client.
+		rdr, err := bkt.Get(context.Background(), path.Join(tenantID, blockID, block.MetaFilename))
+		require.NoError(t, err)
+		completeMeta, err := metadata.Read(rdr)
+		require.NoError(t, err)
+		assert.Equal(t, []metadata.File{
+			{RelPath: block.MetaFilename},
+			{RelPath: "index", SizeBytes: 10, Hash: &metadata.ObjectHash{Func: metadata.SHA256Func, Value: sha256Hex(index)}},
+			{RelPath: "chunks/000001", SizeBytes: 20, Hash: &metadata.ObjectHash{Func: metadata.SHA256Func, Value: sha256Hex(chunks1)}},
+			{RelPath: "chunks/000002", SizeBytes: 10, Hash: &metadata.ObjectHash{Func: metadata.SHA256Func, Value: sha256Hex(chunks2)}},
+		}, completeMeta.Thanos.Files)
+
+		// The hashes recorded while uploading the files have been deleted.
+		var hashes []string
+		require.NoError(t, bkt.Iter(context.Background(), path.Join(tenantID, blockID, uploadingHashesDirname), func(name string) error {
+			hashes = append(hashes, name)
+			return nil
+		}, objstore.WithRecursiveIter))
+		assert.Empty(t, hashes)
+	})
+}
+
+func TestMultitenantCompactor_UploadBlockFileExceedingDeclaredSize(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	meta := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustParse(blockID),
+			Version: metadata.TSDBVersion1,
+		},
+		Thanos: metadata.Thanos{
+			Files: []metadata.File{
+				{RelPath: block.MetaFilename},
+				{RelPath: "index", SizeBytes: 10},
+				{RelPath: "chunks/000001", SizeBytes: 20},
+			},
+		},
 	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
+
+	for name, tc := range map[string]struct {
+		path         string
+		contentRange string
+		content      string
+	}{
+		"whole file": {
+			path:    "index",
+			content: strings.Repeat("i", 11),
+		},
+		"part of a file": {
+			path:         "chunks/000001",
+			contentRange: "bytes 0-9/20",
+			content:      strings.Repeat("c", 20),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
 			bkt := objstore.NewInMemBucket()
-			injectedBkt := bucket.ErrorInjectedBucketClient{
-				Bucket:   bkt,
-				Injector: tc.errorInjector,
-			}
-			if tc.setUpBucket != nil {
-				tc.setUpBucket(t, bkt)
-			}
+			require.NoError(t, marshalAndUploadToBucket(context.Background(), bkt, path.Join(tenantID, blockID, uploadingMetaFilename), meta))
 
 			cfgProvider := newMockConfigProvider()
-			cfgProvider.blockUploadEnabled[tc.tenantID] = !tc.disableBlockUpload
-			cfgProvider.blockUploadValidationEnabled[tc.tenantID] = tc.enableValidation
+			cfgProvider.blockUploadEnabled[tenantID] = true
 			c := &MultitenantCompactor{
 				logger:       log.NewNopLogger(),
-				bucketClient: &injectedBkt,
+				bucketClient: bkt,
 				cfgProvider:  cfgProvider,
 			}
-			c.compactorCfg.MaxBlockUploadValidationConcurrency = tc.maxConcurrency
-			if tc.setConcurrency > 0 {
-				c.blockUploadValidations.Add(tc.setConcurrency)
+
+			// The size of the body isn't known in advance, as when it's sent with chunked encoding.
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/files?path=%s", blockID, url.QueryEscape(tc.path)), io.MultiReader(strings.NewReader(tc.content)))
+			r.ContentLength = -1
+			if tc.contentRange != "" {
+				r.Header.Set("Content-Range", tc.contentRange)
 			}
+			r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			r = mux.SetURLVars(r, map[string]string{"block": blockID})
+			w := httptest.NewRecorder()
+			c.UploadBlockFile(w, r)
 
-			c.compactorCfg.DataDir = t.TempDir()
+			assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, `{"error":"file_too_large","message":"file size exceeds the size declared in meta.json","max_size_bytes":10}`, w.Body.String())
 
-			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/finish", tc.blockID), nil)
-			if tc.tenantID != "" {
-				r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			// Nothing has been stored besides the in-flight meta file.
+			var objects []string
+			require.NoError(t, bkt.Iter(context.Background(), path.Join(tenantID, blockID), func(name string) error {
+				objects = append(objects, name)
+				return nil
+			}, objstore.WithRecursiveIter))
+			assert.Equal(t, []string{path.Join(tenantID, blockID, uploadingMetaFilename)}, objects)
+		})
+	}
+}
+
+func TestMultitenantCompactor_UploadBlockFileOverlappingParts(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	meta := metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:    ulid.MustParse(blockID),
+			Version: metadata.TSDBVersion1,
+		},
+		Thanos: metadata.Thanos{
+			Files: []metadata.File{
+				{RelPath: block.MetaFilename},
+				{RelPath: "index", SizeBytes: 10},
+				{RelPath: "chunks/000001", SizeBytes: 20},
+			},
+		},
+	}
+
+	bkt := objstore.NewInMemBucket()
+	require.NoError(t, marshalAndUploadToBucket(context.Background(), bkt, path.Join(tenantID, blockID, uploadingMetaFilename), meta))
+
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockUploadEnabled[tenantID] = true
+	c := &MultitenantCompactor{
+		logger:       log.NewNopLogger(),
+		bucketClient: bkt,
+		cfgProvider:  cfgProvider,
+	}
+
+	uploadFile := func(pth, contentRange, content string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/files?path=%s", blockID, url.QueryEscape(pth)), strings.NewReader(content))
+		if contentRange != "" {
+			r.Header.Set("Content-Range", contentRange)
+		}
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		r = mux.SetURLVars(r, map[string]string{"block": blockID})
+		w := httptest.NewRecorder()
+		c.UploadBlockFile(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, uploadFile("index", "", strings.Repeat("i", 10)).Code)
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 5-9/20", strings.Repeat("a", 5)).Code)
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 15-19/20", strings.Repeat("b", 5)).Code)
+
+	for contentRange, overlapping := range map[string]int{
+		"bytes 0-5/20":   5,
+		"bytes 8-11/20":  5,
+		"bytes 10-15/20": 15,
+		"bytes 5-15/20":  15,
+	} {
+		start, end, err := parseBlockFileContentRange(contentRange, 20)
+		require.NoError(t, err)
+
+		w := uploadFile("chunks/000001", contentRange, strings.Repeat("c", int(end-start+1)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, contentRange)
+		assert.Equal(t, fmt.Sprintf("part overlaps the part of block file chunks/000001 uploaded at byte %d\n", overlapping), w.Body.String(), contentRange)
+	}
+
+	// Uploading a part at the same offset replaces it, and parts adjacent to the uploaded ones don't overlap them.
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 5-9/20", strings.Repeat("a", 5)).Code)
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 0-4/20", strings.Repeat("a", 5)).Code)
+	require.Equal(t, http.StatusOK, uploadFile("chunks/000001", "bytes 10-14/20", strings.Repeat("a", 5)).Code)
+}
+
+func TestMultitenantCompactor_UploadBlockFileExceedingMaxFileSize(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+	const maxFileSize = 10
+
+	for name, tc := range map[string]struct {
+		size              int
+		expTooLarge       bool
+		expUploadedObject bool
+	}{
+		"file smaller than the limit": {
+			size:              maxFileSize - 1,
+			expUploadedObject: true,
+		},
+		"file size exactly at the limit": {
+			size:              maxFileSize,
+			expUploadedObject: true,
+		},
+		"file one byte larger than the limit": {
+			size:        maxFileSize + 1,
+			expTooLarge: true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			meta := metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{
+					ULID:    ulid.MustParse(blockID),
+					Version: metadata.TSDBVersion1,
+				},
+				Thanos: metadata.Thanos{
+					Files: []metadata.File{
+						{RelPath: block.MetaFilename},
+						{RelPath: "index", SizeBytes: int64(tc.size)},
+					},
+				},
 			}
-			if tc.blockID != "" {
-				r = mux.SetURLVars(r, map[string]string{"block": tc.blockID})
+
+			bkt := objstore.NewInMemBucket()
+			require.NoError(t, marshalAndUploadToBucket(context.Background(), bkt, path.Join(tenantID, blockID, uploadingMetaFilename), meta))
+
+			cfgProvider := newMockConfigProvider()
+			cfgProvider.blockUploadEnabled[tenantID] = true
+			cfgProvider.blockUploadMaxFileSizeBytes[tenantID] = maxFileSize
+			c := &MultitenantCompactor{
+				logger:       log.NewNopLogger(),
+				bucketClient: bkt,
+				cfgProvider:  cfgProvider,
 			}
-			w := httptest.NewRecorder()
-			c.FinishBlockUpload(w, r)
 
-			resp := w.Result()
-			body, err := io.ReadAll(resp.Body)
-			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/files?path=index", blockID), strings.NewReader(strings.Repeat("i", tc.size)))
+			r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			r = mux.SetURLVars(r, map[string]string{"block": blockID})
+			w := httptest.NewRecorder()
+			c.UploadBlockFile(w, r)
 
-			switch {
-			case tc.expBadRequest != "":
-				assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-				assert.Equal(t, fmt.Sprintf("%s\n", tc.expBadRequest), string(body))
-			case tc.expConflict != "":
-				assert.Equal(t, http.StatusConflict, resp.StatusCode)
-				assert.Equal(t, fmt.Sprintf("%s\n", tc.expConflict), string(body))
-			case tc.expNotFound != "":
-				assert.Equal(t, http.StatusNotFound, resp.StatusCode)
-				assert.Equal(t, fmt.Sprintf("%s\n", tc.expNotFound), string(body))
-			case tc.expInternalServerError:
-				assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
-				assert.Equal(t, "internal server error\n", string(body))
-			case tc.expTooManyRequests:
-				assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
-				assert.Equal(t, "too many block upload validations in progress, limit is 2\n", string(body))
-			default:
-				assert.Equal(t, http.StatusOK, resp.StatusCode)
-				assert.Empty(t, string(body))
-				exists, err := bkt.Exists(context.Background(), path.Join(tc.blockID, block.MetaFilename))
-				require.NoError(t, err)
-				require.True(t, exists)
+			if tc.expTooLarge {
+				assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				assert.JSONEq(t, fmt.Sprintf(`{"error":"file_too_large","message":"file size %d bytes exceeds the limit of %d bytes","max_size_bytes":%d}`, tc.size, maxFileSize, maxFileSize), w.Body.String())
+			} else {
+				assert.Equal(t, http.StatusOK, w.Code)
 			}
+
+			exists, err := bkt.Exists(context.Background(), path.Join(tenantID, blockID, "index"))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expUploadedObject, exists)
 		})
 	}
 }
@@ -1350,6 +2766,18 @@ func TestMultitenantCompactor_ValidateAndComplete(t *testing.T) {
 
 	validationSucceeds := func(_ context.Context) error { return nil }
 
+	// failDeletes returns an error injector failing the first n deletions of the in-flight meta file.
+	failDeletes := func(n int) func(op bucket.Operation, name string) error {
+		failures := 0
+		return func(op bucket.Operation, target string) error {
+			if op == bucket.OpDelete && target == uploadingMetaPath && failures < n {
+				failures++
+				return injectedError
+			}
+			return nil
+		}
+	}
+
 	testCases := []struct {
 		name                        string
 		errorInjector               func(op bucket.Operation, name string) error
@@ -1358,6 +2786,7 @@ func TestMultitenantCompactor_ValidateAndComplete(t *testing.T) {
 		expectErrorInValidationFile bool
 		expectTempUploadingMeta     bool
 		expectMeta                  bool
+		expectTempCleanupFailures   int
 	}{
 		{
 			name:                        "validation fails",
@@ -1400,13 +2829,31 @@ func TestMultitenantCompactor_ValidateAndComplete(t *testing.T) {
 			expectMeta:                  false,
 		},
 		{
-			name:                    "removing in-flight meta file fails",
-			errorInjector:           bucket.InjectErrorOn(bucket.OpDelete, uploadingMetaPath, injectedError),
+			name:                      "removing in-flight meta file fails",
+			errorInjector:             bucket.InjectErrorOn(bucket.OpDelete, uploadingMetaPath, injectedError),
+			validation:                validationSucceeds,
+			expectValidationFile:      false,
+			expectTempUploadingMeta:   true,
+			expectMeta:                true,
+			expectTempCleanupFailures: 1,
+		},
+		{
+			name:                    "removing in-flight meta file fails, then succeeds on retry",
+			errorInjector:           failDeletes(2),
 			validation:              validationSucceeds,
 			expectValidationFile:    false,
-			expectTempUploadingMeta: true,
+			expectTempUploadingMeta: false,
 			expectMeta:              true,
 		},
+		{
+			name:                      "removing in-flight meta file fails more times than retries",
+			errorInjector:             failDeletes(3),
+			validation:                validationSucceeds,
+			expectValidationFile:      false,
+			expectTempUploadingMeta:   true,
+			expectMeta:                true,
+			expectTempCleanupFailures: 1,
+		},
 		{
 			name:                        "removing validation file fails",
 			errorInjector:               bucket.InjectErrorOn(bucket.OpDelete, validationPath, injectedError),
@@ -1440,7 +2887,11 @@ func TestMultitenantCompactor_ValidateAndComplete(t *testing.T) {
 				logger:       log.NewNopLogger(),
 				bucketClient: injectedBkt,
 				cfgProvider:  cfgProvider,
+				blockUploadTempCleanupFailures: promauto.With(nil).NewCounter(prometheus.CounterOpts{
+					Name: "cortex_compactor_block_upload_temp_cleanup_failures_total",
+				}),
 			}
+			c.compactorCfg.BlockUploadCleanupRetries = 2
 			userBkt := bucket.NewUserBucketClient(tenantID, injectedBkt, cfgProvider)
 
 			meta := metadata.Meta{}
@@ -1448,7 +2899,7 @@ func TestMultitenantCompactor_ValidateAndComplete(t *testing.T) {
 			v := validationFile{}
 			marshalAndUploadJSON(t, bkt, validationPath, v)
 
-			c.validateAndCompleteBlockUpload(log.NewNopLogger(), userBkt, ulid.MustParse(blockID), &meta, tc.validation)
+			c.validateAndCompleteBlockUpload(log.NewNopLogger(), userBkt, ulid.MustParse(blockID), &meta, time.Time{}, tc.validation)
 
 			tempUploadingMetaExists, err := bkt.Exists(context.Background(), uploadingMetaPath)
 			require.NoError(t, err)
@@ -1458,6 +2909,8 @@ func TestMultitenantCompactor_ValidateAndComplete(t *testing.T) {
 			require.NoError(t, err)
 			require.Equal(t, metaExists, tc.expectMeta)
 
+			assert.Equal(t, float64(tc.expectTempCleanupFailures), promtest.ToFloat64(c.blockUploadTempCleanupFailures))
+
 			if !tc.expectValidationFile {
 				exists, err := bkt.Exists(context.Background(), validationPath)
 				require.NoError(t, err)
@@ -2014,3 +3467,226 @@ func flipByteAt(t *testing.T, fname string, offset int64) {
 	_, err = fd.WriteAt(b[:], offset)
 	require.NoError(t, err)
 }
+
+func TestMultitenantCompactor_IsAllowedBlockFilePath(t *testing.T) {
+	tests := map[string]struct {
+		allowedFilePaths []string
+		expectedAllowed  map[string]bool
+	}{
+		"default allowed file paths": {
+			expectedAllowed: map[string]bool{
+				"index":            true,
+				"chunks/000001":    true,
+				"tombstones":       true,
+				"chunks/0000001":   false,
+				"chunks/invalid":   false,
+				"../foo":           false,
+				"chunks/../index":  false,
+				"/index":           false,
+				"index/":           false,
+				"debug/metas/1.js": false,
+			},
+		},
+		"custom allowed file paths": {
+			allowedFilePaths: []string{`index`, `chunks/\d{6,7}`},
+			expectedAllowed: map[string]bool{
+				"index":          true,
+				"chunks/000001":  true,
+				"chunks/0000001": true,
+				"tombstones":     false,
+				"../foo":         false,
+			},
+		},
+		"loose allowed file paths": {
+			allowedFilePaths: []string{`.*`},
+			expectedAllowed: map[string]bool{
+				"index":                      true,
+				"chunks/000001":              true,
+				"../foo":                     false,
+				"../../other-tenant/index":   false,
+				"chunks/../../index":         false,
+				block.MetaFilename:           false,
+				uploadingMetaFilename:        false,
+				validationFilename:           false,
+				uploadingPartsDirname + "/x": false,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{}
+			flagext.DefaultValues(&cfg)
+			if tc.allowedFilePaths != nil {
+				cfg.BlockUploadAllowedFilePaths = tc.allowedFilePaths
+			}
+			require.NoError(t, cfg.Validate(log.NewNopLogger()))
+
+			c := &MultitenantCompactor{compactorCfg: cfg}
+			for pth, expected := range tc.expectedAllowed {
+				assert.Equal(t, expected, c.isAllowedBlockFilePath(pth), pth)
+			}
+		})
+	}
+}
+
+func TestMultitenantCompactor_UploadBlockFileShouldRejectDirectoryTraversal(t *testing.T) {
+	const tenantID = "test"
+	const blockID = "01G3FZ0JWJYJC0ZM6Y9778P6KD"
+
+	// Even if any file path is allowed, files can't be written outside the block directory.
+	cfg := Config{}
+	flagext.DefaultValues(&cfg)
+	cfg.BlockUploadAllowedFilePaths = []string{`.*`}
+	require.NoError(t, cfg.Validate(log.NewNopLogger()))
+
+	bkt := objstore.NewInMemBucket()
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockUploadEnabled[tenantID] = true
+	c := &MultitenantCompactor{
+		compactorCfg: cfg,
+		logger:       log.NewNopLogger(),
+		bucketClient: bkt,
+		cfgProvider:  cfgProvider,
+	}
+
+	for _, pth := range []string{"chunks/../../../etc", "index/../meta.json", "../foo", "chunks/../index", "./index", "/index"} {
+		t.Run(pth, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/upload/block/%s/files?path=%s", blockID, url.QueryEscape(pth)), strings.NewReader("content"))
+			r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+			r = mux.SetURLVars(r, map[string]string{"block": blockID})
+			w := httptest.NewRecorder()
+			c.UploadBlockFile(w, r)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Empty(t, bkt.Objects())
+		})
+	}
+}
+
+func TestIsWithinBlockDir(t *testing.T) {
+	blockID := ulid.MustParse("01G3FZ0JWJYJC0ZM6Y9778P6KD")
+
+	for pth, expected := range map[string]bool{
+		blockID.String() + "/index":                    true,
+		blockID.String() + "/chunks/000001":            true,
+		blockFilePartPath(blockID, "chunks/000001", 0): true,
+		blockID.String():                               false,
+		blockID.String() + "/../index":                 false,
+		blockID.String() + "/chunks/../../../etc":      false,
+		"01G3FZ0JWJYJC0ZM6Y9778P6KE/index":             false,
+		"index":                                        false,
+		"/" + blockID.String() + "/index":              false,
+		blockID.String() + "extra/index":               false,
+		blockID.String() + "/./index":                  false,
+	} {
+		assert.Equal(t, expected, isWithinBlockDir(blockID, pth), pth)
+	}
+}
+
+func TestMultitenantCompactor_ListBlockUploads(t *testing.T) {
+	const tenantID = "test"
+	uploadingID := ulid.MustParse("01G3FZ0JWJYJC0ZM6Y9778P6KD")
+	emptyUploadingID := ulid.MustParse("01G3FZ0JWJYJC0ZM6Y9778P6KE")
+	completeID := ulid.MustParse("01G3FZ0JWJYJC0ZM6Y9778P6KF")
+
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	userBkt := bucket.NewUserBucketClient(tenantID, bkt, nil)
+	for _, pth := range []string{
+		path.Join(uploadingID.String(), uploadingMetaFilename),
+		path.Join(uploadingID.String(), "index"),
+		path.Join(uploadingID.String(), "chunks", "000001"),
+		path.Join(uploadingID.String(), validationFilename),
+		path.Join(uploadingID.String(), uploadingHashesDirname, "index"),
+		path.Join(uploadingID.String(), uploadingPartsDirname, "chunks", "000002", "0"),
+		path.Join(emptyUploadingID.String(), uploadingMetaFilename),
+		path.Join(completeID.String(), block.MetaFilename),
+		path.Join(completeID.String(), "index"),
+		path.Join("not-a-block", uploadingMetaFilename),
+	} {
+		require.NoError(t, userBkt.Upload(ctx, pth, strings.NewReader("content")))
+	}
+
+	t.Run("block upload disabled", func(t *testing.T) {
+		c := &MultitenantCompactor{
+			logger:       log.NewNopLogger(),
+			bucketClient: bkt,
+			cfgProvider:  newMockConfigProvider(),
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/upload/blocks", nil)
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		w := httptest.NewRecorder()
+		c.ListBlockUploads(w, r)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "block upload is disabled\n", w.Body.String())
+	})
+
+	t.Run("block upload enabled", func(t *testing.T) {
+		cfgProvider := newMockConfigProvider()
+		cfgProvider.blockUploadEnabled[tenantID] = true
+		c := &MultitenantCompactor{
+			logger:       log.NewNopLogger(),
+			bucketClient: bkt,
+			cfgProvider:  cfgProvider,
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/upload/blocks", nil)
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		w := httptest.NewRecorder()
+		c.ListBlockUploads(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var res blockUploadsListResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.False(t, res.Truncated)
+		require.Len(t, res.Uploads, 2)
+
+		assert.Equal(t, uploadingID.String(), res.Uploads[0].Block)
+		assert.Equal(t, 2, res.Uploads[0].FilesUploaded)
+		assert.WithinDuration(t, time.Now(), res.Uploads[0].StartedAt, time.Minute)
+
+		assert.Equal(t, emptyUploadingID.String(), res.Uploads[1].Block)
+		assert.Equal(t, 0, res.Uploads[1].FilesUploaded)
+		assert.WithinDuration(t, time.Now(), res.Uploads[1].StartedAt, time.Minute)
+	})
+
+	t.Run("files of completed blocks aren't listed", func(t *testing.T) {
+		startedAt := time.Now().Add(-time.Hour)
+		bktMock := &bucket.ClientMock{}
+		bktMock.MockIter(tenantID+"/", []string{tenantID + "/" + completeID.String() + "/", tenantID + "/" + uploadingID.String() + "/"}, nil)
+		bktMock.MockExists(path.Join(tenantID, completeID.String(), block.MetaFilename), true, nil)
+		bktMock.MockExists(path.Join(tenantID, uploadingID.String(), block.MetaFilename), false, nil)
+		bktMock.MockAttributes(path.Join(tenantID, uploadingID.String(), uploadingMetaFilename), objstore.ObjectAttributes{LastModified: startedAt}, nil)
+		bktMock.MockIter(path.Join(tenantID, uploadingID.String()), []string{
+			path.Join(tenantID, uploadingID.String(), uploadingMetaFilename),
+			path.Join(tenantID, uploadingID.String(), "index"),
+		}, nil)
+
+		cfgProvider := newMockConfigProvider()
+		cfgProvider.blockUploadEnabled[tenantID] = true
+		c := &MultitenantCompactor{
+			logger:       log.NewNopLogger(),
+			bucketClient: bktMock,
+			cfgProvider:  cfgProvider,
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/upload/blocks", nil)
+		r = r.WithContext(user.InjectOrgID(r.Context(), tenantID))
+		w := httptest.NewRecorder()
+		c.ListBlockUploads(w, r)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var res blockUploadsListResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		require.Len(t, res.Uploads, 1)
+		assert.Equal(t, uploadingID.String(), res.Uploads[0].Block)
+		assert.Equal(t, 1, res.Uploads[0].FilesUploaded)
+		assert.WithinDuration(t, startedAt, res.Uploads[0].StartedAt, time.Second)
+
+		// Only the tenant and the in-progress block have been listed.
+		bktMock.AssertNumberOfCalls(t, "Iter", 2)
+	})
+}
@@ -8,6 +8,7 @@ package compactor
 import (
 	"context"
 	"fmt"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,14 +36,22 @@ import (
 
 const (
 	defaultDeleteBlocksConcurrency = 16
+
+	// Supported actions on the temporary meta file left in the blocks whose upload has completed.
+	StaleTempMetaActionIgnore = "ignore"
+	StaleTempMetaActionLog    = "log"
+	StaleTempMetaActionDelete = "delete"
 )
 
+var StaleTempMetaActions = []string{StaleTempMetaActionIgnore, StaleTempMetaActionLog, StaleTempMetaActionDelete}
+
 type BlocksCleanerConfig struct {
 	DeletionDelay           time.Duration
 	CleanupInterval         time.Duration
 	CleanupConcurrency      int
 	TenantCleanupDelay      time.Duration // Delay before removing tenant deletion mark and "debug".
 	DeleteBlocksConcurrency int
+	StaleTempMetaAction     string // What to do with the temporary meta file left in the blocks whose upload has completed.
 }
 
 type BlocksCleaner struct {
@@ -59,6 +68,11 @@ type BlocksCleaner struct {
 	// Keep track of the last owned users.
 	lastOwnedUsers []string
 
+	// Keep track of the blocks whose stale temporary meta file was still in the storage at the
+	// last cleanup, by tenant, so that they get checked again at the next cleanup.
+	staleTempMetaMtx    sync.Mutex
+	staleTempMetaBlocks map[string]map[ulid.ULID]struct{}
+
 	// Metrics.
 	runsStarted                    prometheus.Counter
 	runsCompleted                  prometheus.Counter
@@ -83,6 +97,9 @@ func NewBlocksCleaner(cfg BlocksCleanerConfig, bucketClient objstore.Bucket, own
 		cfgProvider:  cfgProvider,
 		singleFlight: concurrency.NewLimitedConcurrencySingleFlight(cfg.CleanupConcurrency),
 		logger:       log.With(logger, "component", "cleaner"),
+
+		staleTempMetaBlocks: map[string]map[ulid.ULID]struct{}{},
+
 		runsStarted: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Name: "cortex_compactor_block_cleanup_started_total",
 			Help: "Total number of blocks cleanup runs started.",
@@ -228,6 +245,7 @@ func (c *BlocksCleaner) refreshOwnedUsers(ctx context.Context) ([]string, map[st
 			c.tenantMarkedBlocks.DeleteLabelValues(userID)
 			c.tenantPartialBlocks.DeleteLabelValues(userID)
 			c.tenantBucketIndexLastUpdate.DeleteLabelValues(userID)
+			c.setStaleTempMetaBlocks(userID, nil)
 		}
 	}
 	c.lastOwnedUsers = allUsers
@@ -375,6 +393,14 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string) (returnErr
 		return err
 	}
 
+	// Keep track of the blocks already in the bucket index, to find the ones discovered by this cleanup.
+	knownBlocks := map[ulid.ULID]struct{}{}
+	if idx != nil {
+		for _, b := range idx.Blocks {
+			knownBlocks[b.ID] = struct{}{}
+		}
+	}
+
 	// Mark blocks for future deletion based on the retention period for the user.
 	// Note doing this before UpdateIndex, so it reads in the deletion marks.
 	// The trade-off being that retention is not applied if the index has to be
@@ -394,6 +420,9 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string) (returnErr
 	}
 
 	c.deleteBlocksMarkedForDeletion(ctx, idx, userBucket, userLogger)
+	if c.cfg.StaleTempMetaAction != StaleTempMetaActionIgnore {
+		c.cleanUserStaleTempMeta(ctx, userID, idx, knownBlocks, userBucket, userLogger)
+	}
 
 	// Partial blocks with a deletion mark can be cleaned up. This is a best effort, so we don't return
 	// error if the cleanup of partial blocks fail.
@@ -457,6 +486,81 @@ func (c *BlocksCleaner) deleteBlocksMarkedForDeletion(ctx context.Context, idx *
 	})
 }
 
+// cleanUserStaleTempMeta looks for the temporary meta file of a block upload in the blocks discovered since the
+// previous cleanup, and in the blocks which still had it at the previous cleanup. These blocks have a valid meta.json,
+// so the temporary meta file has been left behind because its deletion failed once the upload completed. It's either
+// deleted or logged, depending on the configured action.
+func (c *BlocksCleaner) cleanUserStaleTempMeta(ctx context.Context, userID string, idx *bucketindex.Index, knownBlocks map[ulid.ULID]struct{}, userBucket objstore.Bucket, userLogger log.Logger) {
+	c.staleTempMetaMtx.Lock()
+	previouslyStale := c.staleTempMetaBlocks[userID]
+	c.staleTempMetaMtx.Unlock()
+
+	var blocks []ulid.ULID
+	for _, b := range idx.Blocks {
+		_, known := knownBlocks[b.ID]
+		_, stale := previouslyStale[b.ID]
+		if !known || stale {
+			blocks = append(blocks, b.ID)
+		}
+	}
+
+	// The blocks are considered stale until the temporary meta file is found to be missing or it's
+	// deleted, so that they're checked again if the cleanup is interrupted.
+	var mu sync.Mutex
+	stale := make(map[ulid.ULID]struct{}, len(blocks))
+	for _, blockID := range blocks {
+		stale[blockID] = struct{}{}
+	}
+	markCleaned := func(blockID ulid.ULID) {
+		mu.Lock()
+		delete(stale, blockID)
+		mu.Unlock()
+	}
+
+	// We don't want to return errors from our function, as that would stop ForEach loop early.
+	_ = concurrency.ForEachJob(ctx, len(blocks), c.cfg.DeleteBlocksConcurrency, func(ctx context.Context, jobIdx int) error {
+		blockID := blocks[jobIdx]
+		tempMetaPath := path.Join(blockID.String(), uploadingMetaFilename)
+
+		exists, err := userBucket.Exists(ctx, tempMetaPath)
+		if err != nil {
+			level.Warn(userLogger).Log("msg", "failed to check if the block has a stale temporary meta file", "block", blockID, "err", err)
+			return nil
+		}
+		if !exists {
+			markCleaned(blockID)
+			return nil
+		}
+
+		if c.cfg.StaleTempMetaAction != StaleTempMetaActionDelete {
+			level.Warn(userLogger).Log("msg", "found stale temporary meta file in a block whose upload has completed", "block", blockID, "file", uploadingMetaFilename)
+			return nil
+		}
+
+		if err := userBucket.Delete(ctx, tempMetaPath); err != nil && !userBucket.IsObjNotFoundErr(err) {
+			level.Warn(userLogger).Log("msg", "failed to delete stale temporary meta file", "block", blockID, "file", uploadingMetaFilename, "err", err)
+			return nil
+		}
+
+		markCleaned(blockID)
+		level.Info(userLogger).Log("msg", "deleted stale temporary meta file", "block", blockID, "file", uploadingMetaFilename)
+		return nil
+	})
+
+	c.setStaleTempMetaBlocks(userID, stale)
+}
+
+func (c *BlocksCleaner) setStaleTempMetaBlocks(userID string, blocks map[ulid.ULID]struct{}) {
+	c.staleTempMetaMtx.Lock()
+	defer c.staleTempMetaMtx.Unlock()
+
+	if len(blocks) == 0 {
+		delete(c.staleTempMetaBlocks, userID)
+		return
+	}
+	c.staleTempMetaBlocks[userID] = blocks
+}
+
 // cleanUserPartialBlocks deletes partial blocks which are safe to be deleted. The provided index is updated accordingly.
 // partialDeletionCutoffTime, if not zero, is used to find blocks without deletion marker that were last modified before this time. Such blocks will be marked for deletion.
 func (c *BlocksCleaner) cleanUserPartialBlocks(ctx context.Context, partials map[ulid.ULID]error, idx *bucketindex.Index, partialDeletionCutoffTime time.Time, userBucket objstore.InstrumentedBucket, userLogger log.Logger) {
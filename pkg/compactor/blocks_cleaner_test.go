@@ -909,6 +909,88 @@ func TestBlocksCleaner_ShouldNotRemovePartialBlocksIfConfiguredDelayIsInvalid(t
 	))
 }
 
+func TestBlocksCleaner_ShouldHandleStaleTempMetaOfUploadedBlocks(t *testing.T) {
+	for _, action := range StaleTempMetaActions {
+		action := action
+		t.Run(action, func(t *testing.T) {
+			bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+			bucketClient = bucketindex.BucketWithGlobalMarkers(bucketClient)
+
+			ctx := context.Background()
+			block1 := createTSDBBlock(t, bucketClient, "user-1", 10, 20, 2, nil)
+			block2 := createTSDBBlock(t, bucketClient, "user-1", 20, 30, 2, nil)
+
+			// Simulate the upload of the first block having completed without deleting the temporary meta file.
+			tempMetaPath := path.Join("user-1", block1.String(), uploadingMetaFilename)
+			require.NoError(t, bucketClient.Upload(ctx, tempMetaPath, strings.NewReader("{}")))
+
+			cfg := BlocksCleanerConfig{
+				DeletionDelay:           time.Hour,
+				CleanupInterval:         time.Minute,
+				CleanupConcurrency:      1,
+				DeleteBlocksConcurrency: 1,
+				StaleTempMetaAction:     action,
+			}
+
+			cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, newMockConfigProvider(), test.NewTestingLogger(t), prometheus.NewPedanticRegistry())
+			require.NoError(t, cleaner.cleanUser(ctx, "user-1"))
+
+			exists, err := bucketClient.Exists(ctx, tempMetaPath)
+			require.NoError(t, err)
+			assert.Equal(t, action != StaleTempMetaActionDelete, exists)
+
+			// The blocks must be left untouched.
+			checkBlock(t, "user-1", bucketClient, block1, true, false)
+			checkBlock(t, "user-1", bucketClient, block2, true, false)
+
+			idx, err := bucketindex.ReadIndex(ctx, bucketClient, "user-1", nil, test.NewTestingLogger(t))
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []ulid.ULID{block1, block2}, idx.Blocks.GetULIDs())
+		})
+	}
+}
+
+func TestBlocksCleaner_ShouldRetryDeletingStaleTempMetaOnNextCleanup(t *testing.T) {
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bucketClient = bucketindex.BucketWithGlobalMarkers(bucketClient)
+
+	ctx := context.Background()
+	block1 := createTSDBBlock(t, bucketClient, "user-1", 10, 20, 2, nil)
+
+	// Simulate the upload of the block having completed without deleting the temporary meta file.
+	tempMetaPath := path.Join("user-1", block1.String(), uploadingMetaFilename)
+	require.NoError(t, bucketClient.Upload(ctx, tempMetaPath, strings.NewReader("{}")))
+
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:           time.Hour,
+		CleanupInterval:         time.Minute,
+		CleanupConcurrency:      1,
+		DeleteBlocksConcurrency: 1,
+		StaleTempMetaAction:     StaleTempMetaActionDelete,
+	}
+
+	// The first cleanup fails to delete the temporary meta file.
+	failingBucket := &mockBucketFailure{Bucket: bucketClient, DeleteFailures: []string{tempMetaPath}}
+	cleaner := NewBlocksCleaner(cfg, failingBucket, tsdb.AllUsers, newMockConfigProvider(), test.NewTestingLogger(t), prometheus.NewPedanticRegistry())
+	require.NoError(t, cleaner.cleanUser(ctx, "user-1"))
+
+	exists, err := bucketClient.Exists(ctx, tempMetaPath)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// The next cleanup checks the block again, even if it's already in the bucket index.
+	failingBucket.DeleteFailures = nil
+	require.NoError(t, cleaner.cleanUser(ctx, "user-1"))
+
+	exists, err = bucketClient.Exists(ctx, tempMetaPath)
+	require.NoError(t, err)
+	require.False(t, exists)
+	checkBlock(t, "user-1", bucketClient, block1, true, false)
+
+	// The block isn't checked anymore once the temporary meta file has been deleted.
+	assert.Empty(t, cleaner.staleTempMetaBlocks)
+}
+
 func TestStalePartialBlockLastModifiedTime(t *testing.T) {
 	b, dir := mimir_testutil.PrepareFilesystemBucket(t)
 
@@ -977,6 +1059,13 @@ type mockConfigProvider struct {
 	userPartialBlockDelay        map[string]time.Duration
 	userPartialBlockDelayInvalid map[string]bool
 	verifyChunks                 map[string]bool
+	blockUploadValidators        map[string][]string
+	blockUploadMaxUncompacted    map[string]int
+	blockUploadMinAge            map[string]time.Duration
+	blockUploadMaxFiles          map[string]int
+	blockUploadMaxFileSizeBytes  map[string]int64
+	blockUploadAllowedLabels     map[string][]string
+	blockRanges                  map[string]tsdb.DurationList
 }
 
 func newMockConfigProvider() *mockConfigProvider {
@@ -990,6 +1079,13 @@ func newMockConfigProvider() *mockConfigProvider {
 		userPartialBlockDelay:        make(map[string]time.Duration),
 		userPartialBlockDelayInvalid: make(map[string]bool),
 		verifyChunks:                 make(map[string]bool),
+		blockUploadValidators:        make(map[string][]string),
+		blockUploadMaxUncompacted:    make(map[string]int),
+		blockUploadMinAge:            make(map[string]time.Duration),
+		blockUploadMaxFiles:          make(map[string]int),
+		blockUploadMaxFileSizeBytes:  make(map[string]int64),
+		blockUploadAllowedLabels:     make(map[string][]string),
+		blockRanges:                  make(map[string]tsdb.DurationList),
 	}
 }
 
@@ -1021,6 +1117,10 @@ func (m *mockConfigProvider) CompactorTenantShardSize(user string) int {
 	return 0
 }
 
+func (m *mockConfigProvider) CompactorBlockRanges(user string) tsdb.DurationList {
+	return m.blockRanges[user]
+}
+
 func (m *mockConfigProvider) CompactorBlockUploadEnabled(tenantID string) bool {
 	return m.blockUploadEnabled[tenantID]
 }
@@ -1041,6 +1141,30 @@ func (m *mockConfigProvider) CompactorBlockUploadMaxBlockSizeBytes(user string)
 	return m.blockUploadMaxBlockSizeBytes[user]
 }
 
+func (m *mockConfigProvider) CompactorBlockUploadValidators(tenantID string) []string {
+	return m.blockUploadValidators[tenantID]
+}
+
+func (m *mockConfigProvider) CompactorBlockUploadMaxUncompactedBlocks(tenantID string) int {
+	return m.blockUploadMaxUncompacted[tenantID]
+}
+
+func (m *mockConfigProvider) CompactorBlockUploadMinAge(tenantID string) time.Duration {
+	return m.blockUploadMinAge[tenantID]
+}
+
+func (m *mockConfigProvider) CompactorBlockUploadMaxFiles(tenantID string) int {
+	return m.blockUploadMaxFiles[tenantID]
+}
+
+func (m *mockConfigProvider) CompactorBlockUploadMaxFileSizeBytes(tenantID string) int64 {
+	return m.blockUploadMaxFileSizeBytes[tenantID]
+}
+
+func (m *mockConfigProvider) CompactorBlockUploadAllowedLabels(tenantID string) []string {
+	return m.blockUploadAllowedLabels[tenantID]
+}
+
 func (m *mockConfigProvider) S3SSEType(user string) string {
 	return ""
 }
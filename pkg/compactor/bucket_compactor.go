@@ -7,6 +7,7 @@ package compactor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
@@ -33,6 +34,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
+	"github.com/grafana/mimir/pkg/util/version"
 )
 
 type DeduplicateFilter interface {
@@ -181,7 +183,8 @@ func (s *Syncer) GarbageCollect(ctx context.Context) error {
 }
 
 // Grouper is responsible to group all known blocks into compaction Job which are safe to be
-// compacted concurrently.
+// compacted concurrently. The split-and-merge grouper is the default implementation, and a
+// different grouping strategy can be plugged in via Config.BlocksGrouperFactory.
 type Grouper interface {
 	// Groups returns the compaction jobs for all blocks currently known to the syncer.
 	// It creates all jobs from the scratch on every call.
@@ -228,6 +231,46 @@ func maxTime(metas []*metadata.Meta) time.Time {
 	return time.Unix(0, maxT*int64(time.Millisecond)).UTC()
 }
 
+// summarizeSourceBlocks returns the summary of the blocks merged by a compaction, recorded in the meta
+// of the compacted blocks.
+func summarizeSourceBlocks(metas []*metadata.Meta) *metadata.SourceBlocks {
+	if len(metas) == 0 {
+		return nil
+	}
+
+	summary := &metadata.SourceBlocks{
+		Count:    len(metas),
+		MinLevel: metas[0].Compaction.Level,
+		MaxLevel: metas[0].Compaction.Level,
+	}
+	for _, meta := range metas {
+		if meta.Compaction.Level < summary.MinLevel {
+			summary.MinLevel = meta.Compaction.Level
+		}
+		if meta.Compaction.Level > summary.MaxLevel {
+			summary.MaxLevel = meta.Compaction.Level
+		}
+	}
+
+	return summary
+}
+
+// summarizeOriginSource returns the source the input blocks of a compaction originate from, or an empty
+// source if they originate from different sources.
+func summarizeOriginSource(metas []*metadata.Meta) metadata.SourceType {
+	if len(metas) == 0 {
+		return ""
+	}
+
+	origin := metas[0].Thanos.GetOriginSource()
+	for _, meta := range metas[1:] {
+		if meta.Thanos.GetOriginSource() != origin {
+			return ""
+		}
+	}
+	return origin
+}
+
 // Planner returns blocks to compact.
 type Planner interface {
 	// Plan returns a list of blocks that should be compacted into single one.
@@ -267,15 +310,35 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 	jobLogger := log.With(c.logger, "groupKey", job.Key())
 	subDir := filepath.Join(c.compactDir, job.Key())
 
+	// Bound the job execution time, if configured.
+	parentCtx := ctx
+	if c.maxJobDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.maxJobDuration)
+		defer cancel()
+	}
+
+	// The job working directory is kept when some of the compacted blocks failed to upload,
+	// so that the next run of the job can resume from its checkpoint.
+	keepJobDir := false
+
 	defer func() {
 		elapsed := time.Since(jobBeginTime)
 
+		// Report the timeout as the failure reason if the job has been cancelled because it ran for too long.
+		if rerr != nil && parentCtx.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			rerr = compactionJobTimeoutError(rerr, c.maxJobDuration)
+		}
+
 		if rerr == nil {
 			level.Info(jobLogger).Log("msg", "compaction job succeeded", "duration", elapsed, "duration_ms", elapsed.Milliseconds())
 		} else {
 			level.Error(jobLogger).Log("msg", "compaction job failed", "duration", elapsed, "duration_ms", elapsed.Milliseconds(), "err", rerr)
 		}
 
+		if keepJobDir {
+			return
+		}
 		if err := os.RemoveAll(subDir); err != nil {
 			level.Error(jobLogger).Log("msg", "failed to remove compaction group work directory", "path", subDir, "err", err)
 		}
@@ -298,93 +361,142 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 	// with the min/max time between all blocks to compact.
 	jobLogger = log.With(jobLogger, "minTime", minTime(toCompact).String(), "maxTime", maxTime(toCompact).String())
 
-	level.Info(jobLogger).Log("msg", "compaction available and planned; downloading blocks", "blocks", len(toCompact), "plan", fmt.Sprintf("%v", toCompact))
+	blocksToCompactDirs := make([]string, len(toCompact))
+	for ix, meta := range toCompact {
+		blocksToCompactDirs[ix] = filepath.Join(subDir, meta.ULID.String())
+	}
 
-	// Once we have a plan we need to download the actual data.
-	downloadBegin := time.Now()
+	// If a previous run of this job crashed after the compaction completed but before the
+	// compacted blocks were uploaded, or failed to upload some of them, resume from there
+	// instead of compacting again.
+	compIDs, alreadyUploaded, resumed := readCompactionCheckpoint(jobLogger, subDir, toCompact)
+	if resumed {
+		level.Info(jobLogger).Log("msg", "found compaction checkpoint; resuming from upload of compacted blocks", "new", fmt.Sprintf("%v", compIDs), "already_uploaded", fmt.Sprintf("%v", alreadyUploaded), "blocks", fmt.Sprintf("%v", blocksToCompactDirs))
+	} else {
+		level.Info(jobLogger).Log("msg", "compaction available and planned; downloading blocks", "blocks", len(toCompact), "plan", fmt.Sprintf("%v", toCompact))
 
-	err = concurrency.ForEachJob(ctx, len(toCompact), c.blockSyncConcurrency, func(ctx context.Context, idx int) error {
-		meta := toCompact[idx]
+		// Once we have a plan we need to download the actual data.
+		downloadBegin := time.Now()
 
-		// Must be the same as in blocksToCompactDirs.
-		bdir := filepath.Join(subDir, meta.ULID.String())
+		err = concurrency.ForEachJob(ctx, len(toCompact), c.blockSyncConcurrency, func(ctx context.Context, idx int) error {
+			meta := toCompact[idx]
 
-		if err := block.Download(ctx, jobLogger, c.bkt, meta.ULID, bdir); err != nil {
-			return errors.Wrapf(err, "download block %s", meta.ULID)
-		}
+			// Must be the same as in blocksToCompactDirs.
+			bdir := filepath.Join(subDir, meta.ULID.String())
+
+			if err := block.Download(ctx, jobLogger, c.bkt, meta.ULID, bdir); err != nil {
+				return errors.Wrapf(err, "download block %s", meta.ULID)
+			}
+
+			// Ensure all input blocks are valid.
+			stats, err := block.GatherBlockHealthStats(jobLogger, bdir, meta.MinTime, meta.MaxTime, false)
+			if err != nil {
+				return errors.Wrapf(err, "gather index issues for block %s", bdir)
+			}
 
-		// Ensure all input blocks are valid.
-		stats, err := block.GatherBlockHealthStats(jobLogger, bdir, meta.MinTime, meta.MaxTime, false)
+			if err := stats.CriticalErr(); err != nil {
+				return errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", bdir, meta.Compaction.Level, meta.Thanos.Labels)
+			}
+
+			if err := stats.OutOfOrderChunksErr(); err != nil {
+				return outOfOrderChunkError(errors.Wrapf(err, "blocks with out-of-order chunks are dropped from compaction:  %s", bdir), meta.ULID)
+			}
+
+			if err := stats.Issue347OutsideChunksErr(); err != nil {
+				return issue347Error(errors.Wrapf(err, "invalid, but reparable block %s", bdir), meta.ULID)
+			}
+
+			if err := stats.OutOfOrderLabelsErr(); err != nil {
+				return errors.Wrapf(err, "block id %s", meta.ULID)
+			}
+			return nil
+		})
 		if err != nil {
-			return errors.Wrapf(err, "gather index issues for block %s", bdir)
+			return false, nil, err
 		}
 
-		if err := stats.CriticalErr(); err != nil {
-			return errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", bdir, meta.Compaction.Level, meta.Thanos.Labels)
-		}
+		elapsed := time.Since(downloadBegin)
+		level.Info(jobLogger).Log("msg", "downloaded and verified blocks; compacting blocks", "blocks", len(blocksToCompactDirs), "plan", fmt.Sprintf("%v", blocksToCompactDirs), "duration", elapsed, "duration_ms", elapsed.Milliseconds())
 
-		if err := stats.OutOfOrderChunksErr(); err != nil {
-			return outOfOrderChunkError(errors.Wrapf(err, "blocks with out-of-order chunks are dropped from compaction:  %s", bdir), meta.ULID)
-		}
+		compactionBegin := time.Now()
 
-		if err := stats.Issue347OutsideChunksErr(); err != nil {
-			return issue347Error(errors.Wrapf(err, "invalid, but reparable block %s", bdir), meta.ULID)
+		if job.UseSplitting() {
+			compIDs, err = c.comp.CompactWithSplitting(subDir, blocksToCompactDirs, nil, uint64(job.SplittingShards()))
+		} else {
+			var compID ulid.ULID
+			compID, err = c.comp.Compact(subDir, blocksToCompactDirs, nil)
+			compIDs = append(compIDs, compID)
 		}
-
-		if err := stats.OutOfOrderLabelsErr(); err != nil {
-			return errors.Wrapf(err, "block id %s", meta.ULID)
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "compact blocks %v", blocksToCompactDirs)
 		}
-		return nil
-	})
-	if err != nil {
-		return false, nil, err
-	}
 
-	blocksToCompactDirs := make([]string, len(toCompact))
-	for ix, meta := range toCompact {
-		blocksToCompactDirs[ix] = filepath.Join(subDir, meta.ULID.String())
-	}
+		if !hasNonZeroULIDs(compIDs) {
+			// Prometheus compactor found that the compacted block would have no samples.
+			level.Info(jobLogger).Log("msg", "compacted block would have no samples, deleting source blocks", "blocks", fmt.Sprintf("%v", blocksToCompactDirs))
+			for _, meta := range toCompact {
+				if meta.Stats.NumSamples == 0 {
+					if err := deleteBlock(c.bkt, meta.ULID, filepath.Join(subDir, meta.ULID.String()), jobLogger, c.metrics.blocksMarkedForDeletion); err != nil {
+						level.Warn(jobLogger).Log("msg", "failed to mark for deletion an empty block found during compaction", "block", meta.ULID, "err", err)
+					}
+				}
+			}
+			// Even though this block was empty, there may be more work to do.
+			return true, nil, nil
+		}
 
-	elapsed := time.Since(downloadBegin)
-	level.Info(jobLogger).Log("msg", "downloaded and verified blocks; compacting blocks", "blocks", len(blocksToCompactDirs), "plan", fmt.Sprintf("%v", blocksToCompactDirs), "duration", elapsed, "duration_ms", elapsed.Milliseconds())
+		// The TSDB compaction doesn't support cancellation, so we check whether the job
+		// has been cancelled (e.g. because of timeout) once it's done.
+		if err := ctx.Err(); err != nil {
+			return false, nil, errors.Wrapf(err, "compact blocks %v", blocksToCompactDirs)
+		}
 
-	compactionBegin := time.Now()
+		// Safety check: the blocks resulting from splitting must cover exactly the time range of the source blocks.
+		if job.UseSplitting() {
+			if err := verifySplitBlocksTimeRange(subDir, toCompact, compIDs); err != nil {
+				return false, nil, errors.Wrapf(err, "split blocks %v", blocksToCompactDirs)
+			}
+		}
 
-	if job.UseSplitting() {
-		compIDs, err = c.comp.CompactWithSplitting(subDir, blocksToCompactDirs, nil, uint64(job.SplittingShards()))
-	} else {
-		var compID ulid.ULID
-		compID, err = c.comp.Compact(subDir, blocksToCompactDirs, nil)
-		compIDs = append(compIDs, compID)
-	}
-	if err != nil {
-		return false, nil, errors.Wrapf(err, "compact blocks %v", blocksToCompactDirs)
-	}
+		elapsed = time.Since(compactionBegin)
+		level.Info(jobLogger).Log("msg", "compacted blocks", "new", fmt.Sprintf("%v", compIDs), "blocks", fmt.Sprintf("%v", blocksToCompactDirs), "duration", elapsed, "duration_ms", elapsed.Milliseconds())
 
-	if !hasNonZeroULIDs(compIDs) {
-		// Prometheus compactor found that the compacted block would have no samples.
-		level.Info(jobLogger).Log("msg", "compacted block would have no samples, deleting source blocks", "blocks", fmt.Sprintf("%v", blocksToCompactDirs))
-		for _, meta := range toCompact {
-			if meta.Stats.NumSamples == 0 {
-				if err := deleteBlock(c.bkt, meta.ULID, filepath.Join(subDir, meta.ULID.String()), jobLogger, c.metrics.blocksMarkedForDeletion); err != nil {
-					level.Warn(jobLogger).Log("msg", "failed to mark for deletion an empty block found during compaction", "block", meta.ULID, "err", err)
-				}
-			}
+		// Record the compaction result, so that the job can resume from here if the compactor
+		// crashes before the compacted blocks are uploaded. Failing to write the checkpoint
+		// only means that the compaction would be done again, so it's not a fatal error.
+		if err := writeCompactionCheckpoint(subDir, toCompact, compIDs, nil); err != nil {
+			level.Warn(jobLogger).Log("msg", "failed to write compaction checkpoint", "err", err)
 		}
-		// Even though this block was empty, there may be more work to do.
-		return true, nil, nil
 	}
 
-	elapsed = time.Since(compactionBegin)
-	level.Info(jobLogger).Log("msg", "compacted blocks", "new", fmt.Sprintf("%v", compIDs), "blocks", fmt.Sprintf("%v", blocksToCompactDirs), "duration", elapsed, "duration_ms", elapsed.Milliseconds())
-
 	uploadBegin := time.Now()
 	uploadedBlocks := atomic.NewInt64(0)
+	sourceBlocks := summarizeSourceBlocks(toCompact)
+	originSource := summarizeOriginSource(toCompact)
+
+	// Keep track of the compacted blocks which have been uploaded, so that if only some of them
+	// fail to upload, the next run of the job doesn't have to upload the other ones again.
+	var (
+		uploadedMtx   sync.Mutex
+		uploaded      = make(map[ulid.ULID]struct{}, len(compIDs))
+		invalidResult = atomic.NewBool(false)
+	)
+	for _, id := range alreadyUploaded {
+		uploaded[id] = struct{}{}
+	}
 
 	blocksToUpload := convertCompactionResultToForEachJobs(compIDs, job.UseSplitting(), jobLogger)
 	err = concurrency.ForEachJob(ctx, len(blocksToUpload), c.blockSyncConcurrency, func(ctx context.Context, idx int) error {
 		blockToUpload := blocksToUpload[idx]
 
+		uploadedMtx.Lock()
+		_, ok := uploaded[blockToUpload.ulid]
+		uploadedMtx.Unlock()
+		if ok {
+			level.Info(jobLogger).Log("msg", "skipped upload of block already uploaded by a previous run of the job", "result_block", blockToUpload.ulid)
+			return nil
+		}
+
 		uploadedBlocks.Inc()
 
 		bdir := filepath.Join(subDir, blockToUpload.ulid.String())
@@ -396,21 +508,27 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 		}
 
 		newMeta, err := metadata.InjectThanos(jobLogger, bdir, metadata.Thanos{
-			Labels:       newLabels,
-			Downsample:   metadata.ThanosDownsample{Resolution: job.Resolution()},
-			Source:       metadata.CompactorSource,
-			SegmentFiles: block.GetSegmentFiles(bdir),
+			Labels:             newLabels,
+			Downsample:         metadata.ThanosDownsample{Resolution: job.Resolution()},
+			Source:             metadata.CompactorSource,
+			OriginSource:       originSource,
+			SegmentFiles:       block.GetSegmentFiles(bdir),
+			SourceBlocks:       sourceBlocks,
+			CompactorVersion:   version.Version,
+			CompactionStrategy: job.Strategy(),
 		}, nil)
 		if err != nil {
 			return errors.Wrapf(err, "failed to finalize the block %s", bdir)
 		}
 
-		if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil {
+		// The tombstones file may have already been removed if we're resuming from a checkpoint.
+		if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil && !os.IsNotExist(err) {
 			return errors.Wrap(err, "remove tombstones")
 		}
 
 		// Ensure the output block is valid.
 		if err := block.VerifyBlock(jobLogger, bdir, newMeta.MinTime, newMeta.MaxTime, false); err != nil {
+			invalidResult.Store(true)
 			return errors.Wrapf(err, "invalid result block %s", bdir)
 		}
 
@@ -419,15 +537,39 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 			return errors.Wrapf(err, "upload of %s failed", blockToUpload.ulid)
 		}
 
+		uploadedMtx.Lock()
+		uploaded[blockToUpload.ulid] = struct{}{}
+		uploadedMtx.Unlock()
+
 		elapsed := time.Since(begin)
 		level.Info(jobLogger).Log("msg", "uploaded block", "result_block", blockToUpload.ulid, "duration", elapsed, "duration_ms", elapsed.Milliseconds(), "external_labels", labels.FromMap(newLabels))
 		return nil
 	})
 	if err != nil {
+		// Commit the compacted blocks which have been successfully uploaded and keep the other ones
+		// on disk, so that the next run of the job only retries the upload of the failed ones instead
+		// of compacting the source blocks again. The source blocks are not marked for deletion until
+		// all the compacted blocks have been uploaded. There's no point in retrying the upload of an
+		// invalid block, so in that case the job starts over.
+		if len(uploaded) > 0 && !invalidResult.Load() {
+			uploadedIDs := make([]ulid.ULID, 0, len(uploaded))
+			for _, id := range compIDs {
+				if _, ok := uploaded[id]; ok {
+					uploadedIDs = append(uploadedIDs, id)
+				}
+			}
+
+			if cerr := writeCompactionCheckpoint(subDir, toCompact, compIDs, uploadedIDs); cerr != nil {
+				level.Warn(jobLogger).Log("msg", "failed to write compaction checkpoint", "err", cerr)
+			} else {
+				keepJobDir = true
+				level.Warn(jobLogger).Log("msg", "some compacted blocks failed to upload; the upload of the remaining blocks will be retried", "uploaded", fmt.Sprintf("%v", uploadedIDs))
+			}
+		}
 		return false, nil, err
 	}
 
-	elapsed = time.Since(uploadBegin)
+	elapsed := time.Since(uploadBegin)
 	level.Info(jobLogger).Log("msg", "uploaded all blocks", "blocks", uploadedBlocks, "duration", elapsed, "duration_ms", elapsed.Milliseconds())
 
 	// Mark for deletion the blocks we just compacted from the job and bucket so they do not get included
@@ -442,6 +584,125 @@ func (c *BucketCompactor) runCompactionJob(ctx context.Context, job *Job) (shoul
 	return true, compIDs, nil
 }
 
+const (
+	// compactionCheckpointDir is the directory, within the job working directory, where the compaction
+	// checkpoint is stored. It's a directory because plain files in the compaction working directory
+	// are not preserved across runs.
+	compactionCheckpointDir      = "checkpoint"
+	compactionCheckpointFilename = "checkpoint.json"
+
+	compactionCheckpointVersion1 = 1
+)
+
+// compactionCheckpoint records the result of a compaction job, so that if the compactor crashes after
+// the compaction but before the compacted blocks have been uploaded, the job can resume from the upload
+// instead of downloading and compacting the source blocks again.
+type compactionCheckpoint struct {
+	Version int `json:"version"`
+
+	// Sources are the IDs of the blocks that have been compacted.
+	Sources []ulid.ULID `json:"sources"`
+
+	// Results are the IDs of the compacted blocks, as returned by the compactor. Empty blocks
+	// are represented by the zero ULID.
+	Results []ulid.ULID `json:"results"`
+
+	// Uploaded are the IDs of the compacted blocks which have already been uploaded to the bucket,
+	// when a previous run of the job failed to upload only some of them.
+	Uploaded []ulid.ULID `json:"uploaded,omitempty"`
+}
+
+func writeCompactionCheckpoint(jobDir string, toCompact []*metadata.Meta, compIDs, uploaded []ulid.ULID) error {
+	checkpoint := compactionCheckpoint{
+		Version:  compactionCheckpointVersion1,
+		Sources:  make([]ulid.ULID, 0, len(toCompact)),
+		Results:  compIDs,
+		Uploaded: uploaded,
+	}
+	for _, meta := range toCompact {
+		checkpoint.Sources = append(checkpoint.Sources, meta.ULID)
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "encode compaction checkpoint")
+	}
+
+	dir := filepath.Join(jobDir, compactionCheckpointDir)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return errors.Wrap(err, "create compaction checkpoint dir")
+	}
+
+	// Write to a temporary file and rename it, so that a crash never leaves a partial checkpoint behind.
+	filename := filepath.Join(dir, compactionCheckpointFilename)
+	if err := os.WriteFile(filename+".tmp", data, 0640); err != nil {
+		return errors.Wrap(err, "write compaction checkpoint")
+	}
+	return errors.Wrap(os.Rename(filename+".tmp", filename), "rename compaction checkpoint")
+}
+
+// loadCompactionCheckpoint returns the compaction checkpoint stored in the job working directory,
+// or nil if there's none.
+func loadCompactionCheckpoint(jobDir string) (*compactionCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(jobDir, compactionCheckpointDir, compactionCheckpointFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := &compactionCheckpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, err
+	}
+	if checkpoint.Version != compactionCheckpointVersion1 {
+		return nil, errors.Errorf("unexpected compaction checkpoint version %d", checkpoint.Version)
+	}
+	return checkpoint, nil
+}
+
+// readCompactionCheckpoint returns the compacted block IDs recorded in the job working directory, and the ones
+// among them which have already been uploaded, if the checkpoint exists, has been written for the same source
+// blocks and all the compacted blocks are still on disk.
+func readCompactionCheckpoint(logger log.Logger, jobDir string, toCompact []*metadata.Meta) ([]ulid.ULID, []ulid.ULID, bool) {
+	checkpoint, err := loadCompactionCheckpoint(jobDir)
+	if err != nil {
+		level.Warn(logger).Log("msg", "failed to read compaction checkpoint, ignoring it", "err", err)
+		return nil, nil, false
+	}
+	if checkpoint == nil || !hasNonZeroULIDs(checkpoint.Results) {
+		return nil, nil, false
+	}
+
+	if len(checkpoint.Sources) != len(toCompact) {
+		level.Info(logger).Log("msg", "compaction checkpoint was written for different source blocks, ignoring it", "sources", fmt.Sprintf("%v", checkpoint.Sources))
+		return nil, nil, false
+	}
+	sources := make(map[ulid.ULID]struct{}, len(checkpoint.Sources))
+	for _, id := range checkpoint.Sources {
+		sources[id] = struct{}{}
+	}
+	for _, meta := range toCompact {
+		if _, ok := sources[meta.ULID]; !ok {
+			level.Info(logger).Log("msg", "compaction checkpoint was written for different source blocks, ignoring it", "sources", fmt.Sprintf("%v", checkpoint.Sources))
+			return nil, nil, false
+		}
+	}
+
+	for _, id := range checkpoint.Results {
+		if id == (ulid.ULID{}) {
+			continue
+		}
+		if _, err := metadata.ReadFromDir(filepath.Join(jobDir, id.String())); err != nil {
+			level.Warn(logger).Log("msg", "compacted block referenced by the compaction checkpoint is not readable, ignoring the checkpoint", "block", id, "err", err)
+			return nil, nil, false
+		}
+	}
+
+	return checkpoint.Results, checkpoint.Uploaded, true
+}
+
 // convertCompactionResultToForEachJobs filters out empty ULIDs.
 // When handling result of split compactions, shard index is index in the slice returned by compaction.
 func convertCompactionResultToForEachJobs(compactedBlocks []ulid.ULID, splitJob bool, jobLogger log.Logger) []ulidWithShardIndex {
@@ -509,6 +770,27 @@ func IsOutOfOrderChunkError(err error) bool {
 	return ok
 }
 
+// CompactionJobTimeoutError is returned when a compaction job has been cancelled because it
+// ran longer than the configured max job duration.
+type CompactionJobTimeoutError struct {
+	err         error
+	maxDuration time.Duration
+}
+
+func (e CompactionJobTimeoutError) Error() string {
+	return fmt.Sprintf("compaction job cancelled because it exceeded the max duration of %s: %s", e.maxDuration, e.err)
+}
+
+func compactionJobTimeoutError(err error, maxDuration time.Duration) CompactionJobTimeoutError {
+	return CompactionJobTimeoutError{err: err, maxDuration: maxDuration}
+}
+
+// IsCompactionJobTimeoutError returns true if the base error is a CompactionJobTimeoutError.
+func IsCompactionJobTimeoutError(err error) bool {
+	_, ok := errors.Cause(err).(CompactionJobTimeoutError)
+	return ok
+}
+
 // RepairIssue347 repairs the https://github.com/prometheus/tsdb/issues/347 issue when having issue347Error.
 func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket, blocksMarkedForDeletion prometheus.Counter, issue347Err error) error {
 	ie, ok := errors.Cause(issue347Err).(Issue347Error)
@@ -591,6 +873,7 @@ type BucketCompactorMetrics struct {
 	blocksMarkedForDeletion      prometheus.Counter
 	blocksMarkedForNoCompact     prometheus.Counter
 	blocksMaxTimeDelta           prometheus.Histogram
+	queueDepth                   *prometheus.GaugeVec
 }
 
 // NewBucketCompactorMetrics makes a new BucketCompactorMetrics.
@@ -623,6 +906,10 @@ func NewBucketCompactorMetrics(blocksMarkedForDeletion prometheus.Counter, reg p
 			Help:    "Difference between now and the max time of a block being compacted in seconds.",
 			Buckets: prometheus.LinearBuckets(86400, 43200, 8), // 1 to 5 days, in 12 hour intervals
 		}),
+		queueDepth: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_compactor_queue_depth",
+			Help: "Number of compaction jobs planned for a tenant and not started yet.",
+		}, []string{"user"}),
 	}
 }
 
@@ -647,7 +934,9 @@ type BucketCompactor struct {
 	ownJob                         ownCompactionJobFunc
 	sortJobs                       JobsOrderFunc
 	waitPeriod                     time.Duration
+	waitPeriodMaxLevel             int
 	blockSyncConcurrency           int
+	maxJobDuration                 time.Duration
 	metrics                        *BucketCompactorMetrics
 }
 
@@ -665,7 +954,9 @@ func NewBucketCompactor(
 	ownJob ownCompactionJobFunc,
 	sortJobs JobsOrderFunc,
 	waitPeriod time.Duration,
+	waitPeriodMaxLevel int,
 	blockSyncConcurrency int,
+	maxJobDuration time.Duration,
 	metrics *BucketCompactorMetrics,
 ) (*BucketCompactor, error) {
 	if concurrency <= 0 {
@@ -684,7 +975,9 @@ func NewBucketCompactor(
 		ownJob:                         ownJob,
 		sortJobs:                       sortJobs,
 		waitPeriod:                     waitPeriod,
+		waitPeriodMaxLevel:             waitPeriodMaxLevel,
 		blockSyncConcurrency:           blockSyncConcurrency,
+		maxJobDuration:                 maxJobDuration,
 		metrics:                        metrics,
 	}, nil
 }
@@ -728,6 +1021,8 @@ func (c *BucketCompactor) Compact(ctx context.Context, maxCompactionTime time.Du
 			go func() {
 				defer wg.Done()
 				for g := range jobChan {
+					c.metrics.queueDepth.WithLabelValues(g.UserID()).Dec()
+
 					// Ensure the job is still owned by the current compactor instance.
 					// If not, we shouldn't run it because another compactor instance may already
 					// process it (or will do it soon).
@@ -759,6 +1054,13 @@ func (c *BucketCompactor) Compact(ctx context.Context, maxCompactionTime time.Du
 					// At this point the compaction has failed.
 					c.metrics.groupCompactionRunsFailed.Inc()
 
+					// A job which ran for too long has already been cancelled and cleaned up,
+					// so we move on with the other jobs instead of failing the whole compaction.
+					if IsCompactionJobTimeoutError(err) {
+						level.Warn(c.logger).Log("msg", "compaction job timed out", "groupKey", g.Key(), "err", err)
+						continue
+					}
+
 					if IsIssue347Error(err) {
 						if err := RepairIssue347(workCtx, c.logger, c.bkt, c.sy.metrics.blocksMarkedForDeletion, err); err == nil {
 							mtx.Lock()
@@ -833,6 +1135,17 @@ func (c *BucketCompactor) Compact(ctx context.Context, maxCompactionTime time.Du
 			for _, grID := range gr.IDs() {
 				ignoreDirs = append(ignoreDirs, filepath.Join(gr.Key(), grID.String()))
 			}
+
+			// Keep the compacted blocks of a job which was interrupted before uploading them,
+			// so that the job can resume from its checkpoint.
+			if checkpoint, err := loadCompactionCheckpoint(filepath.Join(c.compactDir, gr.Key())); err == nil && checkpoint != nil {
+				ignoreDirs = append(ignoreDirs, filepath.Join(gr.Key(), compactionCheckpointDir))
+				for _, id := range checkpoint.Results {
+					if id != (ulid.ULID{}) {
+						ignoreDirs = append(ignoreDirs, filepath.Join(gr.Key(), id.String()))
+					}
+				}
+			}
 		}
 
 		if err := runutil.DeleteAll(c.compactDir, ignoreDirs...); err != nil {
@@ -841,6 +1154,14 @@ func (c *BucketCompactor) Compact(ctx context.Context, maxCompactionTime time.Du
 
 		level.Info(c.logger).Log("msg", "start of compactions")
 
+		queued := map[string]int{}
+		for _, g := range jobs {
+			queued[g.UserID()]++
+		}
+		for userID, count := range queued {
+			c.metrics.queueDepth.WithLabelValues(userID).Set(float64(count))
+		}
+
 		maxCompactionTimeReached := false
 		// Send all jobs found during this pass to the compaction workers.
 		var jobErrs multierror.MultiError
@@ -911,7 +1232,7 @@ func (c *BucketCompactor) filterOwnJobs(jobs []*Job) ([]*Job, error) {
 // filterJobsByWaitPeriod filters out jobs for which the configured wait period hasn't been honored yet.
 func (c *BucketCompactor) filterJobsByWaitPeriod(ctx context.Context, jobs []*Job) []*Job {
 	for i := 0; i < len(jobs); {
-		if elapsed, notElapsedBlock, err := jobWaitPeriodElapsed(ctx, jobs[i], c.waitPeriod, c.bkt); err != nil {
+		if elapsed, notElapsedBlock, err := jobWaitPeriodElapsed(ctx, jobs[i], c.waitPeriod, c.waitPeriodMaxLevel, c.bkt); err != nil {
 			level.Warn(c.logger).Log("msg", "not enforcing compaction wait period because the check if compaction job contains recently uploaded blocks has failed", "groupKey", jobs[i].Key(), "err", err)
 
 			// Keep the job.
@@ -994,6 +1315,53 @@ func hasNonZeroULIDs(ids []ulid.ULID) bool {
 	return false
 }
 
+// verifySplitBlocksTimeRange checks that the union of the time ranges of the blocks resulting from splitting,
+// stored in jobDir, is exactly the time range covered by the source blocks. Empty results are ignored.
+func verifySplitBlocksTimeRange(jobDir string, sources []*metadata.Meta, compIDs []ulid.ULID) error {
+	expectedMinTime, expectedMaxTime := sources[0].MinTime, sources[0].MaxTime
+	for _, meta := range sources[1:] {
+		if meta.MinTime < expectedMinTime {
+			expectedMinTime = meta.MinTime
+		}
+		if meta.MaxTime > expectedMaxTime {
+			expectedMaxTime = meta.MaxTime
+		}
+	}
+
+	var splitMetas []*metadata.Meta
+	for _, id := range compIDs {
+		if id == (ulid.ULID{}) {
+			continue
+		}
+
+		meta, err := metadata.ReadFromDir(filepath.Join(jobDir, id.String()))
+		if err != nil {
+			return errors.Wrapf(err, "read meta of split block %s", id)
+		}
+		splitMetas = append(splitMetas, meta)
+	}
+
+	if len(splitMetas) == 0 {
+		return nil
+	}
+
+	actualMinTime, actualMaxTime := splitMetas[0].MinTime, splitMetas[0].MaxTime
+	for _, meta := range splitMetas[1:] {
+		if meta.MinTime < actualMinTime {
+			actualMinTime = meta.MinTime
+		}
+		if meta.MaxTime > actualMaxTime {
+			actualMaxTime = meta.MaxTime
+		}
+	}
+
+	if actualMinTime != expectedMinTime || actualMaxTime != expectedMaxTime {
+		return errors.Errorf("split blocks cover the time range %d:%d while the source blocks cover %d:%d", actualMinTime, actualMaxTime, expectedMinTime, expectedMaxTime)
+	}
+
+	return nil
+}
+
 // ExcludeMarkedForDeletionFilter is a filter that filters out the blocks that are marked for deletion.
 // Compared to IgnoreDeletionMarkFilter filter from Thanos, this implementation doesn't use any deletion delay,
 // and only uses marker files under bucketindex.MarkersPathname.
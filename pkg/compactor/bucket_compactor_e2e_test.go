@@ -16,7 +16,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -34,16 +36,20 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/index"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/objstore/providers/filesystem"
+	"go.uber.org/atomic"
 	"golang.org/x/exp/slices"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/thanos-io/objstore"
 
+	"github.com/grafana/mimir/pkg/storage/bucket"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
+	"github.com/grafana/mimir/pkg/util/version"
 )
 
 func TestSyncer_GarbageCollect_e2e(t *testing.T) {
@@ -123,7 +129,7 @@ func TestSyncer_GarbageCollect_e2e(t *testing.T) {
 		}
 
 		duplicateBlocksFilter := NewShardAwareDeduplicateFilter()
-		metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", nil, []block.MetadataFilter{
+		metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", 0, nil, []block.MetadataFilter{
 			duplicateBlocksFilter,
 		})
 		require.NoError(t, err)
@@ -168,7 +174,7 @@ func TestSyncer_GarbageCollect_e2e(t *testing.T) {
 		require.NoError(t, sy.GarbageCollect(ctx))
 
 		// Only the level 3 block, the last source block in both resolutions should be left.
-		grouper := NewSplitAndMergeGrouper("user-1", []int64{2 * time.Hour.Milliseconds()}, 0, 0, log.NewNopLogger())
+		grouper := NewSplitAndMergeGrouper("user-1", []int64{2 * time.Hour.Milliseconds()}, 0, 0, false, false, 0, 0, log.NewNopLogger())
 		groups, err := grouper.Groups(sy.Metas())
 		require.NoError(t, err)
 
@@ -231,7 +237,7 @@ func TestGroupCompactE2E(t *testing.T) {
 		ignoreDeletionMarkFilter := NewExcludeMarkedForDeletionFilter(objstore.WithNoopInstr(bkt))
 		duplicateBlocksFilter := NewShardAwareDeduplicateFilter()
 		noCompactMarkerFilter := NewNoCompactionMarkFilter(objstore.WithNoopInstr(bkt), true)
-		metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", nil, []block.MetadataFilter{
+		metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", 0, nil, []block.MetadataFilter{
 			ignoreDeletionMarkFilter,
 			duplicateBlocksFilter,
 			noCompactMarkerFilter,
@@ -246,9 +252,9 @@ func TestGroupCompactE2E(t *testing.T) {
 		require.NoError(t, err)
 
 		planner := NewSplitAndMergePlanner([]int64{1000, 3000})
-		grouper := NewSplitAndMergeGrouper("user-1", []int64{1000, 3000}, 0, 0, logger)
+		grouper := NewSplitAndMergeGrouper("user-1", []int64{1000, 3000}, 0, 0, false, false, 0, 0, logger)
 		metrics := NewBucketCompactorMetrics(blocksMarkedForDeletion, prometheus.NewPedanticRegistry())
-		bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 2, true, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 4, metrics)
+		bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, dir, bkt, 2, true, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 4, 0, metrics)
 		require.NoError(t, err)
 
 		// Compaction on empty should not fail.
@@ -409,6 +415,9 @@ func TestGroupCompactE2E(t *testing.T) {
 			assert.Equal(t, uint64(2*4*100), meta.Stats.NumSamples) // Only 2 times 4*100 because one block was empty.
 			assert.Equal(t, 2, meta.Compaction.Level)
 			assert.Equal(t, []ulid.ULID{metas[0].ULID, metas[1].ULID, metas[2].ULID}, meta.Compaction.Sources)
+			assert.Equal(t, &metadata.SourceBlocks{Count: 3, MinLevel: 1, MaxLevel: 1}, meta.Thanos.SourceBlocks)
+			assert.Equal(t, metadata.TestSource, meta.Thanos.OriginSource)
+			assert.Equal(t, version.Version, meta.Thanos.CompactorVersion)
 
 			// Check thanos meta.
 			assert.True(t, labels.Equal(extLabels, labels.FromMap(meta.Thanos.Labels)), "ext labels does not match")
@@ -425,6 +434,8 @@ func TestGroupCompactE2E(t *testing.T) {
 			assert.Equal(t, uint64(2*4*100-100), meta.Stats.NumSamples)
 			assert.Equal(t, 2, meta.Compaction.Level)
 			assert.Equal(t, []ulid.ULID{metas[6].ULID, metas[7].ULID}, meta.Compaction.Sources)
+			assert.Equal(t, &metadata.SourceBlocks{Count: 2, MinLevel: 1, MaxLevel: 1}, meta.Thanos.SourceBlocks)
+			assert.Equal(t, metadata.TestSource, meta.Thanos.OriginSource)
 
 			// Check thanos meta.
 			assert.True(t, labels.Equal(extLabels2, labels.FromMap(meta.Thanos.Labels)), "ext labels does not match")
@@ -434,6 +445,539 @@ func TestGroupCompactE2E(t *testing.T) {
 	})
 }
 
+func TestBucketCompactor_ResumeFromCheckpoint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	extLabels := labels.FromStrings("e1", "1")
+
+	setup := func(t *testing.T) (objstore.Bucket, *Job, string, []*metadata.Meta) {
+		bkt := objstore.NewInMemBucket()
+		metas := createAndUpload(t, bkt, []blockgenSpec{
+			{
+				numSamples: 100, mint: 0, maxt: 1000, extLset: extLabels,
+				series: []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")},
+			},
+			{
+				numSamples: 100, mint: 1000, maxt: 2000, extLset: extLabels,
+				series: []labels.Labels{labels.FromStrings("a", "2"), labels.FromStrings("a", "3")},
+			},
+		}, nil)
+
+		job := NewJob("user-1", "0@12345", extLabels, 0, false, 0, "", "")
+		for _, meta := range metas {
+			require.NoError(t, job.AppendMeta(meta))
+		}
+
+		compactDir := t.TempDir()
+		return bkt, job, compactDir, metas
+	}
+
+	newBucketCompactor := func(t *testing.T, bkt objstore.Bucket, comp Compactor, compactDir string, metas []*metadata.Meta) *BucketCompactor {
+		planner := &tsdbPlannerMock{}
+		planner.On("Plan", mock.Anything, mock.Anything).Return(metas, nil)
+
+		metrics := NewBucketCompactorMetrics(promauto.With(nil).NewCounter(prometheus.CounterOpts{}), nil)
+		bComp, err := NewBucketCompactor(logger, nil, nil, planner, comp, compactDir, bkt, 1, false, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 4, 0, metrics)
+		require.NoError(t, err)
+		return bComp
+	}
+
+	t.Run("should resume from the upload after a crash following the compaction", func(t *testing.T) {
+		bkt, job, compactDir, metas := setup(t)
+		jobDir := filepath.Join(compactDir, job.Key())
+
+		// Simulate a previous run of the job which compacted the source blocks and then
+		// crashed before uploading the compacted block.
+		var sourceDirs []string
+		for _, meta := range metas {
+			bdir := filepath.Join(jobDir, meta.ULID.String())
+			require.NoError(t, block.Download(ctx, logger, bkt, meta.ULID, bdir))
+			sourceDirs = append(sourceDirs, bdir)
+		}
+
+		tsdbComp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, nil, true)
+		require.NoError(t, err)
+		compID, err := tsdbComp.Compact(jobDir, sourceDirs, nil)
+		require.NoError(t, err)
+		require.NoError(t, writeCompactionCheckpoint(jobDir, metas, []ulid.ULID{compID}, nil))
+
+		// The source blocks are deleted from the job directory on restart, while the compacted ones are kept.
+		for _, dir := range sourceDirs {
+			require.NoError(t, os.RemoveAll(dir))
+		}
+
+		// The compaction must not run again.
+		comp := &tsdbCompactorMock{}
+		bComp := newBucketCompactor(t, bkt, comp, compactDir, metas)
+
+		shouldRerun, compIDs, err := bComp.runCompactionJob(ctx, job)
+		require.NoError(t, err)
+		assert.True(t, shouldRerun)
+		assert.Equal(t, []ulid.ULID{compID}, compIDs)
+		comp.AssertNotCalled(t, "Compact", mock.Anything, mock.Anything, mock.Anything)
+
+		// The compacted block has been uploaded and finalized.
+		r, err := bkt.Get(ctx, path.Join(compID.String(), metadata.MetaFilename))
+		require.NoError(t, err)
+		meta, err := metadata.Read(r)
+		require.NoError(t, err)
+		assert.Equal(t, extLabels.Map(), meta.Thanos.Labels)
+		assert.Equal(t, metadata.CompactorSource, meta.Thanos.Source)
+		assert.Equal(t, uint64(3), meta.Stats.NumSeries)
+		assert.ElementsMatch(t, []ulid.ULID{metas[0].ULID, metas[1].ULID}, meta.Compaction.Sources)
+		assert.Equal(t, &metadata.SourceBlocks{Count: 2, MinLevel: 1, MaxLevel: 1}, meta.Thanos.SourceBlocks)
+
+		// The source blocks have been marked for deletion.
+		for _, meta := range metas {
+			exists, err := bkt.Exists(ctx, path.Join(meta.ULID.String(), metadata.DeletionMarkFilename))
+			require.NoError(t, err)
+			assert.True(t, exists)
+		}
+	})
+
+	t.Run("should ignore a checkpoint written for different source blocks", func(t *testing.T) {
+		bkt, job, compactDir, metas := setup(t)
+		jobDir := filepath.Join(compactDir, job.Key())
+
+		staleID := ulid.MustNew(1, nil)
+		require.NoError(t, writeCompactionCheckpoint(jobDir, metas[:1], []ulid.ULID{staleID}, nil))
+
+		tsdbComp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, nil, true)
+		require.NoError(t, err)
+		bComp := newBucketCompactor(t, bkt, tsdbComp, compactDir, metas)
+
+		_, compIDs, err := bComp.runCompactionJob(ctx, job)
+		require.NoError(t, err)
+		require.Len(t, compIDs, 1)
+		assert.NotEqual(t, staleID, compIDs[0])
+
+		exists, err := bkt.Exists(ctx, path.Join(compIDs[0].String(), metadata.MetaFilename))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+}
+
+// splitResultsRecorder records the blocks produced by the split compactions run by the wrapped compactor.
+type splitResultsRecorder struct {
+	Compactor
+
+	mtx     sync.Mutex
+	results []ulid.ULID
+}
+
+func (c *splitResultsRecorder) CompactWithSplitting(dest string, dirs []string, open []*tsdb.Block, shardCount uint64) ([]ulid.ULID, error) {
+	results, err := c.Compactor.CompactWithSplitting(dest, dirs, open, shardCount)
+
+	c.mtx.Lock()
+	c.results = results
+	c.mtx.Unlock()
+
+	return results, err
+}
+
+func (c *splitResultsRecorder) Results() []ulid.ULID {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.results
+}
+
+func TestBucketCompactor_ShouldRetryOnlyTheFailedUploadsOfSplitCompaction(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	extLabels := labels.FromStrings("e1", "1")
+
+	var series []labels.Labels
+	for i := 0; i < 10; i++ {
+		series = append(series, labels.FromStrings("a", strconv.Itoa(i)))
+	}
+
+	inmem := objstore.NewInMemBucket()
+	metas := createAndUpload(t, inmem, []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLabels, series: series},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLabels, series: series},
+	}, nil)
+
+	job := NewJob("user-1", "0@12345", extLabels, 0, true, 2, "", "")
+	for _, meta := range metas {
+		require.NoError(t, job.AppendMeta(meta))
+	}
+
+	tsdbComp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, nil, true)
+	require.NoError(t, err)
+	recorder := &splitResultsRecorder{Compactor: tsdbComp}
+
+	// Fail the upload of the second shard's block, and record the uploads of all the blocks.
+	failSecondShard := atomic.NewBool(true)
+	uploadsMtx := sync.Mutex{}
+	uploads := map[string]int{}
+	bkt := &bucket.ErrorInjectedBucketClient{Bucket: inmem, Injector: func(op bucket.Operation, name string) error {
+		if op != bucket.OpUpload {
+			return nil
+		}
+
+		uploadsMtx.Lock()
+		uploads[path.Dir(name)]++
+		uploadsMtx.Unlock()
+
+		if results := recorder.Results(); failSecondShard.Load() && len(results) == 2 && strings.HasPrefix(name, results[1].String()+"/") {
+			return errors.New("injected upload error")
+		}
+		return nil
+	}}
+
+	planner := &tsdbPlannerMock{}
+	planner.On("Plan", mock.Anything, mock.Anything).Return(metas, nil)
+
+	// Upload the compacted blocks one at a time, so that the upload of the first shard's block
+	// is not cancelled by the failure of the second one.
+	compactDir := t.TempDir()
+	metrics := NewBucketCompactorMetrics(promauto.With(nil).NewCounter(prometheus.CounterOpts{}), nil)
+	bComp, err := NewBucketCompactor(logger, nil, nil, planner, recorder, compactDir, bkt, 1, false, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 1, 0, metrics)
+	require.NoError(t, err)
+
+	_, _, err = bComp.runCompactionJob(ctx, job)
+	require.Error(t, err)
+
+	results := recorder.Results()
+	require.Len(t, results, 2)
+	require.NotEqual(t, ulid.ULID{}, results[0])
+	require.NotEqual(t, ulid.ULID{}, results[1])
+
+	// The block of the first shard has been committed, while the one of the second shard hasn't.
+	exists, err := inmem.Exists(ctx, path.Join(results[0].String(), metadata.MetaFilename))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = inmem.Exists(ctx, path.Join(results[1].String(), metadata.MetaFilename))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// The source blocks are not marked for deletion until all the compacted blocks have been uploaded.
+	for _, meta := range metas {
+		exists, err := inmem.Exists(ctx, path.Join(meta.ULID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+
+	// The checkpoint records the uploaded block, to retry only the failed one.
+	checkpoint, err := loadCompactionCheckpoint(filepath.Join(compactDir, job.Key()))
+	require.NoError(t, err)
+	require.NotNil(t, checkpoint)
+	assert.Equal(t, results, checkpoint.Results)
+	assert.Equal(t, []ulid.ULID{results[0]}, checkpoint.Uploaded)
+
+	// Retry the job once the bucket is healthy again. The source blocks must not be compacted again.
+	failSecondShard.Store(false)
+	uploadsMtx.Lock()
+	firstShardUploads := uploads[results[0].String()]
+	uploadsMtx.Unlock()
+
+	comp := &tsdbCompactorMock{}
+	bComp, err = NewBucketCompactor(logger, nil, nil, planner, comp, compactDir, bkt, 1, false, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 1, 0, metrics)
+	require.NoError(t, err)
+
+	shouldRerun, compIDs, err := bComp.runCompactionJob(ctx, job)
+	require.NoError(t, err)
+	assert.True(t, shouldRerun)
+	assert.Equal(t, results, compIDs)
+	comp.AssertNotCalled(t, "CompactWithSplitting", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Only the block of the second shard has been uploaded.
+	uploadsMtx.Lock()
+	assert.Equal(t, firstShardUploads, uploads[results[0].String()])
+	uploadsMtx.Unlock()
+
+	exists, err = inmem.Exists(ctx, path.Join(results[1].String(), metadata.MetaFilename))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	for _, meta := range metas {
+		exists, err := inmem.Exists(ctx, path.Join(meta.ULID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+
+	// The job working directory has been removed once the job succeeded.
+	_, err = os.Stat(filepath.Join(compactDir, job.Key()))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBucketCompactor_MaxJobDuration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	extLabels := labels.FromStrings("e1", "1")
+
+	bkt := objstore.NewInMemBucket()
+	metas := createAndUpload(t, bkt, []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLabels, series: []labels.Labels{labels.FromStrings("a", "1")}},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLabels, series: []labels.Labels{labels.FromStrings("a", "2")}},
+	}, nil)
+
+	job := NewJob("user-1", "0@12345", extLabels, 0, false, 0, "", "")
+	for _, meta := range metas {
+		require.NoError(t, job.AppendMeta(meta))
+	}
+
+	planner := &tsdbPlannerMock{}
+	planner.On("Plan", mock.Anything, mock.Anything).Return(metas, nil)
+
+	// Simulate a compaction running longer than the max job duration.
+	compID := ulid.MustNew(ulid.Now(), nil)
+	comp := &tsdbCompactorMock{}
+	comp.On("Compact", mock.Anything, mock.Anything, mock.Anything).After(time.Second).Return(compID, nil)
+
+	compactDir := t.TempDir()
+	metrics := NewBucketCompactorMetrics(promauto.With(nil).NewCounter(prometheus.CounterOpts{}), nil)
+	bComp, err := NewBucketCompactor(logger, nil, nil, planner, comp, compactDir, bkt, 1, false, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 4, 100*time.Millisecond, metrics)
+	require.NoError(t, err)
+
+	_, _, err = bComp.runCompactionJob(ctx, job)
+	require.Error(t, err)
+	assert.True(t, IsCompactionJobTimeoutError(err))
+
+	// The job directory has been cleaned up.
+	_, err = os.Stat(filepath.Join(compactDir, job.Key()))
+	assert.True(t, os.IsNotExist(err))
+
+	// Nothing has been uploaded and the source blocks have not been marked for deletion.
+	exists, err := bkt.Exists(ctx, path.Join(compID.String(), metadata.MetaFilename))
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	for _, meta := range metas {
+		exists, err := bkt.Exists(ctx, path.Join(meta.ULID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+}
+
+func TestBucketCompactor_ShouldFailIfSplitBlocksDoNotCoverTheSourceTimeRange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	extLabels := labels.FromStrings("e1", "1")
+
+	bkt := objstore.NewInMemBucket()
+	metas := createAndUpload(t, bkt, []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLabels, series: []labels.Labels{labels.FromStrings("a", "1")}},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLabels, series: []labels.Labels{labels.FromStrings("a", "2")}},
+	}, nil)
+
+	job := NewJob("user-1", "0@12345", extLabels, 0, true, 2, "", "")
+	for _, meta := range metas {
+		require.NoError(t, job.AppendMeta(meta))
+	}
+
+	planner := &tsdbPlannerMock{}
+	planner.On("Plan", mock.Anything, mock.Anything).Return(metas, nil)
+
+	// Simulate a buggy splitting, whose output blocks don't cover the end of the source time range.
+	splitIDs := []ulid.ULID{ulid.MustNew(1, nil), ulid.MustNew(2, nil)}
+	comp := &tsdbCompactorMock{}
+	comp.On("CompactWithSplitting", mock.Anything, mock.Anything, mock.Anything, uint64(2)).Run(func(args mock.Arguments) {
+		dest := args.Get(0).(string)
+		for _, id := range splitIDs {
+			meta := metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: 0, MaxTime: 1500, Version: metadata.TSDBVersion1}}
+			require.NoError(t, os.MkdirAll(filepath.Join(dest, id.String()), 0750))
+			require.NoError(t, meta.WriteToDir(logger, filepath.Join(dest, id.String())))
+		}
+	}).Return(splitIDs, nil)
+
+	metrics := NewBucketCompactorMetrics(promauto.With(nil).NewCounter(prometheus.CounterOpts{}), nil)
+	bComp, err := NewBucketCompactor(logger, nil, nil, planner, comp, t.TempDir(), bkt, 1, false, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 4, 0, metrics)
+	require.NoError(t, err)
+
+	_, _, err = bComp.runCompactionJob(ctx, job)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "split blocks cover the time range 0:1500 while the source blocks cover 0:2000")
+
+	// Nothing has been uploaded and the source blocks have not been marked for deletion.
+	for _, id := range splitIDs {
+		exists, err := bkt.Exists(ctx, path.Join(id.String(), metadata.MetaFilename))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+
+	for _, meta := range metas {
+		exists, err := bkt.Exists(ctx, path.Join(meta.ULID.String(), metadata.DeletionMarkFilename))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	}
+}
+
+// sizeBalancedGrouper is a Grouper packing blocks with the same labels and resolution into jobs
+// whose total number of samples doesn't exceed maxSamples. It's used to test that the BucketCompactor
+// works with grouping strategies other than the split-and-merge one.
+type sizeBalancedGrouper struct {
+	userID     string
+	maxSamples uint64
+}
+
+func (g *sizeBalancedGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) ([]*Job, error) {
+	byKey := map[string][]*metadata.Meta{}
+	for _, m := range blocks {
+		key := DefaultGroupKey(m.Thanos)
+		byKey[key] = append(byKey[key], m)
+	}
+
+	var jobs []*Job
+	for key, metas := range byKey {
+		sort.Slice(metas, func(i, j int) bool { return metas[i].MinTime < metas[j].MinTime })
+
+		var (
+			job     *Job
+			samples uint64
+		)
+		flush := func() {
+			if job != nil && len(job.Metas()) > 1 {
+				jobs = append(jobs, job)
+			}
+			job, samples = nil, 0
+		}
+
+		for _, m := range metas {
+			if job != nil && samples+m.Stats.NumSamples > g.maxSamples {
+				flush()
+			}
+			if job == nil {
+				job = NewJob(g.userID, fmt.Sprintf("%s-%d", key, len(jobs)), labels.FromMap(m.Thanos.Labels), m.Thanos.Downsample.Resolution, false, 0, "", "")
+			}
+			if err := job.AppendMeta(m); err != nil {
+				return nil, err
+			}
+			samples += m.Stats.NumSamples
+		}
+		flush()
+	}
+
+	return jobs, nil
+}
+
+func TestBucketCompactor_CustomGrouper(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	extLabels := labels.FromStrings("e1", "1")
+	series := []labels.Labels{labels.FromStrings("a", "1"), labels.FromStrings("a", "2")}
+
+	bkt := bucketindex.BucketWithGlobalMarkers(objstore.NewInMemBucket())
+	metas := createAndUpload(t, bkt, []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 750, extLset: extLabels, series: series},
+		{numSamples: 100, mint: 750, maxt: 1500, extLset: extLabels, series: series},
+		{numSamples: 100, mint: 1500, maxt: 2250, extLset: extLabels, series: series},
+		{numSamples: 100, mint: 2250, maxt: 3000, extLset: extLabels, series: series},
+	}, nil)
+
+	ignoreDeletionMarkFilter := NewExcludeMarkedForDeletionFilter(objstore.WithNoopInstr(bkt))
+	duplicateBlocksFilter := NewShardAwareDeduplicateFilter()
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", 0, nil, []block.MetadataFilter{
+		ignoreDeletionMarkFilter,
+		duplicateBlocksFilter,
+	})
+	require.NoError(t, err)
+
+	blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, duplicateBlocksFilter, ignoreDeletionMarkFilter, blocksMarkedForDeletion)
+	require.NoError(t, err)
+
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000, 3000}, nil, nil, true)
+	require.NoError(t, err)
+
+	// Each job gets at most two of the source blocks. The compacted blocks are too big to be
+	// grouped together again, so compaction stops after the first pass.
+	grouper := &sizeBalancedGrouper{userID: "user-1", maxSamples: 2 * metas[0].Stats.NumSamples}
+	planner := NewSplitAndMergePlanner([]int64{1000, 3000})
+	metrics := NewBucketCompactorMetrics(blocksMarkedForDeletion, prometheus.NewPedanticRegistry())
+	bComp, err := NewBucketCompactor(logger, sy, grouper, planner, comp, t.TempDir(), bkt, 2, true, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 4, 0, metrics)
+	require.NoError(t, err)
+
+	require.NoError(t, bComp.Compact(ctx, 0))
+	assert.Equal(t, 2.0, promtest.ToFloat64(metrics.groupCompactions))
+	assert.Equal(t, 4.0, promtest.ToFloat64(sy.metrics.blocksMarkedForDeletion))
+
+	// Read back the blocks which have not been marked for deletion.
+	fetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", 0, nil, []block.MetadataFilter{
+		NewExcludeMarkedForDeletionFilter(objstore.WithNoopInstr(bkt)),
+	})
+	require.NoError(t, err)
+
+	compacted, _, err := fetcher.Fetch(ctx)
+	require.NoError(t, err)
+	require.Len(t, compacted, 2)
+
+	var actualSources [][]ulid.ULID
+	for _, m := range compacted {
+		actualSources = append(actualSources, m.Compaction.Sources)
+	}
+	sort.Slice(actualSources, func(i, j int) bool { return actualSources[i][0].Compare(actualSources[j][0]) < 0 })
+
+	expectedSources := [][]ulid.ULID{
+		{metas[0].ULID, metas[1].ULID},
+		{metas[2].ULID, metas[3].ULID},
+	}
+	sort.Slice(expectedSources, func(i, j int) bool { return expectedSources[i][0].Compare(expectedSources[j][0]) < 0 })
+	assert.Equal(t, expectedSources, actualSources)
+}
+
+func TestBucketCompactor_QueueDepth(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	logger := log.NewNopLogger()
+	extLabels := labels.FromStrings("e1", "1")
+	series := []labels.Labels{labels.FromStrings("a", "1")}
+
+	bkt := objstore.NewInMemBucket()
+	var specs []blockgenSpec
+	for i := int64(0); i < 6; i++ {
+		specs = append(specs, blockgenSpec{numSamples: 100, mint: i * 500, maxt: (i + 1) * 500, extLset: extLabels, series: series})
+	}
+	metas := createAndUpload(t, bkt, specs, nil)
+
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", 0, nil, nil)
+	require.NoError(t, err)
+
+	blocksMarkedForDeletion := promauto.With(nil).NewCounter(prometheus.CounterOpts{})
+	sy, err := NewMetaSyncer(nil, nil, bkt, metaFetcher, NewShardAwareDeduplicateFilter(), NewExcludeMarkedForDeletionFilter(objstore.WithNoopInstr(bkt)), blocksMarkedForDeletion)
+	require.NoError(t, err)
+
+	// Each job gets two of the source blocks, so there are 3 jobs. The planner records the
+	// queue depth when each job starts, and plans nothing, so that the compaction stops after
+	// the first pass.
+	grouper := &sizeBalancedGrouper{userID: "user-1", maxSamples: 2 * metas[0].Stats.NumSamples}
+	metrics := NewBucketCompactorMetrics(blocksMarkedForDeletion, prometheus.NewPedanticRegistry())
+	planner := &queueDepthRecordingPlanner{queueDepth: metrics.queueDepth.WithLabelValues("user-1")}
+	bComp, err := NewBucketCompactor(logger, sy, grouper, planner, &tsdbCompactorMock{}, t.TempDir(), bkt, 1, true, ownAllJobs, sortJobsByNewestBlocksFirst, 0, 1, 4, 0, metrics)
+	require.NoError(t, err)
+
+	require.NoError(t, bComp.Compact(ctx, 0))
+	assert.Equal(t, []float64{2, 1, 0}, planner.observed)
+
+	// The queue depth of the tenant is kept once its compaction is done.
+	assert.Equal(t, 1, promtest.CollectAndCount(metrics.queueDepth))
+	assert.Equal(t, 0.0, promtest.ToFloat64(metrics.queueDepth.WithLabelValues("user-1")))
+}
+
+// queueDepthRecordingPlanner is a Planner recording the value of the queue depth each time a job is planned.
+// It never plans any block to compact.
+type queueDepthRecordingPlanner struct {
+	queueDepth prometheus.Gauge
+	observed   []float64
+}
+
+func (p *queueDepthRecordingPlanner) Plan(context.Context, []*metadata.Meta) ([]*metadata.Meta, error) {
+	p.observed = append(p.observed, promtest.ToFloat64(p.queueDepth))
+	return nil, nil
+}
+
 type blockgenSpec struct {
 	mint, maxt int64
 	series     []labels.Labels
@@ -526,7 +1070,7 @@ func TestGarbageCollectDoesntCreateEmptyBlocksWithDeletionMarksOnly(t *testing.T
 		ignoreDeletionMarkFilter := NewExcludeMarkedForDeletionFilter(objstore.WithNoopInstr(bkt))
 
 		duplicateBlocksFilter := NewShardAwareDeduplicateFilter()
-		metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", nil, []block.MetadataFilter{
+		metaFetcher, err := block.NewMetaFetcher(nil, 32, objstore.WithNoopInstr(bkt), "", 0, nil, []block.MetadataFilter{
 			ignoreDeletionMarkFilter,
 			duplicateBlocksFilter,
 		})
@@ -80,13 +80,40 @@ func TestGroupMaxMinTime(t *testing.T) {
 	assert.Equal(t, int64(30), g.MaxTime())
 }
 
+func TestSummarizeSourceBlocks(t *testing.T) {
+	assert.Nil(t, summarizeSourceBlocks(nil))
+
+	metas := []*metadata.Meta{
+		{BlockMeta: tsdb.BlockMeta{Compaction: tsdb.BlockMetaCompaction{Level: 2}}},
+		{BlockMeta: tsdb.BlockMeta{Compaction: tsdb.BlockMetaCompaction{Level: 1}}},
+		{BlockMeta: tsdb.BlockMeta{Compaction: tsdb.BlockMetaCompaction{Level: 3}}},
+		{BlockMeta: tsdb.BlockMeta{Compaction: tsdb.BlockMetaCompaction{Level: 1}}},
+	}
+	assert.Equal(t, &metadata.SourceBlocks{Count: 4, MinLevel: 1, MaxLevel: 3}, summarizeSourceBlocks(metas))
+}
+
+func TestSummarizeOriginSource(t *testing.T) {
+	assert.Equal(t, metadata.SourceType(""), summarizeOriginSource(nil))
+
+	uploaded := &metadata.Meta{Thanos: metadata.Thanos{Source: metadata.UploadSource}}
+	compactedFromUploaded := &metadata.Meta{Thanos: metadata.Thanos{Source: metadata.CompactorSource, OriginSource: metadata.UploadSource}}
+	compactedFromUnknown := &metadata.Meta{Thanos: metadata.Thanos{Source: metadata.CompactorSource}}
+	ingested := &metadata.Meta{Thanos: metadata.Thanos{Source: "ingester"}}
+
+	assert.Equal(t, metadata.UploadSource, summarizeOriginSource([]*metadata.Meta{uploaded, uploaded}))
+	assert.Equal(t, metadata.UploadSource, summarizeOriginSource([]*metadata.Meta{uploaded, compactedFromUploaded}))
+	assert.Equal(t, metadata.CompactorSource, summarizeOriginSource([]*metadata.Meta{compactedFromUnknown}))
+	assert.Equal(t, metadata.SourceType(""), summarizeOriginSource([]*metadata.Meta{uploaded, ingested}))
+	assert.Equal(t, metadata.SourceType(""), summarizeOriginSource([]*metadata.Meta{compactedFromUploaded, compactedFromUnknown}))
+}
+
 func TestBucketCompactor_FilterOwnJobs(t *testing.T) {
 	jobsFn := func() []*Job {
 		return []*Job{
-			NewJob("user", "key1", labels.EmptyLabels(), 0, false, 0, ""),
-			NewJob("user", "key2", labels.EmptyLabels(), 0, false, 0, ""),
-			NewJob("user", "key3", labels.EmptyLabels(), 0, false, 0, ""),
-			NewJob("user", "key4", labels.EmptyLabels(), 0, false, 0, ""),
+			NewJob("user", "key1", labels.EmptyLabels(), 0, false, 0, "", ""),
+			NewJob("user", "key2", labels.EmptyLabels(), 0, false, 0, "", ""),
+			NewJob("user", "key3", labels.EmptyLabels(), 0, false, 0, "", ""),
+			NewJob("user", "key4", labels.EmptyLabels(), 0, false, 0, "", ""),
 		}
 	}
 
@@ -121,7 +148,7 @@ func TestBucketCompactor_FilterOwnJobs(t *testing.T) {
 	m := NewBucketCompactorMetrics(promauto.With(nil).NewCounter(prometheus.CounterOpts{}), nil)
 	for testName, testCase := range tests {
 		t.Run(testName, func(t *testing.T) {
-			bc, err := NewBucketCompactor(log.NewNopLogger(), nil, nil, nil, nil, "", nil, 2, false, testCase.ownJob, nil, 0, 4, m)
+			bc, err := NewBucketCompactor(log.NewNopLogger(), nil, nil, nil, nil, "", nil, 2, false, testCase.ownJob, nil, 0, 1, 4, 0, m)
 			require.NoError(t, err)
 
 			res, err := bc.filterOwnJobs(jobsFn())
@@ -133,7 +160,7 @@ func TestBucketCompactor_FilterOwnJobs(t *testing.T) {
 }
 
 func TestBlockMaxTimeDeltas(t *testing.T) {
-	j1 := NewJob("user", "key1", labels.EmptyLabels(), 0, false, 0, "")
+	j1 := NewJob("user", "key1", labels.EmptyLabels(), 0, false, 0, "", "")
 	require.NoError(t, j1.AppendMeta(&metadata.Meta{
 		BlockMeta: tsdb.BlockMeta{
 			MinTime: 1500002700159,
@@ -141,7 +168,7 @@ func TestBlockMaxTimeDeltas(t *testing.T) {
 		},
 	}))
 
-	j2 := NewJob("user", "key2", labels.EmptyLabels(), 0, false, 0, "")
+	j2 := NewJob("user", "key2", labels.EmptyLabels(), 0, false, 0, "", "")
 	require.NoError(t, j2.AppendMeta(&metadata.Meta{
 		BlockMeta: tsdb.BlockMeta{
 			MinTime: 1500002600159,
@@ -157,7 +184,7 @@ func TestBlockMaxTimeDeltas(t *testing.T) {
 
 	metrics := NewBucketCompactorMetrics(promauto.With(nil).NewCounter(prometheus.CounterOpts{}), nil)
 	now := time.UnixMilli(1500002900159)
-	bc, err := NewBucketCompactor(log.NewNopLogger(), nil, nil, nil, nil, "", nil, 2, false, nil, nil, 0, 4, metrics)
+	bc, err := NewBucketCompactor(log.NewNopLogger(), nil, nil, nil, nil, "", nil, 2, false, nil, nil, 0, 1, 4, 0, metrics)
 	require.NoError(t, err)
 
 	deltas := bc.blockMaxTimeDeltas(now, []*Job{j1, j2})
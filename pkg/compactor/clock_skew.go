@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+const (
+	// clockSkewProbesDir is the directory, within the Mimir internals prefix of the bucket, where the
+	// compactors write their clock skew probe objects.
+	clockSkewProbesDir = "compactor-clock-skew-probes"
+)
+
+// clockSkewProber periodically writes a probe object to the bucket, and compares its last modified time,
+// as reported by the object store, with the local time. Several features, like the compaction wait period
+// and the deletion delay, compare the local time with the last modified time of objects, and don't work
+// as expected when the two clocks are skewed.
+type clockSkewProber struct {
+	services.Service
+
+	bucketClient objstore.Bucket
+	probePath    string
+	threshold    time.Duration
+	logger       log.Logger
+
+	// Allow to mock the local time in tests.
+	now func() time.Time
+
+	// Metrics.
+	clockSkew prometheus.Gauge
+}
+
+func newClockSkewProber(bucketClient objstore.Bucket, instanceID string, interval, threshold time.Duration, logger log.Logger, reg prometheus.Registerer) *clockSkewProber {
+	p := &clockSkewProber{
+		bucketClient: bucket.NewPrefixedBucketClient(bucketClient, bucket.MimirInternalsPrefix),
+		probePath:    path.Join(clockSkewProbesDir, instanceID),
+		threshold:    threshold,
+		logger:       log.With(logger, "component", "clock-skew-prober"),
+		now:          time.Now,
+		clockSkew: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_compactor_clock_skew_seconds",
+			Help: "Difference between the last modified time of a probe object written to the object store and the local time of the compactor. Positive values mean that the object store clock is ahead.",
+		}),
+	}
+
+	p.Service = services.NewTimerService(interval, p.probe, p.probe, nil)
+	return p
+}
+
+// probe measures the clock skew. Failures are logged and don't stop the service, since they're
+// retried at the next interval.
+func (p *clockSkewProber) probe(ctx context.Context) error {
+	skew, err := p.measureClockSkew(ctx)
+	if err != nil {
+		level.Warn(p.logger).Log("msg", "failed to measure the clock skew between the compactor and the object store", "err", err)
+		return nil
+	}
+
+	p.clockSkew.Set(skew.Seconds())
+
+	if p.threshold > 0 && (skew > p.threshold || skew < -p.threshold) {
+		level.Warn(p.logger).Log("msg", "the clock skew between the compactor and the object store exceeds the threshold, which can break features comparing the local time with the last modified time of objects", "skew", skew, "threshold", p.threshold)
+	}
+	return nil
+}
+
+func (p *clockSkewProber) measureClockSkew(ctx context.Context) (time.Duration, error) {
+	before := p.now()
+	if err := p.bucketClient.Upload(ctx, p.probePath, strings.NewReader(before.UTC().Format(time.RFC3339Nano))); err != nil {
+		return 0, err
+	}
+	after := p.now()
+
+	attrs, err := p.bucketClient.Attributes(ctx, p.probePath)
+	if err != nil {
+		return 0, err
+	}
+
+	// The object store sets the last modified time while the upload is in progress,
+	// so we compare it with the local time in the middle of the upload.
+	return attrs.LastModified.Sub(before.Add(after.Sub(before) / 2)), nil
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package compactor
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+func TestClockSkewProber(t *testing.T) {
+	for name, skew := range map[string]time.Duration{
+		"no skew":                   0,
+		"object store clock ahead":  2 * time.Minute,
+		"object store clock behind": -2 * time.Minute,
+	} {
+		t.Run(name, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			reg := prometheus.NewPedanticRegistry()
+			p := newClockSkewProber(bkt, "compactor-1", time.Hour, time.Minute, log.NewNopLogger(), reg)
+
+			// The in-memory bucket uses the local time as last modified time, so we inject the skew in the
+			// local time of the prober.
+			p.now = func() time.Time { return time.Now().Add(-skew) }
+
+			require.NoError(t, p.probe(context.Background()))
+			assert.InDelta(t, skew.Seconds(), promtest.ToFloat64(p.clockSkew), 1)
+
+			exists, err := bkt.Exists(context.Background(), path.Join(bucket.MimirInternalsPrefix, clockSkewProbesDir, "compactor-1"))
+			require.NoError(t, err)
+			assert.True(t, exists)
+		})
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"hash/fnv"
 	"math/rand"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -20,10 +19,12 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/concurrency"
 	"github.com/grafana/dskit/flagext"
 	"github.com/grafana/dskit/kv"
 	"github.com/grafana/dskit/ring"
 	"github.com/grafana/dskit/services"
+	"github.com/grafana/regexp"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -36,6 +37,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 const (
@@ -56,11 +58,19 @@ const (
 
 var (
 	errInvalidBlockRanges                         = "compactor block range periods should be divisible by the previous one, but %s is not divisible by %s"
+	errUnknownBlockUploadValidator                = "unknown block upload validator %q: no validator with this name is registered in the compactor"
 	errInvalidCompactionOrder                     = fmt.Errorf("unsupported compaction order (supported values: %s)", strings.Join(CompactionOrders, ", "))
 	errInvalidMaxOpeningBlocksConcurrency         = fmt.Errorf("invalid max-opening-blocks-concurrency value, must be positive")
 	errInvalidMaxClosingBlocksConcurrency         = fmt.Errorf("invalid max-closing-blocks-concurrency value, must be positive")
 	errInvalidSymbolFlushersConcurrency           = fmt.Errorf("invalid symbols-flushers-concurrency value, must be positive")
 	errInvalidMaxBlockUploadValidationConcurrency = fmt.Errorf("invalid max-block-upload-validation-concurrency value, can't be negative")
+	errInvalidMaxCompactionJobSamples             = fmt.Errorf("invalid max-compaction-job-samples value, can't be negative")
+	errInvalidMaxCompactionJobBlocks              = fmt.Errorf("invalid max-compaction-job-blocks value, must be 0 or greater than 1")
+	errInvalidCompactionWaitMaxLevel              = fmt.Errorf("invalid compaction-wait-period-max-level value, must be positive")
+	errInvalidMaxConcurrentTenants                = fmt.Errorf("invalid max-concurrent-tenants value, must be positive")
+	errInvalidBlockUploadCleanupRetries           = fmt.Errorf("invalid block-upload-cleanup-retries value, can't be negative")
+	errInvalidBlockUploadStaleMetaAction          = fmt.Errorf("unsupported block upload stale meta action (supported values: %s)", strings.Join(StaleTempMetaActions, ", "))
+	errTenantMarkedForDeletion                    = errors.New("tenant has been marked for deletion")
 	RingOp                                        = ring.NewOp([]ring.InstanceState{ring.ACTIVE}, nil)
 )
 
@@ -74,13 +84,23 @@ type BlocksGrouperFactory func(
 	reg prometheus.Registerer,
 ) Grouper
 
-// BlocksCompactorFactory builds and returns the compactor and planner to use to compact a tenant's blocks.
+// BlocksPlannerFactory builds and returns the planner to use to compact a tenant's blocks.
+type BlocksPlannerFactory func(
+	ctx context.Context,
+	cfg Config,
+	cfgProvider ConfigProvider,
+	userID string,
+	logger log.Logger,
+	reg prometheus.Registerer,
+) Planner
+
+// BlocksCompactorFactory builds and returns the compactor to use to compact the tenants' blocks.
 type BlocksCompactorFactory func(
 	ctx context.Context,
 	cfg Config,
 	logger log.Logger,
 	reg prometheus.Registerer,
-) (Compactor, Planner, error)
+) (Compactor, error)
 
 // Config holds the MultitenantCompactor config.
 type Config struct {
@@ -92,12 +112,17 @@ type Config struct {
 	CompactionInterval         time.Duration           `yaml:"compaction_interval" category:"advanced"`
 	CompactionRetries          int                     `yaml:"compaction_retries" category:"advanced"`
 	CompactionConcurrency      int                     `yaml:"compaction_concurrency" category:"advanced"`
+	MaxConcurrentTenants       int                     `yaml:"max_concurrent_tenants" category:"experimental"`
 	CompactionWaitPeriod       time.Duration           `yaml:"first_level_compaction_wait_period" category:"experimental"`
+	CompactionWaitMaxLevel     int                     `yaml:"compaction_wait_period_max_level" category:"experimental"`
 	CleanupInterval            time.Duration           `yaml:"cleanup_interval" category:"advanced"`
 	CleanupConcurrency         int                     `yaml:"cleanup_concurrency" category:"advanced"`
 	DeletionDelay              time.Duration           `yaml:"deletion_delay" category:"advanced"`
 	TenantCleanupDelay         time.Duration           `yaml:"tenant_cleanup_delay" category:"advanced"`
 	MaxCompactionTime          time.Duration           `yaml:"max_compaction_time" category:"advanced"`
+	MaxCompactionJobDuration   time.Duration           `yaml:"max_compaction_job_duration" category:"experimental"`
+	MaxCompactionJobSamples    int                     `yaml:"max_compaction_job_samples" category:"experimental"`
+	MaxCompactionJobBlocks     int                     `yaml:"max_compaction_job_blocks" category:"experimental"`
 
 	// Compactor concurrency options
 	MaxOpeningBlocksConcurrency         int `yaml:"max_opening_blocks_concurrency" category:"advanced"`          // Number of goroutines opening blocks before compaction.
@@ -105,6 +130,13 @@ type Config struct {
 	SymbolsFlushersConcurrency          int `yaml:"symbols_flushers_concurrency" category:"advanced"`            // Number of symbols flushers used when doing split compaction.
 	MaxBlockUploadValidationConcurrency int `yaml:"max_block_upload_validation_concurrency" category:"advanced"` // Max number of uploaded blocks that can be validated concurrently.
 
+	BlockUploadCleanupRetries   int      `yaml:"block_upload_cleanup_retries" category:"experimental"`
+	BlockUploadAllowedFilePaths []string `yaml:"block_upload_allowed_file_paths" category:"experimental"`
+	BlockUploadStaleMetaAction  string   `yaml:"block_upload_stale_meta_action" category:"experimental"`
+
+	ClockSkewProbeInterval    time.Duration `yaml:"clock_skew_probe_interval" category:"experimental"`
+	ClockSkewWarningThreshold time.Duration `yaml:"clock_skew_warning_threshold" category:"experimental"`
+
 	EnabledTenants  flagext.StringSliceCSV `yaml:"enabled_tenants" category:"advanced"`
 	DisabledTenants flagext.StringSliceCSV `yaml:"disabled_tenants" category:"advanced"`
 
@@ -112,6 +144,9 @@ type Config struct {
 	ShardingRing RingConfig `yaml:"sharding_ring"`
 
 	CompactionJobsOrder string `yaml:"compaction_jobs_order" category:"advanced"`
+	GroupBlocksBySource bool   `yaml:"group_blocks_by_source" category:"experimental"`
+
+	ReshardUploadedBlocks bool `yaml:"reshard_uploaded_blocks" category:"experimental"`
 
 	// No need to add options to customize the retry backoff,
 	// given the defaults should be fine, but allow to override
@@ -119,9 +154,22 @@ type Config struct {
 	retryMinBackoff time.Duration `yaml:"-"`
 	retryMaxBackoff time.Duration `yaml:"-"`
 
+	blockUploadCleanupMinBackoff time.Duration `yaml:"-"`
+	blockUploadCleanupMaxBackoff time.Duration `yaml:"-"`
+
+	// How frequently to check whether a tenant whose blocks are being compacted has been marked for deletion.
+	tenantDeletionCheckInterval time.Duration `yaml:"-"`
+
+	// Compiled from BlockUploadAllowedFilePaths when validating the config.
+	blockUploadFilePathRegexp *regexp.Regexp `yaml:"-"`
+
 	// Allow downstream projects to customise the blocks compactor.
 	BlocksGrouperFactory   BlocksGrouperFactory   `yaml:"-"`
+	BlocksPlannerFactory   BlocksPlannerFactory   `yaml:"-"`
 	BlocksCompactorFactory BlocksCompactorFactory `yaml:"-"`
+
+	// Validators which can be enabled per tenant to check the blocks uploaded via the block upload API, by name.
+	BlockUploadValidators map[string]BlockUploadValidator `yaml:"-"`
 }
 
 // RegisterFlags registers the MultitenantCompactor flags.
@@ -131,6 +179,10 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	cfg.BlockRanges = mimir_tsdb.DurationList{2 * time.Hour, 12 * time.Hour, 24 * time.Hour}
 	cfg.retryMinBackoff = 10 * time.Second
 	cfg.retryMaxBackoff = time.Minute
+	cfg.blockUploadCleanupMinBackoff = 100 * time.Millisecond
+	cfg.blockUploadCleanupMaxBackoff = time.Second
+	cfg.tenantDeletionCheckInterval = time.Minute
+	cfg.BlockUploadAllowedFilePaths = append([]string(nil), defaultBlockUploadAllowedFilePaths...)
 
 	f.Var(&cfg.BlockRanges, "compactor.block-ranges", "List of compaction time ranges.")
 	f.DurationVar(&cfg.DeprecatedConsistencyDelay, consistencyDelayFlag, 0, "Minimum age of fresh (non-compacted) blocks before they are being processed.")
@@ -139,12 +191,19 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.StringVar(&cfg.DataDir, "compactor.data-dir", "./data-compactor/", "Directory to temporarily store blocks during compaction. This directory is not required to be persisted between restarts.")
 	f.DurationVar(&cfg.CompactionInterval, "compactor.compaction-interval", time.Hour, "The frequency at which the compaction runs")
 	f.DurationVar(&cfg.MaxCompactionTime, "compactor.max-compaction-time", time.Hour, "Max time for starting compactions for a single tenant. After this time no new compactions for the tenant are started before next compaction cycle. This can help in multi-tenant environments to avoid single tenant using all compaction time, but also in single-tenant environments to force new discovery of blocks more often. 0 = disabled.")
+	f.DurationVar(&cfg.MaxCompactionJobDuration, "compactor.max-compaction-job-duration", 0, "Max time a single compaction job can run. A job running longer than this is cancelled and considered failed, and the compactor moves on with the other jobs. 0 = disabled.")
+	f.IntVar(&cfg.MaxCompactionJobSamples, "compactor.max-compaction-job-samples", 0, "Max number of samples of a block produced by a merge compaction job, estimated from the source blocks. A job exceeding this limit is split into smaller jobs, and blocks which can't be merged without exceeding it are not compacted further. 0 = disabled.")
+	f.IntVar(&cfg.MaxCompactionJobBlocks, "compactor.max-compaction-job-blocks", 0, "Max number of source blocks of a split-and-merge compaction job. A job exceeding this limit is split into smaller jobs covering the same time range, which are compacted one after the other. 0 = no limit.")
 	f.IntVar(&cfg.CompactionRetries, "compactor.compaction-retries", 3, "How many times to retry a failed compaction within a single compaction run.")
 	f.IntVar(&cfg.CompactionConcurrency, "compactor.compaction-concurrency", 1, "Max number of concurrent compactions running.")
+	f.IntVar(&cfg.MaxConcurrentTenants, "compactor.max-concurrent-tenants", 1, "Max number of tenants compacted concurrently by a compactor. The other tenants owned by the compactor wait until one of them is done. Each tenant runs up to the configured compaction concurrency.")
 	f.DurationVar(&cfg.CompactionWaitPeriod, "compactor.first-level-compaction-wait-period", 0, "How long the compactor waits before compacting first-level blocks that are uploaded by the ingesters. This configuration option allows for the reduction of cases where the compactor begins to compact blocks before all ingesters have uploaded their blocks to the storage.")
+	f.IntVar(&cfg.CompactionWaitMaxLevel, "compactor.compaction-wait-period-max-level", 1, "Maximum compaction level of the blocks to which the first-level compaction wait period also applies. A compaction job waits if its lowest level block has a compaction level up to this value. 1 = only the first-level blocks uploaded by the ingesters. For example, 2 also waits for the blocks which have just been split.")
 	f.DurationVar(&cfg.CleanupInterval, "compactor.cleanup-interval", 15*time.Minute, "How frequently compactor should run blocks cleanup and maintenance, as well as update the bucket index.")
 	f.IntVar(&cfg.CleanupConcurrency, "compactor.cleanup-concurrency", 20, "Max number of tenants for which blocks cleanup and maintenance should run concurrently.")
 	f.StringVar(&cfg.CompactionJobsOrder, "compactor.compaction-jobs-order", CompactionOrderOldestFirst, fmt.Sprintf("The sorting to use when deciding which compaction jobs should run first for a given tenant. Supported values are: %s.", strings.Join(CompactionOrders, ", ")))
+	f.BoolVar(&cfg.GroupBlocksBySource, "compactor.group-blocks-by-source", false, "If enabled, blocks with a different source (for example, uploaded blocks and blocks shipped by ingesters) are never compacted together.")
+	f.BoolVar(&cfg.ReshardUploadedBlocks, "compactor.reshard-uploaded-blocks", false, "If enabled, uploaded blocks whose shard ID external label doesn't match the tenant's current number of split-and-merge shards are split again into the current shards when they fit the smallest compaction range, instead of being compacted only with the blocks of the same shard.")
 	f.DurationVar(&cfg.DeletionDelay, "compactor.deletion-delay", 12*time.Hour, "Time before a block marked for deletion is deleted from bucket. "+
 		"If not 0, blocks will be marked for deletion and compactor component will permanently delete blocks marked for deletion from the bucket. "+
 		"If 0, blocks will be deleted straight away. Note that deleting blocks immediately can cause query failures.")
@@ -154,6 +213,11 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.IntVar(&cfg.MaxClosingBlocksConcurrency, "compactor.max-closing-blocks-concurrency", 1, "Max number of blocks that can be closed concurrently during split compaction. Note that closing of newly compacted block uses a lot of memory for writing index.")
 	f.IntVar(&cfg.SymbolsFlushersConcurrency, "compactor.symbols-flushers-concurrency", 1, "Number of symbols flushers used when doing split compaction.")
 	f.IntVar(&cfg.MaxBlockUploadValidationConcurrency, "compactor.max-block-upload-validation-concurrency", 1, "Max number of uploaded blocks that can be validated concurrently. 0 = no limit.")
+	f.IntVar(&cfg.BlockUploadCleanupRetries, "compactor.block-upload-cleanup-retries", 3, "How many times to retry deleting the temporary meta file of a block once its upload has completed. If it can't be deleted, the block upload succeeds anyway.")
+	f.Var((*flagext.StringSlice)(&cfg.BlockUploadAllowedFilePaths), "compactor.block-upload-allowed-file-paths", "Regular expressions matching the paths, relative to the block directory, of the files which can be uploaded via the block upload API. Each expression must match the whole path. The flag can be repeated to allow more paths in addition to the default ones.")
+	f.StringVar(&cfg.BlockUploadStaleMetaAction, "compactor.block-upload-stale-meta-action", StaleTempMetaActionIgnore, fmt.Sprintf("What the blocks cleaner does with the temporary meta file left in the blocks whose upload has completed, when their meta.json is valid. Only the blocks discovered since the previous cleanup, and the blocks still having the file at the previous cleanup, are checked. Supported values are: %s.", strings.Join(StaleTempMetaActions, ", ")))
+	f.DurationVar(&cfg.ClockSkewProbeInterval, "compactor.clock-skew-probe-interval", 0, "How frequently the compactor measures the clock skew between itself and the object store, by writing a probe object and comparing its last modified time with the local time. 0 = disabled.")
+	f.DurationVar(&cfg.ClockSkewWarningThreshold, "compactor.clock-skew-warning-threshold", time.Minute, "Clock skew between the compactor and the object store above which a warning is logged. 0 = never log a warning.")
 
 	f.Var(&cfg.EnabledTenants, "compactor.enabled-tenants", "Comma separated list of tenants that can be compacted. If specified, only these tenants will be compacted by compactor, otherwise all tenants can be compacted. Subject to sharding.")
 	f.Var(&cfg.DisabledTenants, "compactor.disabled-tenants", "Comma separated list of tenants that cannot be compacted by this compactor. If specified, and compactor would normally pick given tenant for compaction (via -compactor.enabled-tenants or sharding), it will be ignored instead.")
@@ -179,9 +243,32 @@ func (cfg *Config) Validate(logger log.Logger) error {
 	if cfg.MaxBlockUploadValidationConcurrency < 0 {
 		return errInvalidMaxBlockUploadValidationConcurrency
 	}
+	if cfg.MaxCompactionJobSamples < 0 {
+		return errInvalidMaxCompactionJobSamples
+	}
+	if cfg.MaxCompactionJobBlocks < 0 || cfg.MaxCompactionJobBlocks == 1 {
+		return errInvalidMaxCompactionJobBlocks
+	}
+	if cfg.CompactionWaitMaxLevel < 1 {
+		return errInvalidCompactionWaitMaxLevel
+	}
+	if cfg.MaxConcurrentTenants < 1 {
+		return errInvalidMaxConcurrentTenants
+	}
 	if !util.StringsContain(CompactionOrders, cfg.CompactionJobsOrder) {
 		return errInvalidCompactionOrder
 	}
+	if cfg.BlockUploadCleanupRetries < 0 {
+		return errInvalidBlockUploadCleanupRetries
+	}
+	if !util.StringsContain(StaleTempMetaActions, cfg.BlockUploadStaleMetaAction) {
+		return errInvalidBlockUploadStaleMetaAction
+	}
+	re, err := compileBlockUploadAllowedFilePaths(cfg.BlockUploadAllowedFilePaths)
+	if err != nil {
+		return err
+	}
+	cfg.blockUploadFilePathRegexp = re
 	if cfg.DeprecatedConsistencyDelay > 0 {
 		util.WarnDeprecatedConfig(consistencyDelayFlag, logger)
 	}
@@ -189,6 +276,16 @@ func (cfg *Config) Validate(logger log.Logger) error {
 	return nil
 }
 
+// ValidateLimits validates the per-tenant limits against the compactor config.
+func (cfg *Config) ValidateLimits(limits validation.Limits) error {
+	for _, name := range limits.CompactorBlockUploadValidators {
+		if _, ok := cfg.BlockUploadValidators[name]; !ok {
+			return errors.Errorf(errUnknownBlockUploadValidator, name)
+		}
+	}
+	return nil
+}
+
 // ConfigProvider defines the per-tenant config provider for the MultitenantCompactor.
 type ConfigProvider interface {
 	bucket.TenantConfigProvider
@@ -206,6 +303,10 @@ type ConfigProvider interface {
 	// CompactorTenantShardSize returns number of compactors that this user can use. 0 = all compactors.
 	CompactorTenantShardSize(userID string) int
 
+	// CompactorBlockRanges returns the compaction time ranges for a given user. If empty, the ranges
+	// configured for the compactor are used.
+	CompactorBlockRanges(userID string) mimir_tsdb.DurationList
+
 	// CompactorPartialBlockDeletionDelay returns the partial block delay time period for a given user,
 	// and whether the configured value was valid. If the value wasn't valid, the returned delay is the default one
 	// and the caller is responsible to warn the Mimir operator about it.
@@ -222,6 +323,29 @@ type ConfigProvider interface {
 
 	// CompactorBlockUploadMaxBlockSizeBytes returns the maximum size in bytes of a block that is allowed to be uploaded or validated for a given user.
 	CompactorBlockUploadMaxBlockSizeBytes(userID string) int64
+
+	// CompactorBlockUploadValidators returns the names of the validators to run on the blocks uploaded by a given tenant.
+	CompactorBlockUploadValidators(tenantID string) []string
+
+	// CompactorBlockUploadMaxUncompactedBlocks returns the maximum number of blocks not compacted yet above which
+	// block uploads are rejected for a given tenant. 0 = no limit.
+	CompactorBlockUploadMaxUncompactedBlocks(tenantID string) int
+
+	// CompactorBlockUploadMinAge returns the minimum time since the upload of a block has been started before
+	// its upload can be completed for a given tenant. 0 = disabled.
+	CompactorBlockUploadMinAge(tenantID string) time.Duration
+
+	// CompactorBlockUploadMaxFiles returns the maximum number of files of a block that is allowed to be uploaded
+	// for a given tenant. 0 = no limit.
+	CompactorBlockUploadMaxFiles(tenantID string) int
+
+	// CompactorBlockUploadMaxFileSizeBytes returns the maximum size in bytes of a block file that is allowed
+	// to be uploaded for a given tenant. 0 = no limit.
+	CompactorBlockUploadMaxFileSizeBytes(tenantID string) int64
+
+	// CompactorBlockUploadAllowedLabels returns the additional external labels preserved in the blocks
+	// uploaded by a given tenant.
+	CompactorBlockUploadAllowedLabels(tenantID string) []string
 }
 
 // MultitenantCompactor is a multi-tenant TSDB blocks compactor based on Thanos.
@@ -239,14 +363,17 @@ type MultitenantCompactor struct {
 	// Useful for injecting mock objects from tests.
 	bucketClientFactory    func(ctx context.Context) (objstore.Bucket, error)
 	blocksGrouperFactory   BlocksGrouperFactory
+	blocksPlannerFactory   BlocksPlannerFactory
 	blocksCompactorFactory BlocksCompactorFactory
 
 	// Blocks cleaner is responsible to hard delete blocks marked for deletion.
 	blocksCleaner *BlocksCleaner
 
-	// Underlying compactor and planner used to compact TSDB blocks.
+	// Measures the clock skew between the compactor and the object store, if enabled.
+	clockSkewProber *clockSkewProber
+
+	// Underlying compactor used to compact TSDB blocks.
 	blocksCompactor Compactor
-	blocksPlanner   Planner
 
 	// Client used to run operations on the bucket storing blocks.
 	bucketClient objstore.Bucket
@@ -279,7 +406,20 @@ type MultitenantCompactor struct {
 	// TSDB syncer metrics
 	syncerMetrics *aggregatedSyncerMetrics
 
-	blockUploadValidations atomic.Int64
+	blockUploadValidations         atomic.Int64
+	blockUploadTempCleanupFailures prometheus.Counter
+	blockUploadDuration            prometheus.Histogram
+
+	// Clock used by the block upload API. Useful for injecting a fake clock from tests: time.Now is used if nil.
+	nowFunc func() time.Time
+}
+
+// now returns the current time according to the compactor's clock.
+func (c *MultitenantCompactor) now() time.Time {
+	if c.nowFunc != nil {
+		return c.nowFunc()
+	}
+	return time.Now()
 }
 
 // NewMultitenantCompactor makes a new MultitenantCompactor.
@@ -289,16 +429,17 @@ func NewMultitenantCompactor(compactorCfg Config, storageCfg mimir_tsdb.BlocksSt
 	}
 
 	// Configure the compactor and grouper factories.
-	if compactorCfg.BlocksGrouperFactory != nil && compactorCfg.BlocksCompactorFactory != nil {
+	if compactorCfg.BlocksGrouperFactory != nil && compactorCfg.BlocksPlannerFactory != nil && compactorCfg.BlocksCompactorFactory != nil {
 		// Nothing to do because it was already set by a downstream project.
 	} else {
 		configureSplitAndMergeCompactor(&compactorCfg)
 	}
 
 	blocksGrouperFactory := compactorCfg.BlocksGrouperFactory
+	blocksPlannerFactory := compactorCfg.BlocksPlannerFactory
 	blocksCompactorFactory := compactorCfg.BlocksCompactorFactory
 
-	mimirCompactor, err := newMultitenantCompactor(compactorCfg, storageCfg, cfgProvider, logger, registerer, bucketClientFactory, blocksGrouperFactory, blocksCompactorFactory)
+	mimirCompactor, err := newMultitenantCompactor(compactorCfg, storageCfg, cfgProvider, logger, registerer, bucketClientFactory, blocksGrouperFactory, blocksPlannerFactory, blocksCompactorFactory)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create blocks compactor")
 	}
@@ -314,6 +455,7 @@ func newMultitenantCompactor(
 	registerer prometheus.Registerer,
 	bucketClientFactory func(ctx context.Context) (objstore.Bucket, error),
 	blocksGrouperFactory BlocksGrouperFactory,
+	blocksPlannerFactory BlocksPlannerFactory,
 	blocksCompactorFactory BlocksCompactorFactory,
 ) (*MultitenantCompactor, error) {
 	c := &MultitenantCompactor{
@@ -326,6 +468,7 @@ func newMultitenantCompactor(
 		syncerMetrics:          newAggregatedSyncerMetrics(registerer),
 		bucketClientFactory:    bucketClientFactory,
 		blocksGrouperFactory:   blocksGrouperFactory,
+		blocksPlannerFactory:   blocksPlannerFactory,
 		blocksCompactorFactory: blocksCompactorFactory,
 
 		compactionRunsStarted: promauto.With(registerer).NewCounter(prometheus.CounterOpts{
@@ -377,6 +520,17 @@ func newMultitenantCompactor(
 		}),
 	}
 
+	c.blockUploadTempCleanupFailures = promauto.With(registerer).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_compactor_block_upload_temp_cleanup_failures_total",
+		Help: "Total number of completed block uploads whose temporary meta file couldn't be deleted.",
+	})
+
+	c.blockUploadDuration = promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
+		Name:    "cortex_compactor_block_upload_duration_seconds",
+		Help:    "Time from the start to the completion of a block upload.",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 10), // 1s to ~3 days
+	})
+
 	promauto.With(registerer).NewGaugeFunc(prometheus.GaugeOpts{
 		Name: "cortex_block_upload_validations_in_progress",
 		Help: "Number of block upload validations currently running.",
@@ -417,7 +571,7 @@ func (c *MultitenantCompactor) starting(ctx context.Context) error {
 	}
 
 	// Create blocks compactor dependencies.
-	c.blocksCompactor, c.blocksPlanner, err = c.blocksCompactorFactory(ctx, c.compactorCfg, c.logger, c.registerer)
+	c.blocksCompactor, err = c.blocksCompactorFactory(ctx, c.compactorCfg, c.logger, c.registerer)
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize compactor dependencies")
 	}
@@ -484,6 +638,7 @@ func (c *MultitenantCompactor) starting(ctx context.Context) error {
 		CleanupConcurrency:      c.compactorCfg.CleanupConcurrency,
 		TenantCleanupDelay:      c.compactorCfg.TenantCleanupDelay,
 		DeleteBlocksConcurrency: defaultDeleteBlocksConcurrency,
+		StaleTempMetaAction:     c.compactorCfg.BlockUploadStaleMetaAction,
 	}, c.bucketClient, c.shardingStrategy.blocksCleanerOwnUser, c.cfgProvider, c.parentLogger, c.registerer)
 
 	// Start blocks cleaner asynchronously, don't wait until initial cleanup is finished.
@@ -492,6 +647,15 @@ func (c *MultitenantCompactor) starting(ctx context.Context) error {
 		return errors.Wrap(err, "failed to start the blocks cleaner")
 	}
 
+	if c.compactorCfg.ClockSkewProbeInterval > 0 {
+		c.clockSkewProber = newClockSkewProber(c.bucketClient, c.ringLifecycler.GetInstanceID(), c.compactorCfg.ClockSkewProbeInterval, c.compactorCfg.ClockSkewWarningThreshold, c.logger, c.registerer)
+		if err := c.clockSkewProber.StartAsync(ctx); err != nil {
+			c.blocksCleaner.StopAsync()
+			c.ringSubservices.StopAsync()
+			return errors.Wrap(err, "failed to start the clock skew prober")
+		}
+	}
+
 	return nil
 }
 
@@ -529,6 +693,9 @@ func (c *MultitenantCompactor) stopping(_ error) error {
 	ctx := context.Background()
 
 	services.StopAndAwaitTerminated(ctx, c.blocksCleaner) //nolint:errcheck
+	if c.clockSkewProber != nil {
+		services.StopAndAwaitTerminated(ctx, c.clockSkewProber) //nolint:errcheck
+	}
 	if c.ringSubservices != nil {
 		return services.StopManagerAndAwaitStopped(ctx, c.ringSubservices)
 	}
@@ -599,13 +766,8 @@ func (c *MultitenantCompactor) compactUsers(ctx context.Context) {
 
 	// Keep track of users owned by this shard, so that we can delete the local files for all other users.
 	ownedUsers := map[string]struct{}{}
+	compactedUsers := make([]string, 0, len(users))
 	for _, userID := range users {
-		// Ensure the context has not been canceled (ie. compactor shutdown has been triggered).
-		if ctx.Err() != nil {
-			level.Info(c.logger).Log("msg", "interrupting compaction of user blocks", "err", err)
-			return
-		}
-
 		// Ensure the user ID belongs to our shard.
 		if owned, err := c.shardingStrategy.compactorOwnUser(userID); err != nil {
 			c.compactionRunSkippedTenants.Inc()
@@ -618,35 +780,63 @@ func (c *MultitenantCompactor) compactUsers(ctx context.Context) {
 		}
 
 		ownedUsers[userID] = struct{}{}
+		compactedUsers = append(compactedUsers, userID)
+	}
+
+	// Compact up to the configured number of tenants concurrently. The other tenants are queued
+	// and picked up, in order, as soon as the compaction of a tenant is done.
+	errorCount := atomic.NewInt64(0)
+	err = concurrency.ForEachJob(ctx, len(compactedUsers), c.compactorCfg.MaxConcurrentTenants, func(ctx context.Context, idx int) error {
+		userID := compactedUsers[idx]
 
 		if markedForDeletion, err := mimir_tsdb.TenantDeletionMarkExists(ctx, c.bucketClient, userID); err != nil {
 			c.compactionRunSkippedTenants.Inc()
 			level.Warn(c.logger).Log("msg", "unable to check if user is marked for deletion", "user", userID, "err", err)
-			continue
+			return nil
 		} else if markedForDeletion {
 			c.compactionRunSkippedTenants.Inc()
 			level.Debug(c.logger).Log("msg", "skipping user because it is marked for deletion", "user", userID)
-			continue
+			return nil
 		}
 
 		level.Info(c.logger).Log("msg", "starting compaction of user blocks", "user", userID)
 
-		if err = c.compactUserWithRetries(ctx, userID); err != nil {
+		if err := c.compactUserWithRetries(ctx, userID); err != nil {
 			switch {
+			case errors.Is(err, errTenantMarkedForDeletion):
+				c.compactionRunSkippedTenants.Inc()
+				level.Info(c.logger).Log("msg", "compaction for user was interrupted because it has been marked for deletion", "user", userID)
 			case errors.Is(err, context.Canceled):
 				// We don't want to count shutdowns as failed compactions because we will pick up with the rest of the compaction after the restart.
 				level.Info(c.logger).Log("msg", "compaction for user was interrupted by a shutdown", "user", userID)
-				return
+				return err
 			default:
 				c.compactionRunFailedTenants.Inc()
-				compactionErrorCount++
+				errorCount.Inc()
 				level.Error(c.logger).Log("msg", "failed to compact user blocks", "user", userID, "err", err)
 			}
-			continue
+			return nil
 		}
 
 		c.compactionRunSucceededTenants.Inc()
 		level.Info(c.logger).Log("msg", "successfully compacted user blocks", "user", userID)
+		return nil
+	})
+
+	compactionErrorCount += int(errorCount.Load())
+
+	// The compaction of the tenants is only interrupted by a shutdown.
+	if err != nil {
+		level.Info(c.logger).Log("msg", "interrupting compaction of user blocks", "err", err)
+		return
+	}
+
+	// Forget the per-tenant metrics of the tenants not compacted by this instance anymore.
+	for _, userID := range users {
+		if _, owned := ownedUsers[userID]; !owned {
+			c.syncerMetrics.removeUser(userID)
+			c.bucketCompactorMetrics.queueDepth.DeleteLabelValues(userID)
+		}
 	}
 
 	// Delete local files for unowned tenants, if there are any. This cleans up
@@ -657,21 +847,27 @@ func (c *MultitenantCompactor) compactUsers(ctx context.Context) {
 			continue
 		}
 
-		dir := c.metaSyncDirForUser(userID)
-		s, err := os.Stat(dir)
-		if err != nil {
-			if !os.IsNotExist(err) {
-				level.Warn(c.logger).Log("msg", "failed to stat local directory with user data", "dir", dir, "err", err)
-			}
-			continue
+		dirs := []string{c.metaSyncDirForUser(userID)}
+		if c.compactorCfg.MaxConcurrentTenants > 1 {
+			dirs = append(dirs, c.compactDirForUser(userID))
 		}
 
-		if s.IsDir() {
-			err := os.RemoveAll(dir)
-			if err == nil {
-				level.Info(c.logger).Log("msg", "deleted directory for user not owned by this shard", "dir", dir)
-			} else {
-				level.Warn(c.logger).Log("msg", "failed to delete directory for user not owned by this shard", "dir", dir, "err", err)
+		for _, dir := range dirs {
+			s, err := os.Stat(dir)
+			if err != nil {
+				if !os.IsNotExist(err) {
+					level.Warn(c.logger).Log("msg", "failed to stat local directory with user data", "dir", dir, "err", err)
+				}
+				continue
+			}
+
+			if s.IsDir() {
+				err := os.RemoveAll(dir)
+				if err == nil {
+					level.Info(c.logger).Log("msg", "deleted directory for user not owned by this shard", "dir", dir)
+				} else {
+					level.Warn(c.logger).Log("msg", "failed to delete directory for user not owned by this shard", "dir", dir, "err", err)
+				}
 			}
 		}
 	}
@@ -690,8 +886,8 @@ func (c *MultitenantCompactor) compactUserWithRetries(ctx context.Context, userI
 
 	for retries.Ongoing() {
 		lastErr = c.compactUser(ctx, userID)
-		if lastErr == nil {
-			return nil
+		if lastErr == nil || errors.Is(lastErr, errTenantMarkedForDeletion) {
+			return lastErr
 		}
 
 		retries.Wait()
@@ -703,10 +899,16 @@ func (c *MultitenantCompactor) compactUserWithRetries(ctx context.Context, userI
 func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) error {
 	userBucket := bucket.NewUserBucketClient(userID, c.bucketClient, c.cfgProvider)
 	reg := prometheus.NewRegistry()
-	defer c.syncerMetrics.gatherThanosSyncerMetrics(reg)
+	defer c.syncerMetrics.gatherThanosSyncerMetrics(userID, reg)
 
 	userLogger := util_log.WithUserID(userID, c.logger)
 
+	// The blocks of a tenant marked for deletion are going to be deleted by the blocks cleaner,
+	// so we stop compacting them as soon as the tenant is marked.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	markedForDeletion := c.watchTenantDeletionMark(ctx, cancel, userID, userLogger)
+
 	// While fetching blocks, we filter out blocks that were marked for deletion by using ExcludeMarkedForDeletionFilter.
 	// No delay is used -- all blocks with deletion marker are ignored, and not considered for compaction.
 	excludeMarkedForDeletionFilter := NewExcludeMarkedForDeletionFilter(userBucket)
@@ -725,6 +927,9 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 			mimir_tsdb.DeprecatedIngesterIDExternalLabel,
 		}),
 		block.NewConsistencyDelayMetaFilter(userLogger, c.compactorCfg.DeprecatedConsistencyDelay, reg),
+		// Blocks entirely outside of the retention period will be deleted by the blocks cleaner,
+		// so there's no point in compacting them.
+		block.NewRetentionFilter(userID, c.cfgProvider.CompactorBlocksRetentionPeriod),
 		excludeMarkedForDeletionFilter,
 		deduplicateBlocksFilter,
 		// removes blocks that should not be compacted due to being marked so.
@@ -736,6 +941,7 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 		c.compactorCfg.MetaSyncConcurrency,
 		userBucket,
 		c.metaSyncDirForUser(userID),
+		0,
 		reg,
 		fetcherFilters,
 	)
@@ -760,29 +966,77 @@ func (c *MultitenantCompactor) compactUser(ctx context.Context, userID string) e
 		userLogger,
 		syncer,
 		c.blocksGrouperFactory(ctx, c.compactorCfg, c.cfgProvider, userID, userLogger, reg),
-		c.blocksPlanner,
+		c.blocksPlannerFactory(ctx, c.compactorCfg, c.cfgProvider, userID, userLogger, reg),
 		c.blocksCompactor,
-		path.Join(c.compactorCfg.DataDir, "compact"),
+		c.compactDirForUser(userID),
 		userBucket,
 		c.compactorCfg.CompactionConcurrency,
 		true, // Skip blocks without of order chunks, and mark them for no-compaction.
 		c.shardingStrategy.ownJob,
 		c.jobsOrder,
 		c.compactorCfg.CompactionWaitPeriod,
+		c.compactorCfg.CompactionWaitMaxLevel,
 		c.compactorCfg.BlockSyncConcurrency,
+		c.compactorCfg.MaxCompactionJobDuration,
 		c.bucketCompactorMetrics,
 	)
 	if err != nil {
 		return errors.Wrap(err, "failed to create bucket compactor")
 	}
 
-	if err := compactor.Compact(ctx, c.compactorCfg.MaxCompactionTime); err != nil {
+	err = compactor.Compact(ctx, c.compactorCfg.MaxCompactionTime)
+	if markedForDeletion.Load() {
+		return errTenantMarkedForDeletion
+	}
+	if err != nil {
 		return errors.Wrap(err, "compaction")
 	}
 
+	// All the planned jobs have run. The queue depth is instead kept when the compaction fails,
+	// until the next planning, to track the jobs left.
+	c.bucketCompactorMetrics.queueDepth.WithLabelValues(userID).Set(0)
+
 	return nil
 }
 
+// watchTenantDeletionMark periodically checks whether the tenant has been marked for deletion, until the
+// input context is done. Once the tenant is marked, it calls cancel and the returned flag is set.
+func (c *MultitenantCompactor) watchTenantDeletionMark(ctx context.Context, cancel context.CancelFunc, userID string, logger log.Logger) *atomic.Bool {
+	markedForDeletion := atomic.NewBool(false)
+	if c.compactorCfg.tenantDeletionCheckInterval <= 0 {
+		return markedForDeletion
+	}
+
+	go func() {
+		ticker := time.NewTicker(c.compactorCfg.tenantDeletionCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			marked, err := mimir_tsdb.TenantDeletionMarkExists(ctx, c.bucketClient, userID)
+			if err != nil {
+				if ctx.Err() == nil {
+					level.Warn(logger).Log("msg", "unable to check if user is marked for deletion", "err", err)
+				}
+				continue
+			}
+			if marked {
+				level.Info(logger).Log("msg", "cancelling compaction of user blocks because the user has been marked for deletion")
+				markedForDeletion.Store(true)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return markedForDeletion
+}
+
 func (c *MultitenantCompactor) discoverUsersWithRetries(ctx context.Context) ([]string, error) {
 	var lastErr error
 
@@ -901,6 +1155,16 @@ func (c *MultitenantCompactor) metaSyncDirForUser(userID string) string {
 	return filepath.Join(c.compactorCfg.DataDir, compactorMetaPrefix+userID)
 }
 
+// compactDirForUser returns the directory where the blocks of the tenant are downloaded and compacted.
+// The bucket compactor wipes this directory, so each tenant gets its own one when several tenants are
+// compacted concurrently.
+func (c *MultitenantCompactor) compactDirForUser(userID string) string {
+	if c.compactorCfg.MaxConcurrentTenants > 1 {
+		return filepath.Join(c.compactorCfg.DataDir, "compact", userID)
+	}
+	return filepath.Join(c.compactorCfg.DataDir, "compact")
+}
+
 // This function returns tenants with meta sync directories found on local disk. On error, it returns nil map.
 func (c *MultitenantCompactor) listTenantsWithMetaSyncDirectories() map[string]struct{} {
 	result := map[string]struct{}{}
@@ -17,6 +17,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -134,6 +135,32 @@ func TestConfig_Validate(t *testing.T) {
 			setup:    func(cfg *Config) { cfg.SymbolsFlushersConcurrency = 0 },
 			expected: errInvalidSymbolFlushersConcurrency.Error(),
 		},
+		"should fail on negative value of block-upload-cleanup-retries": {
+			setup:    func(cfg *Config) { cfg.BlockUploadCleanupRetries = -1 },
+			expected: errInvalidBlockUploadCleanupRetries.Error(),
+		},
+		"should fail on negative value of max-compaction-job-samples": {
+			setup:    func(cfg *Config) { cfg.MaxCompactionJobSamples = -1 },
+			expected: errInvalidMaxCompactionJobSamples.Error(),
+		},
+		"should fail on negative value of max-compaction-job-blocks": {
+			setup:    func(cfg *Config) { cfg.MaxCompactionJobBlocks = -1 },
+			expected: errInvalidMaxCompactionJobBlocks.Error(),
+		},
+		"should fail on max-compaction-job-blocks set to 1": {
+			setup:    func(cfg *Config) { cfg.MaxCompactionJobBlocks = 1 },
+			expected: errInvalidMaxCompactionJobBlocks.Error(),
+		},
+		"should fail on invalid value of max-concurrent-tenants": {
+			setup:    func(cfg *Config) { cfg.MaxConcurrentTenants = 0 },
+			expected: errInvalidMaxConcurrentTenants.Error(),
+		},
+		"should fail on invalid block upload allowed file path": {
+			setup: func(cfg *Config) {
+				cfg.BlockUploadAllowedFilePaths = append(cfg.BlockUploadAllowedFilePaths, `chunks/(\d{7}`)
+			},
+			expected: "invalid block upload allowed file path \"chunks/(\\\\d{7}\": error parsing regexp: missing closing ): `chunks/(\\d{7}`",
+		},
 	}
 
 	for testName, testData := range tests {
@@ -151,6 +178,40 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestConfig_ValidateLimits(t *testing.T) {
+	tests := map[string]struct {
+		validators []string
+		expected   string
+	}{
+		"should pass without validators": {},
+		"should pass with registered validators": {
+			validators: []string{"require-shard"},
+		},
+		"should fail with an unknown validator": {
+			validators: []string{"require-shard", "unknown"},
+			expected:   errors.Errorf(errUnknownBlockUploadValidator, "unknown").Error(),
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := &Config{}
+			flagext.DefaultValues(cfg)
+			cfg.BlockUploadValidators = map[string]BlockUploadValidator{"require-shard": requireShardValidator{}}
+
+			limits := validation.Limits{}
+			flagext.DefaultValues(&limits)
+			limits.CompactorBlockUploadValidators = testData.validators
+
+			if actualErr := cfg.ValidateLimits(limits); testData.expected != "" {
+				assert.EqualError(t, actualErr, testData.expected)
+			} else {
+				assert.NoError(t, actualErr)
+			}
+		})
+	}
+}
+
 func TestMultitenantCompactor_ShouldDoNothingOnNoUserBlocks(t *testing.T) {
 	t.Parallel()
 
@@ -1365,6 +1426,144 @@ func TestMultitenantCompactor_ShouldSkipCompactionForJobsNoMoreOwnedAfterPlannin
 	))
 }
 
+func TestMultitenantCompactor_ShouldCancelCompactionOfTenantMarkedForDeletion(t *testing.T) {
+	t.Parallel()
+
+	storageDir := t.TempDir()
+	bucketClient, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	// Mock a tenant with 2 overlapping blocks, so that a compaction job is planned.
+	spec := []*testutil.BlockSeriesSpec{{
+		Labels: labels.FromStrings(labels.MetricName, "series_1"),
+		Chunks: []chunks.Meta{tsdbutil.ChunkFromSamples([]tsdbutil.Sample{
+			newSample(1574776800000, 0, nil, nil),
+			newSample(1574783999999, 0, nil, nil),
+		})},
+	}}
+	for i := 0; i < 2; i++ {
+		_, err := testutil.GenerateBlockFromSpec("user-1", filepath.Join(storageDir, "user-1"), spec)
+		require.NoError(t, err)
+	}
+
+	cfg := prepareConfig(t)
+	cfg.tenantDeletionCheckInterval = 10 * time.Millisecond
+	c, _, tsdbPlanner, logs, registry := prepare(t, cfg, bucketClient)
+
+	// Mark the tenant for deletion while its compaction job is running, and wait until the job is cancelled.
+	tsdbPlanner.On("Plan", mock.Anything, mock.Anything).Return([]*metadata.Meta{}, context.Canceled).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		require.NoError(t, mimir_tsdb.WriteTenantDeletionMark(context.Background(), bucketClient, "user-1", nil, mimir_tsdb.NewTenantDeletionMark(time.Now())))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Error("compaction job has not been cancelled")
+		}
+	})
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+
+	// Wait until a run has completed.
+	test.Poll(t, 10*time.Second, 1.0, func() interface{} {
+		return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+	})
+
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+
+	// The compaction of the tenant is not retried.
+	tsdbPlanner.AssertNumberOfCalls(t, "Plan", 1)
+
+	logLines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	assert.Contains(t, logLines, `level=info component=compactor user=user-1 msg="cancelling compaction of user blocks because the user has been marked for deletion"`)
+	assert.Contains(t, logLines, `level=info component=compactor msg="compaction for user was interrupted because it has been marked for deletion" user=user-1`)
+
+	assert.NoError(t, prom_testutil.GatherAndCompare(registry, strings.NewReader(`
+		# TYPE cortex_compactor_runs_completed_total counter
+		# HELP cortex_compactor_runs_completed_total Total number of compaction runs successfully completed.
+		cortex_compactor_runs_completed_total 1
+
+		# TYPE cortex_compactor_runs_failed_total counter
+		# HELP cortex_compactor_runs_failed_total Total number of compaction runs failed.
+		cortex_compactor_runs_failed_total{reason="error"} 0
+		cortex_compactor_runs_failed_total{reason="shutdown"} 0
+	`),
+		"cortex_compactor_runs_completed_total",
+		"cortex_compactor_runs_failed_total",
+	))
+}
+
+func TestMultitenantCompactor_ShouldCompactUpToMaxConcurrentTenants(t *testing.T) {
+	t.Parallel()
+
+	const (
+		numTenants           = 6
+		maxConcurrentTenants = 3
+	)
+
+	storageDir := t.TempDir()
+	bucketClient, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	// Mock the tenants with 2 overlapping blocks each, so that a compaction job is planned for each tenant.
+	spec := []*testutil.BlockSeriesSpec{{
+		Labels: labels.FromStrings(labels.MetricName, "series_1"),
+		Chunks: []chunks.Meta{tsdbutil.ChunkFromSamples([]tsdbutil.Sample{
+			newSample(1574776800000, 0, nil, nil),
+			newSample(1574783999999, 0, nil, nil),
+		})},
+	}}
+	for i := 0; i < numTenants; i++ {
+		userID := fmt.Sprintf("user-%d", i)
+		for j := 0; j < 2; j++ {
+			_, err := testutil.GenerateBlockFromSpec(userID, filepath.Join(storageDir, userID), spec)
+			require.NoError(t, err)
+		}
+	}
+
+	cfg := prepareConfig(t)
+	cfg.MaxConcurrentTenants = maxConcurrentTenants
+	c, _, tsdbPlanner, _, _ := prepare(t, cfg, bucketClient)
+
+	// Keep track of the number of tenants being compacted at the same time. The planner
+	// is called once per tenant, and holds the compaction of the tenant for a while.
+	var (
+		mtx        sync.Mutex
+		running    int
+		maxRunning int
+	)
+	tsdbPlanner.On("Plan", mock.Anything, mock.Anything).Return([]*metadata.Meta{}, nil).Run(func(args mock.Arguments) {
+		mtx.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mtx.Unlock()
+
+		defer func() {
+			mtx.Lock()
+			running--
+			mtx.Unlock()
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c))
+
+	// Wait until a run has completed.
+	test.Poll(t, 10*time.Second, 1.0, func() interface{} {
+		return prom_testutil.ToFloat64(c.compactionRunsCompleted)
+	})
+
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), c))
+
+	// All tenants have been compacted, but never more than the configured number at the same time.
+	tsdbPlanner.AssertNumberOfCalls(t, "Plan", numTenants)
+	assert.LessOrEqual(t, maxRunning, maxConcurrentTenants)
+	assert.Greater(t, maxRunning, 1)
+}
+
 func TestMultitenantCompactor_ShouldSkipCompactionForJobsWithFirstLevelCompactionBlocksAndWaitPeriodNotElapsed(t *testing.T) {
 	t.Parallel()
 
@@ -1703,11 +1902,15 @@ func prepareWithConfigProvider(t *testing.T, compactorCfg Config, bucketClient o
 		return bucketClient, nil
 	}
 
-	blocksCompactorFactory := func(ctx context.Context, cfg Config, logger log.Logger, reg prometheus.Registerer) (Compactor, Planner, error) {
-		return tsdbCompactor, tsdbPlanner, nil
+	blocksPlannerFactory := func(ctx context.Context, cfg Config, cfgProvider ConfigProvider, userID string, logger log.Logger, reg prometheus.Registerer) Planner {
+		return tsdbPlanner
 	}
 
-	c, err := newMultitenantCompactor(compactorCfg, storageCfg, limits, logger, registry, bucketClientFactory, splitAndMergeGrouperFactory, blocksCompactorFactory)
+	blocksCompactorFactory := func(ctx context.Context, cfg Config, logger log.Logger, reg prometheus.Registerer) (Compactor, error) {
+		return tsdbCompactor, nil
+	}
+
+	c, err := newMultitenantCompactor(compactorCfg, storageCfg, limits, logger, registry, bucketClientFactory, splitAndMergeGrouperFactory, blocksPlannerFactory, blocksCompactorFactory)
 	require.NoError(t, err)
 
 	return c, tsdbCompactor, tsdbPlanner, logs, registry
@@ -1908,6 +2111,9 @@ func TestMultitenantCompactor_DeleteLocalSyncFiles(t *testing.T) {
 	// Verify that first compactor has synced all the users, plus there is one extra we have just created.
 	require.Equal(t, numUsers+1, len(c1.listTenantsWithMetaSyncDirectories()))
 
+	// The queue depth is tracked for all the users compacted by the first compactor.
+	require.Equal(t, numUsers, prom_testutil.CollectAndCount(c1.bucketCompactorMetrics.queueDepth))
+
 	// Now start second compactor, and wait until it runs compaction.
 	require.NoError(t, services.StartAndAwaitRunning(context.Background(), c2))
 	test.Poll(t, 10*time.Second, 1.0, func() interface{} {
@@ -1925,6 +2131,9 @@ func TestMultitenantCompactor_DeleteLocalSyncFiles(t *testing.T) {
 	// Now compactor 1 should have cleaned old sync files.
 	require.NotEqual(t, numUsers, c1Users)
 	require.Equal(t, numUsers, c1Users+c2Users)
+
+	// The queue depth of the users not owned anymore has been removed too.
+	require.Equal(t, c1Users, prom_testutil.CollectAndCount(c1.bucketCompactorMetrics.queueDepth))
 }
 
 func TestMultitenantCompactor_ShouldFailCompactionOnTimeout(t *testing.T) {
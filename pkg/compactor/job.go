@@ -15,6 +15,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/thanos-io/objstore"
 
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
 )
@@ -29,13 +30,14 @@ type Job struct {
 	metasByMinTime []*metadata.Meta
 	useSplitting   bool
 	shardingKey    string
+	strategy       string
 
 	// The number of shards to split compacted block into. Not used if splitting is disabled.
 	splitNumShards uint32
 }
 
 // NewJob returns a new compaction Job.
-func NewJob(userID string, key string, lset labels.Labels, resolution int64, useSplitting bool, splitNumShards uint32, shardingKey string) *Job {
+func NewJob(userID string, key string, lset labels.Labels, resolution int64, useSplitting bool, splitNumShards uint32, shardingKey string, strategy string) *Job {
 	return &Job{
 		userID:         userID,
 		key:            key,
@@ -44,6 +46,7 @@ func NewJob(userID string, key string, lset labels.Labels, resolution int64, use
 		useSplitting:   useSplitting,
 		splitNumShards: splitNumShards,
 		shardingKey:    shardingKey,
+		strategy:       strategy,
 	}
 }
 
@@ -59,6 +62,13 @@ func (job *Job) Key() string {
 
 // AppendMeta the block with the given meta to the job.
 func (job *Job) AppendMeta(meta *metadata.Meta) error {
+	// The shard ID is checked on its own to report a clearer error, since a block of
+	// another shard is more likely a planning bug than a block with different labels.
+	if shardID := job.labels.Get(mimir_tsdb.CompactorShardIDExternalLabel); shardID != "" {
+		if blockShardID := meta.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel]; blockShardID != shardID {
+			return fmt.Errorf("block shard ID %q does not match the job shard ID %q", blockShardID, shardID)
+		}
+	}
 	if !labels.Equal(job.labels, labels.FromMap(meta.Thanos.Labels)) {
 		return errors.New("block and group labels do not match")
 	}
@@ -103,6 +113,15 @@ func (job *Job) MaxTime() int64 {
 	return max
 }
 
+// TimeRange returns the min MinTime and the max MaxTime across all job's blocks.
+// If the job has no blocks, it returns 0 for both.
+func (job *Job) TimeRange() (minT, maxT int64) {
+	if len(job.metasByMinTime) == 0 {
+		return 0, 0
+	}
+	return job.MinTime(), job.MaxTime()
+}
+
 // MinCompactionLevel returns the minimum compaction level across all source blocks
 // in this job.
 func (job *Job) MinCompactionLevel() int {
@@ -117,6 +136,20 @@ func (job *Job) MinCompactionLevel() int {
 	return min
 }
 
+// MaxCompactionLevel returns the maximum compaction level across all source blocks
+// in this job.
+func (job *Job) MaxCompactionLevel() int {
+	max := math.MinInt
+
+	for _, m := range job.metasByMinTime {
+		if m.Compaction.Level > max {
+			max = m.Compaction.Level
+		}
+	}
+
+	return max
+}
+
 // Metas returns the metadata for each block that is part of this job, ordered by the block's MinTime
 func (job *Job) Metas() []*metadata.Meta {
 	out := make([]*metadata.Meta, len(job.metasByMinTime))
@@ -134,6 +167,11 @@ func (job *Job) Resolution() int64 {
 	return job.resolution
 }
 
+// Strategy returns the name of the compaction strategy which planned the job.
+func (job *Job) Strategy() string {
+	return job.strategy
+}
+
 // UseSplitting returns whether blocks should be splitted into multiple shards when compacted.
 func (job *Job) UseSplitting() bool {
 	return job.useSplitting
@@ -150,19 +188,21 @@ func (job *Job) ShardingKey() string {
 }
 
 func (job *Job) String() string {
-	return fmt.Sprintf("%s (minTime: %d maxTime: %d)", job.Key(), job.MinTime(), job.MaxTime())
+	minT, maxT := job.TimeRange()
+	return fmt.Sprintf("%s (minTime: %d maxTime: %d)", job.Key(), minT, maxT)
 }
 
-// jobWaitPeriodElapsed returns whether the 1st level compaction wait period has
-// elapsed for the input job. If the wait period has not elapsed, then this function
+// jobWaitPeriodElapsed returns whether the compaction wait period has elapsed for
+// the input job. The wait period only applies to jobs whose lowest compaction level
+// is up to maxLevel. If the wait period has not elapsed, then this function
 // also returns the Meta of the first source block encountered for which the wait
 // period has not elapsed yet.
-func jobWaitPeriodElapsed(ctx context.Context, job *Job, waitPeriod time.Duration, userBucket objstore.Bucket) (bool, *metadata.Meta, error) {
+func jobWaitPeriodElapsed(ctx context.Context, job *Job, waitPeriod time.Duration, maxLevel int, userBucket objstore.Bucket) (bool, *metadata.Meta, error) {
 	if waitPeriod <= 0 {
 		return true, nil, nil
 	}
 
-	if job.MinCompactionLevel() > 1 {
+	if job.MinCompactionLevel() > maxLevel {
 		return true, nil, nil
 	}
 
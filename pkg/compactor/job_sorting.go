@@ -51,8 +51,10 @@ func sortJobsBySmallestRangeOldestBlocksFirst(jobs []*Job) []*Job {
 		}
 
 		if checkLength {
-			iLength := jobs[i].MaxTime() - jobs[i].MinTime()
-			jLength := jobs[j].MaxTime() - jobs[j].MinTime()
+			iMinTime, iMaxTime := jobs[i].TimeRange()
+			jMinTime, jMaxTime := jobs[j].TimeRange()
+			iLength := iMaxTime - iMinTime
+			jLength := jMaxTime - jMinTime
 
 			if iLength != jLength {
 				return iLength < jLength
@@ -4,6 +4,7 @@ package compactor
 
 import (
 	"context"
+	"math"
 	"path"
 	"testing"
 	"time"
@@ -17,12 +18,48 @@ import (
 	"github.com/thanos-io/objstore"
 
 	"github.com/grafana/mimir/pkg/storage/bucket"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
 )
 
+func TestJob_AppendMeta(t *testing.T) {
+	shardLabels := func(shardID string) map[string]string {
+		return map[string]string{mimir_tsdb.CompactorShardIDExternalLabel: shardID}
+	}
+
+	t.Run("block of the job's shard", func(t *testing.T) {
+		job := NewJob("user-1", "group-1", labels.FromMap(shardLabels("1_of_2")), 0, false, 2, "shard-1", CompactionStrategySplitMerge)
+		require.NoError(t, job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}, Thanos: metadata.Thanos{Labels: shardLabels("1_of_2")}}))
+		assert.Len(t, job.Metas(), 1)
+	})
+
+	t.Run("block of another shard", func(t *testing.T) {
+		job := NewJob("user-1", "group-1", labels.FromMap(shardLabels("1_of_2")), 0, false, 2, "shard-1", CompactionStrategySplitMerge)
+		err := job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}, Thanos: metadata.Thanos{Labels: shardLabels("2_of_2")}})
+		require.EqualError(t, err, `block shard ID "2_of_2" does not match the job shard ID "1_of_2"`)
+		assert.Empty(t, job.Metas())
+	})
+
+	t.Run("block without shard", func(t *testing.T) {
+		job := NewJob("user-1", "group-1", labels.FromMap(shardLabels("1_of_2")), 0, false, 2, "shard-1", CompactionStrategySplitMerge)
+		err := job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}})
+		require.EqualError(t, err, `block shard ID "" does not match the job shard ID "1_of_2"`)
+		assert.Empty(t, job.Metas())
+	})
+
+	t.Run("job without shard", func(t *testing.T) {
+		job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1", CompactionStrategySplitMerge)
+		require.NoError(t, job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil)}}))
+
+		err := job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(2, nil)}, Thanos: metadata.Thanos{Labels: shardLabels("1_of_2")}})
+		require.EqualError(t, err, "block and group labels do not match")
+		assert.Len(t, job.Metas(), 1)
+	})
+}
+
 func TestJob_MinCompactionLevel(t *testing.T) {
-	job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1")
+	job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1", CompactionStrategySplitMerge)
 	require.NoError(t, job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), Compaction: tsdb.BlockMetaCompaction{Level: 2}}}))
 	assert.Equal(t, 2, job.MinCompactionLevel())
 
@@ -33,6 +70,67 @@ func TestJob_MinCompactionLevel(t *testing.T) {
 	assert.Equal(t, 1, job.MinCompactionLevel())
 }
 
+func TestJob_MaxCompactionLevel(t *testing.T) {
+	job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1", CompactionStrategySplitMerge)
+	assert.Equal(t, math.MinInt, job.MaxCompactionLevel())
+
+	require.NoError(t, job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), Compaction: tsdb.BlockMetaCompaction{Level: 2}}}))
+	assert.Equal(t, 2, job.MaxCompactionLevel())
+
+	require.NoError(t, job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(2, nil), Compaction: tsdb.BlockMetaCompaction{Level: 1}}}))
+	assert.Equal(t, 2, job.MaxCompactionLevel())
+
+	require.NoError(t, job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(3, nil), Compaction: tsdb.BlockMetaCompaction{Level: 3}}}))
+	assert.Equal(t, 3, job.MaxCompactionLevel())
+}
+
+func TestJob_TimeRange(t *testing.T) {
+	appendBlock := func(t *testing.T, job *Job, id uint64, minT, maxT int64) {
+		require.NoError(t, job.AppendMeta(&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(id, nil), MinTime: minT, MaxTime: maxT}}))
+	}
+
+	t.Run("overlapping blocks", func(t *testing.T) {
+		job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1", CompactionStrategySplitMerge)
+		minT, maxT := job.TimeRange()
+		assert.Equal(t, int64(0), minT)
+		assert.Equal(t, int64(0), maxT)
+
+		appendBlock(t, job, 1, 20, 40)
+		minT, maxT = job.TimeRange()
+		assert.Equal(t, int64(20), minT)
+		assert.Equal(t, int64(40), maxT)
+
+		appendBlock(t, job, 2, 10, 30)
+		minT, maxT = job.TimeRange()
+		assert.Equal(t, int64(10), minT)
+		assert.Equal(t, int64(40), maxT)
+
+		appendBlock(t, job, 3, 15, 35)
+		minT, maxT = job.TimeRange()
+		assert.Equal(t, int64(10), minT)
+		assert.Equal(t, int64(40), maxT)
+	})
+
+	t.Run("disjoint blocks", func(t *testing.T) {
+		job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1", CompactionStrategySplitMerge)
+
+		appendBlock(t, job, 1, 100, 200)
+		minT, maxT := job.TimeRange()
+		assert.Equal(t, int64(100), minT)
+		assert.Equal(t, int64(200), maxT)
+
+		appendBlock(t, job, 2, 300, 400)
+		minT, maxT = job.TimeRange()
+		assert.Equal(t, int64(100), minT)
+		assert.Equal(t, int64(400), maxT)
+
+		appendBlock(t, job, 3, 0, 50)
+		minT, maxT = job.TimeRange()
+		assert.Equal(t, int64(0), minT)
+		assert.Equal(t, int64(400), maxT)
+	})
+}
+
 func TestJobWaitPeriodElapsed(t *testing.T) {
 	type jobBlock struct {
 		meta     *metadata.Meta
@@ -50,6 +148,7 @@ func TestJobWaitPeriodElapsed(t *testing.T) {
 
 	tests := map[string]struct {
 		waitPeriod      time.Duration
+		maxLevel        int // Defaults to 1 if not set.
 		jobBlocks       []jobBlock
 		expectedElapsed bool
 		expectedMeta    *metadata.Meta
@@ -91,6 +190,26 @@ func TestJobWaitPeriodElapsed(t *testing.T) {
 			expectedElapsed: true,
 			expectedMeta:    nil,
 		},
+		"blocks uploaded since less than the wait period, their compaction level is > 1 and the max level is 2": {
+			waitPeriod: 10 * time.Minute,
+			maxLevel:   2,
+			jobBlocks: []jobBlock{
+				{meta: meta3, attrs: objstore.ObjectAttributes{LastModified: time.Now().Add(-4 * time.Minute)}},
+				{meta: meta4, attrs: objstore.ObjectAttributes{LastModified: time.Now().Add(-5 * time.Minute)}},
+			},
+			expectedElapsed: false,
+			expectedMeta:    meta3,
+		},
+		"blocks uploaded since more than the wait period, their compaction level is > 1 and the max level is 2": {
+			waitPeriod: 10 * time.Minute,
+			maxLevel:   2,
+			jobBlocks: []jobBlock{
+				{meta: meta3, attrs: objstore.ObjectAttributes{LastModified: time.Now().Add(-20 * time.Minute)}},
+				{meta: meta4, attrs: objstore.ObjectAttributes{LastModified: time.Now().Add(-25 * time.Minute)}},
+			},
+			expectedElapsed: true,
+			expectedMeta:    nil,
+		},
 		"an error occurred while checking the blocks upload timestamp": {
 			waitPeriod: 10 * time.Minute,
 			jobBlocks: []jobBlock{
@@ -107,7 +226,7 @@ func TestJobWaitPeriodElapsed(t *testing.T) {
 
 	for testName, testData := range tests {
 		t.Run(testName, func(t *testing.T) {
-			job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1")
+			job := NewJob("user-1", "group-1", labels.EmptyLabels(), 0, true, 2, "shard-1", CompactionStrategySplitMerge)
 			for _, b := range testData.jobBlocks {
 				require.NoError(t, job.AppendMeta(b.meta))
 			}
@@ -117,7 +236,12 @@ func TestJobWaitPeriodElapsed(t *testing.T) {
 				userBucket.MockAttributes(path.Join(b.meta.ULID.String(), block.MetaFilename), b.attrs, b.attrsErr)
 			}
 
-			elapsed, meta, err := jobWaitPeriodElapsed(context.Background(), job, testData.waitPeriod, userBucket)
+			maxLevel := testData.maxLevel
+			if maxLevel == 0 {
+				maxLevel = 1
+			}
+
+			elapsed, meta, err := jobWaitPeriodElapsed(context.Background(), job, testData.waitPeriod, maxLevel, userBucket)
 			if testData.expectedErr != "" {
 				require.Error(t, err)
 				assert.ErrorContains(t, err, testData.expectedErr)
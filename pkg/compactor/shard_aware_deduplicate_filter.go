@@ -19,9 +19,34 @@ import (
 
 const duplicateMeta = "duplicate"
 
+// DuplicatePreference decides which of two blocks having exactly the same data is kept by the
+// ShardAwareDeduplicateFilter. It returns true if block a should be kept over block b.
+type DuplicatePreference func(a, b *metadata.Meta) bool
+
+// PreferHigherCompactionLevel is a DuplicatePreference keeping the block with the highest compaction level.
+func PreferHigherCompactionLevel(a, b *metadata.Meta) bool {
+	return a.Compaction.Level > b.Compaction.Level
+}
+
+// PreferLargerBlock is a DuplicatePreference keeping the block with the largest size, as listed in its meta.
+func PreferLargerBlock(a, b *metadata.Meta) bool {
+	return blockSize(a) > blockSize(b)
+}
+
+func blockSize(m *metadata.Meta) int64 {
+	size := int64(0)
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	return size
+}
+
 // ShardAwareDeduplicateFilter is a BaseFetcher filter that filters out older blocks that have exactly the same data.
 // Not go-routine safe.
 type ShardAwareDeduplicateFilter struct {
+	// Preference between blocks with the same data. If nil, or if it has no preference, the newest block is kept.
+	prefer DuplicatePreference
+
 	// List of duplicate IDs after last Filter call.
 	duplicateIDs []ulid.ULID
 }
@@ -31,6 +56,12 @@ func NewShardAwareDeduplicateFilter() *ShardAwareDeduplicateFilter {
 	return &ShardAwareDeduplicateFilter{}
 }
 
+// NewShardAwareDeduplicateFilterWithPreference creates ShardAwareDeduplicateFilter keeping, among blocks
+// with the same data, the one preferred by prefer.
+func NewShardAwareDeduplicateFilterWithPreference(prefer DuplicatePreference) *ShardAwareDeduplicateFilter {
+	return &ShardAwareDeduplicateFilter{prefer: prefer}
+}
+
 // Filter filters out from metas, the initial map of blocks, all the blocks that are contained in other, compacted, blocks.
 // The removed blocks are source blocks of the blocks that remain in metas after the filtering is executed.
 func (f *ShardAwareDeduplicateFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced block.GaugeVec, modified block.GaugeVec) error {
@@ -119,12 +150,21 @@ func (f *ShardAwareDeduplicateFilter) findDuplicates(ctx context.Context, input
 	// 1) sorting the input blocks by number of sources, and
 	// 2) iterating through each input block, and adding it to the correct place in the tree of blocks with successors.
 
-	// Sort blocks with fewer sources first.
+	// Sort blocks with fewer sources first. Among blocks with the same data, the last one is kept,
+	// so the preferred block is sorted after the others.
 	sort.Slice(input, func(i, j int) bool {
 		ilen := len(input[i].Compaction.Sources)
 		jlen := len(input[j].Compaction.Sources)
 
 		if ilen == jlen {
+			if f.prefer != nil {
+				if f.prefer(input[j], input[i]) {
+					return true
+				}
+				if f.prefer(input[i], input[j]) {
+					return false
+				}
+			}
 			return input[i].ULID.Compare(input[j].ULID) < 0
 		}
 
@@ -385,6 +385,70 @@ func TestShardAwareDeduplicateFilter_Filter(t *testing.T) {
 	}
 }
 
+func TestShardAwareDeduplicateFilter_Preference(t *testing.T) {
+	newMeta := func(id ulid.ULID, level int, size int64) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{
+				ULID: id,
+				Compaction: tsdb.BlockMetaCompaction{
+					Level:   level,
+					Sources: []ulid.ULID{ULID(1), ULID(2)},
+				},
+			},
+			Thanos: metadata.Thanos{
+				Files: []metadata.File{{RelPath: "index", SizeBytes: size}},
+			},
+		}
+	}
+
+	// Three blocks with exactly the same data, plus one of their sources.
+	input := map[ulid.ULID]*metadata.Meta{
+		ULID(1):  {BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Compaction: tsdb.BlockMetaCompaction{Level: 1, Sources: []ulid.ULID{ULID(1)}}}},
+		ULID(10): newMeta(ULID(10), 3, 100),
+		ULID(11): newMeta(ULID(11), 2, 300),
+		ULID(12): newMeta(ULID(12), 2, 200),
+	}
+
+	testcases := map[string]struct {
+		filter   *ShardAwareDeduplicateFilter
+		expected ulid.ULID
+	}{
+		"default": {
+			filter:   NewShardAwareDeduplicateFilter(),
+			expected: ULID(12),
+		},
+		"prefer higher compaction level": {
+			filter:   NewShardAwareDeduplicateFilterWithPreference(PreferHigherCompactionLevel),
+			expected: ULID(10),
+		},
+		"prefer larger block": {
+			filter:   NewShardAwareDeduplicateFilterWithPreference(PreferLargerBlock),
+			expected: ULID(11),
+		},
+		"prefer oldest block": {
+			filter: NewShardAwareDeduplicateFilterWithPreference(func(a, b *metadata.Meta) bool {
+				return a.ULID.Compare(b.ULID) < 0
+			}),
+			expected: ULID(10),
+		},
+	}
+
+	for name, tcase := range testcases {
+		t.Run(name, func(t *testing.T) {
+			m := newTestFetcherMetrics()
+
+			metas := make(map[ulid.ULID]*metadata.Meta, len(input))
+			for id, meta := range input {
+				metas[id] = meta
+			}
+
+			require.NoError(t, tcase.filter.Filter(context.Background(), metas, m.Synced, m.Modified))
+			require.Equal(t, map[ulid.ULID]*metadata.Meta{tcase.expected: input[tcase.expected]}, metas)
+			require.Equal(t, float64(3), promtest.ToFloat64(m.Synced.WithLabelValues(duplicateMeta)))
+		})
+	}
+}
+
 func newTestFetcherMetrics() *block.FetcherMetrics {
 	return &block.FetcherMetrics{
 		Synced:   extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{}, []string{"state"}),
@@ -8,22 +8,42 @@ import (
 	"github.com/go-kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/tsdb"
+
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 )
 
+// CompactionStrategySplitMerge is the name of the split-and-merge compaction strategy, recorded
+// in the meta.json of the blocks it produces.
+const CompactionStrategySplitMerge = "split-merge"
+
 func splitAndMergeGrouperFactory(ctx context.Context, cfg Config, cfgProvider ConfigProvider, userID string, logger log.Logger, reg prometheus.Registerer) Grouper {
+	ranges := blockRangesForUser(cfg, cfgProvider, userID)
 	return NewSplitAndMergeGrouper(
 		userID,
-		cfg.BlockRanges.ToMilliseconds(),
+		ranges.ToMilliseconds(),
 		uint32(cfgProvider.CompactorSplitAndMergeShards(userID)),
 		uint32(cfgProvider.CompactorSplitGroups(userID)),
+		cfg.GroupBlocksBySource,
+		cfg.ReshardUploadedBlocks,
+		uint64(cfg.MaxCompactionJobSamples),
+		cfg.MaxCompactionJobBlocks,
 		logger)
 }
 
-func splitAndMergeCompactorFactory(ctx context.Context, cfg Config, logger log.Logger, reg prometheus.Registerer) (Compactor, Planner, error) {
-	// We don't need to customise the TSDB compactor so we're just using the Prometheus one.
+func splitAndMergePlannerFactory(ctx context.Context, cfg Config, cfgProvider ConfigProvider, userID string, logger log.Logger, reg prometheus.Registerer) Planner {
+	// The planner checks the jobs against the largest compaction range, so it must use
+	// the same ranges the blocks have been grouped by.
+	ranges := blockRangesForUser(cfg, cfgProvider, userID)
+	return NewSplitAndMergePlanner(ranges.ToMilliseconds())
+}
+
+func splitAndMergeCompactorFactory(ctx context.Context, cfg Config, logger log.Logger, reg prometheus.Registerer) (Compactor, error) {
+	// We don't need to customise the TSDB compactor so we're just using the Prometheus one. The
+	// TSDB compactor is shared by all tenants: the ranges are only used by its own planning, while
+	// the blocks are planned by the split-and-merge grouper and planner with the tenant's ranges.
 	compactor, err := tsdb.NewLeveledCompactor(ctx, reg, logger, cfg.BlockRanges.ToMilliseconds(), nil, nil, true)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	opts := tsdb.DefaultLeveledCompactorConcurrencyOptions()
@@ -33,12 +53,21 @@ func splitAndMergeCompactorFactory(ctx context.Context, cfg Config, logger log.L
 
 	compactor.SetConcurrencyOptions(opts)
 
-	planner := NewSplitAndMergePlanner(cfg.BlockRanges.ToMilliseconds())
-	return compactor, planner, nil
+	return compactor, nil
+}
+
+// blockRangesForUser returns the compaction ranges configured for the user, or the compactor ones if the
+// user has no specific ranges.
+func blockRangesForUser(cfg Config, cfgProvider ConfigProvider, userID string) mimir_tsdb.DurationList {
+	if ranges := cfgProvider.CompactorBlockRanges(userID); len(ranges) > 0 {
+		return ranges
+	}
+	return cfg.BlockRanges
 }
 
 // configureSplitAndMergeCompactor updates the provided configuration injecting the split-and-merge compactor.
 func configureSplitAndMergeCompactor(cfg *Config) {
 	cfg.BlocksGrouperFactory = splitAndMergeGrouperFactory
+	cfg.BlocksPlannerFactory = splitAndMergePlannerFactory
 	cfg.BlocksCompactorFactory = splitAndMergeCompactorFactory
 }
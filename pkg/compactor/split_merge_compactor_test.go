@@ -5,6 +5,7 @@ package compactor
 import (
 	"context"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -59,10 +60,82 @@ func TestMultitenantCompactor_ShouldSupportSplitAndMergeCompactor(t *testing.T)
 		return labels
 	}
 
+	// markAsUploaded changes the source of the block to the one of the blocks uploaded via the block upload API.
+	markAsUploaded := func(t *testing.T, bkt objstore.Bucket, blockID ulid.ULID) {
+		userBkt := bucket.NewUserBucketClient(userID, bkt, nil)
+		meta, err := block.DownloadMeta(context.Background(), log.NewNopLogger(), userBkt, blockID)
+		require.NoError(t, err)
+		meta.Thanos.Source = metadata.UploadSource
+		require.NoError(t, marshalAndUploadToBucket(context.Background(), userBkt, path.Join(blockID.String(), block.MetaFilename), meta))
+	}
+
 	tests := map[string]struct {
-		numShards int
-		setup     func(t *testing.T, bkt objstore.Bucket) []metadata.Meta
+		numShards             int
+		reshardUploadedBlocks bool
+		setup                 func(t *testing.T, bkt objstore.Bucket) []metadata.Meta
 	}{
+		"uploaded block sharded with a different number of shards should be split again when resharding is enabled": {
+			numShards:             2,
+			reshardUploadedBlocks: true,
+			setup: func(t *testing.T, bkt objstore.Bucket) []metadata.Meta {
+				block1 := createTSDBBlock(t, bkt, userID, blockRangeMillis, 2*blockRangeMillis, numSeries, externalLabels("1_of_3"))
+				markAsUploaded(t, bkt, block1)
+
+				return []metadata.Meta{
+					{
+						BlockMeta: tsdb.BlockMeta{
+							MinTime: 1 * blockRangeMillis,
+							MaxTime: 2 * blockRangeMillis,
+							Compaction: tsdb.BlockMetaCompaction{
+								Sources: []ulid.ULID{block1},
+							},
+						},
+						Thanos: metadata.Thanos{
+							Labels: map[string]string{
+								mimir_tsdb.CompactorShardIDExternalLabel: "1_of_2",
+							},
+						},
+					}, {
+						BlockMeta: tsdb.BlockMeta{
+							MinTime: 1 * blockRangeMillis,
+							MaxTime: 2 * blockRangeMillis,
+							Compaction: tsdb.BlockMetaCompaction{
+								Sources: []ulid.ULID{block1},
+							},
+						},
+						Thanos: metadata.Thanos{
+							Labels: map[string]string{
+								mimir_tsdb.CompactorShardIDExternalLabel: "2_of_2",
+							},
+						},
+					},
+				}
+			},
+		},
+		"uploaded block sharded with a different number of shards should be left as is when resharding is disabled": {
+			numShards: 2,
+			setup: func(t *testing.T, bkt objstore.Bucket) []metadata.Meta {
+				block1 := createTSDBBlock(t, bkt, userID, blockRangeMillis, 2*blockRangeMillis, numSeries, externalLabels("1_of_3"))
+				markAsUploaded(t, bkt, block1)
+
+				return []metadata.Meta{
+					{
+						BlockMeta: tsdb.BlockMeta{
+							MinTime: 1 * blockRangeMillis,
+							MaxTime: 2 * blockRangeMillis,
+							Compaction: tsdb.BlockMetaCompaction{
+								Sources: []ulid.ULID{block1},
+							},
+						},
+						Thanos: metadata.Thanos{
+							Labels: map[string]string{
+								mimir_tsdb.CompactorShardIDExternalLabel: "1_of_3",
+							},
+						},
+					},
+				}
+			},
+		},
 		"overlapping blocks matching the 1st compaction range should be merged and split": {
 			numShards: 2,
 			setup: func(t *testing.T, bkt objstore.Bucket) []metadata.Meta {
@@ -686,6 +759,7 @@ func TestMultitenantCompactor_ShouldSupportSplitAndMergeCompactor(t *testing.T)
 			compactorCfg := prepareConfig(t)
 			compactorCfg.DataDir = workDir
 			compactorCfg.BlockRanges = compactionRanges
+			compactorCfg.ReshardUploadedBlocks = testData.reshardUploadedBlocks
 
 			cfgProvider := newMockConfigProvider()
 			cfgProvider.splitAndMergeShards[userID] = testData.numShards
@@ -721,6 +795,7 @@ func TestMultitenantCompactor_ShouldSupportSplitAndMergeCompactor(t *testing.T)
 				1,
 				userBucket,
 				fetcherDir,
+				0,
 				reg,
 				[]block.MetadataFilter{NewExcludeMarkedForDeletionFilter(userBucket)},
 			)
@@ -739,6 +814,13 @@ func TestMultitenantCompactor_ShouldSupportSplitAndMergeCompactor(t *testing.T)
 				assert.Equal(t, e.MaxTime, actual[i].MaxTime)
 				assert.Equal(t, e.Compaction.Sources, actual[i].Compaction.Sources)
 				assert.Equal(t, e.Thanos.Labels, actual[i].Thanos.Labels)
+
+				// Blocks produced by the compactor must record the strategy which created them.
+				if actual[i].Thanos.Source == metadata.CompactorSource {
+					assert.Equal(t, CompactionStrategySplitMerge, actual[i].Thanos.CompactionStrategy)
+				} else {
+					assert.Empty(t, actual[i].Thanos.CompactionStrategy)
+				}
 			}
 		})
 	}
@@ -812,6 +894,7 @@ func TestMultitenantCompactor_ShouldGuaranteeSeriesShardingConsistencyOverTheTim
 		1,
 		userBucket,
 		fetcherDir,
+		0,
 		reg,
 		[]block.MetadataFilter{NewExcludeMarkedForDeletionFilter(userBucket)},
 	)
@@ -830,6 +913,7 @@ func TestMultitenantCompactor_ShouldGuaranteeSeriesShardingConsistencyOverTheTim
 		assert.Equal(t, 2*blockRangeMillis, actualMeta.MaxTime)
 		assert.Equal(t, []ulid.ULID{blockID}, actualMeta.Compaction.Sources)
 		assert.Equal(t, sharding.FormatShardIDLabelValue(uint64(idx), numShards), actualMeta.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel])
+		assert.Equal(t, CompactionStrategySplitMerge, actualMeta.Thanos.CompactionStrategy)
 	}
 
 	// Ensure each split block contains the right series, based on a series labels
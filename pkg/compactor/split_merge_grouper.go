@@ -28,38 +28,101 @@ type SplitAndMergeGrouper struct {
 
 	// Number of groups that blocks used for splitting are grouped into.
 	splitGroupsCount uint32
+
+	// Whether blocks with a different source (e.g. uploaded vs ingested) should never be compacted together.
+	groupBySource bool
+
+	// Whether uploaded blocks sharded with a different number of shards should be split again.
+	reshardUploadedBlocks bool
+
+	// Max number of samples of the block produced by a merge job. 0 means no limit.
+	maxJobSamples uint64
+
+	// Max number of source blocks of a job. 0 means no limit.
+	maxJobBlocks int
 }
 
 // NewSplitAndMergeGrouper makes a new SplitAndMergeGrouper. The provided ranges must be sorted.
-// If shardCount is 0, the splitting stage is disabled.
+// If shardCount is 0, the splitting stage is disabled. If maxJobSamples is 0, the size of merge jobs is not limited.
+// If maxJobBlocks is 0, the number of source blocks of jobs is not limited.
 func NewSplitAndMergeGrouper(
 	userID string,
 	ranges []int64,
 	shardCount uint32,
 	splitGroupsCount uint32,
+	groupBySource bool,
+	reshardUploadedBlocks bool,
+	maxJobSamples uint64,
+	maxJobBlocks int,
 	logger log.Logger,
 ) *SplitAndMergeGrouper {
 	return &SplitAndMergeGrouper{
-		userID:           userID,
-		ranges:           ranges,
-		shardCount:       shardCount,
-		splitGroupsCount: splitGroupsCount,
-		logger:           logger,
+		userID:                userID,
+		ranges:                ranges,
+		shardCount:            shardCount,
+		splitGroupsCount:      splitGroupsCount,
+		groupBySource:         groupBySource,
+		reshardUploadedBlocks: reshardUploadedBlocks,
+		maxJobSamples:         maxJobSamples,
+		maxJobBlocks:          maxJobBlocks,
+		logger:                logger,
 	}
 }
 
 func (g *SplitAndMergeGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (res []*Job, err error) {
-	flatBlocks := make([]*metadata.Meta, 0, len(blocks))
+	// When grouping by source, blocks with a different source are planned independently,
+	// so that they're never merged together.
+	flatBlocksBySource := map[metadata.SourceType][]*metadata.Meta{}
 	for _, b := range blocks {
-		flatBlocks = append(flatBlocks, b)
+		// Uploaded blocks sharded with a different number of shards are planned as if they were not
+		// sharded, so that they get split again into the current shards. Blocks are only split when
+		// they fit the smallest range, so larger blocks keep their shard ID.
+		if g.reshardUploadedBlocks && len(g.ranges) > 0 && isMisShardedUpload(b, g.shardCount) {
+			if fitsRange(b, g.ranges[0]) {
+				level.Info(g.logger).Log("msg", "uploaded block is sharded with a different number of shards, it will be split again", "block", b.ULID, "shard_id", b.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel], "shard_count", g.shardCount)
+				b = withoutShardIDLabel(b)
+			} else {
+				level.Warn(g.logger).Log("msg", "uploaded block is sharded with a different number of shards, but it can't be split again because it's larger than the smallest compaction range", "block", b.ULID, "shard_id", b.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel], "shard_count", g.shardCount)
+			}
+		}
+
+		var source metadata.SourceType
+		if g.groupBySource {
+			source = b.Thanos.GetOriginSource()
+		}
+		flatBlocksBySource[source] = append(flatBlocksBySource[source], b)
+	}
+
+	// Plan sources in a stable order.
+	sources := make([]metadata.SourceType, 0, len(flatBlocksBySource))
+	for source := range flatBlocksBySource {
+		sources = append(sources, source)
 	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i] < sources[j] })
 
+	for _, source := range sources {
+		jobs, err := g.groupsForBlocks(source, flatBlocksBySource[source])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, jobs...)
+	}
+
+	return res, nil
+}
+
+func (g *SplitAndMergeGrouper) groupsForBlocks(source metadata.SourceType, flatBlocks []*metadata.Meta) (res []*Job, err error) {
+	var jobs []*job
 	for _, job := range planCompaction(g.userID, flatBlocks, g.ranges, g.shardCount, g.splitGroupsCount) {
 		// Sanity check: if splitting is disabled, we don't expect any job for the split stage.
 		if g.shardCount <= 0 && job.stage == stageSplit {
 			return nil, errors.Errorf("unexpected split stage job because splitting is disabled: %s", job.String())
 		}
 
+		jobs = append(jobs, g.splitJob(job)...)
+	}
+
+	for _, job := range jobs {
 		// The group key is used by the compactor as a unique identifier of the compaction job.
 		// Its content is not important for the compactor, but uniqueness must be guaranteed.
 		groupKey := fmt.Sprintf("%s-%s-%s-%d-%d",
@@ -68,6 +131,12 @@ func (g *SplitAndMergeGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (res
 			job.shardID,
 			job.rangeStart,
 			job.rangeEnd)
+		if job.part > 0 {
+			groupKey = fmt.Sprintf("%s-part%d", groupKey, job.part)
+		}
+		if source != "" {
+			groupKey = fmt.Sprintf("%s-%s", groupKey, source)
+		}
 
 		// All the blocks within the same group have the same downsample
 		// resolution and external labels.
@@ -82,6 +151,7 @@ func (g *SplitAndMergeGrouper) Groups(blocks map[ulid.ULID]*metadata.Meta) (res
 			job.stage == stageSplit,
 			g.shardCount,
 			job.shardingKey(),
+			CompactionStrategySplitMerge,
 		)
 
 		for _, m := range job.blocks {
@@ -174,6 +244,117 @@ func planCompaction(userID string, blocks []*metadata.Meta, ranges []int64, shar
 	return jobs
 }
 
+// splitOversizedJob splits the input merge job into smaller jobs of blocks adjacent in time, each one
+// producing a block with at most maxSamples samples (estimated from the source blocks). Blocks which
+// would exceed the limit even if compacted with just one adjacent block are left alone.
+func splitOversizedJob(j *job, maxSamples uint64) []*job {
+	var (
+		out     []*job
+		blocks  []*metadata.Meta
+		samples uint64
+	)
+
+	flush := func() {
+		// No merging to do if there are less than 2 blocks.
+		if len(blocks) >= 2 {
+			out = append(out, &job{
+				userID:  j.userID,
+				stage:   j.stage,
+				shardID: j.shardID,
+				part:    len(out) + 1,
+				blocksGroup: blocksGroup{
+					rangeStart: j.rangeStart,
+					rangeEnd:   j.rangeEnd,
+					blocks:     blocks,
+				},
+			})
+		}
+		blocks, samples = nil, 0
+	}
+
+	// Blocks are expected to be sorted by MinTime.
+	for _, b := range j.blocks {
+		if len(blocks) > 0 && samples+b.Stats.NumSamples > maxSamples {
+			flush()
+		}
+		blocks = append(blocks, b)
+		samples += b.Stats.NumSamples
+	}
+	flush()
+
+	return out
+}
+
+// splitJob returns the input job split into smaller jobs if it exceeds the max number of samples
+// or source blocks, otherwise it returns the input job as is.
+func (g *SplitAndMergeGrouper) splitJob(j *job) []*job {
+	parts := []*job{j}
+	if g.maxJobSamples > 0 && j.stage == stageMerge {
+		if samples := j.estimatedSamples(); samples > g.maxJobSamples {
+			parts = splitOversizedJob(j, g.maxJobSamples)
+			level.Info(g.logger).Log("msg", "compaction job output would exceed the max number of samples, splitting it into smaller jobs", "job", j.String(), "estimated_samples", samples, "max_samples", g.maxJobSamples, "parts", len(parts))
+		}
+	}
+
+	if g.maxJobBlocks > 0 && len(j.blocks) > g.maxJobBlocks {
+		if limited, split := splitJobsByBlocks(parts, g.maxJobBlocks); split {
+			level.Info(g.logger).Log("msg", "compaction job has too many source blocks, splitting it into smaller jobs", "job", j.String(), "blocks", len(j.blocks), "max_blocks", g.maxJobBlocks, "parts", len(limited))
+			parts = limited
+		}
+	}
+
+	return parts
+}
+
+// splitJobsByBlocks splits the input jobs, which are parts of the same job, having more than maxBlocks source
+// blocks into sequential jobs of up to maxBlocks blocks each, covering the same time range. The blocks are
+// spread evenly across the parts. Parts of a merge job with less than 2 blocks are dropped, since there's
+// nothing to merge. It also returns whether any job has been split.
+func splitJobsByBlocks(jobs []*job, maxBlocks int) (out []*job, split bool) {
+	for _, j := range jobs {
+		if len(j.blocks) <= maxBlocks {
+			out = append(out, j)
+			continue
+		}
+		split = true
+
+		// Blocks are expected to be sorted by MinTime.
+		numParts := (len(j.blocks) + maxBlocks - 1) / maxBlocks
+		partSize := (len(j.blocks) + numParts - 1) / numParts
+		for start := 0; start < len(j.blocks); start += partSize {
+			end := start + partSize
+			if end > len(j.blocks) {
+				end = len(j.blocks)
+			}
+
+			// No merging to do if there are less than 2 blocks.
+			if j.stage == stageMerge && end-start < 2 {
+				continue
+			}
+
+			out = append(out, &job{
+				userID:  j.userID,
+				stage:   j.stage,
+				shardID: j.shardID,
+				blocksGroup: blocksGroup{
+					rangeStart: j.rangeStart,
+					rangeEnd:   j.rangeEnd,
+					blocks:     j.blocks[start:end],
+				},
+			})
+		}
+	}
+
+	// Number the parts sequentially, since they're all parts of the same job.
+	if split {
+		for i, j := range out {
+			j.part = i + 1
+		}
+	}
+
+	return out, split
+}
+
 // planCompactionByRange analyze the input blocks and returns a list of compaction jobs to
 // compact blocks for the given compaction time range. Input blocks MUST be sorted by MinTime.
 func planCompactionByRange(userID string, blocks []*metadata.Meta, tr int64, isSmallestRange bool, shardCount, splitGroups uint32) (jobs []*job) {
@@ -358,6 +539,39 @@ func getMaxTime(blocks []*metadata.Meta) int64 {
 	return maxTime
 }
 
+// isMisShardedUpload returns whether the block has been uploaded with a shard ID external label which doesn't
+// match the given shard count. Blocks can't be mis-sharded if splitting is disabled.
+func isMisShardedUpload(meta *metadata.Meta, shardCount uint32) bool {
+	if shardCount == 0 || meta.Thanos.Source != metadata.UploadSource {
+		return false
+	}
+
+	shardID, ok := meta.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel]
+	if !ok || shardID == "" {
+		return false
+	}
+
+	_, count, err := sharding.ParseShardIDLabelValue(shardID)
+	return err != nil || count != uint64(shardCount)
+}
+
+// fitsRange returns whether the block falls into a single aligned time range of size tr.
+func fitsRange(meta *metadata.Meta, tr int64) bool {
+	return meta.MaxTime <= getRangeStart(meta, tr)+tr
+}
+
+// withoutShardIDLabel returns a copy of the meta without the shard ID external label.
+func withoutShardIDLabel(meta *metadata.Meta) *metadata.Meta {
+	out := *meta
+	out.Thanos.Labels = make(map[string]string, len(meta.Thanos.Labels))
+	for k, v := range meta.Thanos.Labels {
+		if k != mimir_tsdb.CompactorShardIDExternalLabel {
+			out.Thanos.Labels[k] = v
+		}
+	}
+	return &out
+}
+
 // defaultGroupKeyWithoutShardID returns the default group key excluding ShardIDLabelName
 // when computing it.
 func defaultGroupKeyWithoutShardID(meta metadata.Thanos) string {
@@ -3,11 +3,15 @@
 package compactor
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
@@ -522,6 +526,328 @@ func TestPlanCompaction(t *testing.T) {
 	}
 }
 
+func TestSplitAndMergeGrouper_GroupBySource(t *testing.T) {
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	block3 := ulid.MustNew(3, nil)
+	block4 := ulid.MustNew(4, nil)
+
+	// The blocks of the first compaction level.
+	level1Blocks := map[ulid.ULID]*metadata.Meta{
+		block1: {BlockMeta: tsdb.BlockMeta{ULID: block1, MinTime: 0, MaxTime: 10}, Thanos: metadata.Thanos{Source: "ingester"}},
+		block2: {BlockMeta: tsdb.BlockMeta{ULID: block2, MinTime: 10, MaxTime: 20}, Thanos: metadata.Thanos{Source: "ingester"}},
+		block3: {BlockMeta: tsdb.BlockMeta{ULID: block3, MinTime: 0, MaxTime: 10}, Thanos: metadata.Thanos{Source: "upload"}},
+		block4: {BlockMeta: tsdb.BlockMeta{ULID: block4, MinTime: 10, MaxTime: 20}, Thanos: metadata.Thanos{Source: "upload"}},
+	}
+
+	// The blocks of the second compaction level, created by the compactor from blocks of different sources.
+	level2Blocks := map[ulid.ULID]*metadata.Meta{
+		block1: {BlockMeta: tsdb.BlockMeta{ULID: block1, MinTime: 0, MaxTime: 20}, Thanos: metadata.Thanos{Source: metadata.CompactorSource, OriginSource: "ingester"}},
+		block2: {BlockMeta: tsdb.BlockMeta{ULID: block2, MinTime: 20, MaxTime: 40}, Thanos: metadata.Thanos{Source: metadata.CompactorSource, OriginSource: "ingester"}},
+		block3: {BlockMeta: tsdb.BlockMeta{ULID: block3, MinTime: 0, MaxTime: 20}, Thanos: metadata.Thanos{Source: metadata.CompactorSource, OriginSource: "upload"}},
+		block4: {BlockMeta: tsdb.BlockMeta{ULID: block4, MinTime: 20, MaxTime: 40}, Thanos: metadata.Thanos{Source: metadata.CompactorSource, OriginSource: "upload"}},
+	}
+
+	tests := map[string]struct {
+		blocks        map[ulid.ULID]*metadata.Meta
+		ranges        []int64
+		groupBySource bool
+		expected      [][]ulid.ULID
+	}{
+		"should merge blocks with a different source when disabled": {
+			blocks:        level1Blocks,
+			ranges:        []int64{20},
+			groupBySource: false,
+			expected:      [][]ulid.ULID{{block1, block2, block3, block4}},
+		},
+		"should not merge blocks with a different source when enabled": {
+			blocks:        level1Blocks,
+			ranges:        []int64{20},
+			groupBySource: true,
+			expected:      [][]ulid.ULID{{block1, block2}, {block3, block4}},
+		},
+		"should merge compacted blocks with a different origin source when disabled": {
+			blocks:        level2Blocks,
+			ranges:        []int64{20, 40},
+			groupBySource: false,
+			expected:      [][]ulid.ULID{{block1, block3}, {block2, block4}},
+		},
+		"should not merge compacted blocks with a different origin source when enabled": {
+			blocks:        level2Blocks,
+			ranges:        []int64{20, 40},
+			groupBySource: true,
+			expected:      [][]ulid.ULID{{block1, block2}, {block3, block4}},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			grouper := NewSplitAndMergeGrouper("user-1", testData.ranges, 0, 0, testData.groupBySource, false, 0, 0, log.NewNopLogger())
+
+			jobs, err := grouper.Groups(testData.blocks)
+			require.NoError(t, err)
+
+			var actual [][]ulid.ULID
+			keys := map[string]struct{}{}
+			for _, job := range jobs {
+				actual = append(actual, job.IDs())
+				keys[job.Key()] = struct{}{}
+			}
+
+			assert.ElementsMatch(t, testData.expected, actual)
+			assert.Len(t, keys, len(jobs), "job keys must be unique")
+		})
+	}
+}
+
+func TestSplitAndMergeGrouper_ReshardUploadedBlocks(t *testing.T) {
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	block3 := ulid.MustNew(3, nil)
+	block4 := ulid.MustNew(4, nil)
+
+	shardLabels := func(shardID string) map[string]string {
+		return map[string]string{mimir_tsdb.CompactorShardIDExternalLabel: shardID}
+	}
+
+	blocks := map[ulid.ULID]*metadata.Meta{
+		// Uploaded blocks sharded with a different number of shards.
+		block1: {BlockMeta: tsdb.BlockMeta{ULID: block1, MinTime: 0, MaxTime: 10}, Thanos: metadata.Thanos{Source: metadata.UploadSource, Labels: shardLabels("1_of_4")}},
+		block2: {BlockMeta: tsdb.BlockMeta{ULID: block2, MinTime: 10, MaxTime: 20}, Thanos: metadata.Thanos{Source: metadata.UploadSource, Labels: shardLabels("1_of_4")}},
+		// Uploaded block sharded with the current number of shards.
+		block3: {BlockMeta: tsdb.BlockMeta{ULID: block3, MinTime: 0, MaxTime: 10}, Thanos: metadata.Thanos{Source: metadata.UploadSource, Labels: shardLabels("1_of_2")}},
+		// Block not uploaded, sharded with a different number of shards.
+		block4: {BlockMeta: tsdb.BlockMeta{ULID: block4, MinTime: 0, MaxTime: 10}, Thanos: metadata.Thanos{Source: metadata.CompactorSource, Labels: shardLabels("2_of_4")}},
+	}
+
+	t.Run("should merge the mis-sharded uploaded blocks of the same shard when disabled", func(t *testing.T) {
+		grouper := NewSplitAndMergeGrouper("user-1", []int64{20}, 2, 0, false, false, 0, 0, log.NewNopLogger())
+
+		jobs, err := grouper.Groups(blocks)
+		require.NoError(t, err)
+		require.Len(t, jobs, 1)
+		assert.False(t, jobs[0].UseSplitting())
+		assert.Equal(t, []ulid.ULID{block1, block2}, jobs[0].IDs())
+		assert.Equal(t, "1_of_4", jobs[0].Labels().Get(mimir_tsdb.CompactorShardIDExternalLabel))
+	})
+
+	t.Run("should split the mis-sharded uploaded blocks again when enabled", func(t *testing.T) {
+		grouper := NewSplitAndMergeGrouper("user-1", []int64{20}, 2, 0, false, true, 0, 0, log.NewNopLogger())
+
+		jobs, err := grouper.Groups(blocks)
+		require.NoError(t, err)
+		require.Len(t, jobs, 1)
+		assert.True(t, jobs[0].UseSplitting())
+		assert.Equal(t, uint32(2), jobs[0].SplittingShards())
+		assert.Equal(t, []ulid.ULID{block1, block2}, jobs[0].IDs())
+		assert.Empty(t, jobs[0].Labels().Get(mimir_tsdb.CompactorShardIDExternalLabel))
+
+		// The metas of the blocks are not modified.
+		assert.Equal(t, "1_of_4", blocks[block1].Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel])
+		assert.Equal(t, "1_of_4", blocks[block2].Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel])
+	})
+
+	t.Run("should not split the mis-sharded uploaded blocks larger than the smallest range when enabled", func(t *testing.T) {
+		block5 := ulid.MustNew(5, nil)
+		block6 := ulid.MustNew(6, nil)
+
+		largeBlocks := map[ulid.ULID]*metadata.Meta{
+			block5: {BlockMeta: tsdb.BlockMeta{ULID: block5, MinTime: 0, MaxTime: 40}, Thanos: metadata.Thanos{Source: metadata.UploadSource, Labels: shardLabels("1_of_4")}},
+			block6: {BlockMeta: tsdb.BlockMeta{ULID: block6, MinTime: 0, MaxTime: 40}, Thanos: metadata.Thanos{Source: metadata.UploadSource, Labels: shardLabels("1_of_4")}},
+		}
+
+		grouper := NewSplitAndMergeGrouper("user-1", []int64{20, 40}, 2, 0, false, true, 0, 0, log.NewNopLogger())
+
+		jobs, err := grouper.Groups(largeBlocks)
+		require.NoError(t, err)
+		require.Len(t, jobs, 1)
+		assert.False(t, jobs[0].UseSplitting())
+		assert.Equal(t, []ulid.ULID{block5, block6}, jobs[0].IDs())
+		assert.Equal(t, "1_of_4", jobs[0].Labels().Get(mimir_tsdb.CompactorShardIDExternalLabel))
+	})
+}
+
+func TestSplitAndMergeGrouper_MaxJobSamples(t *testing.T) {
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	block3 := ulid.MustNew(3, nil)
+	block4 := ulid.MustNew(4, nil)
+	block5 := ulid.MustNew(5, nil)
+
+	blocks := map[ulid.ULID]*metadata.Meta{
+		block1: {BlockMeta: tsdb.BlockMeta{ULID: block1, MinTime: 0, MaxTime: 4, Stats: tsdb.BlockStats{NumSamples: 100}}},
+		block2: {BlockMeta: tsdb.BlockMeta{ULID: block2, MinTime: 4, MaxTime: 8, Stats: tsdb.BlockStats{NumSamples: 100}}},
+		block3: {BlockMeta: tsdb.BlockMeta{ULID: block3, MinTime: 8, MaxTime: 12, Stats: tsdb.BlockStats{NumSamples: 100}}},
+		block4: {BlockMeta: tsdb.BlockMeta{ULID: block4, MinTime: 12, MaxTime: 16, Stats: tsdb.BlockStats{NumSamples: 300}}},
+		block5: {BlockMeta: tsdb.BlockMeta{ULID: block5, MinTime: 16, MaxTime: 20, Stats: tsdb.BlockStats{NumSamples: 100}}},
+	}
+
+	tests := map[string]struct {
+		maxJobSamples uint64
+		expected      [][]ulid.ULID
+	}{
+		"should not split the job when the limit is disabled": {
+			maxJobSamples: 0,
+			expected:      [][]ulid.ULID{{block1, block2, block3, block4, block5}},
+		},
+		"should not split the job when its output doesn't exceed the limit": {
+			maxJobSamples: 700,
+			expected:      [][]ulid.ULID{{block1, block2, block3, block4, block5}},
+		},
+		"should split the job into smaller jobs when its output exceeds the limit": {
+			maxJobSamples: 400,
+			expected:      [][]ulid.ULID{{block1, block2, block3}, {block4, block5}},
+		},
+		"should not plan a job for blocks which can't be merged without exceeding the limit": {
+			maxJobSamples: 250,
+			expected:      [][]ulid.ULID{{block1, block2}},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			grouper := NewSplitAndMergeGrouper("user-1", []int64{20}, 0, 0, false, false, testData.maxJobSamples, 0, log.NewNopLogger())
+
+			jobs, err := grouper.Groups(blocks)
+			require.NoError(t, err)
+
+			var actual [][]ulid.ULID
+			keys := map[string]struct{}{}
+			for _, job := range jobs {
+				actual = append(actual, job.IDs())
+				keys[job.Key()] = struct{}{}
+			}
+
+			assert.ElementsMatch(t, testData.expected, actual)
+			assert.Len(t, keys, len(jobs), "job keys must be unique")
+		})
+	}
+}
+
+func TestSplitAndMergeGrouper_MaxJobBlocks(t *testing.T) {
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	block3 := ulid.MustNew(3, nil)
+	block4 := ulid.MustNew(4, nil)
+	block5 := ulid.MustNew(5, nil)
+	block6 := ulid.MustNew(6, nil)
+	block7 := ulid.MustNew(7, nil)
+
+	// Blocks 1-5 belong to the first time range, and blocks 6-7 to the second one.
+	blocks := map[ulid.ULID]*metadata.Meta{
+		block1: {BlockMeta: tsdb.BlockMeta{ULID: block1, MinTime: 0, MaxTime: 4}},
+		block2: {BlockMeta: tsdb.BlockMeta{ULID: block2, MinTime: 4, MaxTime: 8}},
+		block3: {BlockMeta: tsdb.BlockMeta{ULID: block3, MinTime: 8, MaxTime: 12}},
+		block4: {BlockMeta: tsdb.BlockMeta{ULID: block4, MinTime: 12, MaxTime: 16}},
+		block5: {BlockMeta: tsdb.BlockMeta{ULID: block5, MinTime: 16, MaxTime: 20}},
+		block6: {BlockMeta: tsdb.BlockMeta{ULID: block6, MinTime: 20, MaxTime: 30}},
+		block7: {BlockMeta: tsdb.BlockMeta{ULID: block7, MinTime: 30, MaxTime: 40}},
+	}
+
+	tests := map[string]struct {
+		shardCount   uint32
+		maxJobBlocks int
+		expected     [][]ulid.ULID
+	}{
+		"should not split the jobs when the limit is disabled": {
+			maxJobBlocks: 0,
+			expected:     [][]ulid.ULID{{block1, block2, block3, block4, block5}, {block6, block7}},
+		},
+		"should not split the jobs when they don't exceed the limit": {
+			maxJobBlocks: 5,
+			expected:     [][]ulid.ULID{{block1, block2, block3, block4, block5}, {block6, block7}},
+		},
+		"should split a merge job exceeding the limit into jobs of the same time range": {
+			maxJobBlocks: 3,
+			expected:     [][]ulid.ULID{{block1, block2, block3}, {block4, block5}, {block6, block7}},
+		},
+		"should not plan a merge job for a single block": {
+			maxJobBlocks: 2,
+			expected:     [][]ulid.ULID{{block1, block2}, {block3, block4}, {block6, block7}},
+		},
+		"should split a split job exceeding the limit into jobs of the same time range": {
+			shardCount:   2,
+			maxJobBlocks: 3,
+			expected:     [][]ulid.ULID{{block1, block2, block3}, {block4, block5}, {block6, block7}},
+		},
+		"should plan a split job for a single block": {
+			shardCount:   2,
+			maxJobBlocks: 2,
+			expected:     [][]ulid.ULID{{block1, block2}, {block3, block4}, {block5}, {block6, block7}},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			grouper := NewSplitAndMergeGrouper("user-1", []int64{20}, testData.shardCount, 0, false, false, 0, testData.maxJobBlocks, log.NewNopLogger())
+
+			jobs, err := grouper.Groups(blocks)
+			require.NoError(t, err)
+
+			var actual [][]ulid.ULID
+			keys := map[string]struct{}{}
+			for _, job := range jobs {
+				actual = append(actual, job.IDs())
+				keys[job.Key()] = struct{}{}
+
+				// The jobs never span multiple time ranges.
+				minT, maxT := job.TimeRange()
+				assert.Equal(t, minT/20, (maxT-1)/20, "job %s spans multiple time ranges", job.Key())
+			}
+
+			assert.ElementsMatch(t, testData.expected, actual)
+			assert.Len(t, keys, len(jobs), "job keys must be unique")
+		})
+	}
+}
+
+func TestSplitAndMergeGrouperFactory_PerTenantBlockRanges(t *testing.T) {
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	block3 := ulid.MustNew(3, nil)
+	block4 := ulid.MustNew(4, nil)
+
+	blocks := map[ulid.ULID]*metadata.Meta{
+		block1: {BlockMeta: tsdb.BlockMeta{ULID: block1, MinTime: 0, MaxTime: 10}},
+		block2: {BlockMeta: tsdb.BlockMeta{ULID: block2, MinTime: 10, MaxTime: 20}},
+		block3: {BlockMeta: tsdb.BlockMeta{ULID: block3, MinTime: 20, MaxTime: 30}},
+		block4: {BlockMeta: tsdb.BlockMeta{ULID: block4, MinTime: 30, MaxTime: 40}},
+	}
+
+	cfg := Config{BlockRanges: mimir_tsdb.DurationList{40 * time.Millisecond}}
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockRanges["user-2"] = mimir_tsdb.DurationList{20 * time.Millisecond}
+
+	tests := map[string]struct {
+		userID   string
+		expected [][]ulid.ULID
+	}{
+		"should use the compactor ranges for a tenant without specific ranges": {
+			userID:   "user-1",
+			expected: [][]ulid.ULID{{block1, block2, block3, block4}},
+		},
+		"should use the tenant specific ranges": {
+			userID:   "user-2",
+			expected: [][]ulid.ULID{{block1, block2}, {block3, block4}},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			grouper := splitAndMergeGrouperFactory(context.Background(), cfg, cfgProvider, testData.userID, log.NewNopLogger(), nil)
+
+			jobs, err := grouper.Groups(blocks)
+			require.NoError(t, err)
+
+			var actual [][]ulid.ULID
+			for _, job := range jobs {
+				actual = append(actual, job.IDs())
+			}
+			assert.ElementsMatch(t, testData.expected, actual)
+		})
+	}
+}
+
 func TestPlanSplitting(t *testing.T) {
 	const userID = "user-1"
 
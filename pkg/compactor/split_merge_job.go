@@ -39,6 +39,10 @@ type job struct {
 	// - merge: value of the ShardIDLabelName of all blocks in this job (all blocks in
 	// the job share the same label value).
 	shardID string
+
+	// When a job has been split because its output would exceed the max number of samples,
+	// this is the 1-based index of the part. It's 0 for jobs which haven't been split.
+	part int
 }
 
 func (j *job) shardingKey() string {
@@ -131,6 +135,16 @@ func (g blocksGroup) maxTime() int64 {
 	return max
 }
 
+// estimatedSamples returns the number of samples of the block compacted from the group,
+// estimated as the sum of the samples of the source blocks.
+func (g blocksGroup) estimatedSamples() uint64 {
+	total := uint64(0)
+	for _, b := range g.blocks {
+		total += b.Stats.NumSamples
+	}
+	return total
+}
+
 // getNonShardedBlocks returns the list of non-sharded blocks.
 func (g blocksGroup) getNonShardedBlocks() []*metadata.Meta {
 	var out []*metadata.Meta
@@ -6,11 +6,14 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/stretchr/testify/assert"
 
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
 )
 
@@ -80,3 +83,23 @@ func TestSplitAndMergePlanner_Plan(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitAndMergePlannerFactory_PerTenantBlockRanges(t *testing.T) {
+	cfg := Config{BlockRanges: mimir_tsdb.DurationList{20 * time.Millisecond, 40 * time.Millisecond}}
+	cfgProvider := newMockConfigProvider()
+	cfgProvider.blockRanges["user-2"] = mimir_tsdb.DurationList{20 * time.Millisecond, 80 * time.Millisecond}
+
+	// A block larger than the largest compactor range, but within the tenant specific ones.
+	blocks := []*metadata.Meta{
+		{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(1, nil), MinTime: 0, MaxTime: 80, Version: metadata.TSDBVersion1}},
+	}
+
+	planner := splitAndMergePlannerFactory(context.Background(), cfg, cfgProvider, "user-1", log.NewNopLogger(), nil)
+	_, err := planner.Plan(context.Background(), blocks)
+	assert.Error(t, err)
+
+	planner = splitAndMergePlannerFactory(context.Background(), cfg, cfgProvider, "user-2", log.NewNopLogger(), nil)
+	actual, err := planner.Plan(context.Background(), blocks)
+	assert.NoError(t, err)
+	assert.Equal(t, blocks, actual)
+}
@@ -17,13 +17,22 @@ import (
 // Copied from Thanos, pkg/compact/compact.go.
 // Here we aggregate metrics from all finished syncers.
 type aggregatedSyncerMetrics struct {
-	metaSync                  prometheus.Counter
-	metaSyncFailures          prometheus.Counter
-	metaSyncDuration          *dskit_metrics.HistogramDataCollector // was prometheus.Histogram before
-	metaSyncConsistencyDelay  prometheus.Gauge
-	garbageCollections        prometheus.Counter
-	garbageCollectionFailures prometheus.Counter
-	garbageCollectionDuration *dskit_metrics.HistogramDataCollector // was prometheus.Histogram before
+	metaSync                   prometheus.Counter
+	metaSyncFailures           prometheus.Counter
+	metaSyncDuration           *dskit_metrics.HistogramDataCollector // was prometheus.Histogram before
+	metaSyncConsistencyDelay   prometheus.Gauge
+	metaBlockSize              *dskit_metrics.HistogramDataCollector
+	metaTotalSeries            *prometheus.GaugeVec
+	metaTotalSamples           *prometheus.GaugeVec
+	metaTotalChunks            *prometheus.GaugeVec
+	metaCacheHitRatio          *prometheus.GaugeVec
+	metaFilters                prometheus.Gauge
+	metaFiltersDuration        *dskit_metrics.HistogramDataCollector
+	metaLoadDuration           *dskit_metrics.HistogramDataCollector
+	metaNewlyMarkedForDeletion prometheus.Counter
+	garbageCollections         prometheus.Counter
+	garbageCollectionFailures  prometheus.Counter
+	garbageCollectionDuration  *dskit_metrics.HistogramDataCollector // was prometheus.Histogram before
 }
 
 // Copied (and modified with Mimir prefix) from Thanos, pkg/compact/compact.go
@@ -47,6 +56,42 @@ func newAggregatedSyncerMetrics(reg prometheus.Registerer) *aggregatedSyncerMetr
 		Name: "cortex_compactor_meta_sync_consistency_delay_seconds",
 		Help: "Configured consistency delay in seconds.",
 	})
+	m.metaBlockSize = dskit_metrics.NewHistogramDataCollector(prometheus.NewDesc(
+		"cortex_compactor_meta_block_size_bytes",
+		"Size of the blocks in bytes, observed when their metadata is loaded from the object storage.",
+		nil, nil))
+	m.metaTotalSeries = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cortex_compactor_meta_total_series",
+		Help: "Total number of series across all blocks loaded in the last synchronization of a tenant.",
+	}, []string{"user"})
+	m.metaTotalSamples = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cortex_compactor_meta_total_samples",
+		Help: "Total number of samples across all blocks loaded in the last synchronization of a tenant.",
+	}, []string{"user"})
+	m.metaTotalChunks = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cortex_compactor_meta_total_chunks",
+		Help: "Total number of chunks across all blocks loaded in the last synchronization of a tenant.",
+	}, []string{"user"})
+	m.metaCacheHitRatio = promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cortex_compactor_meta_cache_hit_ratio",
+		Help: "Ratio of block metadata served from the in-memory or disk cache in the last synchronization of a tenant.",
+	}, []string{"user"})
+	m.metaFilters = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "cortex_compactor_meta_filters",
+		Help: "Number of metadata filters run in the last synchronization.",
+	})
+	m.metaFiltersDuration = dskit_metrics.NewHistogramDataCollector(prometheus.NewDesc(
+		"cortex_compactor_meta_filters_duration_seconds",
+		"Cumulative duration of the metadata filters run on each synchronization in seconds.",
+		nil, nil))
+	m.metaLoadDuration = dskit_metrics.NewHistogramDataCollector(prometheus.NewDesc(
+		"cortex_compactor_meta_load_duration_seconds",
+		"Duration of the download of a single block meta.json from the object storage in seconds.",
+		nil, nil))
+	m.metaNewlyMarkedForDeletion = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "cortex_compactor_meta_newly_marked_for_deletion_total",
+		Help: "Total number of blocks found marked for deletion which were not marked for deletion in the previous sync.",
+	})
 
 	m.garbageCollections = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "cortex_compactor_garbage_collection_total",
@@ -62,13 +107,13 @@ func newAggregatedSyncerMetrics(reg prometheus.Registerer) *aggregatedSyncerMetr
 		nil, nil))
 
 	if reg != nil {
-		reg.MustRegister(m.metaSyncDuration, m.garbageCollectionDuration)
+		reg.MustRegister(m.metaSyncDuration, m.metaBlockSize, m.metaFiltersDuration, m.metaLoadDuration, m.garbageCollectionDuration)
 	}
 
 	return &m
 }
 
-func (m *aggregatedSyncerMetrics) gatherThanosSyncerMetrics(reg *prometheus.Registry) {
+func (m *aggregatedSyncerMetrics) gatherThanosSyncerMetrics(userID string, reg *prometheus.Registry) {
 	if m == nil {
 		return
 	}
@@ -89,8 +134,29 @@ func (m *aggregatedSyncerMetrics) gatherThanosSyncerMetrics(reg *prometheus.Regi
 	m.metaSyncFailures.Add(mfm.SumCounters("blocks_meta_sync_failures_total"))
 	m.metaSyncDuration.Add(mfm.SumHistograms("blocks_meta_sync_duration_seconds"))
 	m.metaSyncConsistencyDelay.Set(mfm.MaxGauges("consistency_delay_seconds"))
+	m.metaBlockSize.Add(mfm.SumHistograms("blocks_meta_block_size_bytes"))
+	m.metaTotalSeries.WithLabelValues(userID).Set(mfm.MaxGauges("blocks_meta_total_series"))
+	m.metaTotalSamples.WithLabelValues(userID).Set(mfm.MaxGauges("blocks_meta_total_samples"))
+	m.metaTotalChunks.WithLabelValues(userID).Set(mfm.MaxGauges("blocks_meta_total_chunks"))
+	m.metaCacheHitRatio.WithLabelValues(userID).Set(mfm.MaxGauges("blocks_meta_cache_hit_ratio"))
+	m.metaFilters.Set(mfm.MaxGauges("blocks_meta_filters"))
+	m.metaFiltersDuration.Add(mfm.SumHistograms("blocks_meta_filters_duration_seconds"))
+	m.metaLoadDuration.Add(mfm.SumHistograms("blocks_meta_load_duration_seconds"))
+	m.metaNewlyMarkedForDeletion.Add(mfm.SumCounters("blocks_meta_newly_marked_for_deletion_total"))
 
 	m.garbageCollections.Add(mfm.SumCounters("thanos_compact_garbage_collection_total"))
 	m.garbageCollectionFailures.Add(mfm.SumCounters("thanos_compact_garbage_collection_failures_total"))
 	m.garbageCollectionDuration.Add(mfm.SumHistograms("thanos_compact_garbage_collection_duration_seconds"))
 }
+
+// removeUser removes the per-tenant metrics of a tenant not compacted by this instance anymore.
+func (m *aggregatedSyncerMetrics) removeUser(userID string) {
+	if m == nil {
+		return
+	}
+
+	m.metaTotalSeries.DeleteLabelValues(userID)
+	m.metaTotalSamples.DeleteLabelValues(userID)
+	m.metaTotalChunks.DeleteLabelValues(userID)
+	m.metaCacheHitRatio.DeleteLabelValues(userID)
+}
@@ -19,9 +19,9 @@ func TestSyncerMetrics(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 
 	sm := newAggregatedSyncerMetrics(reg)
-	sm.gatherThanosSyncerMetrics(generateTestData(12345))
-	sm.gatherThanosSyncerMetrics(generateTestData(76543))
-	sm.gatherThanosSyncerMetrics(generateTestData(22222))
+	sm.gatherThanosSyncerMetrics("user-1", generateTestData(12345))
+	sm.gatherThanosSyncerMetrics("user-2", generateTestData(76543))
+	sm.gatherThanosSyncerMetrics("user-3", generateTestData(22222))
 	// total base = 111110
 
 	err := testutil.GatherAndCompare(reg, bytes.NewBufferString(`
@@ -61,6 +61,86 @@ func TestSyncerMetrics(t *testing.T) {
 			cortex_compactor_meta_sync_duration_seconds_sum 33.333000000000006
 			cortex_compactor_meta_sync_duration_seconds_count 3
 
+			# HELP cortex_compactor_meta_block_size_bytes Size of the blocks in bytes, observed when their metadata is loaded from the object storage.
+			# TYPE cortex_compactor_meta_block_size_bytes histogram
+			# Observed values: 12345, 76543, 22222 (MiB)
+			cortex_compactor_meta_block_size_bytes_bucket{le="1.048576e+06"} 0
+			cortex_compactor_meta_block_size_bytes_bucket{le="4.194304e+06"} 0
+			cortex_compactor_meta_block_size_bytes_bucket{le="1.6777216e+07"} 0
+			cortex_compactor_meta_block_size_bytes_bucket{le="6.7108864e+07"} 0
+			cortex_compactor_meta_block_size_bytes_bucket{le="2.68435456e+08"} 0
+			cortex_compactor_meta_block_size_bytes_bucket{le="1.073741824e+09"} 0
+			cortex_compactor_meta_block_size_bytes_bucket{le="4.294967296e+09"} 0
+			cortex_compactor_meta_block_size_bytes_bucket{le="1.7179869184e+10"} 1
+			cortex_compactor_meta_block_size_bytes_bucket{le="6.8719476736e+10"} 2
+			cortex_compactor_meta_block_size_bytes_bucket{le="2.74877906944e+11"} 3
+			cortex_compactor_meta_block_size_bytes_bucket{le="+Inf"} 3
+			cortex_compactor_meta_block_size_bytes_sum 1.1650727936e+11
+			cortex_compactor_meta_block_size_bytes_count 3
+
+			# HELP cortex_compactor_meta_total_series Total number of series across all blocks loaded in the last synchronization of a tenant.
+			# TYPE cortex_compactor_meta_total_series gauge
+			cortex_compactor_meta_total_series{user="user-1"} 123450
+			cortex_compactor_meta_total_series{user="user-2"} 765430
+			cortex_compactor_meta_total_series{user="user-3"} 222220
+
+			# HELP cortex_compactor_meta_total_samples Total number of samples across all blocks loaded in the last synchronization of a tenant.
+			# TYPE cortex_compactor_meta_total_samples gauge
+			cortex_compactor_meta_total_samples{user="user-1"} 246900
+			cortex_compactor_meta_total_samples{user="user-2"} 1.530860e+06
+			cortex_compactor_meta_total_samples{user="user-3"} 444440
+
+			# HELP cortex_compactor_meta_total_chunks Total number of chunks across all blocks loaded in the last synchronization of a tenant.
+			# TYPE cortex_compactor_meta_total_chunks gauge
+			cortex_compactor_meta_total_chunks{user="user-1"} 37035
+			cortex_compactor_meta_total_chunks{user="user-2"} 229629
+			cortex_compactor_meta_total_chunks{user="user-3"} 66666
+
+			# HELP cortex_compactor_meta_cache_hit_ratio Ratio of block metadata served from the in-memory or disk cache in the last synchronization of a tenant.
+			# TYPE cortex_compactor_meta_cache_hit_ratio gauge
+			cortex_compactor_meta_cache_hit_ratio{user="user-1"} 0.5
+			cortex_compactor_meta_cache_hit_ratio{user="user-2"} 0.5
+			cortex_compactor_meta_cache_hit_ratio{user="user-3"} 0.5
+
+			# HELP cortex_compactor_meta_filters Number of metadata filters run in the last synchronization.
+			# TYPE cortex_compactor_meta_filters gauge
+			cortex_compactor_meta_filters 6
+
+			# HELP cortex_compactor_meta_filters_duration_seconds Cumulative duration of the metadata filters run on each synchronization in seconds.
+			# TYPE cortex_compactor_meta_filters_duration_seconds histogram
+			# Observed values: 0.012345, 0.076543, 0.022222 (seconds)
+			cortex_compactor_meta_filters_duration_seconds_bucket{le="0.001"} 0
+			cortex_compactor_meta_filters_duration_seconds_bucket{le="0.01"} 0
+			cortex_compactor_meta_filters_duration_seconds_bucket{le="0.1"} 3
+			cortex_compactor_meta_filters_duration_seconds_bucket{le="1"} 3
+			cortex_compactor_meta_filters_duration_seconds_bucket{le="10"} 3
+			cortex_compactor_meta_filters_duration_seconds_bucket{le="100"} 3
+			cortex_compactor_meta_filters_duration_seconds_bucket{le="+Inf"} 3
+			# rounding error
+			cortex_compactor_meta_filters_duration_seconds_sum 0.11110999999999999
+			cortex_compactor_meta_filters_duration_seconds_count 3
+
+			# HELP cortex_compactor_meta_load_duration_seconds Duration of the download of a single block meta.json from the object storage in seconds.
+			# TYPE cortex_compactor_meta_load_duration_seconds histogram
+			# Observed values: 0.12345, 0.76543, 0.22222 (seconds)
+			cortex_compactor_meta_load_duration_seconds_bucket{le="0.01"} 0
+			cortex_compactor_meta_load_duration_seconds_bucket{le="0.05"} 0
+			cortex_compactor_meta_load_duration_seconds_bucket{le="0.1"} 0
+			cortex_compactor_meta_load_duration_seconds_bucket{le="0.25"} 2
+			cortex_compactor_meta_load_duration_seconds_bucket{le="0.5"} 2
+			cortex_compactor_meta_load_duration_seconds_bucket{le="1"} 3
+			cortex_compactor_meta_load_duration_seconds_bucket{le="2.5"} 3
+			cortex_compactor_meta_load_duration_seconds_bucket{le="5"} 3
+			cortex_compactor_meta_load_duration_seconds_bucket{le="10"} 3
+			cortex_compactor_meta_load_duration_seconds_bucket{le="+Inf"} 3
+			# rounding error
+			cortex_compactor_meta_load_duration_seconds_sum 1.1111000000000002
+			cortex_compactor_meta_load_duration_seconds_count 3
+
+			# HELP cortex_compactor_meta_newly_marked_for_deletion_total Total number of blocks found marked for deletion which were not marked for deletion in the previous sync.
+			# TYPE cortex_compactor_meta_newly_marked_for_deletion_total counter
+			cortex_compactor_meta_newly_marked_for_deletion_total 1.11110e+06
+
 			# HELP cortex_compactor_garbage_collection_total Total number of garbage collection operations.
 			# TYPE cortex_compactor_garbage_collection_total counter
 			cortex_compactor_garbage_collection_total 555550
@@ -93,6 +173,16 @@ func TestSyncerMetrics(t *testing.T) {
 			cortex_compactor_garbage_collection_duration_seconds_count 3
 	`))
 	require.NoError(t, err)
+
+	sm.removeUser("user-2")
+
+	err = testutil.GatherAndCompare(reg, bytes.NewBufferString(`
+			# HELP cortex_compactor_meta_total_series Total number of series across all blocks loaded in the last synchronization of a tenant.
+			# TYPE cortex_compactor_meta_total_series gauge
+			cortex_compactor_meta_total_series{user="user-1"} 123450
+			cortex_compactor_meta_total_series{user="user-3"} 222220
+	`), "cortex_compactor_meta_total_series")
+	require.NoError(t, err)
 }
 
 func generateTestData(base float64) *prometheus.Registry {
@@ -102,6 +192,15 @@ func generateTestData(base float64) *prometheus.Registry {
 	m.metaSyncFailures.Add(2 * base)
 	m.metaSyncDuration.Observe(3 * base / 10000)
 	m.metaSyncConsistencyDelay.Set(300)
+	m.metaBlockSize.Observe(base * 1024 * 1024)
+	m.metaTotalSeries.Set(10 * base)
+	m.metaTotalSamples.Set(20 * base)
+	m.metaTotalChunks.Set(3 * base)
+	m.metaCacheHitRatio.Set(0.5)
+	m.metaFilters.Set(6)
+	m.metaFiltersDuration.Observe(base / 1000000)
+	m.metaLoadDuration.Observe(base / 100000)
+	m.metaNewlyMarkedForDeletion.Add(10 * base)
 	m.garbageCollections.Add(5 * base)
 	m.garbageCollectionFailures.Add(6 * base)
 	m.garbageCollectionDuration.Observe(7 * base / 10000)
@@ -110,13 +209,22 @@ func generateTestData(base float64) *prometheus.Registry {
 
 // directly copied from Thanos (and renamed syncerMetrics to testSyncerMetrics to avoid conflict)
 type testSyncerMetrics struct {
-	metaSync                  prometheus.Counter
-	metaSyncFailures          prometheus.Counter
-	metaSyncDuration          prometheus.Histogram
-	metaSyncConsistencyDelay  prometheus.Gauge
-	garbageCollections        prometheus.Counter
-	garbageCollectionFailures prometheus.Counter
-	garbageCollectionDuration prometheus.Histogram
+	metaSync                   prometheus.Counter
+	metaSyncFailures           prometheus.Counter
+	metaSyncDuration           prometheus.Histogram
+	metaSyncConsistencyDelay   prometheus.Gauge
+	metaBlockSize              prometheus.Histogram
+	metaTotalSeries            prometheus.Gauge
+	metaTotalSamples           prometheus.Gauge
+	metaTotalChunks            prometheus.Gauge
+	metaCacheHitRatio          prometheus.Gauge
+	metaFilters                prometheus.Gauge
+	metaFiltersDuration        prometheus.Histogram
+	metaLoadDuration           prometheus.Histogram
+	metaNewlyMarkedForDeletion prometheus.Counter
+	garbageCollections         prometheus.Counter
+	garbageCollectionFailures  prometheus.Counter
+	garbageCollectionDuration  prometheus.Histogram
 }
 
 func newTestSyncerMetrics(reg prometheus.Registerer) *testSyncerMetrics {
@@ -139,6 +247,45 @@ func newTestSyncerMetrics(reg prometheus.Registerer) *testSyncerMetrics {
 		Name: "consistency_delay_seconds",
 		Help: "Configured consistency delay in seconds.",
 	})
+	m.metaBlockSize = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "blocks_meta_block_size_bytes",
+		Help:    "Size of the blocks in bytes, observed when their metadata is loaded from the object storage",
+		Buckets: prometheus.ExponentialBuckets(1024*1024, 4, 10),
+	})
+	m.metaTotalSeries = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "blocks_meta_total_series",
+		Help: "Total number of series across all loaded blocks",
+	})
+	m.metaTotalSamples = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "blocks_meta_total_samples",
+		Help: "Total number of samples across all loaded blocks",
+	})
+	m.metaTotalChunks = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "blocks_meta_total_chunks",
+		Help: "Total number of chunks across all loaded blocks",
+	})
+	m.metaCacheHitRatio = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "blocks_meta_cache_hit_ratio",
+		Help: "Ratio of block metadata served from the in-memory or disk cache, out of all block metadata loaded in the last synchronization",
+	})
+	m.metaFilters = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "blocks_meta_filters",
+		Help: "Number of metadata filters run in the last synchronization",
+	})
+	m.metaFiltersDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "blocks_meta_filters_duration_seconds",
+		Help:    "Cumulative duration of the metadata filters run on each synchronization in seconds",
+		Buckets: []float64{0.001, 0.01, 0.1, 1, 10, 100},
+	})
+	m.metaLoadDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Name:    "blocks_meta_load_duration_seconds",
+		Help:    "Duration of the download of a single block meta.json from the object storage in seconds",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	})
+	m.metaNewlyMarkedForDeletion = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Name: "blocks_meta_newly_marked_for_deletion_total",
+		Help: "Total number of blocks found marked for deletion which were not marked for deletion in the previous sync",
+	})
 
 	m.garbageCollections = promauto.With(reg).NewCounter(prometheus.CounterOpts{
 		Name: "thanos_compact_garbage_collection_total",
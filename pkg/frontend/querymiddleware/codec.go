@@ -21,6 +21,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/gogo/protobuf/proto"
 	"github.com/gogo/status"
+	"github.com/grafana/dskit/tenant"
 	"github.com/munnerz/goautoneg"
 	"github.com/opentracing/opentracing-go"
 	otlog "github.com/opentracing/opentracing-go/log"
@@ -150,6 +151,7 @@ func newPrometheusCodecMetrics(registerer prometheus.Registerer) *prometheusCode
 
 type prometheusCodec struct {
 	metrics                            *prometheusCodecMetrics
+	limits                             Limits
 	preferredQueryResultResponseFormat string
 }
 
@@ -167,9 +169,13 @@ var knownFormats = []formatter{
 	protobufFormatter{},
 }
 
-func NewPrometheusCodec(registerer prometheus.Registerer, queryResultResponseFormat string) Codec {
+// NewPrometheusCodec returns a Codec for Prometheus API requests and responses. The format used to retrieve
+// query results from queriers is queryResultResponseFormat, unless overridden for the tenant through limits.
+// limits can be nil, in which case queryResultResponseFormat is always used.
+func NewPrometheusCodec(registerer prometheus.Registerer, limits Limits, queryResultResponseFormat string) Codec {
 	return prometheusCodec{
 		metrics:                            newPrometheusCodecMetrics(registerer),
+		limits:                             limits,
 		preferredQueryResultResponseFormat: queryResultResponseFormat,
 	}
 }
@@ -335,18 +341,43 @@ func (c prometheusCodec) EncodeRequest(ctx context.Context, r Request) (*http.Re
 		Header:     http.Header{},
 	}
 
-	switch c.preferredQueryResultResponseFormat {
+	switch format := c.queryResultResponseFormat(ctx); format {
 	case formatJSON:
 		req.Header.Set("Accept", jsonMimeType)
 	case formatProtobuf:
 		req.Header.Set("Accept", mimirpb.QueryResponseMimeType+","+jsonMimeType)
 	default:
-		return nil, fmt.Errorf("unknown query result response format '%s'", c.preferredQueryResultResponseFormat)
+		return nil, fmt.Errorf("unknown query result response format '%s'", format)
 	}
 
 	return req.WithContext(ctx), nil
 }
 
+// queryResultResponseFormat returns the format to use to retrieve query results from queriers. The per-tenant
+// format is used if it's configured, and is the same for all tenants in the request.
+func (c prometheusCodec) queryResultResponseFormat(ctx context.Context) string {
+	if c.limits == nil {
+		return c.preferredQueryResultResponseFormat
+	}
+
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil || len(tenantIDs) == 0 {
+		return c.preferredQueryResultResponseFormat
+	}
+
+	format := c.limits.QueryResultResponseFormat(tenantIDs[0])
+	for _, tenantID := range tenantIDs[1:] {
+		if c.limits.QueryResultResponseFormat(tenantID) != format {
+			return c.preferredQueryResultResponseFormat
+		}
+	}
+
+	if format == "" {
+		return c.preferredQueryResultResponseFormat
+	}
+	return format
+}
+
 func (c prometheusCodec) DecodeResponse(ctx context.Context, r *http.Response, _ Request, logger log.Logger) (Response, error) {
 	if r.StatusCode/100 == 5 {
 		return nil, httpgrpc.ErrorFromHTTPResponse(&httpgrpc.HTTPResponse{
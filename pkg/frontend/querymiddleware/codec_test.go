@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/dskit/tenant"
 	jsoniter "github.com/json-iterator/go"
 	v1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/client_golang/prometheus"
@@ -111,7 +112,7 @@ func TestRequest(t *testing.T) {
 func TestPrometheusCodec_EncodeRequest_AcceptHeader(t *testing.T) {
 	for _, queryResultPayloadFormat := range allFormats {
 		t.Run(queryResultPayloadFormat, func(t *testing.T) {
-			codec := NewPrometheusCodec(prometheus.NewPedanticRegistry(), queryResultPayloadFormat)
+			codec := NewPrometheusCodec(prometheus.NewPedanticRegistry(), nil, queryResultPayloadFormat)
 			req := PrometheusInstantQueryRequest{}
 			encodedRequest, err := codec.EncodeRequest(context.Background(), &req)
 			require.NoError(t, err)
@@ -128,6 +129,72 @@ func TestPrometheusCodec_EncodeRequest_AcceptHeader(t *testing.T) {
 	}
 }
 
+func TestPrometheusCodec_EncodeRequest_PerTenantAcceptHeader(t *testing.T) {
+	limits := multiTenantMockLimits{
+		byTenant: map[string]mockLimits{
+			"tenant-json":     {queryResultResponseFormat: formatJSON},
+			"tenant-protobuf": {queryResultResponseFormat: formatProtobuf},
+			"tenant-proto-2":  {queryResultResponseFormat: formatProtobuf},
+			"tenant-default":  {},
+			"tenant-invalid":  {queryResultResponseFormat: "unknown"},
+		},
+	}
+
+	const (
+		jsonAccept     = "application/json"
+		protobufAccept = "application/vnd.mimir.queryresponse+protobuf,application/json"
+	)
+
+	tests := map[string]struct {
+		orgID          string
+		expectedAccept string
+		expectedErr    string
+	}{
+		"tenant configured with the json format": {
+			orgID:          "tenant-json",
+			expectedAccept: jsonAccept,
+		},
+		"tenant configured with the protobuf format": {
+			orgID:          "tenant-protobuf",
+			expectedAccept: protobufAccept,
+		},
+		"tenant without a configured format uses the default format": {
+			orgID:          "tenant-default",
+			expectedAccept: jsonAccept,
+		},
+		"multiple tenants configured with different formats use the default format": {
+			orgID:          "tenant-json|tenant-protobuf",
+			expectedAccept: jsonAccept,
+		},
+		"multiple tenants configured with the same format": {
+			orgID:          "tenant-protobuf|tenant-proto-2",
+			expectedAccept: protobufAccept,
+		},
+		"tenant configured with an unknown format": {
+			orgID:       "tenant-invalid",
+			expectedErr: "unknown query result response format 'unknown'",
+		},
+	}
+
+	tenant.WithDefaultResolver(tenant.NewMultiResolver())
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			codec := NewPrometheusCodec(prometheus.NewPedanticRegistry(), limits, formatJSON)
+			ctx := user.InjectOrgID(context.Background(), testData.orgID)
+
+			encodedRequest, err := codec.EncodeRequest(ctx, &PrometheusInstantQueryRequest{})
+			if testData.expectedErr != "" {
+				require.EqualError(t, err, testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, testData.expectedAccept, encodedRequest.Header.Get("Accept"))
+		})
+	}
+}
+
 func TestPrometheusCodec_EncodeResponse_ContentNegotiation(t *testing.T) {
 	testResponse := &PrometheusResponse{
 		Status:    statusError,
@@ -279,7 +346,7 @@ func TestPrometheusCodec_DecodeResponse_ContentTypeHandling(t *testing.T) {
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			reg := prometheus.NewPedanticRegistry()
-			codec := NewPrometheusCodec(reg, formatJSON)
+			codec := NewPrometheusCodec(reg, nil, formatJSON)
 
 			resp := prometheusAPIResponse{}
 			body, err := json.Marshal(resp)
@@ -891,5 +958,5 @@ func Test_DecodeOptions(t *testing.T) {
 }
 
 func newTestPrometheusCodec() Codec {
-	return NewPrometheusCodec(prometheus.NewPedanticRegistry(), formatJSON)
+	return NewPrometheusCodec(prometheus.NewPedanticRegistry(), nil, formatJSON)
 }
@@ -85,6 +85,10 @@ type Limits interface {
 
 	// ResultsCacheForOutOfOrderWindowTTL returns TTL for cached results for query that falls into out-of-order ingestion window.
 	ResultsCacheTTLForOutOfOrderTimeWindow(userID string) time.Duration
+
+	// QueryResultResponseFormat returns the format to use when retrieving query results from queriers.
+	// An empty string means the format configured in the query-frontend should be used.
+	QueryResultResponseFormat(userID string) string
 }
 
 type limitsMiddleware struct {
@@ -246,7 +250,10 @@ func (rt limitedParallelismRoundTripper) RoundTrip(r *http.Request) (*http.Respo
 	}
 
 	// Creates workers that will process the sub-requests in parallel for this query.
-	// The amount of workers is limited by the MaxQueryParallelism tenant setting.
+	// The amount of workers is limited by the MaxQueryParallelism tenant setting: a query
+	// with fewer sub-requests just leaves some of them idle, so the parallelism already scales
+	// with the number of sub-requests up to this limit, which should be raised to run more
+	// sub-requests in parallel.
 	parallelism := validation.SmallestPositiveIntPerTenant(tenantIDs, rt.limits.MaxQueryParallelism)
 	for i := 0; i < parallelism; i++ {
 		wg.Add(1)
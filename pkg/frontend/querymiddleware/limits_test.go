@@ -423,6 +423,10 @@ func (m multiTenantMockLimits) NativeHistogramsIngestionEnabled(userID string) b
 	return m.byTenant[userID].nativeHistogramsIngestionEnabled
 }
 
+func (m multiTenantMockLimits) QueryResultResponseFormat(userID string) string {
+	return m.byTenant[userID].queryResultResponseFormat
+}
+
 type mockLimits struct {
 	maxQueryLookback                 time.Duration
 	maxQueryLength                   time.Duration
@@ -441,6 +445,7 @@ type mockLimits struct {
 	nativeHistogramsIngestionEnabled bool
 	resultsCacheTTL                  time.Duration
 	resultsCacheOutOfOrderWindowTTL  time.Duration
+	queryResultResponseFormat        string
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
@@ -517,6 +522,10 @@ func (m mockLimits) NativeHistogramsIngestionEnabled(userID string) bool {
 	return m.nativeHistogramsIngestionEnabled
 }
 
+func (m mockLimits) QueryResultResponseFormat(userID string) string {
+	return m.queryResultResponseFormat
+}
+
 type mockHandler struct {
 	mock.Mock
 }
@@ -31,6 +31,7 @@ import (
 	"github.com/weaveworks/common/user"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 func TestRangeTripperware(t *testing.T) {
@@ -353,6 +354,11 @@ func TestConfig_Validate(t *testing.T) {
 	}
 }
 
+func TestQueryResultResponseFormatsMatchLimits(t *testing.T) {
+	// The per-tenant override is validated against the formats listed in the validation package.
+	assert.ElementsMatch(t, allFormats, validation.QueryResultResponseFormats)
+}
+
 type singleHostRoundTripper struct {
 	host string
 	next http.RoundTripper
@@ -561,7 +561,6 @@ func doRequests(ctx context.Context, downstream Handler, reqs []Request, recordS
 	g, ctx := errgroup.WithContext(ctx)
 	mtx := sync.Mutex{}
 	resps := make([]requestResponse, 0, len(reqs))
-	queryStatistics := stats.FromContext(ctx)
 	for i := 0; i < len(reqs); i++ {
 		req := reqs[i]
 		g.Go(func() error {
@@ -576,7 +575,7 @@ func doRequests(ctx context.Context, downstream Handler, reqs []Request, recordS
 			}
 
 			resp, err := downstream.Do(childCtx, req)
-			queryStatistics.Merge(partialStats)
+			stats.MergeIntoContext(ctx, partialStats)
 			if err != nil {
 				return err
 			}
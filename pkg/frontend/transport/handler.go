@@ -262,6 +262,7 @@ func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, quer
 	numChunks := stats.LoadFetchedChunks()
 	numIndexBytes := stats.LoadFetchedIndexBytes()
 	sharded := strconv.FormatBool(stats.GetShardedQueries() > 0)
+	queriedBlocks := querier_stats.LoadQueriedBlocks(r.Context())
 
 	if stats != nil {
 		// Track stats.
@@ -289,6 +290,7 @@ func (f *Handler) reportQueryStats(r *http.Request, queryString url.Values, quer
 		"sharded_queries", stats.LoadShardedQueries(),
 		"split_queries", stats.LoadSplitQueries(),
 		"estimated_series_count", stats.GetEstimatedSeriesCount(),
+		"queried_blocks", strings.Join(queriedBlocks, ","),
 	}, formatQueryString(queryString)...)
 
 	if len(f.cfg.LogQueryRequestHeaders) != 0 {
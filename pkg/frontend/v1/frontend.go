@@ -275,8 +275,7 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 		// Happy path: merge the stats and propagate the response.
 		case resp := <-resps:
 			if stats.ShouldTrackHTTPGRPCResponse(resp.HttpResponse) {
-				stats := stats.FromContext(req.originalCtx)
-				stats.Merge(resp.Stats) // Safe if stats is nil.
+				stats.MergeIntoContext(req.originalCtx, resp.Stats) // Safe if stats have not been initialised in the context.
 			}
 
 			req.response <- resp.HttpResponse
@@ -259,8 +259,7 @@ enqueueAgain:
 
 	case resp := <-freq.response:
 		if stats.ShouldTrackHTTPGRPCResponse(resp.HttpResponse) {
-			stats := stats.FromContext(ctx)
-			stats.Merge(resp.Stats) // Safe if stats is nil.
+			stats.MergeIntoContext(ctx, resp.Stats) // Safe if stats have not been initialised in the context.
 		}
 
 		return resp.HttpResponse, nil
@@ -292,6 +292,9 @@ func (c *Config) ValidateLimits(limits validation.Limits) error {
 	if err := c.Querier.ValidateLimits(limits); err != nil {
 		return errors.Wrap(err, "invalid limits config for querier")
 	}
+	if err := c.Compactor.ValidateLimits(limits); err != nil {
+		return errors.Wrap(err, "invalid limits config for compactor")
+	}
 	return nil
 }
 
@@ -456,6 +456,16 @@ func TestConfig_ValidateLimits(t *testing.T) {
 			}(),
 			hasError: true,
 		},
+		{
+			name:       "block upload validator not registered in the compactor should return error",
+			testConfig: newDefaultConfig(),
+			limitsConfig: func() validation.Limits {
+				limits := newDefaultConfig().LimitsConfig
+				limits.CompactorBlockUploadValidators = []string{"unknown"}
+				return limits
+			}(),
+			hasError: true,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			err := tc.testConfig.ValidateLimits(tc.limitsConfig)
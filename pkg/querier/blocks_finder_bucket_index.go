@@ -18,6 +18,7 @@ import (
 	"github.com/thanos-io/objstore"
 
 	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/util/globalerror"
 )
@@ -30,6 +31,10 @@ type BucketIndexBlocksFinderConfig struct {
 	IndexLoader              bucketindex.LoaderConfig
 	MaxStalePeriod           time.Duration
 	IgnoreDeletionMarksDelay time.Duration
+
+	// RetentionPeriod returns the retention period of a tenant, whose blocks entirely outside of it aren't
+	// returned. If nil, no block is excluded because of the retention.
+	RetentionPeriod func(userID string) time.Duration
 }
 
 // BucketIndexBlocksFinder implements BlocksFinder interface and find blocks in the bucket
@@ -81,11 +86,20 @@ func (f *BucketIndexBlocksFinder) GetBlocks(ctx context.Context, userID string,
 		matchingDeletionMarks = map[ulid.ULID]*bucketindex.BlockDeletionMark{}
 	)
 
+	// Exclude the blocks outside the tenant's retention, like the block.RetentionFilter does.
+	retentionThreshold, retentionEnabled := int64(0), false
+	if f.cfg.RetentionPeriod != nil {
+		retentionThreshold, retentionEnabled = block.NewRetentionFilter(userID, f.cfg.RetentionPeriod).Threshold()
+	}
+
 	// Filter blocks containing samples within the range.
 	for _, block := range idx.Blocks {
 		if !block.Within(minT, maxT) {
 			continue
 		}
+		if retentionEnabled && block.MaxTime < retentionThreshold {
+			continue
+		}
 
 		matchingBlocks[block.ID] = block
 	}
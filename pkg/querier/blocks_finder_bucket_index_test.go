@@ -204,6 +204,38 @@ func TestBucketIndexBlocksFinder_GetBlocks_BucketIndexIsTooOld(t *testing.T) {
 	require.EqualError(t, err, newBucketIndexTooOldError(idx.GetUpdatedAt(), finder.cfg.MaxStalePeriod).Error())
 }
 
+func TestBucketIndexBlocksFinder_GetBlocks_ShouldExcludeBlocksOutsideRetention(t *testing.T) {
+	const userID = "user-1"
+
+	ctx := context.Background()
+	bkt, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	finder := prepareBucketIndexBlocksFinder(t, bkt)
+	finder.cfg.RetentionPeriod = func(string) time.Duration { return 24 * time.Hour }
+
+	now := time.Now()
+	outside := &bucketindex.Block{ID: ulid.MustNew(1, nil), MinTime: now.Add(-50 * time.Hour).UnixMilli(), MaxTime: now.Add(-25 * time.Hour).UnixMilli()}
+	straddling := &bucketindex.Block{ID: ulid.MustNew(2, nil), MinTime: now.Add(-25 * time.Hour).UnixMilli(), MaxTime: now.Add(-23 * time.Hour).UnixMilli()}
+	inside := &bucketindex.Block{ID: ulid.MustNew(3, nil), MinTime: now.Add(-2 * time.Hour).UnixMilli(), MaxTime: now.Add(-time.Hour).UnixMilli()}
+
+	idx := &bucketindex.Index{
+		Version:            bucketindex.IndexVersion1,
+		Blocks:             bucketindex.Blocks{outside, straddling, inside},
+		BlockDeletionMarks: bucketindex.BlockDeletionMarks{},
+		UpdatedAt:          now.Unix(),
+	}
+	require.NoError(t, bucketindex.WriteIndex(ctx, bkt, userID, nil, idx))
+
+	blocks, _, err := finder.GetBlocks(ctx, userID, 0, now.UnixMilli())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, bucketindex.Blocks{straddling, inside}, blocks)
+
+	// A retention <= 0 disables the filter.
+	finder.cfg.RetentionPeriod = func(string) time.Duration { return 0 }
+	blocks, _, err = finder.GetBlocks(ctx, userID, 0, now.UnixMilli())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, bucketindex.Blocks{outside, straddling, inside}, blocks)
+}
+
 func prepareBucketIndexBlocksFinder(t testing.TB, bkt objstore.Bucket) *BucketIndexBlocksFinder {
 	ctx := context.Background()
 	cfg := BucketIndexBlocksFinderConfig{
@@ -44,9 +44,18 @@ type BucketScanBlocksFinderConfig struct {
 	ScanInterval             time.Duration
 	TenantsConcurrency       int
 	MetasConcurrency         int
+	MaxFailedMetas           int
+	MaxFailedMetasRatio      float64
+	MetasBatchSize           int
+	MetasSoftTimeout         time.Duration
+	MetasCacheTTL            time.Duration
 	CacheDir                 string
 	ConsistencyDelay         time.Duration
 	IgnoreDeletionMarksDelay time.Duration
+
+	// RetentionPeriod returns the retention period of a tenant, whose blocks entirely outside of it aren't
+	// returned. If nil, no block is excluded because of the retention.
+	RetentionPeriod func(userID string) time.Duration
 }
 
 // BucketScanBlocksFinder is a BlocksFinder implementation periodically scanning the bucket to discover blocks.
@@ -300,7 +309,7 @@ func (d *BucketScanBlocksFinder) scanUserBlocks(ctx context.Context, userID stri
 		return nil, nil, errors.Wrapf(err, "create meta fetcher for user %s", userID)
 	}
 
-	metas, partials, err := fetcher.Fetch(ctx)
+	metas, partials, unloaded, err := fetcher.FetchWithUnloaded(ctx)
 	if err != nil {
 		return nil, nil, errors.Wrapf(err, "scan blocks for user %s", userID)
 	}
@@ -335,19 +344,54 @@ func (d *BucketScanBlocksFinder) scanUserBlocks(ctx context.Context, userID stri
 		res = append(res, blockMeta)
 	}
 
-	// The blocks scanner expects all blocks to be sorted by max time.
-	sortBlocksByMaxTime(res)
-
 	// Convert deletion marks to our own data type.
 	marks := map[ulid.ULID]*bucketindex.BlockDeletionMark{}
 	for id, m := range deletionMarkFilter.DeletionMarkBlocks() {
 		marks[id] = bucketindex.BlockDeletionMarkFromThanosMarker(m)
 	}
 
+	// The blocks whose meta.json hasn't been loaded are still in the bucket, so we keep what we found
+	// about them in the previous scan, if any, instead of excluding them from the queried blocks.
+	if len(unloaded) > 0 {
+		prevBlocks, prevMarks := d.getPreviousBlocks(userID, unloaded)
+		res = append(res, prevBlocks...)
+		for id, m := range prevMarks {
+			marks[id] = m
+		}
+
+		level.Warn(d.logger).Log("msg", "the meta.json of some blocks hasn't been loaded, keeping the blocks found in the previous scan", "user", userID, "unloaded", len(unloaded), "kept", len(prevBlocks))
+	}
+
+	// The blocks scanner expects all blocks to be sorted by max time.
+	sortBlocksByMaxTime(res)
+
 	return res, marks, nil
 }
 
-func (d *BucketScanBlocksFinder) getOrCreateMetaFetcher(userID string) (block.MetadataFetcher, objstore.Bucket, *block.IgnoreDeletionMarkFilter, error) {
+// getPreviousBlocks returns the blocks with the input IDs found in the previous scan of the user, and their deletion marks.
+func (d *BucketScanBlocksFinder) getPreviousBlocks(userID string, ids map[ulid.ULID]error) (bucketindex.Blocks, map[ulid.ULID]*bucketindex.BlockDeletionMark) {
+	d.userMx.RLock()
+	defer d.userMx.RUnlock()
+
+	blocks := bucketindex.Blocks{}
+	marks := map[ulid.ULID]*bucketindex.BlockDeletionMark{}
+
+	for id := range ids {
+		b, ok := d.userMetasLookup[userID][id]
+		if !ok {
+			continue
+		}
+		blocks = append(blocks, b)
+
+		if m, ok := d.userDeletionMarks[userID][id]; ok {
+			marks[id] = m
+		}
+	}
+
+	return blocks, marks
+}
+
+func (d *BucketScanBlocksFinder) getOrCreateMetaFetcher(userID string) (*block.MetaFetcher, objstore.Bucket, *block.IgnoreDeletionMarkFilter, error) {
 	d.fetchersMx.Lock()
 	defer d.fetchersMx.Unlock()
 
@@ -369,7 +413,7 @@ func (d *BucketScanBlocksFinder) getOrCreateMetaFetcher(userID string) (block.Me
 	return fetcher, userBucket, deletionMarkFilter, nil
 }
 
-func (d *BucketScanBlocksFinder) createMetaFetcher(userID string) (block.MetadataFetcher, objstore.Bucket, *block.IgnoreDeletionMarkFilter, error) {
+func (d *BucketScanBlocksFinder) createMetaFetcher(userID string) (*block.MetaFetcher, objstore.Bucket, *block.IgnoreDeletionMarkFilter, error) {
 	userLogger := util_log.WithUserID(userID, d.logger)
 	userBucket := bucket.NewUserBucketClient(userID, d.bucketClient, d.cfgProvider)
 	userReg := prometheus.NewRegistry()
@@ -380,8 +424,11 @@ func (d *BucketScanBlocksFinder) createMetaFetcher(userID string) (block.Metadat
 	// - Deduplicate filter: omitted because it could cause troubles with the consistency check if
 	//   we "hide" source blocks because recently compacted by the compactor before the store-gateway instances
 	//   discover and load the compacted ones.
-	deletionMarkFilter := block.NewIgnoreDeletionMarkFilter(userLogger, userBucket, d.cfg.IgnoreDeletionMarksDelay, d.cfg.MetasConcurrency)
+	deletionMarkFilter := block.NewIgnoreDeletionMarkFilter(userLogger, userBucket, d.cfg.IgnoreDeletionMarksDelay, d.cfg.MetasConcurrency, userReg)
 	filters := []block.MetadataFilter{deletionMarkFilter}
+	if d.cfg.RetentionPeriod != nil {
+		filters = append(filters, block.NewRetentionFilter(userID, d.cfg.RetentionPeriod))
+	}
 
 	f, err := block.NewMetaFetcher(
 		userLogger,
@@ -389,8 +436,12 @@ func (d *BucketScanBlocksFinder) createMetaFetcher(userID string) (block.Metadat
 		userBucket,
 		// The fetcher stores cached metas in the "meta-syncer/" sub directory.
 		filepath.Join(d.cfg.CacheDir, userID),
+		d.cfg.MetasCacheTTL,
 		userReg,
 		filters,
+		block.WithFailedMetasTolerance(d.cfg.MaxFailedMetas, d.cfg.MaxFailedMetasRatio),
+		block.WithFetchBatchSize(d.cfg.MetasBatchSize),
+		block.WithFetchSoftTimeout(d.cfg.MetasSoftTimeout),
 	)
 	if err != nil {
 		return nil, nil, nil, err
@@ -431,7 +482,7 @@ func logPartialBlocks(userID string, partials map[ulid.ULID]error, logger log.Lo
 }
 
 type userFetcher struct {
-	metadataFetcher    block.MetadataFetcher
+	metadataFetcher    *block.MetaFetcher
 	deletionMarkFilter *block.IgnoreDeletionMarkFilter
 	userBucket         objstore.Bucket
 }
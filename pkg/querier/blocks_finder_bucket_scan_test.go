@@ -25,6 +25,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/objstore"
+	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/storage/bucket"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
@@ -136,6 +137,85 @@ func TestBucketScanBlocksFinder_InitialScanFailure(t *testing.T) {
 	))
 }
 
+func TestBucketScanBlocksFinder_InitialScanWithFailedMetasWithinTolerance(t *testing.T) {
+	ctx := context.Background()
+	bkt, _ := mimir_testutil.PrepareFilesystemBucket(t)
+
+	block1 := mimir_testutil.MockStorageBlock(t, bkt, "user-1", 10, 20)
+	block2 := mimir_testutil.MockStorageBlock(t, bkt, "user-1", 20, 30)
+
+	// Mock the storage to simulate a failure when reading the meta.json of one of the blocks.
+	bkt = &bucket.ErrorInjectedBucketClient{
+		Bucket:   bkt,
+		Injector: bucket.InjectErrorOn(bucket.OpGet, path.Join("user-1", block2.ULID.String(), "meta.json"), errors.New("mocked error")),
+	}
+
+	cfg := prepareBucketScanBlocksFinderConfig()
+	cfg.CacheDir = t.TempDir()
+	cfg.MaxFailedMetas = 1
+
+	s := NewBucketScanBlocksFinder(cfg, bkt, nil, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	t.Cleanup(func() {
+		s.StopAsync()
+		require.NoError(t, s.AwaitTerminated(context.Background()))
+	})
+
+	// The scan succeeds, because the failed meta.json is within the tolerance.
+	require.NoError(t, services.StartAndAwaitRunning(ctx, s))
+
+	blocks, _, err := s.GetBlocks(ctx, "user-1", 0, 30)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, block1.ULID, blocks[0].ID)
+}
+
+func TestBucketScanBlocksFinder_PeriodicScanWithFailedMetasWithinTolerance(t *testing.T) {
+	ctx := context.Background()
+	bkt, _ := mimir_testutil.PrepareFilesystemBucket(t)
+
+	block1 := mimir_testutil.MockStorageBlock(t, bkt, "user-1", 10, 20)
+	block2 := mimir_testutil.MockStorageBlock(t, bkt, "user-1", 20, 30)
+	mark2 := bucketindex.BlockDeletionMarkFromThanosMarker(mimir_testutil.MockStorageDeletionMark(t, bkt, "user-1", block2))
+
+	// Mock the storage to simulate a failure when checking the meta.json of one of the blocks, once enabled.
+	failing := atomic.NewBool(false)
+	bkt = &bucket.ErrorInjectedBucketClient{
+		Bucket: bkt,
+		Injector: func(op bucket.Operation, name string) error {
+			if failing.Load() && op == bucket.OpExists && name == path.Join("user-1", block2.ULID.String(), "meta.json") {
+				return errors.New("mocked error")
+			}
+			return nil
+		},
+	}
+
+	cfg := prepareBucketScanBlocksFinderConfig()
+	cfg.CacheDir = t.TempDir()
+	cfg.MaxFailedMetas = 1
+
+	s := NewBucketScanBlocksFinder(cfg, bkt, nil, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(ctx, s))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, s))
+	})
+
+	blocks, deletionMarks, err := s.GetBlocks(ctx, "user-1", 0, 30)
+	require.NoError(t, err)
+	require.Len(t, blocks, 2)
+	assert.Equal(t, map[ulid.ULID]*bucketindex.BlockDeletionMark{block2.ULID: mark2}, deletionMarks)
+
+	// The meta.json of an already known block fails to load within the tolerance: the block is still queried.
+	failing.Store(true)
+	require.NoError(t, s.scan(ctx))
+
+	blocks, deletionMarks, err = s.GetBlocks(ctx, "user-1", 0, 30)
+	require.NoError(t, err)
+	require.Len(t, blocks, 2)
+	assert.Equal(t, block2.ULID, blocks[0].ID)
+	assert.Equal(t, block1.ULID, blocks[1].ID)
+	assert.Equal(t, map[ulid.ULID]*bucketindex.BlockDeletionMark{block2.ULID: mark2}, deletionMarks)
+}
+
 func TestBucketScanBlocksFinder_StopWhileRunningTheInitialScanOnManyTenants(t *testing.T) {
 	tenantIDs := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
 
@@ -476,6 +556,36 @@ func TestBucketScanBlocksFinder_GetBlocks(t *testing.T) {
 	}
 }
 
+func TestBucketScanBlocksFinder_ShouldExcludeBlocksOutsideRetention(t *testing.T) {
+	ctx := context.Background()
+	cfg := prepareBucketScanBlocksFinderConfig()
+	cfg.RetentionPeriod = func(userID string) time.Duration {
+		if userID == "user-1" {
+			return 24 * time.Hour
+		}
+		return 0
+	}
+	s, bucket, _, _ := prepareBucketScanBlocksFinder(t, cfg)
+
+	now := time.Now()
+	mimir_testutil.MockStorageBlock(t, bucket, "user-1", now.Add(-50*time.Hour).UnixMilli(), now.Add(-25*time.Hour).UnixMilli())
+	user1Straddling := mimir_testutil.MockStorageBlock(t, bucket, "user-1", now.Add(-25*time.Hour).UnixMilli(), now.Add(-23*time.Hour).UnixMilli())
+	user2Outside := mimir_testutil.MockStorageBlock(t, bucket, "user-2", now.Add(-50*time.Hour).UnixMilli(), now.Add(-25*time.Hour).UnixMilli())
+
+	require.NoError(t, services.StartAndAwaitRunning(ctx, s))
+
+	blocks, _, err := s.GetBlocks(ctx, "user-1", 0, now.UnixMilli())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(blocks))
+	assert.Equal(t, user1Straddling.ULID, blocks[0].ID)
+
+	// The retention of user-2 is disabled.
+	blocks, _, err = s.GetBlocks(ctx, "user-2", 0, now.UnixMilli())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(blocks))
+	assert.Equal(t, user2Outside.ULID, blocks[0].ID)
+}
+
 func prepareBucketScanBlocksFinder(t *testing.T, cfg BucketScanBlocksFinderConfig) (*BucketScanBlocksFinder, objstore.Bucket, string, *prometheus.Registry) {
 	cacheDir := t.TempDir()
 
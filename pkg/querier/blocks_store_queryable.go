@@ -97,6 +97,7 @@ type BlocksStoreLimits interface {
 	MaxLabelsQueryLength(userID string) time.Duration
 	MaxChunksPerQuery(userID string) int
 	StoreGatewayTenantShardSize(userID string) int
+	CompactorBlocksRetentionPeriod(userID string) time.Duration
 }
 
 type blocksStoreQueryableMetrics struct {
@@ -217,14 +218,21 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 			},
 			MaxStalePeriod:           storageCfg.BucketStore.BucketIndex.MaxStalePeriod,
 			IgnoreDeletionMarksDelay: storageCfg.BucketStore.IgnoreDeletionMarksDelay,
+			RetentionPeriod:          limits.CompactorBlocksRetentionPeriod,
 		}, bucketClient, limits, logger, reg)
 	} else {
 		finder = NewBucketScanBlocksFinder(BucketScanBlocksFinderConfig{
 			ScanInterval:             storageCfg.BucketStore.SyncInterval,
 			TenantsConcurrency:       storageCfg.BucketStore.TenantSyncConcurrency,
 			MetasConcurrency:         storageCfg.BucketStore.MetaSyncConcurrency,
+			MaxFailedMetas:           storageCfg.BucketStore.MetaSyncMaxFailedMetas,
+			MaxFailedMetasRatio:      storageCfg.BucketStore.MetaSyncMaxFailedMetasRatio,
+			MetasBatchSize:           storageCfg.BucketStore.MetaSyncBatchSize,
+			MetasSoftTimeout:         storageCfg.BucketStore.MetaSyncSoftTimeout,
+			MetasCacheTTL:            storageCfg.BucketStore.MetaSyncCacheTTL,
 			CacheDir:                 storageCfg.BucketStore.SyncDir,
 			IgnoreDeletionMarksDelay: storageCfg.BucketStore.IgnoreDeletionMarksDelay,
+			RetentionPeriod:          limits.CompactorBlocksRetentionPeriod,
 		}, bucketClient, limits, logger, reg)
 	}
 
@@ -450,6 +458,10 @@ func (q *blocksStoreQuerier) selectSorted(sp *storage.SelectHints, matchers ...*
 		resSeriesSets = append(resSeriesSets, seriesSets...)
 		resWarnings = append(resWarnings, warnings...)
 
+		// Track the queried blocks once all store-gateways have been queried,
+		// instead of updating the stats from each store-gateway request.
+		stats.AddQueriedBlocks(spanCtx, convertULIDsToString(queriedBlocks)...)
+
 		return queriedBlocks, nil
 	}
 
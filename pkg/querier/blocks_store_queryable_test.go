@@ -34,6 +34,7 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
 	"github.com/grafana/mimir/pkg/storegateway/hintspb"
@@ -838,6 +839,67 @@ func TestBlocksStoreQuerier_Select(t *testing.T) {
 	}
 }
 
+func TestBlocksStoreQuerier_Select_ShouldReportQueriedBlocksInStats(t *testing.T) {
+	const (
+		metricName = "test_metric"
+		minT       = int64(10)
+		maxT       = int64(20)
+	)
+
+	var (
+		block1          = ulid.MustNew(1, nil)
+		block2          = ulid.MustNew(2, nil)
+		block3          = ulid.MustNew(3, nil)
+		metricNameLabel = labels.FromStrings(labels.MetricName, metricName)
+	)
+
+	_, ctx := stats.ContextWithEmptyStats(context.Background())
+	ctx = limiter.AddQueryLimiterToContext(ctx, limiter.NewQueryLimiter(0, 0, 0))
+
+	stores := &blocksStoreSetMock{mockedResponses: []interface{}{
+		map[BlocksStoreClient][]ulid.ULID{
+			&storeGatewayClientMock{remoteAddr: "1.1.1.1", mockedSeriesResponses: []*storepb.SeriesResponse{
+				mockSeriesResponse(metricNameLabel, minT, 1),
+				mockHintsResponse(block1, block2),
+			}}: {block1, block2},
+			&storeGatewayClientMock{remoteAddr: "2.2.2.2", mockedSeriesResponses: []*storepb.SeriesResponse{
+				mockSeriesResponse(metricNameLabel, minT+1, 2),
+				mockHintsResponse(block3),
+			}}: {block3},
+		},
+	}}
+
+	finder := &blocksFinderMock{}
+	finder.On("GetBlocks", mock.Anything, "user-1", minT, maxT).Return(bucketindex.Blocks{
+		{ID: block1},
+		{ID: block2},
+		{ID: block3},
+	}, map[ulid.ULID]*bucketindex.BlockDeletionMark(nil), nil)
+
+	q := &blocksStoreQuerier{
+		ctx:         ctx,
+		minT:        minT,
+		maxT:        maxT,
+		userID:      "user-1",
+		finder:      finder,
+		stores:      stores,
+		consistency: NewBlocksConsistencyChecker(0, 0, log.NewNopLogger(), nil),
+		logger:      log.NewNopLogger(),
+		metrics:     newBlocksStoreQueryableMetrics(prometheus.NewPedanticRegistry()),
+		limits:      &blocksStoreLimitsMock{},
+	}
+
+	sp := &storage.SelectHints{Start: minT, End: maxT}
+	set := q.Select(true, sp, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metricName))
+	for set.Next() {
+	}
+	require.NoError(t, set.Err())
+
+	expected := []string{block1.String(), block2.String(), block3.String()}
+	slices.Sort(expected)
+	assert.Equal(t, expected, stats.LoadQueriedBlocks(ctx))
+}
+
 func TestBlocksStoreQuerier_Select_cancelledContext(t *testing.T) {
 	const (
 		metricName = "test_metric"
@@ -1990,6 +2052,7 @@ type blocksStoreLimitsMock struct {
 	maxLabelsQueryLength        time.Duration
 	maxChunksPerQuery           int
 	storeGatewayTenantShardSize int
+	blocksRetentionPeriod       time.Duration
 }
 
 func (m *blocksStoreLimitsMock) MaxLabelsQueryLength(_ string) time.Duration {
@@ -2004,6 +2067,10 @@ func (m *blocksStoreLimitsMock) StoreGatewayTenantShardSize(_ string) int {
 	return m.storeGatewayTenantShardSize
 }
 
+func (m *blocksStoreLimitsMock) CompactorBlocksRetentionPeriod(_ string) time.Duration {
+	return m.blocksRetentionPeriod
+}
+
 func (m *blocksStoreLimitsMock) S3SSEType(_ string) string {
 	return ""
 }
@@ -39,7 +39,7 @@ type Distributor interface {
 	LabelValuesCardinality(ctx context.Context, labelNames []model.LabelName, matchers []*labels.Matcher) (uint64, *client.LabelValuesCardinalityResponse, error)
 }
 
-func newDistributorQueryable(distributor Distributor, iteratorFn chunkIteratorFunc, cfgProvider distributorQueryableConfigProvider, logger log.Logger) QueryableWithFilter {
+func newDistributorQueryable(distributor Distributor, iteratorFn chunkIteratorFuncSelector, cfgProvider distributorQueryableConfigProvider, logger log.Logger) QueryableWithFilter {
 	return distributorQueryable{
 		logger:      logger,
 		distributor: distributor,
@@ -55,7 +55,7 @@ type distributorQueryableConfigProvider interface {
 type distributorQueryable struct {
 	logger      log.Logger
 	distributor Distributor
-	iteratorFn  chunkIteratorFunc
+	iteratorFn  chunkIteratorFuncSelector
 	cfgProvider distributorQueryableConfigProvider
 }
 
@@ -97,7 +97,7 @@ type distributorQuerier struct {
 	distributor          Distributor
 	ctx                  context.Context
 	mint, maxt           int64
-	chunkIterFn          chunkIteratorFunc
+	chunkIterFn          chunkIteratorFuncSelector
 	queryIngestersWithin time.Duration
 }
 
@@ -131,10 +131,10 @@ func (q *distributorQuerier) Select(_ bool, sp *storage.SelectHints, matchers ..
 		return series.LabelsToSeriesSet(ms)
 	}
 
-	return q.streamingSelect(ctx, minT, maxT, matchers)
+	return q.streamingSelect(ctx, minT, maxT, sp, matchers)
 }
 
-func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int64, matchers []*labels.Matcher) storage.SeriesSet {
+func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int64, sp *storage.SelectHints, matchers []*labels.Matcher) storage.SeriesSet {
 	results, err := q.distributor.QueryStream(ctx, model.Time(minT), model.Time(maxT), matchers...)
 	if err != nil {
 		return storage.ErrSeriesSet(err)
@@ -145,6 +145,11 @@ func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int
 		sets = append(sets, newTimeSeriesSeriesSet(results.Timeseries))
 	}
 
+	var chunkIterFn chunkIteratorFunc
+	if len(results.Chunkseries) > 0 {
+		chunkIterFn = q.chunkIterFn(sp)
+	}
+
 	serieses := make([]storage.Series, 0, len(results.Chunkseries))
 	for _, result := range results.Chunkseries {
 		// Sometimes the ingester can send series that have no data.
@@ -162,7 +167,7 @@ func (q *distributorQuerier) streamingSelect(ctx context.Context, minT, maxT int
 		serieses = append(serieses, &chunkSeries{
 			labels:            ls,
 			chunks:            chunks,
-			chunkIteratorFunc: q.chunkIterFn,
+			chunkIteratorFunc: chunkIterFn,
 			mint:              minT,
 			maxt:              maxT,
 		})
@@ -172,7 +172,7 @@ func TestIngesterStreaming(t *testing.T) {
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), log.NewNopLogger())
+	queryable := newDistributorQueryable(d, staticChunkIteratorFunc(mergeChunks), newMockConfigProvider(0), log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -248,7 +248,7 @@ func TestIngesterStreamingMixedResults(t *testing.T) {
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), log.NewNopLogger())
+	queryable := newDistributorQueryable(d, staticChunkIteratorFunc(mergeChunks), newMockConfigProvider(0), log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -334,7 +334,7 @@ func TestIngesterStreamingMixedResultsHistograms(t *testing.T) {
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), log.NewNopLogger())
+	queryable := newDistributorQueryable(d, staticChunkIteratorFunc(mergeChunks), newMockConfigProvider(0), log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -428,7 +428,7 @@ func TestIngesterStreamingMixedTypedResults(t *testing.T) {
 		nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), log.NewNopLogger())
+	queryable := newDistributorQueryable(d, staticChunkIteratorFunc(mergeChunks), newMockConfigProvider(0), log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, mint, maxt)
 	require.NoError(t, err)
 
@@ -515,7 +515,7 @@ func BenchmarkDistributorQueryable_Select(b *testing.B) {
 	d.On("QueryStream", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, nil)
 
 	ctx := user.InjectOrgID(context.Background(), "0")
-	queryable := newDistributorQueryable(d, mergeChunks, newMockConfigProvider(0), log.NewNopLogger())
+	queryable := newDistributorQueryable(d, staticChunkIteratorFunc(mergeChunks), newMockConfigProvider(0), log.NewNopLogger())
 	querier, err := queryable.Querier(ctx, math.MinInt64, math.MaxInt64)
 	require.NoError(b, err)
 
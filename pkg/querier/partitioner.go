@@ -18,6 +18,16 @@ import (
 
 type chunkIteratorFunc func(chunks []chunk.Chunk, from, through model.Time) chunkenc.Iterator
 
+// chunkIteratorFuncSelector returns the chunkIteratorFunc to use for the series selected with the given hints.
+type chunkIteratorFuncSelector func(sp *storage.SelectHints) chunkIteratorFunc
+
+// staticChunkIteratorFunc returns a chunkIteratorFuncSelector always selecting fn.
+func staticChunkIteratorFunc(fn chunkIteratorFunc) chunkIteratorFuncSelector {
+	return func(*storage.SelectHints) chunkIteratorFunc {
+		return fn
+	}
+}
+
 // Series in the returned set are sorted alphabetically by labels.
 func partitionChunks(chunks []chunk.Chunk, mint, maxt int64, iteratorFunc chunkIteratorFunc) storage.SeriesSet {
 	chunksBySeries := map[string][]chunk.Chunk{}
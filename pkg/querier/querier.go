@@ -38,9 +38,10 @@ import (
 
 // Config contains the configuration require to create a querier
 type Config struct {
-	Iterators            bool          `yaml:"iterators" category:"advanced"`
-	BatchIterators       bool          `yaml:"batch_iterators" category:"advanced"`
-	QueryIngestersWithin time.Duration `yaml:"query_ingesters_within" category:"advanced" doc:"hidden"` // TODO: Deprecated in Mimir 2.9.0, remove in Mimir 2.11.0
+	Iterators             bool          `yaml:"iterators" category:"advanced"`
+	BatchIterators        bool          `yaml:"batch_iterators" category:"advanced"`
+	InstantQueryIterators bool          `yaml:"instant_query_iterators" category:"experimental"`
+	QueryIngestersWithin  time.Duration `yaml:"query_ingesters_within" category:"advanced" doc:"hidden"` // TODO: Deprecated in Mimir 2.9.0, remove in Mimir 2.11.0
 
 	// QueryStoreAfter the time after which queries should also be sent to the store and not just ingesters.
 	QueryStoreAfter    time.Duration `yaml:"query_store_after" category:"advanced"`
@@ -71,6 +72,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	cfg.StoreGatewayClient.RegisterFlagsWithPrefix("querier.store-gateway-client", f)
 	f.BoolVar(&cfg.Iterators, "querier.iterators", false, "Use iterators to execute query, as opposed to fully materialising the series in memory.")
 	f.BoolVar(&cfg.BatchIterators, "querier.batch-iterators", true, "Use batch iterators to execute query, as opposed to fully materialising the series in memory.  Takes precedent over the -querier.iterators flag.")
+	f.BoolVar(&cfg.InstantQueryIterators, "querier.instant-query-iterators", false, "Use iterators to execute instant queries which don't select a range of samples, regardless of -querier.batch-iterators and -querier.iterators. Such queries only read the samples within the lookback delta.")
 	f.DurationVar(&cfg.MaxQueryIntoFuture, "querier.max-query-into-future", 10*time.Minute, "Maximum duration into the future you can query. 0 to disable.")
 	f.DurationVar(&cfg.QueryStoreAfter, queryStoreAfterFlag, 12*time.Hour, "The time after which a metric should be queried from storage and not just ingesters. 0 means all queries are sent to store. If this option is enabled, the time range of the query sent to the store-gateway will be manipulated to ensure the query end is not more recent than 'now - query-store-after'.")
 	f.BoolVar(&cfg.ShuffleShardingIngestersEnabled, "querier.shuffle-sharding-ingesters-enabled", true, fmt.Sprintf("Fetch in-memory series from the minimum set of required ingesters, selecting only ingesters which may have received series since -%s. If this setting is false or -%s is '0', queriers always query all ingesters (ingesters shuffle sharding on read path is disabled).", validation.QueryIngestersWithinFlag, validation.QueryIngestersWithinFlag))
@@ -98,13 +100,34 @@ func (cfg *Config) ValidateLimits(limits validation.Limits) error {
 	return nil
 }
 
-func getChunksIteratorFunction(cfg Config) chunkIteratorFunc {
+func getChunksIteratorFunction(cfg Config) chunkIteratorFuncSelector {
+	rangeQueryFn := chunkIteratorFunc(mergeChunks)
 	if cfg.BatchIterators {
-		return batch.NewChunkMergeIterator
+		rangeQueryFn = batch.NewChunkMergeIterator
 	} else if cfg.Iterators {
-		return iterators.NewChunkMergeIterator
+		rangeQueryFn = iterators.NewChunkMergeIterator
 	}
-	return mergeChunks
+
+	if !cfg.InstantQueryIterators {
+		return staticChunkIteratorFunc(rangeQueryFn)
+	}
+
+	lookbackDelta := cfg.EngineConfig.LookbackDelta.Milliseconds()
+	return func(sp *storage.SelectHints) chunkIteratorFunc {
+		if isInstantQuery(sp, lookbackDelta) {
+			return iterators.NewChunkMergeIterator
+		}
+		return rangeQueryFn
+	}
+}
+
+// isInstantQuery returns whether the hints are the ones of an instant query which doesn't select
+// a range of samples, and so only reads the samples within the lookback delta.
+func isInstantQuery(sp *storage.SelectHints, lookbackDelta int64) bool {
+	if sp == nil || sp.Func == "series" {
+		return false
+	}
+	return sp.Step == 0 && sp.Range == 0 && sp.End-sp.Start <= lookbackDelta
 }
 
 // New builds a queryable and promql engine.
@@ -170,7 +193,7 @@ type QueryableWithFilter interface {
 }
 
 // NewQueryable creates a new Queryable for mimir.
-func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter, chunkIterFn chunkIteratorFunc, cfg Config, limits *validation.Overrides, logger log.Logger) storage.Queryable {
+func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter, chunkIterFn chunkIteratorFuncSelector, cfg Config, limits *validation.Overrides, logger log.Logger) storage.Queryable {
 	return storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
 		now := time.Now()
 
@@ -227,7 +250,7 @@ func NewQueryable(distributor QueryableWithFilter, stores []QueryableWithFilter,
 type querier struct {
 	queriers []storage.Querier
 
-	chunkIterFn chunkIteratorFunc
+	chunkIterFn chunkIteratorFuncSelector
 	ctx         context.Context
 	mint, maxt  int64
 
@@ -308,7 +331,7 @@ func (q querier) Select(_ bool, sp *storage.SelectHints, matchers ...*labels.Mat
 	// we have all the sets from different sources (chunk from store, chunks from ingesters,
 	// time series from store and time series from ingesters).
 	// mergeSeriesSets will return sorted set.
-	return q.mergeSeriesSets(result)
+	return q.mergeSeriesSets(result, q.chunkIterFn(sp))
 }
 
 // LabelValues implements storage.Querier.
@@ -396,7 +419,7 @@ func (querier) Close() error {
 	return nil
 }
 
-func (q querier) mergeSeriesSets(sets []storage.SeriesSet) storage.SeriesSet {
+func (q querier) mergeSeriesSets(sets []storage.SeriesSet, chunkIterFn chunkIteratorFunc) storage.SeriesSet {
 	// Here we deal with sets that are based on chunks and build single set from them.
 	// Remaining sets are merged with chunks-based one using storage.NewMergeSeriesSet
 
@@ -429,7 +452,7 @@ func (q querier) mergeSeriesSets(sets []storage.SeriesSet) storage.SeriesSet {
 	}
 
 	// partitionChunks returns set with sorted series, so it can be used by NewMergeSeriesSet
-	chunksSet := partitionChunks(chunks, q.mint, q.maxt, q.chunkIterFn)
+	chunksSet := partitionChunks(chunks, q.mint, q.maxt, chunkIterFn)
 
 	if len(otherSets) == 0 {
 		return chunksSet
@@ -8,6 +8,7 @@ package querier
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
@@ -28,6 +29,8 @@ import (
 
 	"github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/querier/batch"
+	"github.com/grafana/mimir/pkg/querier/iterators"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/test"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -1261,6 +1264,76 @@ func TestConfig_ValidateLimits(t *testing.T) {
 	}
 }
 
+func TestGetChunksIteratorFunction(t *testing.T) {
+	var (
+		instantQuery      = &storage.SelectHints{Start: 0, End: (5 * time.Minute).Milliseconds()}
+		rangeQuery        = &storage.SelectHints{Start: 0, End: time.Hour.Milliseconds(), Step: time.Minute.Milliseconds()}
+		instantRangeQuery = &storage.SelectHints{Start: 0, End: (10 * time.Minute).Milliseconds(), Range: (5 * time.Minute).Milliseconds()}
+		remoteReadQuery   = &storage.SelectHints{Start: 0, End: time.Hour.Milliseconds()}
+	)
+
+	tests := map[string]struct {
+		setup    func(cfg *Config)
+		hints    *storage.SelectHints
+		expected chunkIteratorFunc
+	}{
+		"should use batch iterators for instant queries by default": {
+			setup:    func(cfg *Config) {},
+			hints:    instantQuery,
+			expected: batch.NewChunkMergeIterator,
+		},
+		"should use batch iterators for range queries by default": {
+			setup:    func(cfg *Config) {},
+			hints:    rangeQuery,
+			expected: batch.NewChunkMergeIterator,
+		},
+		"should use iterators for instant queries if instant query iterators are enabled": {
+			setup:    func(cfg *Config) { cfg.InstantQueryIterators = true },
+			hints:    instantQuery,
+			expected: iterators.NewChunkMergeIterator,
+		},
+		"should use batch iterators for range queries if instant query iterators are enabled": {
+			setup:    func(cfg *Config) { cfg.InstantQueryIterators = true },
+			hints:    rangeQuery,
+			expected: batch.NewChunkMergeIterator,
+		},
+		"should use batch iterators for instant queries selecting a range of samples if instant query iterators are enabled": {
+			setup:    func(cfg *Config) { cfg.InstantQueryIterators = true },
+			hints:    instantRangeQuery,
+			expected: batch.NewChunkMergeIterator,
+		},
+		"should use batch iterators for queries without step spanning more than the lookback delta if instant query iterators are enabled": {
+			setup:    func(cfg *Config) { cfg.InstantQueryIterators = true },
+			hints:    remoteReadQuery,
+			expected: batch.NewChunkMergeIterator,
+		},
+		"should use batch iterators for queries without hints if instant query iterators are enabled": {
+			setup:    func(cfg *Config) { cfg.InstantQueryIterators = true },
+			hints:    nil,
+			expected: batch.NewChunkMergeIterator,
+		},
+		"should materialize chunks for range queries if both batch iterators and iterators are disabled": {
+			setup: func(cfg *Config) {
+				cfg.BatchIterators = false
+				cfg.InstantQueryIterators = true
+			},
+			hints:    rangeQuery,
+			expected: mergeChunks,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := Config{}
+			flagext.DefaultValues(&cfg)
+			testData.setup(&cfg)
+
+			actual := getChunksIteratorFunction(cfg)(testData.hints)
+			assert.Equal(t, reflect.ValueOf(testData.expected).Pointer(), reflect.ValueOf(actual).Pointer())
+		})
+	}
+}
+
 type mockQueryableWithFilter struct {
 	useQueryableCalled bool
 }
@@ -6,10 +6,14 @@
 package querier
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -22,6 +26,7 @@ import (
 
 	"github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/chunk"
 	"github.com/grafana/mimir/pkg/util"
 	util_log "github.com/grafana/mimir/pkg/util/log"
 )
@@ -34,6 +39,12 @@ const (
 	// Google's recommendation is to keep protobuf message not larger than 1MB.
 	// https://developers.google.com/protocol-buffers/docs/techniques#large-data
 	maxRemoteReadFrameBytes = 1024 * 1024
+
+	// Media type of the streamed remote read response, and the parameter a client sets to "passthrough" in the
+	// Accept header to receive the chunks as they're stored, without decoding and re-encoding them.
+	streamedChunksMediaType    = "application/x-streamed-protobuf"
+	chunksPassthroughParam     = "chunks"
+	chunksPassthroughParamMode = "passthrough"
 )
 
 // RemoteReadHandler handles Prometheus remote read requests.
@@ -60,7 +71,7 @@ func remoteReadHandler(q storage.SampleAndChunkQueryable, maxBytesInFrame int, l
 
 		switch respType {
 		case client.STREAMED_XOR_CHUNKS:
-			remoteReadStreamedXORChunks(ctx, q, w, &req, maxBytesInFrame, logger)
+			remoteReadStreamedXORChunks(ctx, q, w, &req, maxBytesInFrame, acceptsChunksPassthrough(r.Header), logger)
 		default:
 			remoteReadSamples(ctx, q, w, &req, logger)
 		}
@@ -125,10 +136,11 @@ func remoteReadSamples(
 
 func remoteReadStreamedXORChunks(
 	ctx context.Context,
-	q storage.ChunkQueryable,
+	q storage.SampleAndChunkQueryable,
 	w http.ResponseWriter,
 	req *client.ReadRequest,
 	maxBytesInFrame int,
+	passthrough bool,
 	logger log.Logger,
 ) {
 	f, ok := w.(http.Flusher)
@@ -137,10 +149,14 @@ func remoteReadStreamedXORChunks(
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+	contentType := streamedChunksMediaType + "; proto=prometheus.ChunkedReadResponse"
+	if passthrough {
+		contentType += "; " + chunksPassthroughParam + "=" + chunksPassthroughParamMode
+	}
+	w.Header().Set("Content-Type", contentType)
 
 	for i, qr := range req.Queries {
-		if err := processReadStreamedQueryRequest(ctx, i, qr, q, w, f, maxBytesInFrame); err != nil {
+		if err := processReadStreamedQueryRequest(ctx, i, qr, q, w, f, maxBytesInFrame, passthrough); err != nil {
 			level.Error(logger).Log("msg", "error streaming remote read response", "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -153,35 +169,140 @@ func processReadStreamedQueryRequest(
 	ctx context.Context,
 	idx int,
 	queryReq *client.QueryRequest,
-	q storage.ChunkQueryable,
+	q storage.SampleAndChunkQueryable,
 	w http.ResponseWriter,
 	f http.Flusher,
 	maxBytesInFrame int,
+	passthrough bool,
 ) error {
 	from, to, matchers, err := client.FromQueryRequest(queryReq)
 	if err != nil {
 		return err
 	}
 
-	querier, err := q.ChunkQuerier(ctx, int64(from), int64(to))
-	if err != nil {
-		return err
-	}
-
 	params := &storage.SelectHints{
 		Start: int64(from),
 		End:   int64(to),
 	}
 
+	// The streaming API has to provide the series sorted.
+	var seriesSet storage.ChunkSeriesSet
+	if passthrough {
+		querier, err := q.Querier(ctx, int64(from), int64(to))
+		if err != nil {
+			return err
+		}
+		seriesSet = chunksPassthroughSeriesSet{
+			SeriesSet: querier.Select(true, params, matchers...),
+			mint:      int64(from),
+			maxt:      int64(to),
+		}
+	} else {
+		querier, err := q.ChunkQuerier(ctx, int64(from), int64(to))
+		if err != nil {
+			return err
+		}
+		seriesSet = querier.Select(true, params, matchers...)
+	}
+
 	return streamChunkedReadResponses(
 		prom_remote.NewChunkedWriter(w, f),
-		// The streaming API has to provide the series sorted.
-		querier.Select(true, params, matchers...),
+		seriesSet,
 		idx,
 		maxBytesInFrame,
 	)
 }
 
+// acceptsChunksPassthrough returns whether the client accepts the chunks of the streamed response to be
+// passed through as they're stored.
+func acceptsChunksPassthrough(h http.Header) bool {
+	for _, accept := range h.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err == nil && mediaType == streamedChunksMediaType && params[chunksPassthroughParam] == chunksPassthroughParamMode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// chunksPassthroughSeriesSet is a storage.ChunkSeriesSet passing through the chunks of the series backed by
+// chunks, without decoding and re-encoding them. Only the series read from ingesters are backed by chunks: the
+// series read from store-gateways, including the ones also read from ingesters, are encoded into new chunks.
+//
+// The chunks received from multiple ingesters, given the series are replicated, are passed through once, and
+// the chunks outside the queried time range are dropped. The chunks at the boundaries of the queried time range
+// are not trimmed, so they can contain samples outside of it: the client is responsible for handling them.
+type chunksPassthroughSeriesSet struct {
+	storage.SeriesSet
+
+	mint, maxt int64
+}
+
+func (s chunksPassthroughSeriesSet) At() storage.ChunkSeries {
+	series := s.SeriesSet.At()
+	if sc, ok := series.(SeriesWithChunks); ok {
+		if metas, ok := chunksToMetas(sc.Chunks(), s.mint, s.maxt); ok {
+			return &storage.ChunkSeriesEntry{
+				Lset: series.Labels(),
+				ChunkIteratorFn: func(chunks.Iterator) chunks.Iterator {
+					return storage.NewListChunkSeriesIterator(metas...)
+				},
+			}
+		}
+	}
+	return storage.NewSeriesToChunkEncoder(series)
+}
+
+// chunksToMetas returns the Prometheus chunks wrapped by the input chunks overlapping the [mint, maxt] time
+// range, sorted by min time and without duplicates. It returns false if any of the input chunks doesn't wrap
+// a Prometheus chunk, or if different chunks overlap, given their samples would need to be merged.
+func chunksToMetas(chks []chunk.Chunk, mint, maxt int64) ([]chunks.Meta, bool) {
+	metas := make([]chunks.Meta, 0, len(chks))
+	for _, c := range chks {
+		promChunk := chunk.PrometheusChunk(c.Data)
+		if promChunk == nil {
+			return nil, false
+		}
+		if int64(c.Through) < mint || int64(c.From) > maxt {
+			continue
+		}
+		metas = append(metas, chunks.Meta{
+			MinTime: int64(c.From),
+			MaxTime: int64(c.Through),
+			Chunk:   promChunk,
+		})
+	}
+
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].MinTime != metas[j].MinTime {
+			return metas[i].MinTime < metas[j].MinTime
+		}
+		return metas[i].MaxTime < metas[j].MaxTime
+	})
+
+	deduped := metas[:0]
+	for _, m := range metas {
+		if len(deduped) > 0 {
+			prev := deduped[len(deduped)-1]
+			if isSameChunk(prev, m) {
+				continue
+			}
+			if m.MinTime <= prev.MaxTime {
+				return nil, false
+			}
+		}
+		deduped = append(deduped, m)
+	}
+	return deduped, true
+}
+
+func isSameChunk(a, b chunks.Meta) bool {
+	return a.MinTime == b.MinTime && a.MaxTime == b.MaxTime &&
+		a.Chunk.Encoding() == b.Chunk.Encoding() && bytes.Equal(a.Chunk.Bytes(), b.Chunk.Bytes())
+}
+
 func seriesSetToQueryResponse(s storage.SeriesSet) (*client.QueryResponse, error) {
 	result := &client.QueryResponse{}
 
@@ -26,6 +26,7 @@ import (
 
 	"github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/chunk"
 	"github.com/grafana/mimir/pkg/storage/series"
 	"github.com/grafana/mimir/pkg/util/test"
 )
@@ -351,6 +352,194 @@ func TestStreamedRemoteRead(t *testing.T) {
 	}
 }
 
+func TestStreamedRemoteReadChunksPassthrough(t *testing.T) {
+	newChunk := func(lbls labels.Labels, idx int) chunk.Chunk {
+		data, err := chunk.NewForEncoding(chunk.PrometheusXorChunk)
+		require.NoError(t, err)
+		require.NoError(t, data.UnmarshalFromBuf(getIndexedChunk(idx, 360, chunkenc.EncXOR)))
+		return chunk.NewChunk(lbls, data, model.Time(idx*120), model.Time(idx*120+119))
+	}
+
+	chunksLabels := labels.FromStrings("foo", "bar")
+	q := &mockSampleAndChunkQueryable{
+		queryableFn: func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+			return mockQuerier{
+				seriesSet: series.NewConcreteSeriesSetFromUnsortedSeries([]storage.Series{
+					// The chunks are passed through sorted by their min time, the chunks received from multiple
+					// ingesters are passed through once, and the chunks outside the queried time range are dropped.
+					&chunkSeries{labels: chunksLabels, chunks: []chunk.Chunk{
+						newChunk(chunksLabels, 1), newChunk(chunksLabels, 0), newChunk(chunksLabels, 2), newChunk(chunksLabels, 0), newChunk(chunksLabels, 1),
+					}},
+					// Series not backed by chunks are encoded into new chunks.
+					series.NewConcreteSeries(labels.FromStrings("foo", "baz"), getNSamples(120), nil),
+				}),
+			}, nil
+		},
+		chunkQueryableFn: func(ctx context.Context, mint, maxt int64) (storage.ChunkQuerier, error) {
+			return nil, errors.New("the chunk querier is not expected to be used")
+		},
+	}
+
+	handler := remoteReadHandler(q, maxRemoteReadFrameBytes, log.NewNopLogger())
+
+	requestBody, err := proto.Marshal(&client.ReadRequest{
+		Queries: []*client.QueryRequest{
+			{StartTimestampMs: 0, EndTimestampMs: 200},
+		},
+		AcceptedResponseTypes: []client.ReadRequest_ResponseType{client.STREAMED_XOR_CHUNKS},
+	})
+	require.NoError(t, err)
+	requestBody = snappy.Encode(nil, requestBody)
+	request, err := http.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader(requestBody))
+	require.NoError(t, err)
+	request.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+	request.Header.Set("Accept", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse; chunks=passthrough")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	require.Equal(t, 200, recorder.Result().StatusCode)
+	require.Equal(t, []string{"application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse; chunks=passthrough"}, recorder.Result().Header["Content-Type"])
+
+	expectedResults := []*client.StreamReadResponse{
+		{
+			ChunkedSeries: []*client.StreamChunkedSeries{
+				{
+					Labels: []mimirpb.LabelAdapter{{Name: "foo", Value: "bar"}},
+					Chunks: []client.StreamChunk{
+						{MinTimeMs: 0, MaxTimeMs: 119, Type: client.XOR, Data: getIndexedChunk(0, 360, chunkenc.EncXOR)},
+						{MinTimeMs: 120, MaxTimeMs: 239, Type: client.XOR, Data: getIndexedChunk(1, 360, chunkenc.EncXOR)},
+					},
+				},
+			},
+		},
+		{
+			ChunkedSeries: []*client.StreamChunkedSeries{
+				{
+					Labels: []mimirpb.LabelAdapter{{Name: "foo", Value: "baz"}},
+					Chunks: []client.StreamChunk{
+						{MinTimeMs: 0, MaxTimeMs: 119, Type: client.XOR, Data: getIndexedChunk(0, 120, chunkenc.EncXOR)},
+					},
+				},
+			},
+		},
+	}
+
+	stream := prom_remote.NewChunkedReader(recorder.Result().Body, prom_remote.DefaultChunkedReadLimit, nil)
+
+	i := 0
+	for {
+		var res client.StreamReadResponse
+		err := stream.NextProto(&res)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+
+		// The response references the buffer of the reader, so it's checked before reading the next one.
+		require.Less(t, i, len(expectedResults), "unexpected result message")
+		require.Equal(t, expectedResults[i], &res)
+		i++
+	}
+	require.Len(t, expectedResults, i)
+}
+
+func TestChunksToMetas(t *testing.T) {
+	newChunk := func(from, through model.Time, samples int) chunk.Chunk {
+		data, err := chunk.NewForEncoding(chunk.PrometheusXorChunk)
+		require.NoError(t, err)
+		require.NoError(t, data.UnmarshalFromBuf(getIndexedChunk(0, samples, chunkenc.EncXOR)))
+		return chunk.NewChunk(labels.EmptyLabels(), data, from, through)
+	}
+
+	for name, tc := range map[string]struct {
+		chunks           []chunk.Chunk
+		expectedMinTimes []int64
+		expectedOK       bool
+	}{
+		"no chunks": {
+			expectedMinTimes: []int64{},
+			expectedOK:       true,
+		},
+		"non overlapping chunks": {
+			chunks:           []chunk.Chunk{newChunk(100, 199, 10), newChunk(0, 99, 10)},
+			expectedMinTimes: []int64{0, 100},
+			expectedOK:       true,
+		},
+		"identical chunks from multiple replicas": {
+			chunks:           []chunk.Chunk{newChunk(0, 99, 10), newChunk(100, 199, 10), newChunk(0, 99, 10), newChunk(100, 199, 10)},
+			expectedMinTimes: []int64{0, 100},
+			expectedOK:       true,
+		},
+		"chunks outside the time range": {
+			chunks:           []chunk.Chunk{newChunk(0, 49, 10), newChunk(50, 149, 10), newChunk(500, 599, 10), newChunk(600, 699, 10)},
+			expectedMinTimes: []int64{50, 500},
+			expectedOK:       true,
+		},
+		"overlapping chunks with the same time range": {
+			chunks:     []chunk.Chunk{newChunk(0, 99, 10), newChunk(0, 99, 20)},
+			expectedOK: false,
+		},
+		"overlapping chunks with different time ranges": {
+			chunks:     []chunk.Chunk{newChunk(0, 99, 10), newChunk(50, 149, 10)},
+			expectedOK: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			metas, ok := chunksToMetas(tc.chunks, 50, 500)
+			require.Equal(t, tc.expectedOK, ok)
+			if !ok {
+				return
+			}
+
+			minTimes := make([]int64, 0, len(metas))
+			for _, m := range metas {
+				minTimes = append(minTimes, m.MinTime)
+			}
+			require.Equal(t, tc.expectedMinTimes, minTimes)
+		})
+	}
+}
+
+func TestAcceptsChunksPassthrough(t *testing.T) {
+	for name, tc := range map[string]struct {
+		accept   []string
+		expected bool
+	}{
+		"no Accept header": {
+			expected: false,
+		},
+		"streamed chunks without passthrough": {
+			accept:   []string{"application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"},
+			expected: false,
+		},
+		"streamed chunks with passthrough": {
+			accept:   []string{"application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse; chunks=passthrough"},
+			expected: true,
+		},
+		"streamed chunks with passthrough among other media types": {
+			accept:   []string{"application/x-protobuf, application/x-streamed-protobuf; chunks=passthrough"},
+			expected: true,
+		},
+		"streamed chunks with passthrough in another Accept header": {
+			accept:   []string{"application/x-protobuf", "application/x-streamed-protobuf; chunks=passthrough"},
+			expected: true,
+		},
+		"passthrough parameter on another media type": {
+			accept:   []string{"application/x-protobuf; chunks=passthrough"},
+			expected: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := http.Header{}
+			for _, accept := range tc.accept {
+				h.Add("Accept", accept)
+			}
+			require.Equal(t, tc.expected, acceptsChunksPassthrough(h))
+		})
+	}
+}
+
 func getNSamples(n int) []model.SamplePair {
 	var ret []model.SamplePair
 	for i := 0; i < n; i++ {
@@ -7,6 +7,8 @@ package stats
 
 import (
 	"context"
+	"sort"
+	"sync"
 	"sync/atomic" //lint:ignore faillint we can't use go.uber.org/atomic with a protobuf struct without wrapping it.
 	"time"
 
@@ -17,21 +19,40 @@ type contextKey int
 
 var ctxKey = contextKey(0)
 
+// MaxQueriedBlocks is the max number of queried block IDs recorded in the stats. Only the lowest block
+// IDs are kept, so that merging the stats of several queries keeps the lowest block IDs of all of them.
+const MaxQueriedBlocks = 10
+
+// contextStats is the value stored in the context: the stats, along with the mutex protecting their
+// QueriedBlocks, given we can't add a mutex to the protobuf struct and the list of blocks can't be
+// updated atomically.
+type contextStats struct {
+	stats            *Stats
+	queriedBlocksMtx sync.Mutex
+}
+
 // ContextWithEmptyStats returns a context with empty stats.
 func ContextWithEmptyStats(ctx context.Context) (*Stats, context.Context) {
 	stats := &Stats{}
-	ctx = context.WithValue(ctx, ctxKey, stats)
+	ctx = context.WithValue(ctx, ctxKey, &contextStats{stats: stats})
 	return stats, ctx
 }
 
 // FromContext gets the Stats out of the Context. Returns nil if stats have not
 // been initialised in the context.
 func FromContext(ctx context.Context) *Stats {
+	if cs := contextStatsFromContext(ctx); cs != nil {
+		return cs.stats
+	}
+	return nil
+}
+
+func contextStatsFromContext(ctx context.Context) *contextStats {
 	o := ctx.Value(ctxKey)
 	if o == nil {
 		return nil
 	}
-	return o.(*Stats)
+	return o.(*contextStats)
 }
 
 // IsEnabled returns whether stats tracking is enabled in the context.
@@ -171,7 +192,62 @@ func (s *Stats) LoadEstimatedSeriesCount() uint64 {
 	return atomic.LoadUint64(&s.EstimatedSeriesCount)
 }
 
-// Merge the provided Stats into this one.
+// AddQueriedBlocks adds the provided block IDs to the set of queried blocks of the stats in the context,
+// keeping at most MaxQueriedBlocks of them. It's a no-op if stats have not been initialised in the context.
+func AddQueriedBlocks(ctx context.Context, ids ...string) {
+	cs := contextStatsFromContext(ctx)
+	if cs == nil || len(ids) == 0 {
+		return
+	}
+
+	cs.queriedBlocksMtx.Lock()
+	defer cs.queriedBlocksMtx.Unlock()
+
+	// Keep the list sorted and without duplicates.
+	blocks := append(cs.stats.QueriedBlocks, ids...)
+	sort.Strings(blocks)
+
+	unique := blocks[:1]
+	for _, id := range blocks[1:] {
+		if len(unique) == MaxQueriedBlocks {
+			break
+		}
+		if id != unique[len(unique)-1] {
+			unique = append(unique, id)
+		}
+	}
+	cs.stats.QueriedBlocks = unique
+}
+
+// LoadQueriedBlocks returns a copy of the sorted set of queried block IDs of the stats in the context.
+func LoadQueriedBlocks(ctx context.Context) []string {
+	cs := contextStatsFromContext(ctx)
+	if cs == nil {
+		return nil
+	}
+
+	cs.queriedBlocksMtx.Lock()
+	defer cs.queriedBlocksMtx.Unlock()
+
+	if len(cs.stats.QueriedBlocks) == 0 {
+		return nil
+	}
+	return append([]string(nil), cs.stats.QueriedBlocks...)
+}
+
+// MergeIntoContext merges the provided Stats, which must not be updated concurrently, into the stats in the
+// context, including their queried blocks. It's a no-op if stats have not been initialised in the context.
+func MergeIntoContext(ctx context.Context, other *Stats) {
+	if other == nil {
+		return
+	}
+
+	FromContext(ctx).Merge(other)
+	AddQueriedBlocks(ctx, other.GetQueriedBlocks()...)
+}
+
+// Merge the provided Stats into this one. The queried blocks aren't merged, since they can't be
+// updated atomically: use MergeIntoContext to merge them too.
 func (s *Stats) Merge(other *Stats) {
 	if s == nil || other == nil {
 		return
@@ -46,6 +46,8 @@ type Stats struct {
 	FetchedIndexBytes uint64 `protobuf:"varint,7,opt,name=fetched_index_bytes,json=fetchedIndexBytes,proto3" json:"fetched_index_bytes,omitempty"`
 	// The estimated number of series to be fetched for the query
 	EstimatedSeriesCount uint64 `protobuf:"varint,8,opt,name=estimated_series_count,json=estimatedSeriesCount,proto3" json:"estimated_series_count,omitempty"`
+	// The IDs of the blocks queried from the store-gateways for the query
+	QueriedBlocks []string `protobuf:"bytes,9,rep,name=queried_blocks,json=queriedBlocks,proto3" json:"queried_blocks,omitempty"`
 }
 
 func (m *Stats) Reset()      { *m = Stats{} }
@@ -136,6 +138,13 @@ func (m *Stats) GetEstimatedSeriesCount() uint64 {
 	return 0
 }
 
+func (m *Stats) GetQueriedBlocks() []string {
+	if m != nil {
+		return m.QueriedBlocks
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Stats)(nil), "stats.Stats")
 }
@@ -143,30 +152,31 @@ func init() {
 func init() { proto.RegisterFile("stats.proto", fileDescriptor_b4756a0aec8b9d44) }
 
 var fileDescriptor_b4756a0aec8b9d44 = []byte{
-	// 362 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x92, 0x3f, 0x4f, 0xc2, 0x40,
-	0x18, 0xc6, 0x7b, 0xf2, 0x47, 0x3c, 0x44, 0x63, 0x25, 0xa6, 0x32, 0xbc, 0x10, 0x1d, 0x64, 0x2a,
-	0x46, 0xdd, 0x5c, 0x0c, 0xb8, 0x38, 0x0a, 0x4e, 0x2e, 0x4d, 0xa1, 0x47, 0x69, 0x2c, 0x3d, 0xec,
-	0x5d, 0xa3, 0x6e, 0x7e, 0x04, 0xdd, 0xfc, 0x08, 0x7e, 0x14, 0x46, 0x46, 0x26, 0x95, 0x63, 0x71,
-	0xe4, 0x23, 0x98, 0xbb, 0xb6, 0x04, 0xdc, 0x7a, 0xef, 0xef, 0xfd, 0xe5, 0x79, 0x72, 0x3d, 0x5c,
-	0x64, 0xdc, 0xe6, 0xcc, 0x1c, 0x85, 0x94, 0x53, 0x3d, 0xa7, 0x0e, 0x95, 0xb2, 0x4b, 0x5d, 0xaa,
-	0x26, 0x0d, 0xf9, 0x15, 0xc3, 0x0a, 0xb8, 0x94, 0xba, 0x3e, 0x69, 0xa8, 0x53, 0x37, 0xea, 0x37,
-	0x9c, 0x28, 0xb4, 0xb9, 0x47, 0x83, 0x98, 0x1f, 0xbd, 0x67, 0x70, 0xae, 0x23, 0x7d, 0xfd, 0x0a,
-	0x6f, 0x3d, 0xd9, 0xbe, 0x6f, 0x71, 0x6f, 0x48, 0x0c, 0x54, 0x43, 0xf5, 0xe2, 0xd9, 0xa1, 0x19,
-	0xdb, 0x66, 0x6a, 0x9b, 0xd7, 0x89, 0xdd, 0x2c, 0x8c, 0xbf, 0xaa, 0xda, 0xc7, 0x77, 0x15, 0xb5,
-	0x0b, 0xd2, 0xba, 0xf3, 0x86, 0x44, 0x3f, 0xc5, 0xe5, 0x3e, 0xe1, 0xbd, 0x01, 0x71, 0x2c, 0x46,
-	0x42, 0x8f, 0x30, 0xab, 0x47, 0xa3, 0x80, 0x1b, 0x1b, 0x35, 0x54, 0xcf, 0xb6, 0xf5, 0x84, 0x75,
-	0x14, 0x6a, 0x49, 0xa2, 0x9b, 0x78, 0x3f, 0x35, 0x7a, 0x83, 0x28, 0x78, 0xb0, 0xba, 0x2f, 0x9c,
-	0x30, 0x23, 0xa3, 0x84, 0xbd, 0x04, 0xb5, 0x24, 0x69, 0x4a, 0xb0, 0x9a, 0xa0, 0xf6, 0xd3, 0x84,
-	0xec, 0x5a, 0x82, 0x12, 0x92, 0x84, 0x13, 0xbc, 0xcb, 0x06, 0x76, 0xe8, 0x10, 0xc7, 0x7a, 0x8c,
-	0x54, 0xb2, 0x91, 0xab, 0xa1, 0x7a, 0xa9, 0xbd, 0x93, 0x8c, 0x6f, 0xe3, 0xa9, 0x7e, 0x8c, 0x4b,
-	0x6c, 0xe4, 0x7b, 0x7c, 0xb9, 0x96, 0x57, 0x6b, 0xdb, 0x6a, 0x98, 0x2e, 0xad, 0xf4, 0xf5, 0x02,
-	0x87, 0x3c, 0x27, 0x7d, 0x37, 0xd7, 0xfa, 0xde, 0x48, 0x12, 0xf7, 0xbd, 0xc0, 0x07, 0x84, 0x71,
-	0x6f, 0x68, 0xf3, 0xff, 0x77, 0x52, 0x50, 0x4a, 0x79, 0x49, 0x57, 0x6e, 0xa5, 0x79, 0x39, 0x99,
-	0x81, 0x36, 0x9d, 0x81, 0xb6, 0x98, 0x01, 0x7a, 0x15, 0x80, 0x3e, 0x05, 0xa0, 0xb1, 0x00, 0x34,
-	0x11, 0x80, 0x7e, 0x04, 0xa0, 0x5f, 0x01, 0xda, 0x42, 0x00, 0x7a, 0x9b, 0x83, 0x36, 0x99, 0x83,
-	0x36, 0x9d, 0x83, 0x76, 0x1f, 0x3f, 0x83, 0x6e, 0x5e, 0xfd, 0xab, 0xf3, 0xbf, 0x00, 0x00, 0x00,
-	0xff, 0xff, 0xba, 0xe5, 0x86, 0x2e, 0x23, 0x02, 0x00, 0x00,
+	// 382 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x92, 0xbf, 0x4e, 0xc2, 0x40,
+	0x1c, 0xc7, 0x7b, 0xf2, 0x47, 0x38, 0x04, 0x63, 0x25, 0xa6, 0x32, 0x1c, 0x8d, 0xc6, 0xd8, 0xa9,
+	0x18, 0x75, 0x73, 0x31, 0xc5, 0xc5, 0xd1, 0xe2, 0xe4, 0xd2, 0xf4, 0xcf, 0x51, 0x1a, 0x4a, 0x0f,
+	0x7b, 0xd7, 0xa8, 0x9b, 0x8f, 0xe0, 0xe8, 0x23, 0xf8, 0x08, 0x3e, 0x02, 0x23, 0x23, 0x93, 0x4a,
+	0x59, 0x1c, 0x79, 0x04, 0xd3, 0x6b, 0x4b, 0xc0, 0xad, 0xf7, 0xfd, 0xfc, 0x3e, 0xf9, 0x7d, 0x73,
+	0x3d, 0x58, 0xa3, 0xcc, 0x64, 0x54, 0x1d, 0x87, 0x84, 0x11, 0xb1, 0xc4, 0x0f, 0xad, 0xa6, 0x4b,
+	0x5c, 0xc2, 0x93, 0x4e, 0xf2, 0x95, 0xc2, 0x16, 0x72, 0x09, 0x71, 0x7d, 0xdc, 0xe1, 0x27, 0x2b,
+	0xea, 0x77, 0x9c, 0x28, 0x34, 0x99, 0x47, 0x82, 0x94, 0x1f, 0x7d, 0x16, 0x60, 0xa9, 0x97, 0xf8,
+	0xe2, 0x35, 0xac, 0x3e, 0x99, 0xbe, 0x6f, 0x30, 0x6f, 0x84, 0x25, 0x20, 0x03, 0xa5, 0x76, 0x7e,
+	0xa8, 0xa6, 0xb6, 0x9a, 0xdb, 0xea, 0x4d, 0x66, 0x6b, 0x95, 0xc9, 0x57, 0x5b, 0x78, 0xff, 0x6e,
+	0x03, 0xbd, 0x92, 0x58, 0xf7, 0xde, 0x08, 0x8b, 0x67, 0xb0, 0xd9, 0xc7, 0xcc, 0x1e, 0x60, 0xc7,
+	0xa0, 0x38, 0xf4, 0x30, 0x35, 0x6c, 0x12, 0x05, 0x4c, 0xda, 0x92, 0x81, 0x52, 0xd4, 0xc5, 0x8c,
+	0xf5, 0x38, 0xea, 0x26, 0x44, 0x54, 0xe1, 0x7e, 0x6e, 0xd8, 0x83, 0x28, 0x18, 0x1a, 0xd6, 0x0b,
+	0xc3, 0x54, 0x2a, 0x70, 0x61, 0x2f, 0x43, 0xdd, 0x84, 0x68, 0x09, 0x58, 0xdf, 0xc0, 0xe7, 0xf3,
+	0x0d, 0xc5, 0x8d, 0x0d, 0x5c, 0xc8, 0x36, 0x9c, 0xc2, 0x5d, 0x3a, 0x30, 0x43, 0x07, 0x3b, 0xc6,
+	0x63, 0xc4, 0x37, 0x4b, 0x25, 0x19, 0x28, 0x75, 0xbd, 0x91, 0xc5, 0x77, 0x69, 0x2a, 0x1e, 0xc3,
+	0x3a, 0x1d, 0xfb, 0x1e, 0x5b, 0x8d, 0x95, 0xf9, 0xd8, 0x0e, 0x0f, 0xf3, 0xa1, 0xb5, 0xbe, 0x5e,
+	0xe0, 0xe0, 0xe7, 0xac, 0xef, 0xf6, 0x46, 0xdf, 0xdb, 0x84, 0xa4, 0x7d, 0x2f, 0xe1, 0x01, 0xa6,
+	0xcc, 0x1b, 0x99, 0xec, 0xff, 0x9d, 0x54, 0xb8, 0xd2, 0x5c, 0xd1, 0xf5, 0x5b, 0x39, 0x81, 0x8d,
+	0xb4, 0x84, 0x63, 0x58, 0x3e, 0xb1, 0x87, 0x54, 0xaa, 0xca, 0x05, 0xa5, 0xaa, 0xd7, 0xb3, 0x54,
+	0xe3, 0xa1, 0x76, 0x35, 0x9d, 0x23, 0x61, 0x36, 0x47, 0xc2, 0x72, 0x8e, 0xc0, 0x6b, 0x8c, 0xc0,
+	0x47, 0x8c, 0xc0, 0x24, 0x46, 0x60, 0x1a, 0x23, 0xf0, 0x13, 0x23, 0xf0, 0x1b, 0x23, 0x61, 0x19,
+	0x23, 0xf0, 0xb6, 0x40, 0xc2, 0x74, 0x81, 0x84, 0xd9, 0x02, 0x09, 0x0f, 0xe9, 0x6b, 0xb1, 0xca,
+	0xfc, 0x97, 0x5e, 0xfc, 0x0d, 0x00, 0x25, 0xac, 0xd9, 0x1f, 0x4a, 0x02, 0x00, 0x00,
 }
 
 func (this *Stats) Equal(that interface{}) bool {
@@ -212,13 +222,21 @@ func (this *Stats) Equal(that interface{}) bool {
 	if this.EstimatedSeriesCount != that1.EstimatedSeriesCount {
 		return false
 	}
+	if len(this.QueriedBlocks) != len(that1.QueriedBlocks) {
+		return false
+	}
+	for i := range this.QueriedBlocks {
+		if this.QueriedBlocks[i] != that1.QueriedBlocks[i] {
+			return false
+		}
+	}
 	return true
 }
 func (this *Stats) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 12)
+	s := make([]string, 0, 13)
 	s = append(s, "&stats.Stats{")
 	s = append(s, "WallTime: "+fmt.Sprintf("%#v", this.WallTime)+",\n")
 	s = append(s, "FetchedSeriesCount: "+fmt.Sprintf("%#v", this.FetchedSeriesCount)+",\n")
@@ -228,6 +246,7 @@ func (this *Stats) GoString() string {
 	s = append(s, "SplitQueries: "+fmt.Sprintf("%#v", this.SplitQueries)+",\n")
 	s = append(s, "FetchedIndexBytes: "+fmt.Sprintf("%#v", this.FetchedIndexBytes)+",\n")
 	s = append(s, "EstimatedSeriesCount: "+fmt.Sprintf("%#v", this.EstimatedSeriesCount)+",\n")
+	s = append(s, "QueriedBlocks: "+fmt.Sprintf("%#v", this.QueriedBlocks)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -259,6 +278,15 @@ func (m *Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.QueriedBlocks) > 0 {
+		for iNdEx := len(m.QueriedBlocks) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.QueriedBlocks[iNdEx])
+			copy(dAtA[i:], m.QueriedBlocks[iNdEx])
+			i = encodeVarintStats(dAtA, i, uint64(len(m.QueriedBlocks[iNdEx])))
+			i--
+			dAtA[i] = 0x4a
+		}
+	}
 	if m.EstimatedSeriesCount != 0 {
 		i = encodeVarintStats(dAtA, i, uint64(m.EstimatedSeriesCount))
 		i--
@@ -345,6 +373,12 @@ func (m *Stats) Size() (n int) {
 	if m.EstimatedSeriesCount != 0 {
 		n += 1 + sovStats(uint64(m.EstimatedSeriesCount))
 	}
+	if len(m.QueriedBlocks) > 0 {
+		for _, s := range m.QueriedBlocks {
+			l = len(s)
+			n += 1 + l + sovStats(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -367,6 +401,7 @@ func (this *Stats) String() string {
 		`SplitQueries:` + fmt.Sprintf("%v", this.SplitQueries) + `,`,
 		`FetchedIndexBytes:` + fmt.Sprintf("%v", this.FetchedIndexBytes) + `,`,
 		`EstimatedSeriesCount:` + fmt.Sprintf("%v", this.EstimatedSeriesCount) + `,`,
+		`QueriedBlocks:` + fmt.Sprintf("%v", this.QueriedBlocks) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -574,6 +609,38 @@ func (m *Stats) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueriedBlocks", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthStats
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthStats
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.QueriedBlocks = append(m.QueriedBlocks, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStats(dAtA[iNdEx:])
@@ -7,6 +7,8 @@ package stats
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -115,6 +117,53 @@ func TestStats_AddSplitQueries(t *testing.T) {
 	})
 }
 
+func TestAddQueriedBlocks(t *testing.T) {
+	t.Run("add and load queried blocks", func(t *testing.T) {
+		_, ctx := ContextWithEmptyStats(context.Background())
+		AddQueriedBlocks(ctx, "block-2", "block-1")
+		AddQueriedBlocks(ctx, "block-3", "block-1")
+
+		assert.Equal(t, []string{"block-1", "block-2", "block-3"}, LoadQueriedBlocks(ctx))
+	})
+
+	t.Run("add queried blocks concurrently", func(t *testing.T) {
+		_, ctx := ContextWithEmptyStats(context.Background())
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < MaxQueriedBlocks; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				AddQueriedBlocks(ctx, fmt.Sprintf("block-%d", i), "block-0")
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Len(t, LoadQueriedBlocks(ctx), MaxQueriedBlocks)
+	})
+
+	t.Run("keep only the lowest queried blocks", func(t *testing.T) {
+		_, ctx := ContextWithEmptyStats(context.Background())
+
+		var expected []string
+		for i := MaxQueriedBlocks + 4; i >= 0; i-- {
+			AddQueriedBlocks(ctx, fmt.Sprintf("block-%02d", i))
+		}
+		for i := 0; i < MaxQueriedBlocks; i++ {
+			expected = append(expected, fmt.Sprintf("block-%02d", i))
+		}
+
+		assert.Equal(t, expected, LoadQueriedBlocks(ctx))
+	})
+
+	t.Run("add and load queried blocks without stats in the context", func(t *testing.T) {
+		ctx := context.Background()
+		AddQueriedBlocks(ctx, "block-1")
+
+		assert.Nil(t, LoadQueriedBlocks(ctx))
+	})
+}
+
 func TestStats_Merge(t *testing.T) {
 	t.Run("merge two stats objects", func(t *testing.T) {
 		stats1 := &Stats{}
@@ -132,6 +181,7 @@ func TestStats_Merge(t *testing.T) {
 		stats2.AddFetchedChunks(11)
 		stats2.AddShardedQueries(21)
 		stats2.AddSplitQueries(11)
+		stats2.QueriedBlocks = []string{"block-2", "block-3"}
 
 		stats1.Merge(stats2)
 
@@ -141,6 +191,7 @@ func TestStats_Merge(t *testing.T) {
 		assert.Equal(t, uint64(21), stats1.LoadFetchedChunks())
 		assert.Equal(t, uint32(41), stats1.LoadShardedQueries())
 		assert.Equal(t, uint32(21), stats1.LoadSplitQueries())
+		assert.Empty(t, stats1.GetQueriedBlocks())
 	})
 
 	t.Run("merge two nil stats objects", func(t *testing.T) {
@@ -157,3 +208,38 @@ func TestStats_Merge(t *testing.T) {
 		assert.Equal(t, uint32(0), stats1.LoadSplitQueries())
 	})
 }
+
+func TestMergeIntoContext(t *testing.T) {
+	t.Run("merge stats into the context", func(t *testing.T) {
+		stats1, ctx := ContextWithEmptyStats(context.Background())
+		stats1.AddFetchedSeries(50)
+		AddQueriedBlocks(ctx, "block-1", "block-2")
+
+		stats2 := &Stats{}
+		stats2.AddFetchedSeries(60)
+		stats2.QueriedBlocks = []string{"block-2", "block-3"}
+
+		MergeIntoContext(ctx, stats2)
+
+		assert.Equal(t, uint64(110), stats1.LoadFetchedSeries())
+		assert.Equal(t, []string{"block-1", "block-2", "block-3"}, LoadQueriedBlocks(ctx))
+	})
+
+	t.Run("merge nil stats into the context", func(t *testing.T) {
+		stats1, ctx := ContextWithEmptyStats(context.Background())
+		AddQueriedBlocks(ctx, "block-1")
+
+		MergeIntoContext(ctx, nil)
+
+		assert.Equal(t, uint64(0), stats1.LoadFetchedSeries())
+		assert.Equal(t, []string{"block-1"}, LoadQueriedBlocks(ctx))
+	})
+
+	t.Run("merge stats into a context without stats", func(t *testing.T) {
+		ctx := context.Background()
+
+		MergeIntoContext(ctx, &Stats{QueriedBlocks: []string{"block-1"}})
+
+		assert.Nil(t, LoadQueriedBlocks(ctx))
+	})
+}
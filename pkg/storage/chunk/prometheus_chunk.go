@@ -50,6 +50,21 @@ func (p *prometheusChunk) Len() int {
 	return p.chunk.NumSamples()
 }
 
+// PrometheusChunk returns the Prometheus chunk wrapped by the encoded chunk, or nil if the encoded
+// chunk doesn't wrap a Prometheus chunk or its data is not set.
+func PrometheusChunk(c EncodedChunk) chunkenc.Chunk {
+	switch pc := c.(type) {
+	case *prometheusXorChunk:
+		return pc.chunk
+	case *prometheusHistogramChunk:
+		return pc.chunk
+	case *prometheusFloatHistogramChunk:
+		return pc.chunk
+	default:
+		return nil
+	}
+}
+
 // Wrapper around a Prometheus XOR chunk.
 type prometheusXorChunk struct {
 	prometheusChunk
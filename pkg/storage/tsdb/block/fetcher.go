@@ -8,10 +8,14 @@ package block
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,11 +26,14 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/spf13/afero"
 	"github.com/thanos-io/objstore"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/yaml.v2"
 
+	"github.com/grafana/dskit/backoff"
 	"github.com/grafana/dskit/multierror"
 	"github.com/grafana/dskit/runutil"
 
@@ -41,6 +48,18 @@ type FetcherMetrics struct {
 	Syncs        prometheus.Counter
 	SyncFailures prometheus.Counter
 	SyncDuration prometheus.Histogram
+	BlockSize    prometheus.Histogram
+
+	TotalSeries  prometheus.Gauge
+	TotalSamples prometheus.Gauge
+	TotalChunks  prometheus.Gauge
+
+	CacheHitRatio prometheus.Gauge
+
+	Filters         prometheus.Gauge
+	FiltersDuration prometheus.Histogram
+
+	MetaLoadDuration prometheus.Histogram
 
 	Synced   *extprom.TxGaugeVec
 	Modified *extprom.TxGaugeVec
@@ -67,10 +86,15 @@ const (
 	FailedMeta    = "failed"
 
 	// Synced label values.
-	labelExcludedMeta = "label-excluded"
-	timeExcludedMeta  = "time-excluded"
-	tooFreshMeta      = "too-fresh"
-	duplicateMeta     = "duplicate"
+	labelExcludedMeta            = "label-excluded"
+	timeExcludedMeta             = "time-excluded"
+	tooFreshMeta                 = "too-fresh"
+	duplicateMeta                = "duplicate"
+	overMaxDurationMeta          = "over-max-duration"
+	emptyMeta                    = "empty"
+	belowMinLevelMeta            = "below-min-compaction-level"
+	incompleteMeta               = "incomplete"
+	compactorVersionExcludedMeta = "compactor-version-excluded"
 	// Blocks that are marked for deletion can be loaded as well. This is done to make sure that we load blocks that are meant to be deleted,
 	// but don't have a replacement block yet.
 	MarkedForDeletionMeta = "marked-for-deletion"
@@ -101,6 +125,50 @@ func NewFetcherMetrics(reg prometheus.Registerer, syncedExtraLabels, modifiedExt
 		Help:      "Duration of the blocks metadata synchronization in seconds",
 		Buckets:   []float64{0.01, 1, 10, 100, 300, 600, 1000},
 	})
+	m.BlockSize = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "block_size_bytes",
+		Help:      "Size of the blocks in bytes, observed when their metadata is loaded from the object storage",
+		// From 1MiB to 256GiB.
+		Buckets: prometheus.ExponentialBuckets(1024*1024, 4, 10),
+	})
+	m.TotalSeries = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "total_series",
+		Help:      "Total number of series across all loaded blocks",
+	})
+	m.TotalSamples = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "total_samples",
+		Help:      "Total number of samples across all loaded blocks",
+	})
+	m.TotalChunks = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "total_chunks",
+		Help:      "Total number of chunks across all loaded blocks",
+	})
+	m.CacheHitRatio = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "cache_hit_ratio",
+		Help:      "Ratio of block metadata served from the in-memory or disk cache, out of all block metadata loaded in the last synchronization",
+	})
+	m.Filters = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "filters",
+		Help:      "Number of metadata filters run in the last synchronization",
+	})
+	m.FiltersDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "filters_duration_seconds",
+		Help:      "Cumulative duration of the metadata filters run on each synchronization in seconds",
+		Buckets:   []float64{0.001, 0.01, 0.1, 1, 10, 100},
+	})
+	m.MetaLoadDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Subsystem: fetcherSubSys,
+		Name:      "load_duration_seconds",
+		Help:      "Duration of the download of a single block meta.json from the object storage in seconds",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	})
 	m.Synced = extprom.NewTxGaugeVec(
 		reg,
 		prometheus.GaugeOpts{
@@ -118,6 +186,11 @@ func NewFetcherMetrics(reg prometheus.Registerer, syncedExtraLabels, modifiedExt
 			{labelExcludedMeta},
 			{timeExcludedMeta},
 			{duplicateMeta},
+			{overMaxDurationMeta},
+			{emptyMeta},
+			{belowMinLevelMeta},
+			{incompleteMeta},
+			{compactorVersionExcludedMeta},
 			{MarkedForDeletionMeta},
 			{MarkedForNoCompactionMeta},
 		}, syncedExtraLabels...)...,
@@ -141,6 +214,13 @@ type MetadataFetcher interface {
 	Fetch(ctx context.Context) (metas map[ulid.ULID]*metadata.Meta, partial map[ulid.ULID]error, err error)
 }
 
+// MetadataFetcherWithUnloaded is a MetadataFetcher which can also return the blocks whose meta.json hasn't been
+// loaded, see MetaFetcher.FetchWithUnloaded.
+type MetadataFetcherWithUnloaded interface {
+	MetadataFetcher
+	FetchWithUnloaded(ctx context.Context) (metas map[ulid.ULID]*metadata.Meta, partial, unloaded map[ulid.ULID]error, err error)
+}
+
 // GaugeVec hides something like a Prometheus GaugeVec or an extprom.TxGaugeVec.
 type GaugeVec interface {
 	WithLabelValues(lvs ...string) prometheus.Gauge
@@ -151,6 +231,75 @@ type MetadataFilter interface {
 	Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, modified GaugeVec) error
 }
 
+// PooledMetadataFilter is a MetadataFilter which can run its concurrent work on a FilterPool shared
+// with the other filters of a MetaFetcher, instead of starting its own workers on each call.
+type PooledMetadataFilter interface {
+	MetadataFilter
+
+	FilterWithPool(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, modified GaugeVec, pool *FilterPool) error
+}
+
+// FilterPool bounds the number of jobs running concurrently across all the filters sharing it.
+// Go-routine safe.
+type FilterPool struct {
+	sem chan struct{}
+}
+
+// NewFilterPool creates a FilterPool running at most concurrency jobs at once.
+func NewFilterPool(concurrency int) *FilterPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &FilterPool{sem: make(chan struct{}, concurrency)}
+}
+
+// ForEach runs fn for each index in [0, jobs), waiting for a free slot in the pool before starting each
+// job. It stops starting jobs as soon as a job fails or ctx is canceled, and returns the first error.
+func (p *FilterPool) ForEach(ctx context.Context, jobs int, fn func(ctx context.Context, idx int) error) error {
+	g, gctx := errgroup.WithContext(ctx)
+
+	for idx := 0; idx < jobs; idx++ {
+		acquired := false
+		select {
+		case p.sem <- struct{}{}:
+			acquired = true
+		case <-gctx.Done():
+		}
+
+		// Don't start the job if the context is done, even if a slot was free in the meanwhile.
+		if gctx.Err() != nil {
+			if acquired {
+				<-p.sem
+			}
+			break
+		}
+
+		idx := idx
+		g.Go(func() error {
+			defer func() { <-p.sem }()
+			return fn(gctx, idx)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// FetchPolicy validates the final set of metas returned by a fetch, after all filters have been applied.
+// If an invariant on the whole set is violated, Check returns a descriptive error and the fetch fails.
+type FetchPolicy interface {
+	Check(ctx context.Context, metas map[ulid.ULID]*metadata.Meta) error
+}
+
+// BlockCallback is notified of the blocks added to and removed from the bucket, as seen by the fetches
+// which loaded the meta.json of all blocks.
+type BlockCallback interface {
+	OnBlockAdded(id ulid.ULID, meta *metadata.Meta)
+	OnBlockRemoved(id ulid.ULID)
+}
+
 // BaseFetcher is a struct that synchronizes filtered metadata of all block in the object storage with the local state.
 // Go-routine safe.
 type BaseFetcher struct {
@@ -158,17 +307,149 @@ type BaseFetcher struct {
 	concurrency int
 	bkt         objstore.InstrumentedBucketReader
 
-	// Optional local directory to cache meta.json files.
-	cacheDir string
-	syncs    prometheus.Counter
-	g        singleflight.Group
+	// Optional local directory to cache meta.json files, and the filesystem it's on.
+	cacheDir       string
+	fs             afero.Fs
+	syncs          prometheus.Counter
+	retries        prometheus.Counter
+	cacheCorrupted prometheus.Counter
+	nonBlocks      prometheus.Counter
+	g              singleflight.Group
 
 	mtx    sync.Mutex
 	cached map[ulid.ULID]*metadata.Meta
+
+	// Whether cached metas should be checked against the meta.json object attributes, and the
+	// attributes of the meta.json from which each cached meta has been loaded.
+	checkMetaAttributes bool
+	cachedAttrs         map[ulid.ULID]objstore.ObjectAttributes
+
+	// Tolerance to blocks whose meta.json failed to load, before considering the fetch failed.
+	maxFailedMetas      int
+	maxFailedMetasRatio float64
+
+	// Max number of blocks whose meta.json is fetched at once. 0 means no limit.
+	batchSize int
+
+	// Time after which a fetch stops loading the meta.json of more blocks, and returns the ones loaded
+	// so far. 0 means no limit.
+	softTimeout time.Duration
+
+	// Policies the fetched metas are checked against.
+	policies []FetchPolicy
+
+	// Max number of retries, and the initial delay between them, of the object storage requests
+	// failed with a transient error while loading a meta.json.
+	metaLoadRetries    int
+	metaLoadRetryDelay time.Duration
+
+	// Max time a cached meta is served before being loaded again from the bucket, and the time each cached
+	// meta has been loaded at. A zero TTL means cached metas never expire.
+	cacheTTL time.Duration
+	cachedAt map[ulid.ULID]time.Time
+	now      func() time.Time
+
+	// Callbacks notified of the added and removed blocks, and the blocks they have been notified of.
+	callbacks []BlockCallback
+	notified  map[ulid.ULID]struct{}
+
+	// Size of the pool shared by the filters of the MetaFetchers created from this BaseFetcher. 0 means
+	// no pool is shared, and each filter runs with its own concurrency.
+	filterPoolSize int
+}
+
+const (
+	defaultMetaLoadRetries    = 3
+	defaultMetaLoadRetryDelay = 100 * time.Millisecond
+)
+
+// BaseFetcherOption configures the BaseFetcher.
+type BaseFetcherOption func(f *BaseFetcher)
+
+// WithFailedMetasTolerance configures the BaseFetcher to not fail a fetch when some meta.json files failed
+// to load, as long as they're at most maxCount or at most maxRatio of all the blocks in the bucket. The blocks
+// whose meta.json failed to load are returned as unloaded by MetaFetcher.FetchWithUnloaded, while
+// MetaFetcher.Fetch returns ErrIncompleteFetch. A zero value disables the respective threshold. By default,
+// a fetch fails if any meta.json fails to load.
+func WithFailedMetasTolerance(maxCount int, maxRatio float64) BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.maxFailedMetas = maxCount
+		f.maxFailedMetasRatio = maxRatio
+	}
+}
+
+// WithMetaAttributesCheck configures the BaseFetcher to compare the object attributes (size and last
+// modification time) of each meta.json in the bucket with the ones of the meta.json it was cached from,
+// and to download it again if they differ. This allows to detect a cached meta.json which has been
+// overwritten in the bucket, at the cost of reading the object attributes instead of checking its existence.
+func WithMetaAttributesCheck() BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.checkMetaAttributes = true
+	}
 }
 
-// NewBaseFetcher constructs BaseFetcher.
-func NewBaseFetcher(logger log.Logger, concurrency int, bkt objstore.InstrumentedBucketReader, dir string, reg prometheus.Registerer) (*BaseFetcher, error) {
+// WithFetchBatchSize configures the BaseFetcher to fetch the meta.json files in batches of at most size
+// blocks, waiting for a batch to be completely fetched before starting the next one. This bounds the
+// number of blocks in flight when the bucket contains many of them. A zero value disables batching.
+func WithFetchBatchSize(size int) BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.batchSize = size
+	}
+}
+
+// WithFetchSoftTimeout configures the BaseFetcher to stop loading the meta.json of more blocks once a fetch
+// has been running for longer than timeout, and to return the metas loaded so far. The blocks whose meta.json
+// hasn't been loaded are returned as unloaded by MetaFetcher.FetchWithUnloaded, with ErrorSyncMetaSkipped, so
+// that the caller can retry loading them (see RetryFailed), while MetaFetcher.Fetch returns ErrIncompleteFetch.
+// A zero value disables the soft timeout.
+func WithFetchSoftTimeout(timeout time.Duration) BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.softTimeout = timeout
+	}
+}
+
+// WithFetchPolicies configures the BaseFetcher to check the metas returned by each fetch against the
+// given policies. A fetch fails if any of the policies is violated.
+func WithFetchPolicies(policies ...FetchPolicy) BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.policies = append(f.policies, policies...)
+	}
+}
+
+// WithMetaLoadRetries configures how many times the BaseFetcher retries the object storage requests
+// failed with a transient error while loading a meta.json, and the initial delay between retries, which
+// grows exponentially with jitter. A meta.json which doesn't exist or is corrupted is never retried.
+// By default, requests are retried 3 times starting with a 100ms delay. Zero retries disables retrying.
+func WithMetaLoadRetries(retries int, delay time.Duration) BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.metaLoadRetries = retries
+		f.metaLoadRetryDelay = delay
+	}
+}
+
+// WithFilterPoolSize configures the MetaFetchers created from the BaseFetcher to run the filters implementing
+// PooledMetadataFilter on a pool shared across all of them, running at most size jobs at once. This replaces
+// the concurrency each filter has been configured with. By default, no pool is shared, and each filter runs
+// with its own concurrency.
+func WithFilterPoolSize(size int) BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.filterPoolSize = size
+	}
+}
+
+// WithCacheFS configures the BaseFetcher to cache the meta.json files on the given filesystem, instead
+// of the OS one. The cache directory passed to NewBaseFetcher is a path on this filesystem.
+func WithCacheFS(fs afero.Fs) BaseFetcherOption {
+	return func(f *BaseFetcher) {
+		f.fs = fs
+	}
+}
+
+// NewBaseFetcher constructs BaseFetcher. The metas cached for longer than cacheTTL are loaded again from
+// the bucket, bypassing both the in-memory and the disk cache. This bounds the staleness of the cached metas,
+// given the in-memory cache is only refreshed by fetches which successfully loaded the meta.json of all
+// blocks. A zero cacheTTL disables expiry.
+func NewBaseFetcher(logger log.Logger, concurrency int, bkt objstore.InstrumentedBucketReader, dir string, cacheTTL time.Duration, reg prometheus.Registerer, opts ...BaseFetcherOption) (*BaseFetcher, error) {
 	if logger == nil {
 		logger = log.NewNopLogger()
 	}
@@ -176,34 +457,63 @@ func NewBaseFetcher(logger log.Logger, concurrency int, bkt objstore.Instrumente
 	cacheDir := ""
 	if dir != "" {
 		cacheDir = filepath.Join(dir, "meta-syncer")
-		if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
-			return nil, err
-		}
 	}
 
-	return &BaseFetcher{
+	f := &BaseFetcher{
 		logger:      log.With(logger, "component", "block.BaseFetcher"),
 		concurrency: concurrency,
 		bkt:         bkt,
 		cacheDir:    cacheDir,
+		fs:          afero.NewOsFs(),
 		cached:      map[ulid.ULID]*metadata.Meta{},
+		cachedAttrs: map[ulid.ULID]objstore.ObjectAttributes{},
+		cacheTTL:    cacheTTL,
+		cachedAt:    map[ulid.ULID]time.Time{},
+		now:         time.Now,
 		syncs: promauto.With(reg).NewCounter(prometheus.CounterOpts{
 			Subsystem: fetcherSubSys,
 			Name:      "base_syncs_total",
 			Help:      "Total blocks metadata synchronization attempts by base Fetcher",
 		}),
-	}, nil
+		retries: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Subsystem: fetcherSubSys,
+			Name:      "base_load_retries_total",
+			Help:      "Total retries of object storage requests failed with a transient error while loading block metadata by base Fetcher",
+		}),
+		cacheCorrupted: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Subsystem: fetcherSubSys,
+			Name:      "cache_corrupted_total",
+			Help:      "Total number of block metadata cached on disk which failed to be read and has been evicted from the cache",
+		}),
+		nonBlocks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Subsystem: fetcherSubSys,
+			Name:      "non_block_entries_total",
+			Help:      "Total number of entries found while listing the blocks in the bucket which are not block directories",
+		}),
+		metaLoadRetries:    defaultMetaLoadRetries,
+		metaLoadRetryDelay: defaultMetaLoadRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	if f.cacheDir != "" {
+		if err := f.fs.MkdirAll(f.cacheDir, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
 }
 
 // NewRawMetaFetcher returns basic meta fetcher without proper handling for eventual consistent backends or partial uploads.
 // NOTE: Not suitable to use in production.
 func NewRawMetaFetcher(logger log.Logger, bkt objstore.InstrumentedBucketReader) (*MetaFetcher, error) {
-	return NewMetaFetcher(logger, 1, bkt, "", nil, nil)
+	return NewMetaFetcher(logger, 1, bkt, "", 0, nil, nil)
 }
 
-// NewMetaFetcher returns meta fetcher.
-func NewMetaFetcher(logger log.Logger, concurrency int, bkt objstore.InstrumentedBucketReader, dir string, reg prometheus.Registerer, filters []MetadataFilter) (*MetaFetcher, error) {
-	b, err := NewBaseFetcher(logger, concurrency, bkt, dir, reg)
+// NewMetaFetcher returns meta fetcher. See NewBaseFetcher for the meaning of cacheTTL.
+func NewMetaFetcher(logger log.Logger, concurrency int, bkt objstore.InstrumentedBucketReader, dir string, cacheTTL time.Duration, reg prometheus.Registerer, filters []MetadataFilter, opts ...BaseFetcherOption) (*MetaFetcher, error) {
+	b, err := NewBaseFetcher(logger, concurrency, bkt, dir, cacheTTL, reg, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -212,88 +522,245 @@ func NewMetaFetcher(logger log.Logger, concurrency int, bkt objstore.Instrumente
 
 // NewMetaFetcher transforms BaseFetcher into actually usable *MetaFetcher.
 func (f *BaseFetcher) NewMetaFetcher(reg prometheus.Registerer, filters []MetadataFilter) *MetaFetcher {
-	return &MetaFetcher{metrics: NewFetcherMetrics(reg, nil, nil), wrapped: f, filters: filters}
+	var pool *FilterPool
+	if f.filterPoolSize > 0 {
+		pool = NewFilterPool(f.filterPoolSize)
+	}
+	return &MetaFetcher{metrics: NewFetcherMetrics(reg, nil, nil), wrapped: f, filters: filters, pool: pool}
 }
 
+const (
+	// cachedMetaAttributesFilename is the name of the file storing, in the local cache dir, the object attributes of
+	// the meta.json the cached meta has been loaded from.
+	cachedMetaAttributesFilename = "meta.json.attributes"
+)
+
 var (
 	ErrorSyncMetaNotFound  = errors.New("meta.json not found")
 	ErrorSyncMetaCorrupted = errors.New("meta.json corrupted")
+	ErrorSyncMetaSkipped   = errors.New("meta.json not loaded because the fetch soft timeout has been exceeded")
+
+	// ErrIncompleteFetch is returned by MetaFetcher.Fetch, together with the metas loaded, when the meta.json of
+	// some blocks hasn't been loaded, so that callers not aware of unloaded blocks don't act on an incomplete view.
+	ErrIncompleteFetch = errors.New("the meta.json of some blocks hasn't been loaded")
 )
 
-// loadMeta returns metadata from object storage or error.
+// loadMeta returns metadata from object storage or error, the object attributes of the meta.json it has
+// been loaded from (only if the attributes check is enabled), and whether it has been served from cache.
 // It returns `ErrorSyncMetaNotFound` and `ErrorSyncMetaCorrupted` sentinel errors in those cases.
-func (f *BaseFetcher) loadMeta(ctx context.Context, id ulid.ULID) (*metadata.Meta, error) {
+// The duration of each download of the meta.json is observed by loadDuration, if not nil.
+func (f *BaseFetcher) loadMeta(ctx context.Context, id ulid.ULID, loadDuration prometheus.Observer) (_ *metadata.Meta, _ objstore.ObjectAttributes, cached bool, _ error) {
 	var (
 		metaFile       = path.Join(id.String(), MetaFilename)
 		cachedBlockDir = filepath.Join(f.cacheDir, id.String())
+		attrs          objstore.ObjectAttributes
 	)
 
-	// TODO(bwplotka): If that causes problems (obj store rate limits), add longer ttl to cached items.
-	// For 1y and 100 block sources this generates ~1.5-3k HEAD RPM. AWS handles 330k RPM per prefix.
-	// TODO(bwplotka): Consider filtering by consistency delay here (can't do until compactor healthyOverride work).
-	ok, err := f.bkt.Exists(ctx, metaFile)
+	err := f.retryMetaLoad(ctx, func() error {
+		if f.checkMetaAttributes {
+			var err error
+			attrs, err = f.bkt.ReaderWithExpectedErrs(f.bkt.IsObjNotFoundErr).Attributes(ctx, metaFile)
+			if f.bkt.IsObjNotFoundErr(err) {
+				return ErrorSyncMetaNotFound
+			}
+			if err != nil {
+				return errors.Wrapf(err, "meta.json file attributes: %v", metaFile)
+			}
+			return nil
+		}
+
+		// TODO(bwplotka): If that causes problems (obj store rate limits), add longer ttl to cached items.
+		// For 1y and 100 block sources this generates ~1.5-3k HEAD RPM. AWS handles 330k RPM per prefix.
+		// TODO(bwplotka): Consider filtering by consistency delay here (can't do until compactor healthyOverride work).
+		ok, err := f.bkt.Exists(ctx, metaFile)
+		if err != nil {
+			return errors.Wrapf(err, "meta.json file exists: %v", metaFile)
+		}
+		if !ok {
+			return ErrorSyncMetaNotFound
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "meta.json file exists: %v", metaFile)
-	}
-	if !ok {
-		return nil, ErrorSyncMetaNotFound
+		return nil, attrs, false, err
 	}
 
-	if m, seen := f.cached[id]; seen {
-		return m, nil
+	// An expired meta is loaded again from the bucket, even if it's still cached.
+	expired := f.isCacheExpired(id)
+
+	if m, cachedAttrs, seen := f.getCached(id); seen && !expired && (!f.checkMetaAttributes || sameObjectAttributes(cachedAttrs, attrs)) {
+		return m, attrs, true, nil
 	}
 
 	// Best effort load from local dir.
-	if f.cacheDir != "" {
-		m, err := metadata.ReadFromDir(cachedBlockDir)
+	if f.cacheDir != "" && !expired {
+		m, err := f.readCachedMeta(cachedBlockDir)
+		if err == nil && m.ULID != id {
+			// Cached before the block ID was validated: load it from the bucket again.
+			err = errors.Errorf("cached meta.json has block ID %s", m.ULID)
+		}
+		if err == nil && f.checkMetaAttributes {
+			var cachedAttrs objstore.ObjectAttributes
+			cachedAttrs, err = f.readCachedMetaAttributes(cachedBlockDir)
+			if err == nil && !sameObjectAttributes(cachedAttrs, attrs) {
+				err = errors.New("cached meta.json attributes don't match the ones in the bucket")
+			}
+		}
 		if err == nil {
-			return m, nil
+			return m, attrs, true, nil
 		}
 
 		if !errors.Is(err, os.ErrNotExist) {
+			f.cacheCorrupted.Inc()
 			level.Warn(f.logger).Log("msg", "best effort read of the local meta.json failed; removing cached block dir", "dir", cachedBlockDir, "err", err)
-			if err := os.RemoveAll(cachedBlockDir); err != nil {
+			if err := f.fs.RemoveAll(cachedBlockDir); err != nil {
 				level.Warn(f.logger).Log("msg", "best effort remove of cached dir failed; ignoring", "dir", cachedBlockDir, "err", err)
 			}
 		}
 	}
 
-	r, err := f.bkt.ReaderWithExpectedErrs(f.bkt.IsObjNotFoundErr).Get(ctx, metaFile)
-	if f.bkt.IsObjNotFoundErr(err) {
-		// Meta.json was deleted between bkt.Exists and here.
-		return nil, errors.Wrapf(ErrorSyncMetaNotFound, "%v", err)
-	}
-	if err != nil {
-		return nil, errors.Wrapf(err, "get meta file: %v", metaFile)
-	}
+	var metaContent []byte
+	err = f.retryMetaLoad(ctx, func() error {
+		if loadDuration != nil {
+			start := time.Now()
+			defer func() {
+				loadDuration.Observe(time.Since(start).Seconds())
+			}()
+		}
+
+		r, err := f.bkt.ReaderWithExpectedErrs(f.bkt.IsObjNotFoundErr).Get(ctx, metaFile)
+		if f.bkt.IsObjNotFoundErr(err) {
+			// Meta.json was deleted between bkt.Exists and here.
+			return errors.Wrapf(ErrorSyncMetaNotFound, "%v", err)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "get meta file: %v", metaFile)
+		}
 
-	defer runutil.CloseWithLogOnErr(f.logger, r, "close bkt meta get")
+		defer runutil.CloseWithLogOnErr(f.logger, r, "close bkt meta get")
 
-	metaContent, err := io.ReadAll(r)
+		metaContent, err = io.ReadAll(r)
+		if err != nil {
+			return errors.Wrapf(err, "read meta file: %v", metaFile)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, errors.Wrapf(err, "read meta file: %v", metaFile)
+		return nil, attrs, false, err
 	}
 
 	m := &metadata.Meta{}
 	if err := json.Unmarshal(metaContent, m); err != nil {
-		return nil, errors.Wrapf(ErrorSyncMetaCorrupted, "meta.json %v unmarshal: %v", metaFile, err)
+		return nil, attrs, false, errors.Wrapf(ErrorSyncMetaCorrupted, "meta.json %v unmarshal: %v", metaFile, err)
+	}
+
+	// A meta.json copied from another block would make the block be handled as the other one.
+	if m.ULID != id {
+		return nil, attrs, false, errors.Wrapf(ErrorSyncMetaCorrupted, "meta.json %v contains block ID %s, which doesn't match the block directory %s", metaFile, m.ULID, id)
 	}
 
 	if m.Version != metadata.TSDBVersion1 {
-		return nil, errors.Errorf("unexpected meta file: %s version: %d", metaFile, m.Version)
+		return nil, attrs, false, errors.Errorf("unexpected meta file: %s version: %d", metaFile, m.Version)
 	}
 
 	// Best effort cache in local dir.
 	if f.cacheDir != "" {
-		if err := os.MkdirAll(cachedBlockDir, os.ModePerm); err != nil {
+		if err := f.fs.MkdirAll(cachedBlockDir, os.ModePerm); err != nil {
 			level.Warn(f.logger).Log("msg", "best effort mkdir of the meta.json block dir failed; ignoring", "dir", cachedBlockDir, "err", err)
 		}
 
-		if err := m.WriteToDir(f.logger, cachedBlockDir); err != nil {
+		if err := f.writeCachedMeta(cachedBlockDir, m); err != nil {
 			level.Warn(f.logger).Log("msg", "best effort save of the meta.json to local dir failed; ignoring", "dir", cachedBlockDir, "err", err)
+		} else if f.checkMetaAttributes {
+			if err := f.writeCachedMetaAttributes(cachedBlockDir, attrs); err != nil {
+				level.Warn(f.logger).Log("msg", "best effort save of the meta.json attributes to local dir failed; ignoring", "dir", cachedBlockDir, "err", err)
+			}
+		}
+	}
+	return m, attrs, false, nil
+}
+
+// retryMetaLoad runs fn, which runs object storage requests to load a meta.json, retrying it with
+// exponential backoff while it fails with a transient error. The error of the last attempt is returned.
+func (f *BaseFetcher) retryMetaLoad(ctx context.Context, fn func() error) error {
+	// Cap the shift to not overflow the max delay with a very high number of retries.
+	shift := f.metaLoadRetries
+	if shift > 10 {
+		shift = 10
+	}
+	boff := backoff.New(ctx, backoff.Config{MinBackoff: f.metaLoadRetryDelay, MaxBackoff: f.metaLoadRetryDelay << shift})
+
+	for {
+		err := fn()
+		if err == nil || !isTransientMetaLoadError(err) || boff.NumRetries() >= f.metaLoadRetries || ctx.Err() != nil {
+			return err
 		}
+
+		f.retries.Inc()
+		boff.Wait()
+	}
+}
+
+// isTransientMetaLoadError returns whether err is an error loading a meta.json which may succeed if retried.
+func isTransientMetaLoadError(err error) bool {
+	cause := errors.Cause(err)
+	return !errors.Is(cause, ErrorSyncMetaNotFound) &&
+		!errors.Is(cause, ErrorSyncMetaCorrupted) &&
+		!errors.Is(cause, context.Canceled) &&
+		!errors.Is(cause, context.DeadlineExceeded)
+}
+
+// sameObjectAttributes returns whether a and b are the attributes of the same version of an object.
+func sameObjectAttributes(a, b objstore.ObjectAttributes) bool {
+	return a.Size == b.Size && a.LastModified.Equal(b.LastModified)
+}
+
+// readCachedMeta reads the meta.json cached in dir.
+func (f *BaseFetcher) readCachedMeta(dir string) (*metadata.Meta, error) {
+	r, err := f.fs.Open(filepath.Join(dir, MetaFilename))
+	if err != nil {
+		return nil, err
+	}
+	return metadata.Read(r)
+}
+
+// writeCachedMeta caches m in dir. The meta.json is written to a temporary file first, to make the
+// change appear atomic.
+func (f *BaseFetcher) writeCachedMeta(dir string, m *metadata.Meta) error {
+	metaPath := filepath.Join(dir, MetaFilename)
+	tmp := metaPath + ".tmp"
+
+	w, err := f.fs.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := m.Write(w); err != nil {
+		runutil.CloseWithLogOnErr(f.logger, w, "close cached meta")
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.fs.Rename(tmp, metaPath)
+}
+
+func (f *BaseFetcher) readCachedMetaAttributes(dir string) (objstore.ObjectAttributes, error) {
+	var attrs objstore.ObjectAttributes
+
+	content, err := afero.ReadFile(f.fs, filepath.Join(dir, cachedMetaAttributesFilename))
+	if err != nil {
+		return attrs, err
+	}
+	err = json.Unmarshal(content, &attrs)
+	return attrs, err
+}
+
+func (f *BaseFetcher) writeCachedMetaAttributes(dir string, attrs objstore.ObjectAttributes) error {
+	content, err := json.Marshal(attrs)
+	if err != nil {
+		return err
 	}
-	return m, nil
+	return afero.WriteFile(f.fs, filepath.Join(dir, cachedMetaAttributesFilename), content, 0o666)
 }
 
 type response struct {
@@ -301,82 +768,102 @@ type response struct {
 	partial map[ulid.ULID]error
 	// If metaErr > 0 it means incomplete view, so some metas, failed to be loaded.
 	metaErrs multierror.MultiError
+	// unloaded holds the blocks whose metas failed to be loaded, or haven't been loaded because the
+	// fetch soft timeout has been exceeded. Unlike partial ones, these blocks may be complete in the bucket.
+	unloaded map[ulid.ULID]error
+	// attrs holds the object attributes of the loaded meta.json files, if the attributes check is enabled.
+	attrs map[ulid.ULID]objstore.ObjectAttributes
+	// at holds the time the loaded metas have been loaded from the bucket.
+	at map[ulid.ULID]time.Time
 
 	noMetas        float64
 	corruptedMetas float64
+	// Number of blocks whose meta.json hasn't been loaded because the fetch soft timeout has been exceeded.
+	skippedMetas int
+
+	// Number of loaded metas served from the in-memory or disk cache, and downloaded from the bucket.
+	cacheHits   float64
+	cacheMisses float64
 }
 
-func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
+func (f *BaseFetcher) fetchMetadata(ctx context.Context, metrics *FetcherMetrics) (interface{}, error) {
 	f.syncs.Inc()
 
 	var (
 		resp = response{
-			metas:   make(map[ulid.ULID]*metadata.Meta),
-			partial: make(map[ulid.ULID]error),
+			metas:    make(map[ulid.ULID]*metadata.Meta),
+			partial:  make(map[ulid.ULID]error),
+			unloaded: make(map[ulid.ULID]error),
+			attrs:    make(map[ulid.ULID]objstore.ObjectAttributes),
+			at:       make(map[ulid.ULID]time.Time),
 		}
-		eg  errgroup.Group
-		ch  = make(chan ulid.ULID, f.concurrency)
-		mtx sync.Mutex
+		mtx   sync.Mutex
+		start = time.Now()
 	)
-	level.Debug(f.logger).Log("msg", "fetching meta data", "concurrency", f.concurrency)
-	for i := 0; i < f.concurrency; i++ {
-		eg.Go(func() error {
-			for id := range ch {
-				meta, err := f.loadMeta(ctx, id)
-				if err == nil {
-					mtx.Lock()
-					resp.metas[id] = meta
-					mtx.Unlock()
-					continue
-				}
 
-				if errors.Is(errors.Cause(err), ErrorSyncMetaNotFound) {
-					mtx.Lock()
-					resp.noMetas++
-					mtx.Unlock()
-				} else if errors.Is(errors.Cause(err), ErrorSyncMetaCorrupted) {
-					mtx.Lock()
-					resp.corruptedMetas++
-					mtx.Unlock()
-				} else {
-					mtx.Lock()
-					resp.metaErrs.Add(err)
-					mtx.Unlock()
-					continue
-				}
+	fetch := func(id ulid.ULID) {
+		// Once the soft timeout is exceeded, the remaining blocks are still listed, but their meta.json isn't loaded.
+		if f.softTimeout > 0 && time.Since(start) > f.softTimeout {
+			mtx.Lock()
+			resp.skippedMetas++
+			resp.unloaded[id] = ErrorSyncMetaSkipped
+			mtx.Unlock()
+			return
+		}
 
-				mtx.Lock()
-				resp.partial[id] = err
-				mtx.Unlock()
-			}
-			return nil
-		})
-	}
+		meta, attrs, cached, err := f.loadMeta(ctx, id, metrics.MetaLoadDuration)
+		if err == nil {
+			at := f.loadedAt(id, cached)
 
-	// Workers scheduled, distribute blocks.
-	eg.Go(func() error {
-		defer close(ch)
-		return f.bkt.Iter(ctx, "", func(name string) error {
-			id, ok := IsBlockDir(name)
-			if !ok {
-				return nil
+			mtx.Lock()
+			resp.metas[id] = meta
+			resp.at[id] = at
+			if f.checkMetaAttributes {
+				resp.attrs[id] = attrs
 			}
+			if cached {
+				resp.cacheHits++
+			} else {
+				resp.cacheMisses++
+			}
+			mtx.Unlock()
 
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case ch <- id:
+			// The size of a block never changes, so it's only observed when its meta.json is loaded
+			// from the object storage. Blocks uploaded by older versions don't list their files,
+			// so their size is unknown.
+			if !cached && len(meta.Thanos.Files) > 0 {
+				metrics.BlockSize.Observe(float64(blockSize(meta)))
 			}
+			return
+		}
 
-			return nil
-		})
-	})
+		if errors.Is(errors.Cause(err), ErrorSyncMetaNotFound) {
+			mtx.Lock()
+			resp.noMetas++
+			mtx.Unlock()
+		} else if errors.Is(errors.Cause(err), ErrorSyncMetaCorrupted) {
+			mtx.Lock()
+			resp.corruptedMetas++
+			mtx.Unlock()
+		} else {
+			mtx.Lock()
+			resp.metaErrs.Add(err)
+			resp.unloaded[id] = err
+			mtx.Unlock()
+			return
+		}
+
+		mtx.Lock()
+		resp.partial[id] = err
+		mtx.Unlock()
+	}
 
-	if err := eg.Wait(); err != nil {
+	level.Debug(f.logger).Log("msg", "fetching meta data", "concurrency", f.concurrency, "batch_size", f.batchSize)
+	if err := f.forEachBlock(ctx, fetch); err != nil {
 		return nil, errors.Wrap(err, "BaseFetcher: iter bucket")
 	}
 
-	if len(resp.metaErrs) > 0 {
+	if len(resp.metaErrs) > 0 || resp.skippedMetas > 0 {
 		return resp, nil
 	}
 
@@ -386,13 +873,40 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 		cached[id] = m
 	}
 
+	cachedAttrs := make(map[ulid.ULID]objstore.ObjectAttributes, len(resp.attrs))
+	for id, attrs := range resp.attrs {
+		cachedAttrs[id] = attrs
+	}
+
+	cachedAt := make(map[ulid.ULID]time.Time, len(resp.at))
+	for id, at := range resp.at {
+		cachedAt[id] = at
+	}
+
 	f.mtx.Lock()
 	f.cached = cached
+	f.cachedAttrs = cachedAttrs
+	f.cachedAt = cachedAt
+	callbacks := f.callbacks
+	var added, removed []ulid.ULID
+	if len(callbacks) > 0 {
+		added, removed = f.updateNotified(resp.metas)
+	}
 	f.mtx.Unlock()
 
+	// Notify the callbacks without holding the lock, so that they can't stall the fetcher.
+	for _, cb := range callbacks {
+		for _, id := range added {
+			cb.OnBlockAdded(id, resp.metas[id])
+		}
+		for _, id := range removed {
+			cb.OnBlockRemoved(id)
+		}
+	}
+
 	// Best effort cleanup of disk-cached metas.
 	if f.cacheDir != "" {
-		fis, err := os.ReadDir(f.cacheDir)
+		fis, err := afero.ReadDir(f.fs, f.cacheDir)
 		names := make([]string, 0, len(fis))
 		for _, fi := range fis {
 			names = append(names, fi.Name())
@@ -401,6 +915,13 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 			level.Warn(f.logger).Log("msg", "best effort remove of not needed cached dirs failed; ignoring", "err", err)
 		} else {
 			for _, n := range names {
+				// The cleanup is best effort, so it's abandoned as soon as the context is canceled
+				// instead of delaying the shutdown.
+				if ctx.Err() != nil {
+					level.Debug(f.logger).Log("msg", "context canceled; skipping the remove of not needed cached dirs", "err", ctx.Err())
+					break
+				}
+
 				id, ok := IsBlockDir(n)
 				if !ok {
 					continue
@@ -413,7 +934,7 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 				cachedBlockDir := filepath.Join(f.cacheDir, id.String())
 
 				// No such block loaded, remove the local dir.
-				if err := os.RemoveAll(cachedBlockDir); err != nil {
+				if err := f.fs.RemoveAll(cachedBlockDir); err != nil {
 					level.Warn(f.logger).Log("msg", "best effort remove of not needed cached dir failed; ignoring", "dir", cachedBlockDir, "err", err)
 				}
 			}
@@ -422,54 +943,403 @@ func (f *BaseFetcher) fetchMetadata(ctx context.Context) (interface{}, error) {
 	return resp, nil
 }
 
-func (f *BaseFetcher) fetch(ctx context.Context, metrics *FetcherMetrics, filters []MetadataFilter) (_ map[ulid.ULID]*metadata.Meta, _ map[ulid.ULID]error, err error) {
-	start := time.Now()
-	defer func() {
-		metrics.SyncDuration.Observe(time.Since(start).Seconds())
-		if err != nil {
-			metrics.SyncFailures.Inc()
-		}
-	}()
-	metrics.Syncs.Inc()
-	metrics.ResetTx()
+// forEachBlock calls fn for each block found in the bucket, running at most f.concurrency calls
+// concurrently. When fetching in batches, at most one batch of blocks is in flight.
+func (f *BaseFetcher) forEachBlock(ctx context.Context, fn func(id ulid.ULID)) error {
+	var (
+		eg errgroup.Group
+		ch = make(chan ulid.ULID, f.concurrency)
+	)
+	// Tracks the blocks sent to the workers and not processed yet.
+	var inflight sync.WaitGroup
 
-	// Run this in thread safe run group.
-	// TODO(bwplotka): Consider custom singleflight with ttl.
-	v, err := f.g.Do("", func() (i interface{}, err error) {
-		// NOTE: First go routine context will go through.
-		return f.fetchMetadata(ctx)
-	})
-	if err != nil {
-		return nil, nil, err
+	for i := 0; i < f.concurrency; i++ {
+		eg.Go(func() error {
+			for id := range ch {
+				fn(id)
+				inflight.Done()
+			}
+			return nil
+		})
 	}
-	resp := v.(response)
 
-	// Copy as same response might be reused by different goroutines.
-	metas := make(map[ulid.ULID]*metadata.Meta, len(resp.metas))
-	for id, m := range resp.metas {
-		metas[id] = m
-	}
+	// Workers scheduled, distribute blocks.
+	eg.Go(func() error {
+		defer close(ch)
 
-	metrics.Synced.WithLabelValues(FailedMeta).Set(float64(len(resp.metaErrs)))
-	metrics.Synced.WithLabelValues(NoMeta).Set(resp.noMetas)
-	metrics.Synced.WithLabelValues(CorruptedMeta).Set(resp.corruptedMetas)
+		var batch []ulid.ULID
 
-	for _, filter := range filters {
+		// dispatch sends the given blocks to the workers. When fetching in batches, it waits until
+		// all of them have been processed, so that at most one batch of blocks is in flight.
+		dispatch := func(ids []ulid.ULID) error {
+			for _, id := range ids {
+				inflight.Add(1)
+
+				select {
+				case <-ctx.Done():
+					inflight.Done()
+					return ctx.Err()
+				case ch <- id:
+				}
+			}
+
+			if f.batchSize > 0 {
+				inflight.Wait()
+			}
+			return nil
+		}
+
+		// The iteration is intentionally not recursive: backends list with a delimiter, returning
+		// only the top-level block directories instead of every object of every block.
+		err := f.bkt.Iter(ctx, "", func(name string) error {
+			id, ok := IsBlockDir(name)
+			if !ok {
+				f.nonBlocks.Inc()
+				return nil
+			}
+
+			if f.batchSize <= 0 {
+				return dispatch([]ulid.ULID{id})
+			}
+
+			batch = append(batch, id)
+			if len(batch) < f.batchSize {
+				return nil
+			}
+
+			err := dispatch(batch)
+			batch = batch[:0]
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Send the last (incomplete) batch, if any.
+		return dispatch(batch)
+	})
+
+	return eg.Wait()
+}
+
+// FetchChan loads the metas of all the blocks in the bucket, sending each meta to the returned metas channel
+// as soon as it's loaded, instead of waiting for all of them like Fetch. The metas channel is closed once
+// all the blocks have been processed, after which the errors channel returns the error of the fetch, if any,
+// and is closed. Blocks without meta.json or with a corrupted one are skipped.
+//
+// Filters aren't applied, because they may need the metas of all blocks, and neither the in-memory cache
+// nor the callbacks are updated, because the fetch may not see a complete view of the bucket.
+func (f *BaseFetcher) FetchChan(ctx context.Context) (<-chan *metadata.Meta, <-chan error) {
+	var (
+		metas = make(chan *metadata.Meta)
+		errs  = make(chan error, 1)
+	)
+
+	go func() {
+		defer close(errs)
+		defer close(metas)
+
+		var (
+			mtx      sync.Mutex
+			loadErrs multierror.MultiError
+		)
+
+		err := f.forEachBlock(ctx, func(id ulid.ULID) {
+			meta, _, _, err := f.loadMeta(ctx, id, nil)
+			if err != nil {
+				cause := errors.Cause(err)
+				if !errors.Is(cause, ErrorSyncMetaNotFound) && !errors.Is(cause, ErrorSyncMetaCorrupted) {
+					mtx.Lock()
+					loadErrs.Add(err)
+					mtx.Unlock()
+				}
+				return
+			}
+
+			select {
+			case metas <- meta:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			errs <- errors.Wrap(err, "BaseFetcher: iter bucket")
+			return
+		}
+		if err := loadErrs.Err(); err != nil {
+			errs <- errors.Wrap(err, "BaseFetcher: load metas")
+		}
+	}()
+
+	return metas, errs
+}
+
+// fetch returns the filtered metas, the partial blocks (blocks without or with corrupted meta file), and the blocks
+// whose meta.json hasn't been loaded, either because it failed to load or because the soft timeout has been exceeded.
+func (f *BaseFetcher) fetch(ctx context.Context, metrics *FetcherMetrics, filters []MetadataFilter, pool *FilterPool) (_ map[ulid.ULID]*metadata.Meta, _ map[ulid.ULID]error, _ map[ulid.ULID]error, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.SyncDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.SyncFailures.Inc()
+		}
+	}()
+	metrics.Syncs.Inc()
+	metrics.ResetTx()
+
+	// Run this in thread safe run group.
+	// TODO(bwplotka): Consider custom singleflight with ttl.
+	v, err := f.g.Do("", func() (i interface{}, err error) {
+		// NOTE: First go routine context and metrics will go through.
+		return f.fetchMetadata(ctx, metrics)
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	resp := v.(response)
+
+	// Copy as same response might be reused by different goroutines.
+	metas := make(map[ulid.ULID]*metadata.Meta, len(resp.metas))
+	for id, m := range resp.metas {
+		metas[id] = m
+	}
+
+	metrics.Synced.WithLabelValues(FailedMeta).Set(float64(len(resp.metaErrs)))
+	metrics.Synced.WithLabelValues(NoMeta).Set(resp.noMetas)
+	metrics.Synced.WithLabelValues(CorruptedMeta).Set(resp.corruptedMetas)
+	if loaded := resp.cacheHits + resp.cacheMisses; loaded > 0 {
+		metrics.CacheHitRatio.Set(resp.cacheHits / loaded)
+	}
+
+	// Track the filters cost separately from the time spent loading the metas from the object storage.
+	filtersStart := time.Now()
+	metrics.Filters.Set(float64(len(filters)))
+	for _, filter := range filters {
 		// NOTE: filter can update synced metric accordingly to the reason of the exclude.
-		if err := filter.Filter(ctx, metas, metrics.Synced, metrics.Modified); err != nil {
-			return nil, nil, errors.Wrap(err, "filter metas")
+		if err := runFilter(ctx, filter, metas, metrics, pool); err != nil {
+			metrics.FiltersDuration.Observe(time.Since(filtersStart).Seconds())
+			return nil, nil, nil, errors.Wrap(err, "filter metas")
+		}
+	}
+	metrics.FiltersDuration.Observe(time.Since(filtersStart).Seconds())
+
+	for _, policy := range f.policies {
+		if err := policy.Check(ctx, metas); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "fetch policy violated")
 		}
 	}
 
 	metrics.Synced.WithLabelValues(LoadedMeta).Set(float64(len(metas)))
 	metrics.Submit()
 
+	var totalSeries, totalSamples, totalChunks uint64
+	for _, m := range metas {
+		totalSeries += m.Stats.NumSeries
+		totalSamples += m.Stats.NumSamples
+		totalChunks += m.Stats.NumChunks
+	}
+	metrics.TotalSeries.Set(float64(totalSeries))
+	metrics.TotalSamples.Set(float64(totalSamples))
+	metrics.TotalChunks.Set(float64(totalChunks))
+
+	// Copy as same response might be reused by different goroutines.
+	partial := make(map[ulid.ULID]error, len(resp.partial))
+	for id, err := range resp.partial {
+		partial[id] = err
+	}
+	unloaded := make(map[ulid.ULID]error, len(resp.unloaded))
+	for id, err := range resp.unloaded {
+		unloaded[id] = err
+	}
+
 	if len(resp.metaErrs) > 0 {
-		return metas, resp.partial, errors.Wrap(resp.metaErrs.Err(), "incomplete view")
+		failed := len(resp.metaErrs)
+		if !f.failedMetasTolerated(failed, len(resp.metas)+len(resp.partial)+len(resp.unloaded)) {
+			return metas, partial, unloaded, errors.Wrap(resp.metaErrs.Err(), "incomplete view")
+		}
+
+		level.Warn(f.logger).Log("msg", "some block metadata failed to load, but within the configured tolerance; returning them as unloaded", "failed", failed, "err", resp.metaErrs.Err())
+	}
+
+	if resp.skippedMetas > 0 {
+		level.Warn(f.logger).Log("msg", "fetch soft timeout exceeded; returning the block metadata loaded so far", "soft_timeout", f.softTimeout, "duration", time.Since(start).String(), "returned", len(metas), "skipped", resp.skippedMetas)
+	}
+
+	level.Info(f.logger).Log("msg", "successfully synchronized block metadata", "duration", time.Since(start).String(), "duration_ms", time.Since(start).Milliseconds(), "cached", f.countCached(), "returned", len(metas), "partial", len(partial), "unloaded", len(unloaded))
+	return metas, partial, unloaded, nil
+}
+
+// blockSize returns the total size of the block files listed in the meta.
+func blockSize(m *metadata.Meta) int64 {
+	size := int64(0)
+	for _, f := range m.Thanos.Files {
+		size += f.SizeBytes
+	}
+	return size
+}
+
+// failedMetasTolerated returns whether failed metas out of total blocks are within the configured tolerance.
+func (f *BaseFetcher) failedMetasTolerated(failed, total int) bool {
+	if f.maxFailedMetas > 0 && failed <= f.maxFailedMetas {
+		return true
+	}
+	if f.maxFailedMetasRatio > 0 && total > 0 && float64(failed)/float64(total) <= f.maxFailedMetasRatio {
+		return true
+	}
+	return false
+}
+
+// getCached returns the cached meta of the given block, and the attributes of the meta.json it was loaded from.
+func (f *BaseFetcher) getCached(id ulid.ULID) (*metadata.Meta, objstore.ObjectAttributes, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	m, ok := f.cached[id]
+	return m, f.cachedAttrs[id], ok
+}
+
+// RegisterCallback registers a callback notified of the blocks added to and removed from the bucket, as seen
+// by the fetches which loaded the meta.json of all blocks. Callbacks are called sequentially, once per block
+// transition, after the cache has been updated. The first fetch after the first callback is registered
+// notifies all blocks as added.
+func (f *BaseFetcher) RegisterCallback(cb BlockCallback) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	// Copy on write, given the callbacks are called without holding the lock.
+	callbacks := make([]BlockCallback, 0, len(f.callbacks)+1)
+	callbacks = append(callbacks, f.callbacks...)
+	f.callbacks = append(callbacks, cb)
+}
+
+// updateNotified updates the blocks the callbacks have been notified of to the given ones, and returns
+// the blocks added and removed since the previous update. Must be called with the lock held.
+func (f *BaseFetcher) updateNotified(metas map[ulid.ULID]*metadata.Meta) (added, removed []ulid.ULID) {
+	notified := make(map[ulid.ULID]struct{}, len(metas))
+	for id := range metas {
+		notified[id] = struct{}{}
+		if _, ok := f.notified[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for id := range f.notified {
+		if _, ok := notified[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	f.notified = notified
+
+	return added, removed
+}
+
+// isCacheExpired returns whether the meta of the block has been cached for longer than the cache TTL.
+func (f *BaseFetcher) isCacheExpired(id ulid.ULID) bool {
+	if f.cacheTTL <= 0 {
+		return false
 	}
 
-	level.Info(f.logger).Log("msg", "successfully synchronized block metadata", "duration", time.Since(start).String(), "duration_ms", time.Since(start).Milliseconds(), "cached", f.countCached(), "returned", len(metas), "partial", len(resp.partial))
-	return metas, resp.partial, nil
+	f.mtx.Lock()
+	at, ok := f.cachedAt[id]
+	f.mtx.Unlock()
+
+	return ok && f.now().Sub(at) > f.cacheTTL
+}
+
+// loadedAt returns the time the meta of the block just loaded has been loaded from the bucket: now, unless
+// it has been served from the in-memory cache.
+func (f *BaseFetcher) loadedAt(id ulid.ULID, cached bool) time.Time {
+	if cached {
+		f.mtx.Lock()
+		at, ok := f.cachedAt[id]
+		f.mtx.Unlock()
+
+		if ok {
+			return at
+		}
+	}
+	return f.now()
+}
+
+// RetryFailed re-attempts to load the meta.json of the blocks which failed to load in a previous fetch, as
+// returned in its unloaded blocks, without scanning the whole bucket again. Blocks whose meta.json doesn't
+// exist or is corrupted are skipped, given retrying wouldn't help. Successfully loaded metas are merged into
+// the cache, so that the next fetch doesn't need to download them again.
+//
+// It returns the metas loaded on retry and the blocks which failed to load again.
+func (f *BaseFetcher) RetryFailed(ctx context.Context, previousUnloaded map[ulid.ULID]error) (map[ulid.ULID]*metadata.Meta, map[ulid.ULID]error) {
+	var (
+		metas  = make(map[ulid.ULID]*metadata.Meta)
+		attrs  = make(map[ulid.ULID]objstore.ObjectAttributes)
+		at     = make(map[ulid.ULID]time.Time)
+		failed = make(map[ulid.ULID]error)
+		ch     = make(chan ulid.ULID, f.concurrency)
+		wg     sync.WaitGroup
+		mtx    sync.Mutex
+	)
+
+	for i := 0; i < f.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for id := range ch {
+				meta, metaAttrs, cached, err := f.loadMeta(ctx, id, nil)
+
+				var loadedAt time.Time
+				if err == nil {
+					loadedAt = f.loadedAt(id, cached)
+				}
+
+				mtx.Lock()
+				if err == nil {
+					metas[id] = meta
+					attrs[id] = metaAttrs
+					at[id] = loadedAt
+				} else {
+					failed[id] = err
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	for id, err := range previousUnloaded {
+		if errors.Is(errors.Cause(err), ErrorSyncMetaNotFound) || errors.Is(errors.Cause(err), ErrorSyncMetaCorrupted) {
+			continue
+		}
+		ch <- id
+	}
+	close(ch)
+	wg.Wait()
+
+	if len(metas) > 0 {
+		f.mtx.Lock()
+		cached := make(map[ulid.ULID]*metadata.Meta, len(f.cached)+len(metas))
+		for id, m := range f.cached {
+			cached[id] = m
+		}
+		cachedAttrs := make(map[ulid.ULID]objstore.ObjectAttributes, len(f.cachedAttrs)+len(attrs))
+		for id, a := range f.cachedAttrs {
+			cachedAttrs[id] = a
+		}
+		cachedAt := make(map[ulid.ULID]time.Time, len(f.cachedAt)+len(at))
+		for id, t := range f.cachedAt {
+			cachedAt[id] = t
+		}
+		for id, m := range metas {
+			cached[id] = m
+			cachedAt[id] = at[id]
+			if f.checkMetaAttributes {
+				cachedAttrs[id] = attrs[id]
+			}
+		}
+		f.cached = cached
+		f.cachedAttrs = cachedAttrs
+		f.cachedAt = cachedAt
+		f.mtx.Unlock()
+	}
+
+	level.Info(f.logger).Log("msg", "retried loading of failed block metadata", "retried", len(metas)+len(failed), "loaded", len(metas), "failed", len(failed))
+	return metas, failed
 }
 
 func (f *BaseFetcher) countCached() int {
@@ -479,19 +1349,93 @@ func (f *BaseFetcher) countCached() int {
 	return len(f.cached)
 }
 
+// runFilter runs the filter on the shared pool if the filter supports it, otherwise it runs it as is.
+func runFilter(ctx context.Context, filter MetadataFilter, metas map[ulid.ULID]*metadata.Meta, metrics *FetcherMetrics, pool *FilterPool) error {
+	if pooled, ok := filter.(PooledMetadataFilter); ok && pool != nil {
+		return pooled.FilterWithPool(ctx, metas, metrics.Synced, metrics.Modified, pool)
+	}
+	return filter.Filter(ctx, metas, metrics.Synced, metrics.Modified)
+}
+
 type MetaFetcher struct {
 	wrapped *BaseFetcher
 	metrics *FetcherMetrics
 
 	filters []MetadataFilter
+
+	// Shared by all the filters implementing PooledMetadataFilter, to bound the number
+	// of concurrent requests they run overall. Nil if no pool size has been configured.
+	pool *FilterPool
+}
+
+// Filters returns the descriptions of the filters applied to the fetched metas, in the order they're applied.
+// A filter is described by its String method if it implements fmt.Stringer, or by its type name otherwise.
+func (f *MetaFetcher) Filters() []string {
+	descs := make([]string, 0, len(f.filters))
+	for _, filter := range f.filters {
+		if s, ok := filter.(fmt.Stringer); ok {
+			descs = append(descs, s.String())
+			continue
+		}
+
+		t := reflect.TypeOf(filter)
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		descs = append(descs, t.Name())
+	}
+	return descs
 }
 
 // Fetch returns all block metas as well as partial blocks (blocks without or with corrupted meta file) from the bucket.
 // It's caller responsibility to not change the returned metadata files. Maps can be modified.
 //
 // Returned error indicates a failure in fetching metadata. Returned meta can be assumed as correct, with some blocks missing.
+// If the meta.json of some blocks hasn't been loaded, an error wrapping ErrIncompleteFetch is returned together with
+// the metas loaded. Use FetchWithUnloaded to get the blocks whose meta.json hasn't been loaded instead.
 func (f *MetaFetcher) Fetch(ctx context.Context) (metas map[ulid.ULID]*metadata.Meta, partial map[ulid.ULID]error, err error) {
-	return f.wrapped.fetch(ctx, f.metrics, f.filters)
+	metas, partial, unloaded, err := f.FetchWithUnloaded(ctx)
+	return metas, partial, incompleteFetchErr(unloaded, err)
+}
+
+// FetchWithUnloaded is like Fetch, but additionally returns the blocks whose meta.json hasn't been loaded, because
+// it failed to load within the configured tolerance (see WithFailedMetasTolerance) or the fetch soft timeout has been
+// exceeded (see WithFetchSoftTimeout). Unlike partial blocks, unloaded blocks may be complete in the bucket, so they
+// shouldn't be treated as partially uploaded. Their meta.json can be loaded again with RetryFailed.
+func (f *MetaFetcher) FetchWithUnloaded(ctx context.Context) (metas map[ulid.ULID]*metadata.Meta, partial, unloaded map[ulid.ULID]error, err error) {
+	return f.wrapped.fetch(ctx, f.metrics, f.filters, f.pool)
+}
+
+// FetchFiltered is like Fetch, but additionally applies extraFilters to the metas, after the MetaFetcher filters.
+// The extra filters only apply to this call, and the metas cache is shared with Fetch.
+func (f *MetaFetcher) FetchFiltered(ctx context.Context, extraFilters []MetadataFilter) (metas map[ulid.ULID]*metadata.Meta, partial map[ulid.ULID]error, err error) {
+	// Build a new slice, to not modify the MetaFetcher filters concurrently with other calls.
+	filters := make([]MetadataFilter, 0, len(f.filters)+len(extraFilters))
+	filters = append(filters, f.filters...)
+	filters = append(filters, extraFilters...)
+
+	metas, partial, unloaded, err := f.wrapped.fetch(ctx, f.metrics, filters, f.pool)
+	return metas, partial, incompleteFetchErr(unloaded, err)
+}
+
+// incompleteFetchErr returns err if not nil, or an error wrapping ErrIncompleteFetch if there are unloaded blocks.
+func incompleteFetchErr(unloaded map[ulid.ULID]error, err error) error {
+	if err != nil || len(unloaded) == 0 {
+		return err
+	}
+	return errors.Wrapf(ErrIncompleteFetch, "%d blocks", len(unloaded))
+}
+
+// FetchChan streams the metas of all the blocks in the bucket. See BaseFetcher.FetchChan. Filters are not
+// applied to the returned metas.
+func (f *MetaFetcher) FetchChan(ctx context.Context) (<-chan *metadata.Meta, <-chan error) {
+	return f.wrapped.FetchChan(ctx)
+}
+
+// RetryFailed re-attempts to load the meta.json of the blocks which failed to load in a previous fetch.
+// See BaseFetcher.RetryFailed. Filters are not applied to the returned metas.
+func (f *MetaFetcher) RetryFailed(ctx context.Context, previousUnloaded map[ulid.ULID]error) (map[ulid.ULID]*metadata.Meta, map[ulid.ULID]error) {
+	return f.wrapped.RetryFailed(ctx, previousUnloaded)
 }
 
 // Special label that will have an ULID of the meta.json being referenced to.
@@ -522,6 +1466,11 @@ func NewConsistencyDelayMetaFilter(logger log.Logger, consistencyDelay time.Dura
 	}
 }
 
+// String implements fmt.Stringer.
+func (f *ConsistencyDelayMetaFilter) String() string {
+	return fmt.Sprintf("ConsistencyDelayMetaFilter(delay=%s)", f.consistencyDelay)
+}
+
 // Filter filters out blocks that filters blocks that have are created before a specified consistency delay.
 func (f *ConsistencyDelayMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, modified GaugeVec) error {
 	for id, meta := range metas {
@@ -542,6 +1491,384 @@ func (f *ConsistencyDelayMetaFilter) Filter(_ context.Context, metas map[ulid.UL
 	return nil
 }
 
+// RetentionFilter is a BaseFetcher filter that filters out blocks whose data is entirely outside
+// the tenant's retention period. The retention is read for the tenant on every Filter call, so
+// changes to per-tenant retention are honored without recreating the filter.
+// A retention <= 0 disables the filter.
+type RetentionFilter struct {
+	userID      string
+	retentionFn func(userID string) time.Duration
+}
+
+// NewRetentionFilter creates RetentionFilter.
+func NewRetentionFilter(userID string, retentionFn func(userID string) time.Duration) *RetentionFilter {
+	return &RetentionFilter{
+		userID:      userID,
+		retentionFn: retentionFn,
+	}
+}
+
+// String implements fmt.Stringer.
+func (f *RetentionFilter) String() string {
+	return fmt.Sprintf("RetentionFilter(user=%s)", f.userID)
+}
+
+// Threshold returns the time, in milliseconds, before which the blocks are outside the tenant's retention period,
+// and false if the tenant's retention is disabled.
+func (f *RetentionFilter) Threshold() (int64, bool) {
+	retention := f.retentionFn(f.userID)
+	if retention <= 0 {
+		return 0, false
+	}
+	return time.Now().Add(-retention).UnixMilli(), true
+}
+
+// Filter filters out blocks whose MaxTime is older than now minus the tenant's retention period.
+func (f *RetentionFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec) error {
+	threshold, ok := f.Threshold()
+	if !ok {
+		return nil
+	}
+
+	for id, meta := range metas {
+		if meta.MaxTime < threshold {
+			synced.WithLabelValues(timeExcludedMeta).Inc()
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
+
+// TimeRangeMetaFilter is a BaseFetcher filter that filters out blocks entirely outside of a time range:
+// blocks whose MaxTime is before minTime, or whose MinTime is after maxTime. A zero minTime or maxTime
+// leaves the respective side of the range unbounded.
+type TimeRangeMetaFilter struct {
+	minTime int64
+	maxTime int64
+}
+
+// NewTimeRangeMetaFilter creates TimeRangeMetaFilter for the time range between minTime and maxTime, in milliseconds.
+func NewTimeRangeMetaFilter(minTime, maxTime int64) *TimeRangeMetaFilter {
+	return &TimeRangeMetaFilter{
+		minTime: minTime,
+		maxTime: maxTime,
+	}
+}
+
+// String implements fmt.Stringer.
+func (f *TimeRangeMetaFilter) String() string {
+	return fmt.Sprintf("TimeRangeMetaFilter(min_time=%d, max_time=%d)", f.minTime, f.maxTime)
+}
+
+// Filter filters out blocks which don't overlap the configured time range.
+func (f *TimeRangeMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec) error {
+	for id, meta := range metas {
+		if (f.minTime != 0 && meta.MaxTime < f.minTime) || (f.maxTime != 0 && meta.MinTime > f.maxTime) {
+			synced.WithLabelValues(timeExcludedMeta).Inc()
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
+
+// LabelSelectorMetaFilter is a BaseFetcher filter that filters out blocks based on relabel configs
+// applied to their external labels and the BlockIDLabel. For example, a HashMod on BlockIDLabel
+// followed by a Keep shards the blocks across several fetchers.
+type LabelSelectorMetaFilter struct {
+	relabelConfig []*relabel.Config
+}
+
+// NewLabelSelectorMetaFilter creates LabelSelectorMetaFilter.
+func NewLabelSelectorMetaFilter(relabelConfig []*relabel.Config) *LabelSelectorMetaFilter {
+	return &LabelSelectorMetaFilter{relabelConfig: relabelConfig}
+}
+
+// String implements fmt.Stringer.
+func (f *LabelSelectorMetaFilter) String() string {
+	return fmt.Sprintf("LabelSelectorMetaFilter(relabel_configs=%d)", len(f.relabelConfig))
+}
+
+// Filter filters out blocks dropped by the relabel configs.
+func (f *LabelSelectorMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec) error {
+	for id, meta := range metas {
+		lbls := make(map[string]string, len(meta.Thanos.Labels)+1)
+		for name, value := range meta.Thanos.Labels {
+			lbls[name] = value
+		}
+		lbls[BlockIDLabel] = id.String()
+
+		if processed, keep := relabel.Process(labels.FromMap(lbls), f.relabelConfig...); !keep || processed.IsEmpty() {
+			synced.WithLabelValues(labelExcludedMeta).Inc()
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
+
+// OverlappingBlocksFilter is a BaseFetcher filter that doesn't filter out any block, but detects the
+// blocks with the same shard and overlapping time ranges. Such blocks are expected to be merged by
+// the compactor eventually, but until then they may be a sign of compaction lagging behind.
+type OverlappingBlocksFilter struct {
+	shardLabel  string
+	overlapping prometheus.Gauge
+
+	mtx  sync.Mutex
+	sets [][]ulid.ULID
+}
+
+// NewOverlappingBlocksFilter creates OverlappingBlocksFilter. The shard of a block is the value of its
+// shardLabel external label; blocks without it belong to the same shard.
+func NewOverlappingBlocksFilter(shardLabel string, reg prometheus.Registerer) *OverlappingBlocksFilter {
+	return &OverlappingBlocksFilter{
+		shardLabel: shardLabel,
+		overlapping: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "blocks_meta_overlapping_blocks",
+			Help: "Number of blocks overlapping at least another block of the same shard, as of the last fetch.",
+		}),
+	}
+}
+
+// String implements fmt.Stringer.
+func (f *OverlappingBlocksFilter) String() string {
+	return fmt.Sprintf("OverlappingBlocksFilter(shard_label=%s)", f.shardLabel)
+}
+
+// Filter detects the overlapping blocks, without modifying metas.
+func (f *OverlappingBlocksFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, _ GaugeVec, _ GaugeVec) error {
+	sets := FindOverlappingBlocks(metas, f.shardLabel)
+
+	overlapping := 0
+	for _, set := range sets {
+		overlapping += len(set)
+	}
+	f.overlapping.Set(float64(overlapping))
+
+	f.mtx.Lock()
+	f.sets = sets
+	f.mtx.Unlock()
+
+	return nil
+}
+
+// OverlappingBlocks returns the sets of overlapping blocks of the same shard detected by the last fetch.
+func (f *OverlappingBlocksFilter) OverlappingBlocks() [][]ulid.ULID {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.sets
+}
+
+// FindOverlappingBlocks returns the sets of blocks with the same value of shardLabel whose time ranges
+// overlap, transitively. The sets are sorted by shard and then by time, and the blocks within each set
+// are sorted by MinTime.
+func FindOverlappingBlocks(metas map[ulid.ULID]*metadata.Meta, shardLabel string) [][]ulid.ULID {
+	byShard := map[string][]*metadata.Meta{}
+	for _, meta := range metas {
+		shard := meta.Thanos.Labels[shardLabel]
+		byShard[shard] = append(byShard[shard], meta)
+	}
+
+	shards := make([]string, 0, len(byShard))
+	for shard := range byShard {
+		shards = append(shards, shard)
+	}
+	sort.Strings(shards)
+
+	var sets [][]ulid.ULID
+	for _, shard := range shards {
+		blocks := byShard[shard]
+		sort.Slice(blocks, func(i, j int) bool {
+			if blocks[i].MinTime != blocks[j].MinTime {
+				return blocks[i].MinTime < blocks[j].MinTime
+			}
+			return blocks[i].ULID.Compare(blocks[j].ULID) < 0
+		})
+
+		var (
+			set     []ulid.ULID
+			setMaxT int64
+		)
+		for _, b := range blocks {
+			// Block time ranges are half-open, so a block starting at the max time of another one doesn't overlap it.
+			if len(set) > 0 && b.MinTime < setMaxT {
+				set = append(set, b.ULID)
+				if b.MaxTime > setMaxT {
+					setMaxT = b.MaxTime
+				}
+				continue
+			}
+
+			if len(set) > 1 {
+				sets = append(sets, set)
+			}
+			set = []ulid.ULID{b.ULID}
+			setMaxT = b.MaxTime
+		}
+		if len(set) > 1 {
+			sets = append(sets, set)
+		}
+	}
+
+	return sets
+}
+
+// MaxBlockDurationFilter is a BaseFetcher filter that filters out blocks whose time range is wider
+// than a configured maximum. Such blocks are typically the result of a bug (eg. in compaction) and
+// can cause problems to both queries and compaction.
+// A maxDuration <= 0 disables the filter.
+type MaxBlockDurationFilter struct {
+	logger      log.Logger
+	maxDuration time.Duration
+}
+
+// NewMaxBlockDurationFilter creates MaxBlockDurationFilter.
+func NewMaxBlockDurationFilter(logger log.Logger, maxDuration time.Duration) *MaxBlockDurationFilter {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	return &MaxBlockDurationFilter{
+		logger:      logger,
+		maxDuration: maxDuration,
+	}
+}
+
+// String implements fmt.Stringer.
+func (f *MaxBlockDurationFilter) String() string {
+	return fmt.Sprintf("MaxBlockDurationFilter(max_duration=%s)", f.maxDuration)
+}
+
+// Filter filters out blocks whose MaxTime - MinTime is greater than the configured max duration.
+func (f *MaxBlockDurationFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec) error {
+	if f.maxDuration <= 0 {
+		return nil
+	}
+
+	for id, meta := range metas {
+		if duration := time.Duration(meta.MaxTime-meta.MinTime) * time.Millisecond; duration > f.maxDuration {
+			level.Warn(f.logger).Log("msg", "block time range is wider than the max allowed duration", "block", id, "duration", duration, "max_duration", f.maxDuration)
+			synced.WithLabelValues(overMaxDurationMeta).Inc()
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
+
+// MinCompactionLevelMetaFilter is a BaseFetcher filter that filters out blocks whose compaction level is
+// lower than a configured minimum. For example, a min level of 2 filters out the blocks uploaded by the
+// ingesters, which haven't been compacted yet.
+// A minLevel <= 1 disables the filter.
+type MinCompactionLevelMetaFilter struct {
+	minLevel int
+}
+
+// NewMinCompactionLevelMetaFilter creates MinCompactionLevelMetaFilter.
+func NewMinCompactionLevelMetaFilter(minLevel int) *MinCompactionLevelMetaFilter {
+	return &MinCompactionLevelMetaFilter{minLevel: minLevel}
+}
+
+// String implements fmt.Stringer.
+func (f *MinCompactionLevelMetaFilter) String() string {
+	return fmt.Sprintf("MinCompactionLevelMetaFilter(min_level=%d)", f.minLevel)
+}
+
+// Filter filters out blocks whose compaction level is lower than the configured min level.
+func (f *MinCompactionLevelMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec) error {
+	if f.minLevel <= 1 {
+		return nil
+	}
+
+	for id, meta := range metas {
+		if meta.Compaction.Level < f.minLevel {
+			synced.WithLabelValues(belowMinLevelMeta).Inc()
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
+
+// CompactorVersionMetaFilter is a BaseFetcher filter that filters out blocks created by any of the
+// configured compactor versions, for example to quarantine the blocks produced by a buggy release
+// until they're compacted again. Blocks which don't record the compactor version are never filtered out.
+type CompactorVersionMetaFilter struct {
+	excluded map[string]struct{}
+}
+
+// NewCompactorVersionMetaFilter creates CompactorVersionMetaFilter.
+func NewCompactorVersionMetaFilter(excludedVersions []string) *CompactorVersionMetaFilter {
+	excluded := make(map[string]struct{}, len(excludedVersions))
+	for _, v := range excludedVersions {
+		excluded[v] = struct{}{}
+	}
+
+	return &CompactorVersionMetaFilter{excluded: excluded}
+}
+
+// String implements fmt.Stringer.
+func (f *CompactorVersionMetaFilter) String() string {
+	versions := make([]string, 0, len(f.excluded))
+	for v := range f.excluded {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return fmt.Sprintf("CompactorVersionMetaFilter(excluded=%s)", strings.Join(versions, ","))
+}
+
+// Filter filters out blocks created by an excluded compactor version.
+func (f *CompactorVersionMetaFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec) error {
+	if len(f.excluded) == 0 {
+		return nil
+	}
+
+	for id, meta := range metas {
+		if meta.Thanos.CompactorVersion == "" {
+			continue
+		}
+		if _, ok := f.excluded[meta.Thanos.CompactorVersion]; ok {
+			synced.WithLabelValues(compactorVersionExcludedMeta).Inc()
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
+
+// EmptyBlockFilter is a BaseFetcher filter that filters out blocks with no samples. Such blocks are
+// effectively empty (eg. they can be generated when splitting blocks), so there's no point in compacting
+// or querying them.
+type EmptyBlockFilter struct {
+	logger log.Logger
+}
+
+// NewEmptyBlockFilter creates EmptyBlockFilter.
+func NewEmptyBlockFilter(logger log.Logger) *EmptyBlockFilter {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	return &EmptyBlockFilter{
+		logger: logger,
+	}
+}
+
+// Filter filters out blocks whose Stats.NumSamples is 0.
+func (f *EmptyBlockFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec) error {
+	for id, meta := range metas {
+		if meta.Stats.NumSamples == 0 {
+			level.Debug(f.logger).Log("msg", "block has no samples", "block", id)
+			synced.WithLabelValues(emptyMeta).Inc()
+			delete(metas, id)
+		}
+	}
+
+	return nil
+}
+
 // IgnoreDeletionMarkFilter is a filter that filters out the blocks that are marked for deletion after a given delay.
 // The delay duration is to make sure that the replacement block can be fetched before we filter out the old block.
 // Delay is not considered when computing DeletionMarkBlocks map.
@@ -552,20 +1879,33 @@ type IgnoreDeletionMarkFilter struct {
 	concurrency int
 	bkt         objstore.InstrumentedBucketReader
 
-	mtx             sync.Mutex
-	deletionMarkMap map[ulid.ULID]*metadata.DeletionMark
+	newlyMarked prometheus.Counter
+
+	mtx                sync.Mutex
+	deletionMarkMap    map[ulid.ULID]*metadata.DeletionMark
+	pendingDeletionMap map[ulid.ULID]time.Time
 }
 
 // NewIgnoreDeletionMarkFilter creates IgnoreDeletionMarkFilter.
-func NewIgnoreDeletionMarkFilter(logger log.Logger, bkt objstore.InstrumentedBucketReader, delay time.Duration, concurrency int) *IgnoreDeletionMarkFilter {
+func NewIgnoreDeletionMarkFilter(logger log.Logger, bkt objstore.InstrumentedBucketReader, delay time.Duration, concurrency int, reg prometheus.Registerer) *IgnoreDeletionMarkFilter {
 	return &IgnoreDeletionMarkFilter{
 		logger:      logger,
 		bkt:         bkt,
 		delay:       delay,
 		concurrency: concurrency,
+		newlyMarked: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Subsystem: fetcherSubSys,
+			Name:      "newly_marked_for_deletion_total",
+			Help:      "Total number of blocks found marked for deletion which were not marked for deletion in the previous sync.",
+		}),
 	}
 }
 
+// String implements fmt.Stringer.
+func (f *IgnoreDeletionMarkFilter) String() string {
+	return fmt.Sprintf("IgnoreDeletionMarkFilter(delay=%s)", f.delay)
+}
+
 // DeletionMarkBlocks returns block ids that were marked for deletion.
 func (f *IgnoreDeletionMarkFilter) DeletionMarkBlocks() map[ulid.ULID]*metadata.DeletionMark {
 	f.mtx.Lock()
@@ -579,10 +1919,31 @@ func (f *IgnoreDeletionMarkFilter) DeletionMarkBlocks() map[ulid.ULID]*metadata.
 	return deletionMarkMap
 }
 
+// PendingDeletionBlocks returns the blocks marked for deletion which haven't been filtered out yet
+// because their deletion delay hasn't passed, with the time at which they will be filtered out.
+func (f *IgnoreDeletionMarkFilter) PendingDeletionBlocks() map[ulid.ULID]time.Time {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	pendingDeletionMap := make(map[ulid.ULID]time.Time, len(f.pendingDeletionMap))
+	for id, t := range f.pendingDeletionMap {
+		pendingDeletionMap[id] = t
+	}
+
+	return pendingDeletionMap
+}
+
 // Filter filters out blocks that are marked for deletion after a given delay.
 // It also returns the blocks that can be deleted since they were uploaded delay duration before current time.
 func (f *IgnoreDeletionMarkFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, modified GaugeVec) error {
+	return f.FilterWithPool(ctx, metas, synced, modified, NewFilterPool(f.concurrency))
+}
+
+// FilterWithPool is like Filter, but reads the deletion marks running at most as many concurrent
+// requests as allowed by the pool.
+func (f *IgnoreDeletionMarkFilter) FilterWithPool(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec, pool *FilterPool) error {
 	deletionMarkMap := make(map[ulid.ULID]*metadata.DeletionMark)
+	pendingDeletionMap := make(map[ulid.ULID]time.Time)
 
 	// Make a copy of block IDs to check, in order to avoid concurrency issues
 	// between the scheduler and workers.
@@ -592,71 +1953,157 @@ func (f *IgnoreDeletionMarkFilter) Filter(ctx context.Context, metas map[ulid.UL
 	}
 
 	var (
-		eg  errgroup.Group
-		ch  = make(chan ulid.ULID, f.concurrency)
-		mtx sync.Mutex
+		mtx     sync.Mutex
+		lastErr error
 	)
 
-	for i := 0; i < f.concurrency; i++ {
-		eg.Go(func() error {
-			var lastErr error
-			for id := range ch {
-				m := &metadata.DeletionMark{}
-				if err := metadata.ReadMarker(ctx, f.logger, f.bkt, id.String(), m); err != nil {
-					if errors.Is(errors.Cause(err), metadata.ErrorMarkerNotFound) {
-						continue
-					}
-					if errors.Is(errors.Cause(err), metadata.ErrorUnmarshalMarker) {
-						level.Warn(f.logger).Log("msg", "found partial deletion-mark.json; if we will see it happening often for the same block, consider manually deleting deletion-mark.json from the object storage", "block", id, "err", err)
-						continue
-					}
-					// Remember the last error and continue to drain the channel.
-					lastErr = err
-					continue
-				}
+	err := pool.ForEach(ctx, len(blockIDs), func(ctx context.Context, idx int) error {
+		id := blockIDs[idx]
 
-				// Keep track of the blocks marked for deletion and filter them out if their
-				// deletion time is greater than the configured delay.
-				mtx.Lock()
-				deletionMarkMap[id] = m
-				if time.Since(time.Unix(m.DeletionTime, 0)).Seconds() > f.delay.Seconds() {
-					synced.WithLabelValues(MarkedForDeletionMeta).Inc()
-					delete(metas, id)
-				}
-				mtx.Unlock()
+		m := &metadata.DeletionMark{}
+		if err := metadata.ReadMarker(ctx, f.logger, f.bkt, id.String(), m); err != nil {
+			if errors.Is(errors.Cause(err), metadata.ErrorMarkerNotFound) {
+				return nil
 			}
-
-			return lastErr
-		})
-	}
-
-	// Workers scheduled, distribute blocks.
-	eg.Go(func() error {
-		defer close(ch)
-
-		for _, id := range blockIDs {
-			select {
-			case ch <- id:
-				// Nothing to do.
-			case <-ctx.Done():
-				return ctx.Err()
+			if errors.Is(errors.Cause(err), metadata.ErrorUnmarshalMarker) {
+				level.Warn(f.logger).Log("msg", "found partial deletion-mark.json; if we will see it happening often for the same block, consider manually deleting deletion-mark.json from the object storage", "block", id, "err", err)
+				return nil
 			}
+			// Remember the last error and continue with the other blocks.
+			mtx.Lock()
+			lastErr = err
+			mtx.Unlock()
+			return nil
 		}
 
+		// Keep track of the blocks marked for deletion and filter them out if their
+		// deletion time is greater than the configured delay.
+		mtx.Lock()
+		deletionMarkMap[id] = m
+		if time.Since(time.Unix(m.DeletionTime, 0)).Seconds() > f.delay.Seconds() {
+			synced.WithLabelValues(MarkedForDeletionMeta).Inc()
+			delete(metas, id)
+		} else {
+			pendingDeletionMap[id] = time.Unix(m.DeletionTime, 0).Add(f.delay)
+		}
+		mtx.Unlock()
 		return nil
 	})
-
-	if err := eg.Wait(); err != nil {
+	if err == nil {
+		err = lastErr
+	}
+	if err != nil {
 		return errors.Wrap(err, "filter blocks marked for deletion")
 	}
 
 	f.mtx.Lock()
+	// Blocks marked for deletion before the first sync are not considered newly marked.
+	if f.deletionMarkMap != nil {
+		for id := range deletionMarkMap {
+			if _, ok := f.deletionMarkMap[id]; !ok {
+				level.Debug(f.logger).Log("msg", "block has been newly marked for deletion", "block", id)
+				f.newlyMarked.Inc()
+			}
+		}
+	}
 	f.deletionMarkMap = deletionMarkMap
+	f.pendingDeletionMap = pendingDeletionMap
 	f.mtx.Unlock()
 
 	return nil
 }
 
+// DefaultPartialUploadFilterFiles are the files checked by PartialUploadFilter if no other files are configured.
+var DefaultPartialUploadFilterFiles = []string{IndexFilename, path.Join(ChunksDirname, "000001")}
+
+// PartialUploadFilter is a BaseFetcher filter that filters out the blocks whose upload isn't complete,
+// because some of their files are missing from the bucket even if their meta.json has been uploaded.
+type PartialUploadFilter struct {
+	logger      log.Logger
+	bkt         objstore.InstrumentedBucketReader
+	files       []string
+	concurrency int
+}
+
+// NewPartialUploadFilter creates PartialUploadFilter. Each block is checked for the existence of files,
+// which are paths relative to the block directory. If files is empty, DefaultPartialUploadFilterFiles are
+// checked.
+func NewPartialUploadFilter(logger log.Logger, bkt objstore.InstrumentedBucketReader, files []string, concurrency int) *PartialUploadFilter {
+	if len(files) == 0 {
+		files = DefaultPartialUploadFilterFiles
+	}
+
+	return &PartialUploadFilter{
+		logger:      logger,
+		bkt:         bkt,
+		files:       files,
+		concurrency: concurrency,
+	}
+}
+
+// String implements fmt.Stringer.
+func (f *PartialUploadFilter) String() string {
+	return fmt.Sprintf("PartialUploadFilter(files=%s)", strings.Join(f.files, ","))
+}
+
+// Filter filters out blocks missing any of the configured files.
+func (f *PartialUploadFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, modified GaugeVec) error {
+	return f.FilterWithPool(ctx, metas, synced, modified, NewFilterPool(f.concurrency))
+}
+
+// FilterWithPool is like Filter, but checks the files running at most as many concurrent requests
+// as allowed by the pool.
+func (f *PartialUploadFilter) FilterWithPool(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced GaugeVec, _ GaugeVec, pool *FilterPool) error {
+	// Make a copy of block IDs to check, in order to avoid concurrency issues
+	// between the scheduler and workers.
+	blockIDs := make([]ulid.ULID, 0, len(metas))
+	for id := range metas {
+		blockIDs = append(blockIDs, id)
+	}
+
+	var mtx sync.Mutex
+
+	err := pool.ForEach(ctx, len(blockIDs), func(ctx context.Context, idx int) error {
+		id := blockIDs[idx]
+
+		missing, err := f.missingFile(ctx, id)
+		if err != nil {
+			return err
+		}
+		if missing == "" {
+			return nil
+		}
+
+		level.Debug(f.logger).Log("msg", "block upload is incomplete", "block", id, "missing", missing)
+
+		mtx.Lock()
+		synced.WithLabelValues(incompleteMeta).Inc()
+		delete(metas, id)
+		mtx.Unlock()
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "filter partially uploaded blocks")
+	}
+
+	return nil
+}
+
+// missingFile returns the first configured file missing from the block, or an empty string if there's none.
+func (f *PartialUploadFilter) missingFile(ctx context.Context, id ulid.ULID) (string, error) {
+	for _, file := range f.files {
+		exists, err := f.bkt.Exists(ctx, path.Join(id.String(), file))
+		if err != nil {
+			return "", errors.Wrapf(err, "check existence of %s in block %s", file, id)
+		}
+		if !exists {
+			return file, nil
+		}
+	}
+
+	return "", nil
+}
+
 var (
 	SelectorSupportedRelabelActions = map[relabel.Action]struct{}{relabel.Keep: {}, relabel.Drop: {}, relabel.HashMod: {}}
 )
@@ -664,6 +2111,13 @@ var (
 // ParseRelabelConfig parses relabel configuration.
 // If supportedActions not specified, all relabel actions are valid.
 func ParseRelabelConfig(contentYaml []byte, supportedActions map[relabel.Action]struct{}) ([]*relabel.Config, error) {
+	return ParseRelabelConfigStrict(contentYaml, supportedActions, nil)
+}
+
+// ParseRelabelConfigStrict parses relabel configuration like ParseRelabelConfig, and additionally
+// checks that all source labels are in knownLabels.
+// If knownLabels not specified, all source labels are valid.
+func ParseRelabelConfigStrict(contentYaml []byte, supportedActions map[relabel.Action]struct{}, knownLabels map[string]struct{}) ([]*relabel.Config, error) {
 	var relabelConfig []*relabel.Config
 	if err := yaml.Unmarshal(contentYaml, &relabelConfig); err != nil {
 		return nil, errors.Wrap(err, "parsing relabel configuration")
@@ -677,5 +2131,15 @@ func ParseRelabelConfig(contentYaml []byte, supportedActions map[relabel.Action]
 		}
 	}
 
+	if knownLabels != nil {
+		for i, cfg := range relabelConfig {
+			for _, name := range cfg.SourceLabels {
+				if _, ok := knownLabels[string(name)]; !ok {
+					return nil, errors.Errorf("unknown source label %q in relabel configuration at index %d", name, i)
+				}
+			}
+		}
+	}
+
 	return relabelConfig, nil
 }
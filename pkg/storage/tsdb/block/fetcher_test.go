@@ -6,10 +6,36 @@
 package block
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
+	"github.com/grafana/mimir/pkg/util/extprom"
 )
 
 func ULID(i int) ulid.ULID { return ulid.MustNew(uint64(i), nil) }
@@ -38,3 +64,1982 @@ func Test_ParseRelabelConfig(t *testing.T) {
     `), SelectorSupportedRelabelActions)
 	require.ErrorContains(t, err, "unsupported relabel action: labelmap")
 }
+
+func Test_ParseRelabelConfigStrict(t *testing.T) {
+	knownLabels := map[string]struct{}{BlockIDLabel: {}, "cluster": {}}
+
+	_, err := ParseRelabelConfigStrict([]byte(`
+    - action: drop
+      regex: "A"
+      source_labels:
+      - cluster
+    - action: keep
+      regex: "B"
+      source_labels:
+      - __block_id
+    `), SelectorSupportedRelabelActions, knownLabels)
+	require.NoError(t, err)
+
+	_, err = ParseRelabelConfigStrict([]byte(`
+    - action: drop
+      regex: "A"
+      source_labels:
+      - cluster
+    - action: keep
+      regex: "B"
+      source_labels:
+      - __block_id
+      - clutser
+    `), SelectorSupportedRelabelActions, knownLabels)
+	require.EqualError(t, err, `unknown source label "clutser" in relabel configuration at index 1`)
+
+	_, err = ParseRelabelConfigStrict([]byte(`
+    - action: labelmap
+      regex: "A"
+    `), SelectorSupportedRelabelActions, knownLabels)
+	require.ErrorContains(t, err, "unsupported relabel action: labelmap")
+
+	_, err = ParseRelabelConfigStrict([]byte(`
+    - action: drop
+      regex: "A"
+      source_labels:
+      - clutser
+    `), SelectorSupportedRelabelActions, nil)
+	require.NoError(t, err)
+}
+
+func TestRetentionFilter(t *testing.T) {
+	now := time.Now()
+	retention := 24 * time.Hour
+	threshold := now.Add(-retention)
+
+	inputMetas := map[ulid.ULID]*metadata.Meta{
+		// Entirely outside of the retention period.
+		ULID(1): {BlockMeta: tsdb.BlockMeta{MinTime: threshold.Add(-3 * time.Hour).UnixMilli(), MaxTime: threshold.Add(-time.Hour).UnixMilli()}},
+		// Straddling the retention boundary.
+		ULID(2): {BlockMeta: tsdb.BlockMeta{MinTime: threshold.Add(-time.Hour).UnixMilli(), MaxTime: threshold.Add(time.Hour).UnixMilli()}},
+		// Entirely within the retention period.
+		ULID(3): {BlockMeta: tsdb.BlockMeta{MinTime: threshold.Add(time.Hour).UnixMilli(), MaxTime: threshold.Add(3 * time.Hour).UnixMilli()}},
+	}
+
+	retentions := map[string]time.Duration{
+		"user-1": retention,
+		"user-2": 0,
+	}
+	retentionFn := func(userID string) time.Duration {
+		return retentions[userID]
+	}
+
+	t.Run("retention enabled", func(t *testing.T) {
+		metas := copyMetas(inputMetas)
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+		f := NewRetentionFilter("user-1", retentionFn)
+		require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+		assert.Equal(t, map[ulid.ULID]*metadata.Meta{
+			ULID(2): inputMetas[ULID(2)],
+			ULID(3): inputMetas[ULID(3)],
+		}, metas)
+		assert.Equal(t, 1.0, promtest.ToFloat64(synced.WithLabelValues(timeExcludedMeta)))
+	})
+
+	t.Run("retention disabled", func(t *testing.T) {
+		metas := copyMetas(inputMetas)
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+		f := NewRetentionFilter("user-2", retentionFn)
+		require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+		assert.Equal(t, inputMetas, metas)
+		assert.Equal(t, 0.0, promtest.ToFloat64(synced.WithLabelValues(timeExcludedMeta)))
+	})
+}
+
+func TestTimeRangeMetaFilter(t *testing.T) {
+	inputMetas := map[ulid.ULID]*metadata.Meta{
+		// Entirely before the time range.
+		ULID(1): {BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 50}},
+		// Overlapping the start of the time range.
+		ULID(2): {BlockMeta: tsdb.BlockMeta{MinTime: 50, MaxTime: 150}},
+		// Entirely within the time range.
+		ULID(3): {BlockMeta: tsdb.BlockMeta{MinTime: 120, MaxTime: 180}},
+		// Overlapping the end of the time range.
+		ULID(4): {BlockMeta: tsdb.BlockMeta{MinTime: 150, MaxTime: 250}},
+		// Entirely after the time range.
+		ULID(5): {BlockMeta: tsdb.BlockMeta{MinTime: 250, MaxTime: 300}},
+		// Covering the whole time range.
+		ULID(6): {BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 300}},
+	}
+
+	tests := map[string]struct {
+		minTime, maxTime int64
+		expectedIDs      []ulid.ULID
+	}{
+		"bounded time range": {
+			minTime:     100,
+			maxTime:     200,
+			expectedIDs: []ulid.ULID{ULID(2), ULID(3), ULID(4), ULID(6)},
+		},
+		"unbounded min time": {
+			maxTime:     200,
+			expectedIDs: []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(6)},
+		},
+		"unbounded max time": {
+			minTime:     100,
+			expectedIDs: []ulid.ULID{ULID(2), ULID(3), ULID(4), ULID(5), ULID(6)},
+		},
+		"unbounded time range": {
+			expectedIDs: []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5), ULID(6)},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			metas := copyMetas(inputMetas)
+			synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+			f := NewTimeRangeMetaFilter(testData.minTime, testData.maxTime)
+			require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+			assert.ElementsMatch(t, testData.expectedIDs, mapKeys(metas))
+			assert.Equal(t, float64(len(inputMetas)-len(testData.expectedIDs)), promtest.ToFloat64(synced.WithLabelValues(timeExcludedMeta)))
+		})
+	}
+}
+
+func TestLabelSelectorMetaFilter(t *testing.T) {
+	inputMetas := map[ulid.ULID]*metadata.Meta{}
+	for i := 1; i <= 10; i++ {
+		meta := &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i)}}
+		// Leave some blocks without external labels.
+		if i%5 != 0 {
+			meta.Thanos.Labels = map[string]string{"cluster": fmt.Sprintf("cluster-%d", i%2)}
+		}
+		inputMetas[ULID(i)] = meta
+	}
+
+	filter := func(t *testing.T, config string) map[ulid.ULID]*metadata.Meta {
+		relabelConfig, err := ParseRelabelConfig([]byte(config), SelectorSupportedRelabelActions)
+		require.NoError(t, err)
+
+		metas := copyMetas(inputMetas)
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+		require.NoError(t, NewLabelSelectorMetaFilter(relabelConfig).Filter(context.Background(), metas, synced, nil))
+		assert.Equal(t, float64(len(inputMetas)-len(metas)), promtest.ToFloat64(synced.WithLabelValues(labelExcludedMeta)))
+		return metas
+	}
+
+	t.Run("keep", func(t *testing.T) {
+		metas := filter(t, `
+        - action: keep
+          source_labels: [cluster]
+          regex: cluster-1
+        `)
+		assert.ElementsMatch(t, []ulid.ULID{ULID(1), ULID(3), ULID(7), ULID(9)}, mapKeys(metas))
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		metas := filter(t, `
+        - action: drop
+          source_labels: [cluster]
+          regex: cluster-1
+        `)
+		assert.ElementsMatch(t, []ulid.ULID{ULID(2), ULID(4), ULID(5), ULID(6), ULID(8), ULID(10)}, mapKeys(metas))
+	})
+
+	t.Run("block ID is injected to blocks without external labels", func(t *testing.T) {
+		metas := filter(t, fmt.Sprintf(`
+        - action: keep
+          source_labels: [%s]
+          regex: %s|%s
+        `, BlockIDLabel, ULID(5), ULID(10)))
+		assert.ElementsMatch(t, []ulid.ULID{ULID(5), ULID(10)}, mapKeys(metas))
+	})
+
+	t.Run("hashmod", func(t *testing.T) {
+		const shards = 3
+
+		owned := map[ulid.ULID]int{}
+		for shard := 0; shard < shards; shard++ {
+			metas := filter(t, fmt.Sprintf(`
+            - action: hashmod
+              source_labels: [%s]
+              target_label: shard
+              modulus: %d
+            - action: keep
+              source_labels: [shard]
+              regex: %d
+            `, BlockIDLabel, shards, shard))
+			assert.NotEmpty(t, metas)
+
+			for id := range metas {
+				owned[id]++
+			}
+		}
+
+		// Each block is owned by exactly one shard.
+		require.Len(t, owned, len(inputMetas))
+		for id, count := range owned {
+			assert.Equal(t, 1, count, id.String())
+		}
+	})
+}
+
+func TestOverlappingBlocksFilter(t *testing.T) {
+	const shardLabel = "shard"
+
+	meta := func(id ulid.ULID, shard string, minTime, maxTime int64) *metadata.Meta {
+		m := &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: minTime, MaxTime: maxTime}}
+		if shard != "" {
+			m.Thanos.Labels = map[string]string{shardLabel: shard}
+		}
+		return m
+	}
+
+	inputMetas := map[ulid.ULID]*metadata.Meta{
+		// Overlapping blocks without shard.
+		ULID(1): meta(ULID(1), "", 0, 20),
+		ULID(2): meta(ULID(2), "", 10, 30),
+		// Adjacent blocks of the same shard.
+		ULID(3): meta(ULID(3), "1_of_2", 0, 20),
+		ULID(4): meta(ULID(4), "1_of_2", 20, 40),
+		// Blocks overlapping transitively within the same shard.
+		ULID(5): meta(ULID(5), "2_of_2", 0, 20),
+		ULID(6): meta(ULID(6), "2_of_2", 10, 40),
+		ULID(7): meta(ULID(7), "2_of_2", 30, 50),
+		// Block of the same shard not overlapping the previous ones.
+		ULID(8): meta(ULID(8), "2_of_2", 60, 80),
+		// Block overlapping blocks of other shards only.
+		ULID(9): meta(ULID(9), "3_of_3", 0, 80),
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	f := NewOverlappingBlocksFilter(shardLabel, reg)
+
+	metas := copyMetas(inputMetas)
+	require.NoError(t, f.Filter(context.Background(), metas, nil, nil))
+
+	// The filter doesn't filter out any block.
+	assert.Equal(t, inputMetas, metas)
+
+	assert.Equal(t, [][]ulid.ULID{
+		{ULID(1), ULID(2)},
+		{ULID(5), ULID(6), ULID(7)},
+	}, f.OverlappingBlocks())
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_overlapping_blocks Number of blocks overlapping at least another block of the same shard, as of the last fetch.
+		# TYPE blocks_meta_overlapping_blocks gauge
+		blocks_meta_overlapping_blocks 5
+	`), "blocks_meta_overlapping_blocks"))
+
+	// Once the overlapping blocks have been merged, no overlap is reported anymore.
+	delete(metas, ULID(2))
+	delete(metas, ULID(6))
+	delete(metas, ULID(7))
+	require.NoError(t, f.Filter(context.Background(), metas, nil, nil))
+
+	assert.Empty(t, f.OverlappingBlocks())
+	assert.Equal(t, float64(0), promtest.ToFloat64(f.overlapping))
+}
+
+func TestMaxBlockDurationFilter(t *testing.T) {
+	const hour = int64(time.Hour / time.Millisecond)
+
+	inputMetas := map[ulid.ULID]*metadata.Meta{
+		// Shorter than the max duration.
+		ULID(1): {BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 2 * hour}},
+		// Exactly the max duration.
+		ULID(2): {BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 24 * hour}},
+		// Exceeding the max duration (eg. a block spanning 30 days).
+		ULID(3): {BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 30 * 24 * hour}},
+	}
+
+	t.Run("max duration enabled", func(t *testing.T) {
+		metas := copyMetas(inputMetas)
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+		f := NewMaxBlockDurationFilter(log.NewNopLogger(), 24*time.Hour)
+		require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+		assert.Equal(t, map[ulid.ULID]*metadata.Meta{
+			ULID(1): inputMetas[ULID(1)],
+			ULID(2): inputMetas[ULID(2)],
+		}, metas)
+		assert.Equal(t, 1.0, promtest.ToFloat64(synced.WithLabelValues(overMaxDurationMeta)))
+	})
+
+	t.Run("max duration disabled", func(t *testing.T) {
+		metas := copyMetas(inputMetas)
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+		f := NewMaxBlockDurationFilter(log.NewNopLogger(), 0)
+		require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+		assert.Equal(t, inputMetas, metas)
+		assert.Equal(t, 0.0, promtest.ToFloat64(synced.WithLabelValues(overMaxDurationMeta)))
+	})
+}
+
+func TestMinCompactionLevelMetaFilter(t *testing.T) {
+	inputMetas := map[ulid.ULID]*metadata.Meta{}
+	for i, level := range []int{1, 1, 2, 3, 4} {
+		inputMetas[ULID(i+1)] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i + 1), Compaction: tsdb.BlockMetaCompaction{Level: level}}}
+	}
+
+	tests := map[string]struct {
+		minLevel    int
+		expectedIDs []ulid.ULID
+	}{
+		"disabled": {
+			minLevel:    0,
+			expectedIDs: []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5)},
+		},
+		"min level 1": {
+			minLevel:    1,
+			expectedIDs: []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5)},
+		},
+		"min level 2": {
+			minLevel:    2,
+			expectedIDs: []ulid.ULID{ULID(3), ULID(4), ULID(5)},
+		},
+		"min level 4": {
+			minLevel:    4,
+			expectedIDs: []ulid.ULID{ULID(5)},
+		},
+		"min level higher than all blocks": {
+			minLevel:    5,
+			expectedIDs: []ulid.ULID{},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			metas := copyMetas(inputMetas)
+			synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+			f := NewMinCompactionLevelMetaFilter(testData.minLevel)
+			require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+			assert.ElementsMatch(t, testData.expectedIDs, mapKeys(metas))
+			assert.Equal(t, float64(len(inputMetas)-len(testData.expectedIDs)), promtest.ToFloat64(synced.WithLabelValues(belowMinLevelMeta)))
+		})
+	}
+}
+
+func TestCompactorVersionMetaFilter(t *testing.T) {
+	inputMetas := map[ulid.ULID]*metadata.Meta{}
+	for i, version := range []string{"", "2.5.0", "2.6.0", "2.6.0", "2.7.0"} {
+		inputMetas[ULID(i+1)] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i + 1)}, Thanos: metadata.Thanos{CompactorVersion: version}}
+	}
+
+	tests := map[string]struct {
+		excludedVersions []string
+		expectedIDs      []ulid.ULID
+	}{
+		"no excluded versions": {
+			expectedIDs: []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5)},
+		},
+		"one excluded version": {
+			excludedVersions: []string{"2.6.0"},
+			expectedIDs:      []ulid.ULID{ULID(1), ULID(2), ULID(5)},
+		},
+		"multiple excluded versions": {
+			excludedVersions: []string{"2.5.0", "2.7.0"},
+			expectedIDs:      []ulid.ULID{ULID(1), ULID(3), ULID(4)},
+		},
+		"excluded version not matching any block": {
+			excludedVersions: []string{"2.8.0"},
+			expectedIDs:      []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5)},
+		},
+		"empty version doesn't match blocks without version": {
+			excludedVersions: []string{""},
+			expectedIDs:      []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5)},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			metas := copyMetas(inputMetas)
+			synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+			f := NewCompactorVersionMetaFilter(testData.excludedVersions)
+			require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+			assert.ElementsMatch(t, testData.expectedIDs, mapKeys(metas))
+			assert.Equal(t, float64(len(inputMetas)-len(testData.expectedIDs)), promtest.ToFloat64(synced.WithLabelValues(compactorVersionExcludedMeta)))
+		})
+	}
+}
+
+func TestPartialUploadFilter(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+
+	upload := func(id ulid.ULID, files ...string) {
+		for _, file := range files {
+			require.NoError(t, bkt.Upload(ctx, path.Join(id.String(), file), strings.NewReader("content")))
+		}
+	}
+	upload(ULID(1), "index", "chunks/000001")
+	upload(ULID(2), "index")
+	upload(ULID(3), "chunks/000001")
+	upload(ULID(4), "index", "chunks/000001", "tombstones")
+
+	inputMetas := map[ulid.ULID]*metadata.Meta{}
+	for i := 1; i <= 5; i++ {
+		inputMetas[ULID(i)] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i)}}
+	}
+
+	tests := map[string]struct {
+		files       []string
+		expectedIDs []ulid.ULID
+	}{
+		"default files": {
+			expectedIDs: []ulid.ULID{ULID(1), ULID(4)},
+		},
+		"index only": {
+			files:       []string{"index"},
+			expectedIDs: []ulid.ULID{ULID(1), ULID(2), ULID(4)},
+		},
+		"additional files": {
+			files:       []string{"index", "chunks/000001", "tombstones"},
+			expectedIDs: []ulid.ULID{ULID(4)},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			metas := copyMetas(inputMetas)
+			synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+			f := NewPartialUploadFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), testData.files, 2)
+			require.NoError(t, f.Filter(ctx, metas, synced, nil))
+
+			assert.ElementsMatch(t, testData.expectedIDs, mapKeys(metas))
+			assert.Equal(t, float64(len(inputMetas)-len(testData.expectedIDs)), promtest.ToFloat64(synced.WithLabelValues(incompleteMeta)))
+		})
+	}
+
+	t.Run("bucket error", func(t *testing.T) {
+		metas := copyMetas(inputMetas)
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+		errBkt := &bucket.ErrorInjectedBucketClient{Bucket: bkt, Injector: bucket.InjectErrorOn(bucket.OpExists, path.Join(ULID(1).String(), "index"), errors.New("injected error"))}
+		f := NewPartialUploadFilter(log.NewNopLogger(), objstore.WithNoopInstr(errBkt), nil, 2)
+		require.ErrorContains(t, f.Filter(ctx, metas, synced, nil), "injected error")
+	})
+}
+
+func TestEmptyBlockFilter(t *testing.T) {
+	inputMetas := map[ulid.ULID]*metadata.Meta{
+		ULID(1): {BlockMeta: tsdb.BlockMeta{Stats: tsdb.BlockStats{NumSeries: 1, NumSamples: 10}}},
+		ULID(2): {BlockMeta: tsdb.BlockMeta{Stats: tsdb.BlockStats{NumSamples: 0}}},
+		ULID(3): {BlockMeta: tsdb.BlockMeta{Stats: tsdb.BlockStats{NumSeries: 2, NumSamples: 20}}},
+	}
+
+	metas := copyMetas(inputMetas)
+	synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+	f := NewEmptyBlockFilter(log.NewNopLogger())
+	require.NoError(t, f.Filter(context.Background(), metas, synced, nil))
+
+	assert.Equal(t, map[ulid.ULID]*metadata.Meta{
+		ULID(1): inputMetas[ULID(1)],
+		ULID(3): inputMetas[ULID(3)],
+	}, metas)
+	assert.Equal(t, 1.0, promtest.ToFloat64(synced.WithLabelValues(emptyMeta)))
+}
+
+func TestConsistencyDelayMetaFilter(t *testing.T) {
+	freshID := ulid.MustNew(ulid.Timestamp(time.Now().Add(-time.Hour)), nil)
+	oldID := ulid.MustNew(ulid.Timestamp(time.Now().Add(-3*time.Hour)), nil)
+
+	inputMetas := map[ulid.ULID]*metadata.Meta{
+		freshID: {BlockMeta: tsdb.BlockMeta{ULID: freshID}},
+		oldID:   {BlockMeta: tsdb.BlockMeta{ULID: oldID}},
+	}
+
+	// Each tenant has its own filter and registry, so the configured delay is exposed per tenant.
+	user1Reg := prometheus.NewPedanticRegistry()
+	user1Filter := NewConsistencyDelayMetaFilter(log.NewNopLogger(), 2*time.Hour, user1Reg)
+	user2Reg := prometheus.NewPedanticRegistry()
+	user2Filter := NewConsistencyDelayMetaFilter(log.NewNopLogger(), 30*time.Minute, user2Reg)
+
+	assertDelay := func(reg *prometheus.Registry, expected string) {
+		assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+			# HELP consistency_delay_seconds Configured consistency delay in seconds.
+			# TYPE consistency_delay_seconds gauge
+			consistency_delay_seconds `+expected+`
+		`), "consistency_delay_seconds"))
+	}
+	assertDelay(user1Reg, "7200")
+	assertDelay(user2Reg, "1800")
+
+	metas := copyMetas(inputMetas)
+	synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+	require.NoError(t, user1Filter.Filter(context.Background(), metas, synced, nil))
+	assert.Equal(t, map[ulid.ULID]*metadata.Meta{oldID: inputMetas[oldID]}, metas)
+	assert.Equal(t, 1.0, promtest.ToFloat64(synced.WithLabelValues(tooFreshMeta)))
+
+	metas = copyMetas(inputMetas)
+	require.NoError(t, user2Filter.Filter(context.Background(), metas, synced, nil))
+	assert.Equal(t, inputMetas, metas)
+}
+
+func TestMetaFetcher_BlockSizeMetric(t *testing.T) {
+	const mib = 1024 * 1024
+
+	bkt := objstore.NewInMemBucket()
+
+	// Block listing its files.
+	uploadMeta(t, bkt, &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1},
+		Thanos: metadata.Thanos{Files: []metadata.File{
+			{RelPath: "index", SizeBytes: mib},
+			{RelPath: "chunks/000001", SizeBytes: mib},
+			{RelPath: "meta.json"},
+		}},
+	})
+	// Bigger block listing its files.
+	uploadMeta(t, bkt, &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ULID(2), Version: metadata.TSDBVersion1},
+		Thanos: metadata.Thanos{Files: []metadata.File{
+			{RelPath: "index", SizeBytes: 20 * mib},
+			{RelPath: "chunks/000001", SizeBytes: 80 * mib},
+		}},
+	})
+	// Block not listing its files, which is not observed.
+	uploadMeta(t, bkt, &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ULID(3), Version: metadata.TSDBVersion1},
+	})
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, reg, nil)
+	require.NoError(t, err)
+
+	metas, _, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metas, 3)
+
+	// The metas are cached now, so a following sync doesn't observe the blocks again.
+	metas, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metas, 3)
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_block_size_bytes Size of the blocks in bytes, observed when their metadata is loaded from the object storage
+		# TYPE blocks_meta_block_size_bytes histogram
+		blocks_meta_block_size_bytes_bucket{le="1.048576e+06"} 0
+		blocks_meta_block_size_bytes_bucket{le="4.194304e+06"} 1
+		blocks_meta_block_size_bytes_bucket{le="1.6777216e+07"} 1
+		blocks_meta_block_size_bytes_bucket{le="6.7108864e+07"} 1
+		blocks_meta_block_size_bytes_bucket{le="2.68435456e+08"} 2
+		blocks_meta_block_size_bytes_bucket{le="1.073741824e+09"} 2
+		blocks_meta_block_size_bytes_bucket{le="4.294967296e+09"} 2
+		blocks_meta_block_size_bytes_bucket{le="1.7179869184e+10"} 2
+		blocks_meta_block_size_bytes_bucket{le="6.8719476736e+10"} 2
+		blocks_meta_block_size_bytes_bucket{le="2.74877906944e+11"} 2
+		blocks_meta_block_size_bytes_bucket{le="+Inf"} 2
+		blocks_meta_block_size_bytes_sum 1.06954752e+08
+		blocks_meta_block_size_bytes_count 2
+	`), "blocks_meta_block_size_bytes"))
+}
+
+func TestMetaFetcher_BlockStatsMetrics(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+
+	uploadMeta(t, bkt, &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1, Stats: tsdb.BlockStats{NumSeries: 10, NumSamples: 1000, NumChunks: 20}},
+	})
+	uploadMeta(t, bkt, &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ULID(2), Version: metadata.TSDBVersion1, Stats: tsdb.BlockStats{NumSeries: 5, NumSamples: 500, NumChunks: 8}},
+	})
+	// Block excluded by a filter, which must not be accounted.
+	uploadMeta(t, bkt, &metadata.Meta{
+		BlockMeta: tsdb.BlockMeta{ULID: ULID(3), Version: metadata.TSDBVersion1, MinTime: 0, MaxTime: (48 * time.Hour).Milliseconds(), Stats: tsdb.BlockStats{NumSeries: 100, NumSamples: 10000, NumChunks: 200}},
+	})
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, reg, []MetadataFilter{
+		NewMaxBlockDurationFilter(log.NewNopLogger(), 24*time.Hour),
+	})
+	require.NoError(t, err)
+
+	metas, _, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metas, 2)
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_total_series Total number of series across all loaded blocks
+		# TYPE blocks_meta_total_series gauge
+		blocks_meta_total_series 15
+
+		# HELP blocks_meta_total_samples Total number of samples across all loaded blocks
+		# TYPE blocks_meta_total_samples gauge
+		blocks_meta_total_samples 1500
+
+		# HELP blocks_meta_total_chunks Total number of chunks across all loaded blocks
+		# TYPE blocks_meta_total_chunks gauge
+		blocks_meta_total_chunks 28
+	`), "blocks_meta_total_series", "blocks_meta_total_samples", "blocks_meta_total_chunks"))
+}
+
+func TestMetaFetcher_CacheHitRatioMetric(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	for i := 1; i <= 4; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), t.TempDir(), 0, reg, nil)
+	require.NoError(t, err)
+
+	// The first fetch downloads all metas.
+	_, _, err = f.Fetch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, promtest.ToFloat64(f.metrics.CacheHitRatio))
+
+	// With a warm cache, only the new block's meta is downloaded.
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(5), Version: metadata.TSDBVersion1}})
+
+	_, _, err = f.Fetch(ctx)
+	require.NoError(t, err)
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_cache_hit_ratio Ratio of block metadata served from the in-memory or disk cache, out of all block metadata loaded in the last synchronization
+		# TYPE blocks_meta_cache_hit_ratio gauge
+		blocks_meta_cache_hit_ratio 0.8
+	`), "blocks_meta_cache_hit_ratio"))
+}
+
+func TestBaseFetcher_CacheCorruptedMetric(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	for i := 1; i <= 3; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	dir := t.TempDir()
+	_, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), dir, 0, nil, nil)
+	require.NoError(t, err)
+	cacheDir := filepath.Join(dir, "meta-syncer")
+
+	// Block 1 has a corrupted cached meta, block 2 has a cached dir without meta and block 3 isn't cached.
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, ULID(1).String()), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, ULID(1).String(), MetaFilename), []byte("{"), 0o666))
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, ULID(2).String()), 0o750))
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), dir, 0, reg, nil)
+	require.NoError(t, err)
+
+	metas, _, err := f.Fetch(ctx)
+	require.NoError(t, err)
+	assert.Len(t, metas, 3)
+
+	// Only the corrupted cached meta is counted.
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_cache_corrupted_total Total number of block metadata cached on disk which failed to be read and has been evicted from the cache
+		# TYPE blocks_meta_cache_corrupted_total counter
+		blocks_meta_cache_corrupted_total 1
+	`), "blocks_meta_cache_corrupted_total"))
+}
+
+func TestMetaFetcher_ShouldReportMetaWithMismatchingBlockIDAsCorrupted(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1}})
+
+	// Block 2 has the meta.json of block 3, like after a wrong copy of the block.
+	var buf bytes.Buffer
+	require.NoError(t, (&metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(3), Version: metadata.TSDBVersion1}}).Write(&buf))
+	require.NoError(t, bkt.Upload(ctx, path.Join(ULID(2).String(), metadata.MetaFilename), &buf))
+
+	dir := t.TempDir()
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), dir, 0, reg, nil)
+	require.NoError(t, err)
+
+	metas, partial, err := f.Fetch(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ulid.ULID{ULID(1)}, mapKeys(metas))
+	require.Contains(t, partial, ULID(2))
+	assert.ErrorIs(t, partial[ULID(2)], ErrorSyncMetaCorrupted)
+	assert.ErrorContains(t, partial[ULID(2)], fmt.Sprintf("contains block ID %s, which doesn't match the block directory %s", ULID(3), ULID(2)))
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_synced Number of block metadata synced
+		# TYPE blocks_meta_synced gauge
+		blocks_meta_synced{state="below-min-compaction-level"} 0
+		blocks_meta_synced{state="compactor-version-excluded"} 0
+		blocks_meta_synced{state="corrupted-meta-json"} 1
+		blocks_meta_synced{state="duplicate"} 0
+		blocks_meta_synced{state="empty"} 0
+		blocks_meta_synced{state="failed"} 0
+		blocks_meta_synced{state="incomplete"} 0
+		blocks_meta_synced{state="label-excluded"} 0
+		blocks_meta_synced{state="loaded"} 1
+		blocks_meta_synced{state="marked-for-deletion"} 0
+		blocks_meta_synced{state="marked-for-no-compact"} 0
+		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="over-max-duration"} 0
+		blocks_meta_synced{state="time-excluded"} 0
+		blocks_meta_synced{state="too-fresh"} 0
+	`), "blocks_meta_synced"))
+
+	// The mismatching meta.json hasn't been cached on disk.
+	_, err = os.Stat(filepath.Join(dir, "meta-syncer", ULID(2).String(), MetaFilename))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMetaFetcher_FiltersMetrics(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	for i := 1; i <= 3; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	filters := []MetadataFilter{slowFilter{delay: 50 * time.Millisecond}, slowFilter{delay: 50 * time.Millisecond}}
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, reg, filters)
+	require.NoError(t, err)
+
+	metas, _, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 3)
+	assert.Equal(t, 2.0, promtest.ToFloat64(f.metrics.Filters))
+
+	mfs, err := reg.Gather()
+	require.NoError(t, err)
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "blocks_meta_filters_duration_seconds" {
+			continue
+		}
+
+		found = true
+		require.Len(t, mf.GetMetric(), 1)
+		assert.Equal(t, uint64(1), mf.GetMetric()[0].GetHistogram().GetSampleCount())
+		assert.GreaterOrEqual(t, mf.GetMetric()[0].GetHistogram().GetSampleSum(), (100 * time.Millisecond).Seconds())
+	}
+	assert.True(t, found)
+}
+
+func TestMetaFetcher_MetaLoadDurationMetric(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	for i := 1; i <= 3; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, reg, nil)
+	require.NoError(t, err)
+
+	loadDurationSampleCount := func() uint64 {
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+
+		for _, mf := range mfs {
+			if mf.GetName() == "blocks_meta_load_duration_seconds" {
+				require.Len(t, mf.GetMetric(), 1)
+				return mf.GetMetric()[0].GetHistogram().GetSampleCount()
+			}
+		}
+		require.Fail(t, "metric not found")
+		return 0
+	}
+
+	// Each meta.json downloaded from the bucket is observed.
+	metas, _, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 3)
+	assert.Equal(t, uint64(3), loadDurationSampleCount())
+
+	// The metas served from the cache aren't observed.
+	metas, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 3)
+	assert.Equal(t, uint64(3), loadDurationSampleCount())
+}
+
+// slowFilter is a MetadataFilter which doesn't filter out any meta, but takes delay to run.
+type slowFilter struct {
+	delay time.Duration
+}
+
+func (f slowFilter) Filter(context.Context, map[ulid.ULID]*metadata.Meta, GaugeVec, GaugeVec) error {
+	time.Sleep(f.delay)
+	return nil
+}
+
+func TestIgnoreDeletionMarkFilter_ShouldReturnPromptlyOnContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Cancel the context while the first deletion mark is read.
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error {
+		cancel()
+		return nil
+	}}
+
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i := 1; i <= 10; i++ {
+		metas[ULID(i)] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i)}}
+	}
+
+	synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+	f := NewIgnoreDeletionMarkFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), 0, 1, nil)
+
+	err := f.Filter(ctx, metas, synced, nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Only the deletion mark read in progress when the context was canceled has been read.
+	assert.Equal(t, int64(1), bkt.gets.Load())
+}
+
+func TestIgnoreDeletionMarkFilter_ShouldCountNewlyMarkedBlocks(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewPedanticRegistry()
+	f := NewIgnoreDeletionMarkFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), time.Hour, 1, reg)
+
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i := 1; i <= 3; i++ {
+		metas[ULID(i)] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i)}}
+	}
+
+	filter := func() {
+		synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+		require.NoError(t, f.Filter(ctx, copyMetas(metas), synced, nil))
+	}
+
+	// Blocks already marked for deletion at the first sync are not counted.
+	require.NoError(t, MarkForDeletion(ctx, log.NewNopLogger(), bkt, ULID(1), "test", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
+	filter()
+	assert.Equal(t, 0.0, promtest.ToFloat64(f.newlyMarked))
+
+	// A block marked for deletion between two syncs is counted once.
+	require.NoError(t, MarkForDeletion(ctx, log.NewNopLogger(), bkt, ULID(2), "test", promauto.With(nil).NewCounter(prometheus.CounterOpts{})))
+	filter()
+	filter()
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_newly_marked_for_deletion_total Total number of blocks found marked for deletion which were not marked for deletion in the previous sync.
+		# TYPE blocks_meta_newly_marked_for_deletion_total counter
+		blocks_meta_newly_marked_for_deletion_total 1
+	`), "blocks_meta_newly_marked_for_deletion_total"))
+	assert.Len(t, f.DeletionMarkBlocks(), 2)
+}
+
+func TestIgnoreDeletionMarkFilter_PendingDeletionBlocks(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	f := NewIgnoreDeletionMarkFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), time.Hour, 1, nil)
+
+	now := time.Now()
+	markForDeletion := func(id ulid.ULID, deletionTime time.Time) {
+		mark, err := json.Marshal(metadata.DeletionMark{
+			ID:           id,
+			DeletionTime: deletionTime.Unix(),
+			Version:      metadata.DeletionMarkVersion1,
+		})
+		require.NoError(t, err)
+		require.NoError(t, bkt.Upload(ctx, path.Join(id.String(), metadata.DeletionMarkFilename), bytes.NewReader(mark)))
+	}
+
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i := 1; i <= 3; i++ {
+		metas[ULID(i)] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i)}}
+	}
+
+	// Block 1 is past the deletion delay, block 2 is still pending and block 3 isn't marked.
+	markForDeletion(ULID(1), now.Add(-2*time.Hour))
+	markForDeletion(ULID(2), now.Add(-30*time.Minute))
+
+	synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+	require.NoError(t, f.Filter(ctx, metas, synced, nil))
+
+	assert.Len(t, f.DeletionMarkBlocks(), 2)
+	assert.Equal(t, map[ulid.ULID]time.Time{
+		ULID(2): time.Unix(now.Add(-30*time.Minute).Unix(), 0).Add(time.Hour),
+	}, f.PendingDeletionBlocks())
+
+	// The pending blocks reflect the most recent run.
+	require.NoError(t, bkt.Delete(ctx, path.Join(ULID(2).String(), metadata.DeletionMarkFilename)))
+	require.NoError(t, f.Filter(ctx, metas, synced, nil))
+	assert.Empty(t, f.PendingDeletionBlocks())
+}
+
+// getCountingBucket is an objstore.Bucket counting Get calls and calling onGet on each of them.
+// If onGet returns an error, Get fails with it.
+type getCountingBucket struct {
+	objstore.Bucket
+
+	gets  atomic.Int64
+	onGet func(name string) error
+}
+
+func (b *getCountingBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	b.gets.Inc()
+	if err := b.onGet(name); err != nil {
+		return nil, err
+	}
+	return b.Bucket.Get(ctx, name)
+}
+
+func TestMetaFetcher_FailedMetasTolerance(t *testing.T) {
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(name string) error {
+		// Fail loading the meta.json of 2 out of 10 blocks.
+		if name == path.Join(ULID(1).String(), metadata.MetaFilename) || name == path.Join(ULID(2).String(), metadata.MetaFilename) {
+			return errors.New("transient error")
+		}
+		return nil
+	}}
+	for i := 1; i <= 10; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	tests := map[string]struct {
+		maxCount    int
+		maxRatio    float64
+		expectedErr bool
+	}{
+		"no tolerance": {
+			expectedErr: true,
+		},
+		"failed metas equal to the max count": {
+			maxCount: 2,
+		},
+		"failed metas above the max count": {
+			maxCount:    1,
+			expectedErr: true,
+		},
+		"failed metas ratio equal to the max ratio": {
+			maxRatio: 0.2,
+		},
+		"failed metas ratio above the max ratio": {
+			maxRatio:    0.1,
+			expectedErr: true,
+		},
+		"failed metas above the max count but within the max ratio": {
+			maxCount: 1,
+			maxRatio: 0.5,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, nil, nil, WithFailedMetasTolerance(testData.maxCount, testData.maxRatio), WithMetaLoadRetries(0, 0))
+			require.NoError(t, err)
+
+			metas, partial, unloaded, err := f.FetchWithUnloaded(context.Background())
+			assert.Len(t, metas, 8)
+
+			if testData.expectedErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "incomplete view")
+				return
+			}
+
+			// The blocks whose meta.json failed to load aren't reported as partially uploaded.
+			require.NoError(t, err)
+			assert.Empty(t, partial)
+			assert.Len(t, unloaded, 2)
+			assert.Contains(t, unloaded, ULID(1))
+			assert.Contains(t, unloaded, ULID(2))
+
+			// Fetch doesn't return the unloaded blocks, so it flags the incomplete view with an error.
+			metas, partial, err = f.Fetch(context.Background())
+			require.ErrorIs(t, err, ErrIncompleteFetch)
+			assert.Len(t, metas, 8)
+			assert.Empty(t, partial)
+		})
+	}
+}
+
+func TestMetaFetcher_FetchBatchSize(t *testing.T) {
+	var inflight, maxInflight atomic.Int64
+
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error {
+		// Keep each fetch in flight for a while, to track how many of them run at once.
+		curr := inflight.Inc()
+		defer inflight.Dec()
+
+		for prev := maxInflight.Load(); curr > prev && !maxInflight.CompareAndSwap(prev, curr); prev = maxInflight.Load() {
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}}
+	for i := 1; i <= 10; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	// The concurrency is higher than the batch size, and the number of blocks isn't a multiple of it.
+	f, err := NewMetaFetcher(log.NewNopLogger(), 5, objstore.WithNoopInstr(bkt), "", 0, nil, nil, WithFetchBatchSize(3))
+	require.NoError(t, err)
+
+	metas, partial, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 10)
+	assert.Empty(t, partial)
+	assert.Equal(t, int64(10), bkt.gets.Load())
+	assert.LessOrEqual(t, maxInflight.Load(), int64(3))
+
+	// The cache has been updated with the metas of all batches, so no meta.json is downloaded again.
+	metas, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 10)
+	assert.Equal(t, int64(10), bkt.gets.Load())
+}
+
+func TestMetaFetcher_FetchSoftTimeout(t *testing.T) {
+	const (
+		numBlocks   = 10
+		loadDelay   = 50 * time.Millisecond
+		softTimeout = 120 * time.Millisecond
+	)
+
+	slow := atomic.NewBool(true)
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error {
+		if slow.Load() {
+			time.Sleep(loadDelay)
+		}
+		return nil
+	}}
+	for i := 1; i <= numBlocks; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, nil, nil, WithFetchSoftTimeout(softTimeout))
+	require.NoError(t, err)
+
+	// The fetch stops loading metas once the soft timeout is exceeded, and successfully returns the ones loaded so far.
+	start := time.Now()
+	metas, partial, unloaded, err := f.FetchWithUnloaded(context.Background())
+	elapsed := time.Since(start)
+	require.NoError(t, err)
+	assert.Less(t, elapsed, softTimeout+2*loadDelay)
+	assert.NotEmpty(t, metas)
+	assert.Less(t, len(metas), numBlocks)
+
+	// The blocks not loaded are returned as unloaded, flagged as skipped, and not as partially uploaded.
+	assert.Empty(t, partial)
+	assert.Len(t, unloaded, numBlocks-len(metas))
+	for id, err := range unloaded {
+		assert.NotContains(t, metas, id)
+		assert.ErrorIs(t, err, ErrorSyncMetaSkipped)
+	}
+
+	// The skipped blocks can be loaded on retry.
+	slow.Store(false)
+	retried, failed := f.RetryFailed(context.Background(), unloaded)
+	assert.Empty(t, failed)
+	assert.Len(t, retried, len(unloaded))
+
+	// A fetch within the soft timeout returns all the blocks.
+	metas, partial, unloaded, err = f.FetchWithUnloaded(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, numBlocks)
+	assert.Empty(t, partial)
+	assert.Empty(t, unloaded)
+}
+
+func TestMetaFetcher_MetaCacheTTL(t *testing.T) {
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error { return nil }}
+	for i := 1; i <= 3; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	bf, err := NewBaseFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), t.TempDir(), time.Hour, nil)
+	require.NoError(t, err)
+	now := time.Now()
+	bf.now = func() time.Time { return now }
+	f := bf.NewMetaFetcher(nil, nil)
+
+	metas, _, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 3)
+	assert.Equal(t, int64(3), bkt.gets.Load())
+
+	// Overwrite a meta.json in the bucket: the cached meta is served until it expires.
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1, MinTime: 10}})
+
+	now = now.Add(30 * time.Minute)
+	metas, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), metas[ULID(1)].MinTime)
+	assert.Equal(t, int64(3), bkt.gets.Load())
+
+	// Once expired, the cached metas are read again from the bucket, instead of from either the memory or the disk cache.
+	now = now.Add(31 * time.Minute)
+	metas, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), metas[ULID(1)].MinTime)
+	assert.Equal(t, int64(6), bkt.gets.Load())
+
+	// The metas read again are cached for another TTL.
+	now = now.Add(30 * time.Minute)
+	metas, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 3)
+	assert.Equal(t, int64(6), bkt.gets.Load())
+}
+
+func TestBaseFetcher_BlockCallbacks(t *testing.T) {
+	var failBlock5 atomic.Bool
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(name string) error {
+		if failBlock5.Load() && name == path.Join(ULID(5).String(), metadata.MetaFilename) {
+			return errors.New("transient error")
+		}
+		return nil
+	}}
+	for i := 1; i <= 3; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	bf, err := NewBaseFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, nil, WithMetaLoadRetries(0, 0))
+	require.NoError(t, err)
+	f := bf.NewMetaFetcher(nil, nil)
+
+	cb1, cb2 := &recordingBlockCallback{}, &recordingBlockCallback{}
+	bf.RegisterCallback(cb1)
+	bf.RegisterCallback(cb2)
+
+	// All blocks are notified as added by the first fetch.
+	_, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	for _, cb := range []*recordingBlockCallback{cb1, cb2} {
+		assert.ElementsMatch(t, []ulid.ULID{ULID(1), ULID(2), ULID(3)}, cb.popAdded())
+		assert.Empty(t, cb.popRemoved())
+	}
+
+	// Nothing is notified if the blocks didn't change.
+	_, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	for _, cb := range []*recordingBlockCallback{cb1, cb2} {
+		assert.Empty(t, cb.popAdded())
+		assert.Empty(t, cb.popRemoved())
+	}
+
+	// Blocks added and removed are notified once.
+	require.NoError(t, bkt.Delete(context.Background(), path.Join(ULID(2).String(), metadata.MetaFilename)))
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(4), Version: metadata.TSDBVersion1}})
+
+	for i := 0; i < 2; i++ {
+		_, _, err = f.Fetch(context.Background())
+		require.NoError(t, err)
+	}
+	for _, cb := range []*recordingBlockCallback{cb1, cb2} {
+		assert.Equal(t, []ulid.ULID{ULID(4)}, cb.popAdded())
+		assert.Equal(t, []ulid.ULID{ULID(2)}, cb.popRemoved())
+	}
+
+	// Nothing is notified by fetches without a complete view of the blocks.
+	failBlock5.Store(true)
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(5), Version: metadata.TSDBVersion1}})
+	require.NoError(t, bkt.Delete(context.Background(), path.Join(ULID(3).String(), metadata.MetaFilename)))
+
+	_, _, err = f.Fetch(context.Background())
+	require.Error(t, err)
+	for _, cb := range []*recordingBlockCallback{cb1, cb2} {
+		assert.Empty(t, cb.popAdded())
+		assert.Empty(t, cb.popRemoved())
+	}
+
+	failBlock5.Store(false)
+	_, _, err = f.Fetch(context.Background())
+	require.NoError(t, err)
+	for _, cb := range []*recordingBlockCallback{cb1, cb2} {
+		assert.Equal(t, []ulid.ULID{ULID(5)}, cb.popAdded())
+		assert.Equal(t, []ulid.ULID{ULID(3)}, cb.popRemoved())
+	}
+}
+
+// recordingBlockCallback is a BlockCallback recording the blocks it has been notified of.
+func TestBaseFetcher_FetchMetadata_ShouldSkipCacheCleanupOnContextCancellation(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1}})
+
+	dir := t.TempDir()
+	bf, err := NewBaseFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), dir, 0, nil)
+	require.NoError(t, err)
+
+	// Create cached dirs of blocks which aren't in the bucket anymore.
+	cacheDir := bf.cacheDir
+	for i := 2; i <= 10; i++ {
+		require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, ULID(i).String()), 0o750))
+	}
+
+	// Cancel the context once the metas have been fetched, right before the cleanup.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bf.RegisterCallback(cancelingBlockCallback{cancel: cancel})
+
+	resp, err := bf.fetchMetadata(ctx, NewFetcherMetrics(nil, nil, nil))
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ulid.ULID{ULID(1)}, mapKeys(resp.(response).metas))
+
+	// The cleanup has been abandoned.
+	for i := 2; i <= 10; i++ {
+		assert.DirExists(t, filepath.Join(cacheDir, ULID(i).String()))
+	}
+
+	// The cleanup is done by the next fetch with a context that isn't canceled.
+	_, err = bf.fetchMetadata(context.Background(), NewFetcherMetrics(nil, nil, nil))
+	require.NoError(t, err)
+	for i := 2; i <= 10; i++ {
+		assert.NoDirExists(t, filepath.Join(cacheDir, ULID(i).String()))
+	}
+}
+
+func TestBaseFetcher_CacheFS(t *testing.T) {
+	ctx := context.Background()
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error { return nil }}
+	for i := 1; i <= 2; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	fs := afero.NewMemMapFs()
+	newFetcher := func() *BaseFetcher {
+		bf, err := NewBaseFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "/data", 0, nil, WithCacheFS(fs))
+		require.NoError(t, err)
+		return bf
+	}
+	fetch := func(bf *BaseFetcher) {
+		resp, err := bf.fetchMetadata(ctx, NewFetcherMetrics(nil, nil, nil))
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []ulid.ULID{ULID(1), ULID(2)}, mapKeys(resp.(response).metas))
+	}
+	cachedMetaPath := func(id ulid.ULID) string {
+		return filepath.Join("/data", "meta-syncer", id.String(), MetaFilename)
+	}
+
+	// The metas are cached on the configured filesystem.
+	fetch(newFetcher())
+	assert.Equal(t, int64(2), bkt.gets.Load())
+	for i := 1; i <= 2; i++ {
+		exists, err := afero.Exists(fs, cachedMetaPath(ULID(i)))
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+
+	// A new fetcher loads the metas from the filesystem instead of the bucket.
+	fetch(newFetcher())
+	assert.Equal(t, int64(2), bkt.gets.Load())
+
+	// A corrupted cached meta is loaded again from the bucket, and cached again.
+	require.NoError(t, afero.WriteFile(fs, cachedMetaPath(ULID(1)), []byte("{"), 0o666))
+	bf := newFetcher()
+	fetch(bf)
+	assert.Equal(t, int64(3), bkt.gets.Load())
+	assert.Equal(t, 1.0, promtest.ToFloat64(bf.cacheCorrupted))
+	m, err := newFetcher().readCachedMeta(filepath.Dir(cachedMetaPath(ULID(1))))
+	require.NoError(t, err)
+	assert.Equal(t, ULID(1), m.ULID)
+
+	// The cached metas of blocks which aren't in the bucket anymore are removed.
+	stale := filepath.Join("/data", "meta-syncer", ULID(3).String())
+	require.NoError(t, fs.MkdirAll(stale, os.ModePerm))
+	fetch(newFetcher())
+	exists, err := afero.DirExists(fs, stale)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// cancelingBlockCallback is a BlockCallback canceling a context when a block is added.
+type cancelingBlockCallback struct {
+	cancel context.CancelFunc
+}
+
+func (c cancelingBlockCallback) OnBlockAdded(ulid.ULID, *metadata.Meta) { c.cancel() }
+
+func (c cancelingBlockCallback) OnBlockRemoved(ulid.ULID) {}
+
+type recordingBlockCallback struct {
+	mtx     sync.Mutex
+	added   []ulid.ULID
+	removed []ulid.ULID
+}
+
+func (c *recordingBlockCallback) OnBlockAdded(_ ulid.ULID, meta *metadata.Meta) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// Record the ID from the meta, to check the meta of the added block is passed.
+	c.added = append(c.added, meta.ULID)
+}
+
+func (c *recordingBlockCallback) OnBlockRemoved(id ulid.ULID) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.removed = append(c.removed, id)
+}
+
+func (c *recordingBlockCallback) popAdded() []ulid.ULID {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	added := c.added
+	c.added = nil
+	return added
+}
+
+func (c *recordingBlockCallback) popRemoved() []ulid.ULID {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	removed := c.removed
+	c.removed = nil
+	return removed
+}
+
+func TestMetaFetcher_ShouldListOnlyBlockDirectories(t *testing.T) {
+	bkt := &iterRecordingBucket{Bucket: objstore.NewInMemBucket()}
+	for i := 1; i <= 3; i++ {
+		meta := &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}}
+		uploadMeta(t, bkt, meta)
+		require.NoError(t, bkt.Upload(context.Background(), path.Join(meta.ULID.String(), IndexFilename), strings.NewReader("index")))
+		require.NoError(t, bkt.Upload(context.Background(), path.Join(meta.ULID.String(), ChunksDirname, "000001"), strings.NewReader("chunks")))
+	}
+
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, nil, nil)
+	require.NoError(t, err)
+
+	metas, _, err := f.Fetch(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metas, 3)
+
+	// Only the top-level block directories have been iterated, not the objects in them.
+	assert.ElementsMatch(t, []string{ULID(1).String() + "/", ULID(2).String() + "/", ULID(3).String() + "/"}, bkt.iterated)
+}
+
+func TestMetaFetcher_ShouldCountNonBlockEntries(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	for i := 1; i <= 2; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	// Entries at the root of the bucket which are not block directories.
+	require.NoError(t, bkt.Upload(ctx, "not-a-block/meta.json", strings.NewReader("{}")))
+	require.NoError(t, bkt.Upload(ctx, "backup/index", strings.NewReader("index")))
+	require.NoError(t, bkt.Upload(ctx, "notes.txt", strings.NewReader("notes")))
+
+	reg := prometheus.NewPedanticRegistry()
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, reg, nil)
+	require.NoError(t, err)
+
+	metas, _, err := f.Fetch(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ulid.ULID{ULID(1), ULID(2)}, mapKeys(metas))
+
+	assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(`
+		# HELP blocks_meta_non_block_entries_total Total number of entries found while listing the blocks in the bucket which are not block directories
+		# TYPE blocks_meta_non_block_entries_total counter
+		blocks_meta_non_block_entries_total 3
+	`), "blocks_meta_non_block_entries_total"))
+}
+
+// iterRecordingBucket is an objstore.Bucket recording the names returned by Iter.
+type iterRecordingBucket struct {
+	objstore.Bucket
+
+	mtx      sync.Mutex
+	iterated []string
+}
+
+func (b *iterRecordingBucket) Iter(ctx context.Context, dir string, f func(string) error, options ...objstore.IterOption) error {
+	return b.Bucket.Iter(ctx, dir, func(name string) error {
+		b.mtx.Lock()
+		b.iterated = append(b.iterated, name)
+		b.mtx.Unlock()
+		return f(name)
+	}, options...)
+}
+
+func TestMetaFetcher_FetchPolicies(t *testing.T) {
+	const shardLabel = "__compactor_shard_id__"
+
+	newMeta := func(id int, minTime, maxTime int64, shardID string) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: ULID(id), MinTime: minTime, MaxTime: maxTime, Version: metadata.TSDBVersion1},
+			Thanos:    metadata.Thanos{Labels: map[string]string{shardLabel: shardID}},
+		}
+	}
+
+	tests := map[string]struct {
+		metas       []*metadata.Meta
+		expectedErr string
+	}{
+		"different shards in the same range": {
+			metas: []*metadata.Meta{newMeta(1, 0, 10, "1_of_2"), newMeta(2, 0, 10, "2_of_2")},
+		},
+		"same shard in different ranges": {
+			metas: []*metadata.Meta{newMeta(1, 0, 10, "1_of_2"), newMeta(2, 10, 20, "1_of_2")},
+		},
+		"same shard in the same range": {
+			metas:       []*metadata.Meta{newMeta(1, 0, 10, "1_of_2"), newMeta(2, 0, 10, "1_of_2"), newMeta(3, 0, 10, "2_of_2")},
+			expectedErr: "fetch policy violated: blocks " + ULID(1).String() + " and " + ULID(2).String() + " have the same shard 1_of_2 in the range 0-10",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			bkt := objstore.NewInMemBucket()
+			for _, m := range testData.metas {
+				uploadMeta(t, bkt, m)
+			}
+
+			f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, nil, nil, WithFetchPolicies(uniqueShardPolicy{label: shardLabel}))
+			require.NoError(t, err)
+
+			metas, partial, err := f.Fetch(context.Background())
+			if testData.expectedErr != "" {
+				require.EqualError(t, err, testData.expectedErr)
+				assert.Nil(t, metas)
+				assert.Nil(t, partial)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Len(t, metas, len(testData.metas))
+		})
+	}
+}
+
+// uniqueShardPolicy is a FetchPolicy rejecting blocks with the same shard label value in the same time range.
+type uniqueShardPolicy struct {
+	label string
+}
+
+func (p uniqueShardPolicy) Check(_ context.Context, metas map[ulid.ULID]*metadata.Meta) error {
+	// Check the blocks in a deterministic order, so that the error is stable.
+	ids := make([]ulid.ULID, 0, len(metas))
+	for id := range metas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+
+	seen := map[string]ulid.ULID{}
+	for _, id := range ids {
+		m := metas[id]
+		key := fmt.Sprintf("%s in the range %d-%d", m.Thanos.Labels[p.label], m.MinTime, m.MaxTime)
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("blocks %s and %s have the same shard %s", other, id, key)
+		}
+		seen[key] = id
+	}
+	return nil
+}
+
+func TestMetaFetcher_MetaLoadRetries(t *testing.T) {
+	errTransient := errors.New("transient error")
+
+	tests := map[string]struct {
+		failures        int
+		corrupted       bool
+		expectedErr     error
+		expectedGets    int64
+		expectedRetries float64
+	}{
+		"no failures": {
+			expectedGets: 1,
+		},
+		"transient failures within the retries": {
+			failures:        2,
+			expectedGets:    3,
+			expectedRetries: 2,
+		},
+		"transient failures exceeding the retries": {
+			failures:        5,
+			expectedErr:     errTransient,
+			expectedGets:    4,
+			expectedRetries: 3,
+		},
+		"corrupted meta.json is not retried": {
+			corrupted:    true,
+			expectedGets: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			failures := atomic.NewInt64(int64(testData.failures))
+			bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error {
+				if failures.Dec() >= 0 {
+					return errTransient
+				}
+				return nil
+			}}
+			if testData.corrupted {
+				require.NoError(t, bkt.Upload(context.Background(), path.Join(ULID(1).String(), metadata.MetaFilename), strings.NewReader("{")))
+			} else {
+				uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1}})
+			}
+
+			reg := prometheus.NewPedanticRegistry()
+			f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, reg, nil, WithMetaLoadRetries(3, time.Millisecond))
+			require.NoError(t, err)
+
+			metas, partial, unloaded, err := f.FetchWithUnloaded(context.Background())
+			switch {
+			case testData.expectedErr != nil:
+				require.Error(t, err)
+				assert.Empty(t, metas)
+				assert.Empty(t, partial)
+				require.Contains(t, unloaded, ULID(1))
+				// The original cause is preserved.
+				assert.ErrorIs(t, unloaded[ULID(1)], testData.expectedErr)
+			case testData.corrupted:
+				require.NoError(t, err)
+				assert.Empty(t, metas)
+				require.Contains(t, partial, ULID(1))
+				assert.ErrorIs(t, partial[ULID(1)], ErrorSyncMetaCorrupted)
+			default:
+				require.NoError(t, err)
+				assert.Len(t, metas, 1)
+				assert.Empty(t, partial)
+			}
+
+			assert.Equal(t, testData.expectedGets, bkt.gets.Load())
+			assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+				# HELP blocks_meta_base_load_retries_total Total retries of object storage requests failed with a transient error while loading block metadata by base Fetcher
+				# TYPE blocks_meta_base_load_retries_total counter
+				blocks_meta_base_load_retries_total %v
+			`, testData.expectedRetries)), "blocks_meta_base_load_retries_total"))
+		})
+	}
+}
+
+func TestMetaFetcher_FetchFiltered(t *testing.T) {
+	ctx := context.Background()
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error { return nil }}
+	for i := 1; i <= 4; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), MinTime: int64(i) * 10, MaxTime: int64(i+1) * 10, Version: metadata.TSDBVersion1}})
+	}
+
+	// The configured filter excludes the oldest block, the extra one the newest.
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, nil, []MetadataFilter{minTimeFilter{minTime: 20}})
+	require.NoError(t, err)
+
+	metas, _, err := f.FetchFiltered(ctx, []MetadataFilter{maxTimeFilter{maxTime: 40}})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ulid.ULID{ULID(2), ULID(3)}, mapKeys(metas))
+	assert.Equal(t, int64(4), bkt.gets.Load())
+
+	// The extra filters don't apply to the next fetches, which are served from the shared cache.
+	metas, _, err = f.Fetch(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []ulid.ULID{ULID(2), ULID(3), ULID(4)}, mapKeys(metas))
+	assert.Equal(t, int64(4), bkt.gets.Load())
+	assert.Len(t, f.filters, 1)
+}
+
+func TestFilterPool_ForEach(t *testing.T) {
+	t.Run("should not run more jobs than the pool concurrency", func(t *testing.T) {
+		pool := NewFilterPool(3)
+
+		var inflight, maxInflight, calls atomic.Int64
+		require.NoError(t, pool.ForEach(context.Background(), 20, func(context.Context, int) error {
+			calls.Inc()
+			n := inflight.Inc()
+			for {
+				max := maxInflight.Load()
+				if n <= max || maxInflight.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			inflight.Dec()
+			return nil
+		}))
+
+		assert.Equal(t, int64(20), calls.Load())
+		assert.LessOrEqual(t, maxInflight.Load(), int64(3))
+	})
+
+	t.Run("should stop starting jobs on error", func(t *testing.T) {
+		pool := NewFilterPool(1)
+
+		var calls atomic.Int64
+		err := pool.ForEach(context.Background(), 10, func(context.Context, int) error {
+			calls.Inc()
+			return errors.New("job failed")
+		})
+		require.EqualError(t, err, "job failed")
+		assert.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("should stop starting jobs on context cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pool := NewFilterPool(1)
+
+		var calls atomic.Int64
+		err := pool.ForEach(ctx, 10, func(context.Context, int) error {
+			calls.Inc()
+			cancel()
+			return nil
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, int64(1), calls.Load())
+	})
+}
+
+func TestMetaFetcher_ShouldRunPooledFiltersOnSharedPool(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	for i := 1; i <= 4; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), MinTime: int64(i) * 10, MaxTime: int64(i+1) * 10, Version: metadata.TSDBVersion1}})
+	}
+
+	t.Run("should run pooled filters on the shared pool if its size is configured", func(t *testing.T) {
+		first, second := &poolRecordingFilter{}, &poolRecordingFilter{}
+		f, err := NewMetaFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, nil, []MetadataFilter{first, minTimeFilter{minTime: 20}, second}, WithFilterPoolSize(2))
+		require.NoError(t, err)
+
+		metas, _, err := f.Fetch(ctx)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []ulid.ULID{ULID(2), ULID(3), ULID(4)}, mapKeys(metas))
+
+		// Both pooled filters have run on the same pool, owned by the fetcher.
+		require.NotNil(t, first.pool)
+		assert.Same(t, f.pool, first.pool)
+		assert.Same(t, f.pool, second.pool)
+		assert.Equal(t, 4, first.jobs)
+		assert.Equal(t, 3, second.jobs)
+	})
+
+	t.Run("should run pooled filters with their own concurrency if the pool size isn't configured", func(t *testing.T) {
+		first := &poolRecordingFilter{}
+		f, err := NewMetaFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, nil, []MetadataFilter{first})
+		require.NoError(t, err)
+
+		metas, _, err := f.Fetch(ctx)
+		require.NoError(t, err)
+		assert.Len(t, metas, 4)
+
+		assert.Nil(t, f.pool)
+		assert.Nil(t, first.pool)
+		assert.True(t, first.unpooled)
+	})
+}
+
+// poolRecordingFilter is a PooledMetadataFilter which doesn't filter out any meta, but records the pool
+// it has been run on, or whether it has been run without a pool.
+type poolRecordingFilter struct {
+	pool     *FilterPool
+	jobs     int
+	unpooled bool
+}
+
+func (f *poolRecordingFilter) Filter(context.Context, map[ulid.ULID]*metadata.Meta, GaugeVec, GaugeVec) error {
+	f.unpooled = true
+	return nil
+}
+
+func (f *poolRecordingFilter) FilterWithPool(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, _ GaugeVec, _ GaugeVec, pool *FilterPool) error {
+	f.pool = pool
+
+	var jobs atomic.Int64
+	err := pool.ForEach(ctx, len(metas), func(context.Context, int) error {
+		jobs.Inc()
+		return nil
+	})
+	f.jobs = int(jobs.Load())
+	return err
+}
+
+func TestMetaFetcher_Filters(t *testing.T) {
+	bkt := objstore.NewInMemBucket()
+	reg := prometheus.NewPedanticRegistry()
+
+	f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, reg, []MetadataFilter{
+		NewTimeRangeMetaFilter(1000, 2000),
+		NewConsistencyDelayMetaFilter(log.NewNopLogger(), 30*time.Minute, reg),
+		NewCompactorVersionMetaFilter([]string{"2.9.0", "2.8.0"}),
+		NewEmptyBlockFilter(log.NewNopLogger()),
+		NewIgnoreDeletionMarkFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), time.Hour, 1, reg),
+		NewPartialUploadFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), []string{IndexFilename}, 1),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"TimeRangeMetaFilter(min_time=1000, max_time=2000)",
+		"ConsistencyDelayMetaFilter(delay=30m0s)",
+		"CompactorVersionMetaFilter(excluded=2.8.0,2.9.0)",
+		"EmptyBlockFilter",
+		"IgnoreDeletionMarkFilter(delay=1h0m0s)",
+		"PartialUploadFilter(files=index)",
+	}, f.Filters())
+
+	f, err = NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, prometheus.NewPedanticRegistry(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, f.Filters())
+}
+
+func TestMetaFetcher_FetchChan(t *testing.T) {
+	// collect reads all the metas from the channel, and then the fetch error.
+	collect := func(metas <-chan *metadata.Meta, errs <-chan error) ([]ulid.ULID, error) {
+		var ids []ulid.ULID
+		for m := range metas {
+			ids = append(ids, m.ULID)
+		}
+		return ids, <-errs
+	}
+
+	t.Run("should stream the metas of the blocks in the bucket", func(t *testing.T) {
+		ctx := context.Background()
+		bkt := objstore.NewInMemBucket()
+		for i := 1; i <= 5; i++ {
+			uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), MinTime: int64(i) * 10, MaxTime: int64(i+1) * 10, Version: metadata.TSDBVersion1}})
+		}
+		// Blocks with a corrupted or without meta.json are skipped.
+		require.NoError(t, bkt.Upload(ctx, path.Join(ULID(6).String(), MetaFilename), strings.NewReader("{")))
+		require.NoError(t, bkt.Upload(ctx, path.Join(ULID(7).String(), IndexFilename), strings.NewReader("index")))
+
+		// Filters don't apply to the streamed metas.
+		f, err := NewMetaFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, nil, []MetadataFilter{minTimeFilter{minTime: 30}})
+		require.NoError(t, err)
+
+		ids, err := collect(f.FetchChan(ctx))
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []ulid.ULID{ULID(1), ULID(2), ULID(3), ULID(4), ULID(5)}, ids)
+	})
+
+	t.Run("should send a meta as soon as it's loaded", func(t *testing.T) {
+		ctx := context.Background()
+		release := make(chan struct{})
+		bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(name string) error {
+			// The meta of block 2 can't be loaded until the meta of block 1 has been received.
+			if strings.HasPrefix(name, ULID(2).String()) {
+				<-release
+			}
+			return nil
+		}}
+		for i := 1; i <= 2; i++ {
+			uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+		}
+
+		f, err := NewMetaFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, nil, nil)
+		require.NoError(t, err)
+
+		metas, errs := f.FetchChan(ctx)
+		select {
+		case m := <-metas:
+			assert.Equal(t, ULID(1), m.ULID)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "the first meta hasn't been received")
+		}
+		close(release)
+
+		ids, err := collect(metas, errs)
+		require.NoError(t, err)
+		assert.Equal(t, []ulid.ULID{ULID(2)}, ids)
+	})
+
+	t.Run("should return the errors loading the metas after all the loaded ones", func(t *testing.T) {
+		ctx := context.Background()
+		bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(name string) error {
+			if strings.HasPrefix(name, ULID(2).String()) {
+				return errors.New("injected error")
+			}
+			return nil
+		}}
+		for i := 1; i <= 3; i++ {
+			uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+		}
+
+		f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), "", 0, nil, nil)
+		require.NoError(t, err)
+
+		ids, err := collect(f.FetchChan(ctx))
+		require.ErrorContains(t, err, "injected error")
+		assert.ElementsMatch(t, []ulid.ULID{ULID(1), ULID(3)}, ids)
+	})
+
+	t.Run("should stop when the context is canceled while the metas are not consumed", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		bkt := objstore.NewInMemBucket()
+		for i := 1; i <= 10; i++ {
+			uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+		}
+
+		f, err := NewMetaFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, nil, nil)
+		require.NoError(t, err)
+
+		metas, errs := f.FetchChan(ctx)
+		<-metas
+		cancel()
+
+		select {
+		case err := <-errs:
+			require.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "the fetch hasn't stopped after the context has been canceled")
+		}
+	})
+}
+
+// minTimeFilter is a MetadataFilter excluding the blocks with min time lower than minTime.
+type minTimeFilter struct {
+	minTime int64
+}
+
+func (f minTimeFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, _ GaugeVec, _ GaugeVec) error {
+	for id, m := range metas {
+		if m.MinTime < f.minTime {
+			delete(metas, id)
+		}
+	}
+	return nil
+}
+
+// maxTimeFilter is a MetadataFilter excluding the blocks with max time higher than maxTime.
+type maxTimeFilter struct {
+	maxTime int64
+}
+
+func (f maxTimeFilter) Filter(_ context.Context, metas map[ulid.ULID]*metadata.Meta, _ GaugeVec, _ GaugeVec) error {
+	for id, m := range metas {
+		if m.MaxTime > f.maxTime {
+			delete(metas, id)
+		}
+	}
+	return nil
+}
+
+func mapKeys(metas map[ulid.ULID]*metadata.Meta) []ulid.ULID {
+	ids := make([]ulid.ULID, 0, len(metas))
+	for id := range metas {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestMetaFetcher_RetryFailed(t *testing.T) {
+	ctx := context.Background()
+	failing := atomic.NewBool(true)
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(name string) error {
+		// Fail loading the meta.json of 2 blocks until the failure is resolved.
+		if failing.Load() && (name == path.Join(ULID(1).String(), metadata.MetaFilename) || name == path.Join(ULID(2).String(), metadata.MetaFilename)) {
+			return errors.New("transient error")
+		}
+		return nil
+	}}
+	for i := 1; i <= 4; i++ {
+		uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(i), Version: metadata.TSDBVersion1}})
+	}
+
+	// A block without meta.json.
+	require.NoError(t, bkt.Upload(ctx, path.Join(ULID(5).String(), "index"), strings.NewReader("index")))
+
+	// Disable the retries of the object storage requests, to count the meta.json loading attempts.
+	f, err := NewMetaFetcher(log.NewNopLogger(), 2, objstore.WithNoopInstr(bkt), "", 0, nil, nil, WithMetaLoadRetries(0, 0))
+	require.NoError(t, err)
+
+	metas, partial, unloaded, err := f.FetchWithUnloaded(ctx)
+	require.Error(t, err)
+	assert.Len(t, metas, 2)
+	assert.Len(t, partial, 1)
+	assert.Len(t, unloaded, 2)
+
+	t.Run("should return the blocks still failing", func(t *testing.T) {
+		gets := bkt.gets.Load()
+
+		retried, failed := f.RetryFailed(ctx, unloaded)
+		assert.Empty(t, retried)
+		assert.Len(t, failed, 2)
+		assert.Contains(t, failed, ULID(1))
+		assert.Contains(t, failed, ULID(2))
+
+		// Only the failed blocks have been retried.
+		assert.Equal(t, gets+2, bkt.gets.Load())
+	})
+
+	t.Run("should load the previously failed blocks and cache them", func(t *testing.T) {
+		failing.Store(false)
+		gets := bkt.gets.Load()
+
+		retried, failed := f.RetryFailed(ctx, unloaded)
+		assert.Empty(t, failed)
+		assert.Len(t, retried, 2)
+		assert.Contains(t, retried, ULID(1))
+		assert.Contains(t, retried, ULID(2))
+		assert.Equal(t, gets+2, bkt.gets.Load())
+
+		// The next fetch succeeds, serving the retried blocks from the cache.
+		metas, partial, err := f.Fetch(ctx)
+		require.NoError(t, err)
+		assert.Len(t, metas, 4)
+		assert.Len(t, partial, 1)
+		assert.Equal(t, gets+2+2, bkt.gets.Load())
+	})
+}
+
+func TestMetaFetcher_MetaAttributesCheck(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bkt := &getCountingBucket{Bucket: objstore.NewInMemBucket(), onGet: func(string) error { return nil }}
+
+	newFetcher := func() *MetaFetcher {
+		f, err := NewMetaFetcher(log.NewNopLogger(), 1, objstore.WithNoopInstr(bkt), dir, 0, nil, nil, WithMetaAttributesCheck())
+		require.NoError(t, err)
+		return f
+	}
+
+	fetchNumSeries := func(f *MetaFetcher) uint64 {
+		metas, _, err := f.Fetch(ctx)
+		require.NoError(t, err)
+		require.Len(t, metas, 1)
+		return metas[ULID(1)].Stats.NumSeries
+	}
+
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1, Stats: tsdb.BlockStats{NumSeries: 1}}})
+
+	f := newFetcher()
+	assert.Equal(t, uint64(1), fetchNumSeries(f))
+	assert.Equal(t, int64(1), bkt.gets.Load())
+
+	// The meta.json is served from the in-memory cache while it doesn't change in the bucket.
+	assert.Equal(t, uint64(1), fetchNumSeries(f))
+	assert.Equal(t, int64(1), bkt.gets.Load())
+
+	// The meta.json is served from the disk cache to a new fetcher while it doesn't change in the bucket.
+	assert.Equal(t, uint64(1), fetchNumSeries(newFetcher()))
+	assert.Equal(t, int64(1), bkt.gets.Load())
+
+	// Overwrite the meta.json in the bucket.
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1, Stats: tsdb.BlockStats{NumSeries: 1000}}})
+
+	// The changed attributes force a re-download, bypassing the in-memory cache.
+	assert.Equal(t, uint64(1000), fetchNumSeries(f))
+	assert.Equal(t, int64(2), bkt.gets.Load())
+
+	// Overwrite the meta.json in the bucket again.
+	uploadMeta(t, bkt, &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ULID(1), Version: metadata.TSDBVersion1, Stats: tsdb.BlockStats{NumSeries: 100000}}})
+
+	// The changed attributes force a re-download, bypassing the disk cache.
+	assert.Equal(t, uint64(100000), fetchNumSeries(newFetcher()))
+	assert.Equal(t, int64(3), bkt.gets.Load())
+}
+
+func uploadMeta(t *testing.T, bkt objstore.Bucket, meta *metadata.Meta) {
+	var buf bytes.Buffer
+	require.NoError(t, meta.Write(&buf))
+	require.NoError(t, bkt.Upload(context.Background(), path.Join(meta.ULID.String(), metadata.MetaFilename), &buf))
+}
+
+func copyMetas(in map[ulid.ULID]*metadata.Meta) map[ulid.ULID]*metadata.Meta {
+	out := make(map[ulid.ULID]*metadata.Meta, len(in))
+	for id, m := range in {
+		out[id] = m
+	}
+	return out
+}
@@ -168,7 +168,7 @@ func TestUpdater_UpdateIndex_NoTenantInTheBucket(t *testing.T) {
 		idx, partials, err := w.UpdateIndex(ctx, oldIdx)
 
 		require.NoError(t, err)
-		assert.Equal(t, IndexVersion2, idx.Version)
+		assert.Equal(t, IndexVersion3, idx.Version)
 		assert.InDelta(t, time.Now().Unix(), idx.UpdatedAt, 2)
 		assert.Len(t, idx.Blocks, 0)
 		assert.Len(t, idx.BlockDeletionMarks, 0)
@@ -199,7 +199,7 @@ func TestUpdater_UpdateIndexFromVersion1ToVersion2(t *testing.T) {
 	require.Equal(t, "1_of_4", block1.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel])
 	require.Equal(t, "3_of_4", block2.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel])
 
-	// Generate index (this produces V2 index, with compactor shard IDs).
+	// Generate index (this produces V3 index, with compactor shard IDs).
 	w := NewUpdater(bkt, userID, nil, logger)
 	returnedIdx, _, err := w.UpdateIndex(ctx, nil)
 	require.NoError(t, err)
@@ -229,6 +229,37 @@ func TestUpdater_UpdateIndexFromVersion1ToVersion2(t *testing.T) {
 		[]*metadata.DeletionMark{})
 }
 
+func TestUpdater_UpdateIndexFromVersion2ToVersion3(t *testing.T) {
+	const userID = "user-1"
+
+	bkt, _ := testutil.PrepareFilesystemBucket(t)
+
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	bkt = BucketWithGlobalMarkers(bkt)
+	block1 := testutil.MockStorageBlockWithExtLabels(t, bkt, userID, 10, 20, nil)
+	block2 := testutil.MockStorageBlockWithExtLabels(t, bkt, userID, 20, 30, nil)
+	require.Equal(t, 1, block1.Compaction.Level)
+	require.Equal(t, 1, block2.Compaction.Level)
+
+	// Generate index, and remove the compaction levels, which aren't in V2 indexes.
+	w := NewUpdater(bkt, userID, nil, logger)
+	returnedIdx, _, err := w.UpdateIndex(ctx, nil)
+	require.NoError(t, err)
+	for _, b := range returnedIdx.Blocks {
+		b.CompactionLevel = 0
+	}
+	returnedIdx.Version = IndexVersion2
+
+	// Rerunning updater should rebuild index from scratch.
+	returnedIdx, _, err = w.UpdateIndex(ctx, returnedIdx)
+	require.NoError(t, err)
+	assertBucketIndexEqual(t, returnedIdx, bkt, userID,
+		[]metadata.Meta{block1, block2}, // Compaction levels are back.
+		[]*metadata.DeletionMark{})
+}
+
 func getBlockUploadedAt(t testing.TB, bkt objstore.Bucket, userID string, blockID ulid.ULID) int64 {
 	metaFile := path.Join(userID, blockID.String(), block.MetaFilename)
 
@@ -239,7 +270,7 @@ func getBlockUploadedAt(t testing.TB, bkt objstore.Bucket, userID string, blockI
 }
 
 func assertBucketIndexEqual(t testing.TB, idx *Index, bkt objstore.Bucket, userID string, expectedBlocks []metadata.Meta, expectedDeletionMarks []*metadata.DeletionMark) {
-	assert.Equal(t, IndexVersion2, idx.Version)
+	assert.Equal(t, IndexVersion3, idx.Version)
 	assert.InDelta(t, time.Now().Unix(), idx.UpdatedAt, 2)
 
 	// Build the list of expected block index entries.
@@ -251,6 +282,7 @@ func assertBucketIndexEqual(t testing.TB, idx *Index, bkt objstore.Bucket, userI
 			MaxTime:          b.MaxTime,
 			UploadedAt:       getBlockUploadedAt(t, bkt, userID, b.ULID),
 			CompactorShardID: b.Thanos.Labels[mimir_tsdb.CompactorShardIDExternalLabel],
+			CompactionLevel:  b.Compaction.Level,
 		})
 	}
 
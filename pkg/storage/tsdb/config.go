@@ -112,6 +112,7 @@ var (
 	errInvalidWALReplayConcurrency  = errors.New("invalid TSDB WAL replay concurrency")
 	errInvalidStripeSize            = errors.New("invalid TSDB stripe size")
 	errInvalidStreamingBatchSize    = errors.New("invalid store-gateway streaming batch size")
+	errInvalidMaxFailedMetasRatio   = errors.New("invalid bucket store max failed metas ratio, must be between 0 and 1")
 	errEmptyBlockranges             = errors.New("empty block ranges for TSDB")
 )
 
@@ -334,19 +335,24 @@ func (cfg *TSDBConfig) IsBlocksShippingEnabled() bool {
 
 // BucketStoreConfig holds the config information for Bucket Stores used by the querier and store-gateway.
 type BucketStoreConfig struct {
-	SyncDir                    string              `yaml:"sync_dir"`
-	SyncInterval               time.Duration       `yaml:"sync_interval" category:"advanced"`
-	MaxConcurrent              int                 `yaml:"max_concurrent" category:"advanced"`
-	TenantSyncConcurrency      int                 `yaml:"tenant_sync_concurrency" category:"advanced"`
-	BlockSyncConcurrency       int                 `yaml:"block_sync_concurrency" category:"advanced"`
-	MetaSyncConcurrency        int                 `yaml:"meta_sync_concurrency" category:"advanced"`
-	DeprecatedConsistencyDelay time.Duration       `yaml:"consistency_delay" category:"deprecated"` // Deprecated. Remove in Mimir 2.9.
-	IndexCache                 IndexCacheConfig    `yaml:"index_cache"`
-	ChunksCache                ChunksCacheConfig   `yaml:"chunks_cache"`
-	MetadataCache              MetadataCacheConfig `yaml:"metadata_cache"`
-	IgnoreDeletionMarksDelay   time.Duration       `yaml:"ignore_deletion_mark_delay" category:"advanced"`
-	BucketIndex                BucketIndexConfig   `yaml:"bucket_index"`
-	IgnoreBlocksWithin         time.Duration       `yaml:"ignore_blocks_within" category:"advanced"`
+	SyncDir                     string              `yaml:"sync_dir"`
+	SyncInterval                time.Duration       `yaml:"sync_interval" category:"advanced"`
+	MaxConcurrent               int                 `yaml:"max_concurrent" category:"advanced"`
+	TenantSyncConcurrency       int                 `yaml:"tenant_sync_concurrency" category:"advanced"`
+	BlockSyncConcurrency        int                 `yaml:"block_sync_concurrency" category:"advanced"`
+	MetaSyncConcurrency         int                 `yaml:"meta_sync_concurrency" category:"advanced"`
+	MetaSyncMaxFailedMetas      int                 `yaml:"meta_sync_max_failed_metas" category:"experimental"`
+	MetaSyncMaxFailedMetasRatio float64             `yaml:"meta_sync_max_failed_metas_ratio" category:"experimental"`
+	MetaSyncBatchSize           int                 `yaml:"meta_sync_batch_size" category:"experimental"`
+	MetaSyncSoftTimeout         time.Duration       `yaml:"meta_sync_soft_timeout" category:"experimental"`
+	MetaSyncCacheTTL            time.Duration       `yaml:"meta_sync_cache_ttl" category:"experimental"`
+	DeprecatedConsistencyDelay  time.Duration       `yaml:"consistency_delay" category:"deprecated"` // Deprecated. Remove in Mimir 2.9.
+	IndexCache                  IndexCacheConfig    `yaml:"index_cache"`
+	ChunksCache                 ChunksCacheConfig   `yaml:"chunks_cache"`
+	MetadataCache               MetadataCacheConfig `yaml:"metadata_cache"`
+	IgnoreDeletionMarksDelay    time.Duration       `yaml:"ignore_deletion_mark_delay" category:"advanced"`
+	BucketIndex                 BucketIndexConfig   `yaml:"bucket_index"`
+	IgnoreBlocksWithin          time.Duration       `yaml:"ignore_blocks_within" category:"advanced"`
 
 	// Chunk pool.
 	DeprecatedMaxChunkPoolBytes           uint64 `yaml:"max_chunk_pool_bytes" category:"deprecated"`             // Deprecated. TODO: Remove in Mimir 2.11.
@@ -410,6 +416,11 @@ func (cfg *BucketStoreConfig) RegisterFlags(f *flag.FlagSet, logger log.Logger)
 	f.IntVar(&cfg.TenantSyncConcurrency, "blocks-storage.bucket-store.tenant-sync-concurrency", 10, "Maximum number of concurrent tenants synching blocks.")
 	f.IntVar(&cfg.BlockSyncConcurrency, "blocks-storage.bucket-store.block-sync-concurrency", 20, "Maximum number of concurrent blocks synching per tenant.")
 	f.IntVar(&cfg.MetaSyncConcurrency, "blocks-storage.bucket-store.meta-sync-concurrency", 20, "Number of Go routines to use when syncing block meta files from object storage per tenant.")
+	f.IntVar(&cfg.MetaSyncMaxFailedMetas, "blocks-storage.bucket-store.meta-sync-max-failed-metas", 0, "Maximum number of block meta files of a tenant which can fail to load from object storage without failing the whole sync. The blocks whose meta file failed to load are retried on the next sync. 0 to not tolerate any failure, unless -blocks-storage.bucket-store.meta-sync-max-failed-metas-ratio is set. This option is used only when the bucket index is disabled.")
+	f.Float64Var(&cfg.MetaSyncMaxFailedMetasRatio, "blocks-storage.bucket-store.meta-sync-max-failed-metas-ratio", 0, "Maximum ratio, out of all the blocks of a tenant, of block meta files which can fail to load from object storage without failing the whole sync. 0 to not tolerate any failure, unless -blocks-storage.bucket-store.meta-sync-max-failed-metas is set. This option is used only when the bucket index is disabled.")
+	f.IntVar(&cfg.MetaSyncBatchSize, "blocks-storage.bucket-store.meta-sync-batch-size", 0, "Maximum number of blocks of a tenant whose meta file is synced from object storage at once. 0 to sync all blocks at once. This option is used only when the bucket index is disabled.")
+	f.DurationVar(&cfg.MetaSyncSoftTimeout, "blocks-storage.bucket-store.meta-sync-soft-timeout", 0, "Time after which the sync of the block meta files of a tenant stops loading new meta files, and uses the ones loaded so far. The blocks whose meta file hasn't been loaded are synced on the next sync. 0 to disable. This option is used only when the bucket index is disabled.")
+	f.DurationVar(&cfg.MetaSyncCacheTTL, "blocks-storage.bucket-store.meta-sync-cache-ttl", 0, "Max time a cached block meta file is used before being read again from the object storage. This bounds how stale the cached meta files can be when syncs repeatedly fail to load some of them. 0 to disable. This option is used only when the bucket index is disabled.")
 	f.DurationVar(&cfg.DeprecatedConsistencyDelay, consistencyDelayFlag, 0, "Minimum age of a block before it's being read. Set it to safe value (e.g 30m) if your object storage is eventually consistent. GCS and S3 are (roughly) strongly consistent.")
 	f.DurationVar(&cfg.IgnoreDeletionMarksDelay, "blocks-storage.bucket-store.ignore-deletion-marks-delay", time.Hour*1, "Duration after which the blocks marked for deletion will be filtered out while fetching blocks. "+
 		"The idea of ignore-deletion-marks-delay is to ignore blocks that are marked for deletion with some delay. This ensures store can still serve blocks that are meant to be deleted but do not have a replacement yet.")
@@ -428,6 +439,9 @@ func (cfg *BucketStoreConfig) Validate(logger log.Logger) error {
 	if cfg.StreamingBatchSize <= 0 {
 		return errInvalidStreamingBatchSize
 	}
+	if cfg.MetaSyncMaxFailedMetasRatio < 0 || cfg.MetaSyncMaxFailedMetasRatio > 1 {
+		return errInvalidMaxFailedMetasRatio
+	}
 	if err := cfg.IndexCache.Validate(); err != nil {
 		return errors.Wrap(err, "index-cache configuration")
 	}
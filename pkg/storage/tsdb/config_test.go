@@ -127,6 +127,18 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: errInvalidStreamingBatchSize,
 		},
+		"should fail on negative max failed metas ratio": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.MetaSyncMaxFailedMetasRatio = -0.1
+			},
+			expectedErr: errInvalidMaxFailedMetasRatio,
+		},
+		"should fail on max failed metas ratio greater than 1": {
+			setup: func(cfg *BlocksStorageConfig) {
+				cfg.BucketStore.MetaSyncMaxFailedMetasRatio = 1.5
+			},
+			expectedErr: errInvalidMaxFailedMetasRatio,
+		},
 	}
 
 	for testName, testData := range tests {
@@ -37,6 +37,7 @@ const (
 	CompactorSource       SourceType = "compactor"
 	CompactorRepairSource SourceType = "compactor.repair"
 	BucketRepairSource    SourceType = "bucket.repair"
+	UploadSource          SourceType = "upload"
 	TestSource            SourceType = "test"
 )
 
@@ -74,6 +75,10 @@ type Thanos struct {
 	// Source is a real upload source of the block.
 	Source SourceType `json:"source"`
 
+	// OriginSource is the source of the blocks merged by the compactor into this block, when all of them
+	// originate from the same source. It's carried over by further compactions. Optional.
+	OriginSource SourceType `json:"origin_source,omitempty"`
+
 	// List of segment files (in chunks directory), in sorted order. Optional.
 	// Deprecated. Use Files instead.
 	SegmentFiles []string `json:"segment_files,omitempty"`
@@ -86,6 +91,24 @@ type Thanos struct {
 
 	// Rewrites is present when any rewrite (deletion, relabel etc) were applied to this block. Optional.
 	Rewrites []Rewrite `json:"rewrites,omitempty"`
+
+	// SourceBlocks summarizes the blocks merged into this block by the compactor. Optional.
+	SourceBlocks *SourceBlocks `json:"source_blocks,omitempty"`
+
+	// CompactorVersion is the version of the compactor which created this block. Optional.
+	CompactorVersion string `json:"compactor_version,omitempty"`
+
+	// CompactionStrategy is the name of the compaction strategy which created this block. Optional.
+	CompactionStrategy string `json:"compaction_strategy,omitempty"`
+}
+
+// SourceBlocks summarizes the blocks merged by a compaction.
+type SourceBlocks struct {
+	// Count is the number of blocks merged.
+	Count int `json:"count"`
+	// MinLevel and MaxLevel are the lowest and highest compaction level of the blocks merged.
+	MinLevel int `json:"min_level"`
+	MaxLevel int `json:"max_level"`
 }
 
 type Rewrite struct {
@@ -99,6 +122,15 @@ type Rewrite struct {
 
 type Matchers []*labels.Matcher
 
+// GetOriginSource returns the source the block originates from: for blocks created by the compactor, it's
+// the source of the blocks merged into it, if known.
+func (t *Thanos) GetOriginSource() SourceType {
+	if t.Source == CompactorSource && t.OriginSource != "" {
+		return t.OriginSource
+	}
+	return t.Source
+}
+
 func (m *Matchers) UnmarshalYAML(value *yaml.Node) (err error) {
 	*m, err = parser.ParseMetricSelector(value.Value)
 	if err != nil {
@@ -118,7 +150,20 @@ type File struct {
 	// SizeBytes is optional (e.g meta.json does not show size).
 	SizeBytes int64 `json:"size_bytes,omitempty"`
 
-	// The json field "hash" is reserved because it is used by Thanos for the file hash.
+	// Hash is optional, and uses the same format as the file hash of Thanos.
+	Hash *ObjectHash `json:"hash,omitempty"`
+}
+
+// HashFunc is the function used to compute the hash of a block file.
+type HashFunc string
+
+// SHA256Func is the SHA-256 hash function.
+const SHA256Func HashFunc = "SHA256"
+
+// ObjectHash is the hash of a block file, hex encoded.
+type ObjectHash struct {
+	Func  HashFunc `json:"hashFunc"`
+	Value string   `json:"value"`
 }
 
 type ThanosDownsample struct {
@@ -292,7 +292,7 @@ func (s *BucketStore) Stats() BucketStoreStats {
 // SyncBlocks synchronizes the stores state with the Bucket bucket.
 // It will reuse disk space as persistent cache based on s.dir param.
 func (s *BucketStore) SyncBlocks(ctx context.Context) error {
-	metas, _, metaFetchErr := s.fetcher.Fetch(ctx)
+	metas, unloaded, metaFetchErr := s.fetchMetas(ctx)
 	// For partial view allow adding new blocks at least.
 	if metaFetchErr != nil && metas == nil {
 		return metaFetchErr
@@ -330,11 +330,15 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 		return metaFetchErr
 	}
 
-	// Drop all blocks that are no longer present in the bucket.
+	// Drop all blocks that are no longer present in the bucket. The blocks whose meta.json hasn't
+	// been loaded may still be in the bucket, so they're kept as they are until the next sync.
 	for id := range s.blocks {
 		if _, ok := metas[id]; ok {
 			continue
 		}
+		if _, ok := unloaded[id]; ok {
+			continue
+		}
 		if err := s.removeBlock(id); err != nil {
 			level.Warn(s.logger).Log("msg", "drop of outdated block failed", "block", id, "err", err)
 		}
@@ -344,6 +348,18 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 	return nil
 }
 
+// fetchMetas returns the metas of the blocks in the bucket and, if the fetcher supports it, the blocks
+// whose meta.json hasn't been loaded.
+func (s *BucketStore) fetchMetas(ctx context.Context) (map[ulid.ULID]*metadata.Meta, map[ulid.ULID]error, error) {
+	if f, ok := s.fetcher.(block.MetadataFetcherWithUnloaded); ok {
+		metas, _, unloaded, err := f.FetchWithUnloaded(ctx)
+		return metas, unloaded, err
+	}
+
+	metas, _, err := s.fetcher.Fetch(ctx)
+	return metas, nil, err
+}
+
 // InitialSync perform blocking sync with extra step at the end to delete locally saved blocks that are no longer
 // present in the bucket. The mismatch of these can only happen between restarts, so we can do that only once per startup.
 func (s *BucketStore) InitialSync(ctx context.Context) error {
@@ -57,7 +57,7 @@ func TestBucketIndexMetadataFetcher_Fetch(t *testing.T) {
 
 	// Create a metadata fetcher with filters.
 	filters := []block.MetadataFilter{
-		NewIgnoreDeletionMarkFilter(logger, bucket.NewUserBucketClient(userID, bkt, nil), 2*time.Hour, 1),
+		NewIgnoreDeletionMarkFilter(logger, bucket.NewUserBucketClient(userID, bkt, nil), 2*time.Hour, 1, nil),
 		newMinTimeMetaFilter(1 * time.Hour),
 	}
 
@@ -82,16 +82,21 @@ func TestBucketIndexMetadataFetcher_Fetch(t *testing.T) {
 
 		# HELP blocks_meta_synced Number of block metadata synced
 		# TYPE blocks_meta_synced gauge
+		blocks_meta_synced{state="below-min-compaction-level"} 0
+		blocks_meta_synced{state="compactor-version-excluded"} 0
 		blocks_meta_synced{state="corrupted-bucket-index"} 0
 		blocks_meta_synced{state="corrupted-meta-json"} 0
 		blocks_meta_synced{state="duplicate"} 0
+		blocks_meta_synced{state="empty"} 0
 		blocks_meta_synced{state="failed"} 0
+		blocks_meta_synced{state="incomplete"} 0
 		blocks_meta_synced{state="label-excluded"} 0
 		blocks_meta_synced{state="loaded"} 2
 		blocks_meta_synced{state="marked-for-deletion"} 1
 		blocks_meta_synced{state="marked-for-no-compact"} 0
 		blocks_meta_synced{state="no-bucket-index"} 0
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="over-max-duration"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="min-time-excluded"} 1
 		blocks_meta_synced{state="too-fresh"} 0
@@ -134,16 +139,21 @@ func TestBucketIndexMetadataFetcher_Fetch_NoBucketIndex(t *testing.T) {
 
 		# HELP blocks_meta_synced Number of block metadata synced
 		# TYPE blocks_meta_synced gauge
+		blocks_meta_synced{state="below-min-compaction-level"} 0
+		blocks_meta_synced{state="compactor-version-excluded"} 0
 		blocks_meta_synced{state="corrupted-bucket-index"} 0
 		blocks_meta_synced{state="corrupted-meta-json"} 0
 		blocks_meta_synced{state="duplicate"} 0
+		blocks_meta_synced{state="empty"} 0
 		blocks_meta_synced{state="failed"} 0
+		blocks_meta_synced{state="incomplete"} 0
 		blocks_meta_synced{state="label-excluded"} 0
 		blocks_meta_synced{state="loaded"} 0
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
 		blocks_meta_synced{state="no-bucket-index"} 1
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="over-max-duration"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="min-time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
@@ -189,16 +199,21 @@ func TestBucketIndexMetadataFetcher_Fetch_CorruptedBucketIndex(t *testing.T) {
 
 		# HELP blocks_meta_synced Number of block metadata synced
 		# TYPE blocks_meta_synced gauge
+		blocks_meta_synced{state="below-min-compaction-level"} 0
+		blocks_meta_synced{state="compactor-version-excluded"} 0
 		blocks_meta_synced{state="corrupted-bucket-index"} 1
 		blocks_meta_synced{state="corrupted-meta-json"} 0
 		blocks_meta_synced{state="duplicate"} 0
+		blocks_meta_synced{state="empty"} 0
 		blocks_meta_synced{state="failed"} 0
+		blocks_meta_synced{state="incomplete"} 0
 		blocks_meta_synced{state="label-excluded"} 0
 		blocks_meta_synced{state="loaded"} 0
 		blocks_meta_synced{state="marked-for-deletion"} 0
 		blocks_meta_synced{state="marked-for-no-compact"} 0
 		blocks_meta_synced{state="no-bucket-index"} 0
 		blocks_meta_synced{state="no-meta-json"} 0
+		blocks_meta_synced{state="over-max-duration"} 0
 		blocks_meta_synced{state="time-excluded"} 0
 		blocks_meta_synced{state="min-time-excluded"} 0
 		blocks_meta_synced{state="too-fresh"} 0
@@ -421,7 +421,7 @@ func (u *BucketStores) getOrCreateStore(userID string) (*BucketStore, error) {
 		block.NewConsistencyDelayMetaFilter(userLogger, u.cfg.BucketStore.DeprecatedConsistencyDelay, fetcherReg),
 		newMinTimeMetaFilter(u.cfg.BucketStore.IgnoreBlocksWithin),
 		// Use our own custom implementation.
-		NewIgnoreDeletionMarkFilter(userLogger, userBkt, u.cfg.BucketStore.IgnoreDeletionMarksDelay, u.cfg.BucketStore.MetaSyncConcurrency),
+		NewIgnoreDeletionMarkFilter(userLogger, userBkt, u.cfg.BucketStore.IgnoreDeletionMarksDelay, u.cfg.BucketStore.MetaSyncConcurrency, fetcherReg),
 		// The duplicate filter has been intentionally omitted because it could cause troubles with
 		// the consistency check done on the querier. The duplicate filter removes redundant blocks
 		// but if the store-gateway removes redundant blocks before the querier discovers them, the
@@ -446,8 +446,12 @@ func (u *BucketStores) getOrCreateStore(userID string) (*BucketStore, error) {
 			u.cfg.BucketStore.MetaSyncConcurrency,
 			userBkt,
 			u.syncDirForUser(userID), // The fetcher stores cached metas in the "meta-syncer/" sub directory
+			u.cfg.BucketStore.MetaSyncCacheTTL,
 			fetcherReg,
 			filters,
+			block.WithFailedMetasTolerance(u.cfg.BucketStore.MetaSyncMaxFailedMetas, u.cfg.BucketStore.MetaSyncMaxFailedMetasRatio),
+			block.WithFetchBatchSize(u.cfg.BucketStore.MetaSyncBatchSize),
+			block.WithFetchSoftTimeout(u.cfg.BucketStore.MetaSyncSoftTimeout),
 		)
 		if err != nil {
 			return nil, err
@@ -147,8 +147,11 @@ func TestBucketStores_InitialSyncShouldRetryOnFailure(t *testing.T) {
 	bucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
 	require.NoError(t, err)
 
-	// Wrap the bucket to fail the 1st Get() request.
-	bucket = &failFirstGetBucket{Bucket: bucket}
+	// Wrap the bucket to fail the first Get() requests, more than the retries of the meta.json loading,
+	// so that the first sync fails.
+	failingBucket := &failFirstGetsBucket{Bucket: bucket}
+	failingBucket.failures.Store(4)
+	bucket = failingBucket
 
 	reg := prometheus.NewPedanticRegistry()
 	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), bucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
@@ -266,6 +269,65 @@ func TestBucketStores_SyncBlocks(t *testing.T) {
 	assert.Greater(t, testutil.ToFloat64(stores.syncLastSuccess), float64(0))
 }
 
+func TestBucketStores_SyncBlocksShouldKeepBlocksWhoseMetaFailedToLoadWithinTolerance(t *testing.T) {
+	test.VerifyNoLeak(t)
+
+	const (
+		userID     = "user-1"
+		metricName = "series_1"
+	)
+
+	ctx := context.Background()
+	cfg := prepareStorageConfig(t)
+	cfg.BucketStore.MetaSyncMaxFailedMetas = 1
+
+	storageDir := t.TempDir()
+	generateStorageBlock(t, storageDir, userID, metricName, 10, 100, 15)
+
+	fsBucket, err := filesystem.NewBucketClient(filesystem.Config{Directory: storageDir})
+	require.NoError(t, err)
+
+	// Wrap the bucket to fail checking the meta.json of the blocks, once enabled.
+	failing := atomic.NewBool(false)
+	injectedBucket := &bucket.ErrorInjectedBucketClient{
+		Bucket: fsBucket,
+		Injector: func(op bucket.Operation, name string) error {
+			if failing.Load() && op == bucket.OpExists && strings.HasSuffix(name, "/"+metadata.MetaFilename) {
+				return errors.New("mocked error")
+			}
+			return nil
+		},
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	stores, err := NewBucketStores(cfg, newNoShardingStrategy(), injectedBucket, defaultLimitsOverrides(t), log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, stores.InitialSync(ctx))
+
+	// The meta.json of the loaded block fails to load within the tolerance: the block is kept loaded.
+	failing.Store(true)
+	require.NoError(t, stores.SyncBlocks(ctx))
+
+	seriesSet, warnings, err := querySeries(t, stores, userID, metricName, 20, 40)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	require.Len(t, seriesSet, 1)
+	assert.Equal(t, []mimirpb.LabelAdapter{{Name: labels.MetricName, Value: metricName}}, seriesSet[0].Labels)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_bucket_store_blocks_loaded Number of currently loaded blocks.
+			# TYPE cortex_bucket_store_blocks_loaded gauge
+			cortex_bucket_store_blocks_loaded 1
+
+			# HELP cortex_bucket_store_block_drops_total Total number of local blocks that were dropped.
+			# TYPE cortex_bucket_store_block_drops_total counter
+			cortex_bucket_store_block_drops_total 0
+	`),
+		"cortex_bucket_store_blocks_loaded",
+		"cortex_bucket_store_block_drops_total",
+	))
+}
+
 func TestBucketStores_syncUsersBlocks(t *testing.T) {
 	test.VerifyNoLeak(t)
 
@@ -770,15 +832,16 @@ func (u *userShardingStrategy) FilterBlocks(ctx context.Context, userID string,
 	return nil
 }
 
-// failFirstGetBucket is an objstore.Bucket wrapper which fails the first Get() request with a mocked error.
-type failFirstGetBucket struct {
+// failFirstGetsBucket is an objstore.Bucket wrapper which fails the first Get() requests with a mocked error.
+type failFirstGetsBucket struct {
 	objstore.Bucket
 
-	firstGet atomic.Bool
+	// Number of Get() requests still to fail.
+	failures atomic.Int64
 }
 
-func (f *failFirstGetBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
-	if f.firstGet.CompareAndSwap(false, true) {
+func (f *failFirstGetsBucket) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if f.failures.Dec() >= 0 {
 		return nil, errors.New("Get() request mocked error")
 	}
 
@@ -11,6 +11,8 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/thanos-io/objstore"
 
@@ -31,13 +33,23 @@ type IgnoreDeletionMarkFilter struct {
 
 	delay           time.Duration
 	deletionMarkMap map[ulid.ULID]*metadata.DeletionMark
+
+	// The blocks found marked for deletion in the previous sync, nil before the first sync.
+	previouslyMarked map[ulid.ULID]struct{}
+	newlyMarked      prometheus.Counter
 }
 
 // NewIgnoreDeletionMarkFilter creates IgnoreDeletionMarkFilter.
-func NewIgnoreDeletionMarkFilter(logger log.Logger, bkt objstore.InstrumentedBucketReader, delay time.Duration, concurrency int) *IgnoreDeletionMarkFilter {
+func NewIgnoreDeletionMarkFilter(logger log.Logger, bkt objstore.InstrumentedBucketReader, delay time.Duration, concurrency int, reg prometheus.Registerer) *IgnoreDeletionMarkFilter {
 	return &IgnoreDeletionMarkFilter{
-		upstream: block.NewIgnoreDeletionMarkFilter(logger, bkt, delay, concurrency),
+		// The newly marked blocks are tracked by this filter, because the upstream one doesn't see
+		// the deletion marks when filtering with the bucket index.
+		upstream: block.NewIgnoreDeletionMarkFilter(logger, bkt, delay, concurrency, nil),
 		delay:    delay,
+		newlyMarked: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "blocks_meta_newly_marked_for_deletion_total",
+			Help: "Total number of blocks found marked for deletion which were not marked for deletion in the previous sync.",
+		}),
 	}
 }
 
@@ -54,7 +66,12 @@ func (f *IgnoreDeletionMarkFilter) DeletionMarkBlocks() map[ulid.ULID]*metadata.
 
 // Filter implements block.MetadataFilter.
 func (f *IgnoreDeletionMarkFilter) Filter(ctx context.Context, metas map[ulid.ULID]*metadata.Meta, synced block.GaugeVec, modified block.GaugeVec) error {
-	return f.upstream.Filter(ctx, metas, synced, modified)
+	if err := f.upstream.Filter(ctx, metas, synced, modified); err != nil {
+		return err
+	}
+
+	f.trackNewlyMarked(f.upstream.DeletionMarkBlocks())
+	return nil
 }
 
 // FilterWithBucketIndex implements MetadataFilterWithBucketIndex.
@@ -67,6 +84,7 @@ func (f *IgnoreDeletionMarkFilter) FilterWithBucketIndex(_ context.Context, meta
 
 	// Keep it cached.
 	f.deletionMarkMap = marks
+	f.trackNewlyMarked(marks)
 
 	for _, mark := range marks {
 		if _, ok := metas[mark.ID]; !ok {
@@ -82,6 +100,24 @@ func (f *IgnoreDeletionMarkFilter) FilterWithBucketIndex(_ context.Context, meta
 	return nil
 }
 
+// trackNewlyMarked counts the blocks marked for deletion which were not marked in the previous sync.
+// Blocks marked for deletion before the first sync are not considered newly marked.
+func (f *IgnoreDeletionMarkFilter) trackNewlyMarked(marks map[ulid.ULID]*metadata.DeletionMark) {
+	marked := make(map[ulid.ULID]struct{}, len(marks))
+	for id := range marks {
+		marked[id] = struct{}{}
+
+		if f.previouslyMarked == nil {
+			continue
+		}
+		if _, ok := f.previouslyMarked[id]; !ok {
+			f.newlyMarked.Inc()
+		}
+	}
+
+	f.previouslyMarked = marked
+}
+
 const minTimeExcludedMeta = "min-time-excluded"
 
 // minTimeMetaFilter filters out blocks that contain the most recent data (based on block MinTime).
@@ -100,7 +100,7 @@ func testIgnoreDeletionMarkFilter(t *testing.T, bucketIndexEnabled bool) {
 	}
 
 	synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
-	f := NewIgnoreDeletionMarkFilter(logger, objstore.WithNoopInstr(userBkt), 48*time.Hour, 32)
+	f := NewIgnoreDeletionMarkFilter(logger, objstore.WithNoopInstr(userBkt), 48*time.Hour, 32, nil)
 
 	if bucketIndexEnabled {
 		require.NoError(t, f.FilterWithBucketIndex(ctx, inputMetas, idx, synced))
@@ -113,6 +113,43 @@ func testIgnoreDeletionMarkFilter(t *testing.T, bucketIndexEnabled bool) {
 	assert.Equal(t, expectedDeletionMarks, f.DeletionMarkBlocks())
 }
 
+func TestIgnoreDeletionMarkFilter_FilterWithBucketIndexShouldCountNewlyMarkedBlocks(t *testing.T) {
+	now := time.Now()
+	ctx := context.Background()
+	reg := prometheus.NewPedanticRegistry()
+	synced := extprom.NewTxGaugeVec(nil, prometheus.GaugeOpts{Name: "synced"}, []string{"state"})
+
+	bkt, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	f := NewIgnoreDeletionMarkFilter(log.NewNopLogger(), objstore.WithNoopInstr(bkt), time.Hour, 1, reg)
+
+	sync := func(marks ...*bucketindex.BlockDeletionMark) {
+		metas := map[ulid.ULID]*metadata.Meta{
+			ulid.MustNew(1, nil): {},
+			ulid.MustNew(2, nil): {},
+			ulid.MustNew(3, nil): {},
+		}
+		require.NoError(t, f.FilterWithBucketIndex(ctx, metas, &bucketindex.Index{BlockDeletionMarks: marks}, synced))
+	}
+
+	// The blocks marked for deletion before the first sync are not counted.
+	sync(&bucketindex.BlockDeletionMark{ID: ulid.MustNew(1, nil), DeletionTime: now.Unix()})
+	assert.Equal(t, 0.0, promtest.ToFloat64(f.newlyMarked))
+
+	sync(
+		&bucketindex.BlockDeletionMark{ID: ulid.MustNew(1, nil), DeletionTime: now.Unix()},
+		&bucketindex.BlockDeletionMark{ID: ulid.MustNew(2, nil), DeletionTime: now.Unix()},
+	)
+	assert.Equal(t, 1.0, promtest.ToFloat64(f.newlyMarked))
+
+	// A block already marked in the previous sync isn't counted again.
+	sync(
+		&bucketindex.BlockDeletionMark{ID: ulid.MustNew(1, nil), DeletionTime: now.Unix()},
+		&bucketindex.BlockDeletionMark{ID: ulid.MustNew(2, nil), DeletionTime: now.Unix()},
+		&bucketindex.BlockDeletionMark{ID: ulid.MustNew(3, nil), DeletionTime: now.Unix()},
+	)
+	assert.Equal(t, 2.0, promtest.ToFloat64(f.newlyMarked))
+}
+
 func TestTimeMetaFilter(t *testing.T) {
 	now := time.Now()
 	limit := 10 * time.Minute
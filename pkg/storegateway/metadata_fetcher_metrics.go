@@ -18,11 +18,21 @@ type MetadataFetcherMetrics struct {
 	regs *dskit_metrics.TenantRegistries
 
 	// Exported metrics, gathered from Thanos MetaFetcher
-	syncs                *prometheus.Desc
-	syncFailures         *prometheus.Desc
-	syncDuration         *prometheus.Desc
-	syncConsistencyDelay *prometheus.Desc
-	synced               *prometheus.Desc
+	syncs                  *prometheus.Desc
+	syncFailures           *prometheus.Desc
+	syncDuration           *prometheus.Desc
+	syncConsistencyDelay   *prometheus.Desc
+	tenantConsistencyDelay *prometheus.Desc
+	synced                 *prometheus.Desc
+	blockSize              *prometheus.Desc
+	totalSeries            *prometheus.Desc
+	totalSamples           *prometheus.Desc
+	totalChunks            *prometheus.Desc
+	cacheHitRatio          *prometheus.Desc
+	filters                *prometheus.Desc
+	filtersDuration        *prometheus.Desc
+	loadDuration           *prometheus.Desc
+	newlyMarkedForDeletion *prometheus.Desc
 
 	// Ignored:
 	// blocks_meta_modified
@@ -51,10 +61,50 @@ func NewMetadataFetcherMetrics() *MetadataFetcherMetrics {
 			"cortex_blocks_meta_sync_consistency_delay_seconds",
 			"Configured consistency delay in seconds.",
 			nil, nil),
+		tenantConsistencyDelay: prometheus.NewDesc(
+			"cortex_blocks_meta_sync_tenant_consistency_delay_seconds",
+			"Consistency delay in seconds applied to the blocks of a tenant.",
+			[]string{"user"}, nil),
 		synced: prometheus.NewDesc(
 			"cortex_blocks_meta_synced",
 			"Reflects current state of synced blocks (over all tenants).",
 			[]string{"state"}, nil),
+		blockSize: prometheus.NewDesc(
+			"cortex_blocks_meta_block_size_bytes",
+			"Size of the blocks in bytes, observed when their metadata is loaded from the object storage.",
+			nil, nil),
+		totalSeries: prometheus.NewDesc(
+			"cortex_blocks_meta_total_series",
+			"Total number of series across all blocks loaded in the last synchronization of a tenant.",
+			[]string{"user"}, nil),
+		totalSamples: prometheus.NewDesc(
+			"cortex_blocks_meta_total_samples",
+			"Total number of samples across all blocks loaded in the last synchronization of a tenant.",
+			[]string{"user"}, nil),
+		totalChunks: prometheus.NewDesc(
+			"cortex_blocks_meta_total_chunks",
+			"Total number of chunks across all blocks loaded in the last synchronization of a tenant.",
+			[]string{"user"}, nil),
+		cacheHitRatio: prometheus.NewDesc(
+			"cortex_blocks_meta_cache_hit_ratio",
+			"Ratio of block metadata served from the in-memory or disk cache in the last synchronization of a tenant.",
+			[]string{"user"}, nil),
+		filters: prometheus.NewDesc(
+			"cortex_blocks_meta_filters",
+			"Number of metadata filters run in the last synchronization.",
+			nil, nil),
+		filtersDuration: prometheus.NewDesc(
+			"cortex_blocks_meta_filters_duration_seconds",
+			"Cumulative duration of the metadata filters run on each synchronization in seconds.",
+			nil, nil),
+		loadDuration: prometheus.NewDesc(
+			"cortex_blocks_meta_load_duration_seconds",
+			"Duration of the download of a single block meta.json from the object storage in seconds.",
+			nil, nil),
+		newlyMarkedForDeletion: prometheus.NewDesc(
+			"cortex_blocks_meta_newly_marked_for_deletion_total",
+			"Total number of blocks found marked for deletion which were not marked for deletion in the previous sync.",
+			nil, nil),
 	}
 }
 
@@ -71,7 +121,17 @@ func (m *MetadataFetcherMetrics) Describe(out chan<- *prometheus.Desc) {
 	out <- m.syncFailures
 	out <- m.syncDuration
 	out <- m.syncConsistencyDelay
+	out <- m.tenantConsistencyDelay
 	out <- m.synced
+	out <- m.blockSize
+	out <- m.totalSeries
+	out <- m.totalSamples
+	out <- m.totalChunks
+	out <- m.cacheHitRatio
+	out <- m.filters
+	out <- m.filtersDuration
+	out <- m.loadDuration
+	out <- m.newlyMarkedForDeletion
 }
 
 func (m *MetadataFetcherMetrics) Collect(out chan<- prometheus.Metric) {
@@ -81,5 +141,15 @@ func (m *MetadataFetcherMetrics) Collect(out chan<- prometheus.Metric) {
 	data.SendSumOfCounters(out, m.syncFailures, "blocks_meta_sync_failures_total")
 	data.SendSumOfHistograms(out, m.syncDuration, "blocks_meta_sync_duration_seconds")
 	data.SendMaxOfGauges(out, m.syncConsistencyDelay, "consistency_delay_seconds")
+	data.SendMaxOfGaugesPerTenant(out, m.tenantConsistencyDelay, "consistency_delay_seconds")
 	data.SendSumOfGaugesWithLabels(out, m.synced, "blocks_meta_synced", "state")
+	data.SendSumOfHistograms(out, m.blockSize, "blocks_meta_block_size_bytes")
+	data.SendSumOfGaugesPerTenant(out, m.totalSeries, "blocks_meta_total_series")
+	data.SendSumOfGaugesPerTenant(out, m.totalSamples, "blocks_meta_total_samples")
+	data.SendSumOfGaugesPerTenant(out, m.totalChunks, "blocks_meta_total_chunks")
+	data.SendMaxOfGaugesPerTenant(out, m.cacheHitRatio, "blocks_meta_cache_hit_ratio")
+	data.SendMaxOfGauges(out, m.filters, "blocks_meta_filters")
+	data.SendSumOfHistograms(out, m.filtersDuration, "blocks_meta_filters_duration_seconds")
+	data.SendSumOfHistograms(out, m.loadDuration, "blocks_meta_load_duration_seconds")
+	data.SendSumOfCounters(out, m.newlyMarkedForDeletion, "blocks_meta_newly_marked_for_deletion_total")
 }
@@ -48,13 +48,77 @@ func TestMetadataFetcherMetrics(t *testing.T) {
 
 		# HELP cortex_blocks_meta_sync_consistency_delay_seconds Configured consistency delay in seconds.
 		# TYPE cortex_blocks_meta_sync_consistency_delay_seconds gauge
-		cortex_blocks_meta_sync_consistency_delay_seconds 300
+		cortex_blocks_meta_sync_consistency_delay_seconds 420
+
+		# HELP cortex_blocks_meta_sync_tenant_consistency_delay_seconds Consistency delay in seconds applied to the blocks of a tenant.
+		# TYPE cortex_blocks_meta_sync_tenant_consistency_delay_seconds gauge
+		cortex_blocks_meta_sync_tenant_consistency_delay_seconds{user="user1"} 180
+		cortex_blocks_meta_sync_tenant_consistency_delay_seconds{user="user2"} 300
+		cortex_blocks_meta_sync_tenant_consistency_delay_seconds{user="user3"} 420
 
 		# HELP cortex_blocks_meta_synced Reflects current state of synced blocks (over all tenants).
 		# TYPE cortex_blocks_meta_synced gauge
 		cortex_blocks_meta_synced{state="corrupted-meta-json"} 75
 		cortex_blocks_meta_synced{state="loaded"} 90
 		cortex_blocks_meta_synced{state="too-fresh"} 105
+
+		# HELP cortex_blocks_meta_block_size_bytes Size of the blocks in bytes, observed when their metadata is loaded from the object storage.
+		# TYPE cortex_blocks_meta_block_size_bytes histogram
+		cortex_blocks_meta_block_size_bytes_bucket{le="1.048576e+06"} 0
+		cortex_blocks_meta_block_size_bytes_bucket{le="4.194304e+06"} 1
+		cortex_blocks_meta_block_size_bytes_bucket{le="1.6777216e+07"} 3
+		cortex_blocks_meta_block_size_bytes_bucket{le="+Inf"} 3
+		cortex_blocks_meta_block_size_bytes_sum 1.5728640e+07
+		cortex_blocks_meta_block_size_bytes_count 3
+
+		# HELP cortex_blocks_meta_total_series Total number of series across all blocks loaded in the last synchronization of a tenant.
+		# TYPE cortex_blocks_meta_total_series gauge
+		cortex_blocks_meta_total_series{user="user1"} 300
+		cortex_blocks_meta_total_series{user="user2"} 500
+		cortex_blocks_meta_total_series{user="user3"} 700
+
+		# HELP cortex_blocks_meta_total_samples Total number of samples across all blocks loaded in the last synchronization of a tenant.
+		# TYPE cortex_blocks_meta_total_samples gauge
+		cortex_blocks_meta_total_samples{user="user1"} 3000
+		cortex_blocks_meta_total_samples{user="user2"} 5000
+		cortex_blocks_meta_total_samples{user="user3"} 7000
+
+		# HELP cortex_blocks_meta_total_chunks Total number of chunks across all blocks loaded in the last synchronization of a tenant.
+		# TYPE cortex_blocks_meta_total_chunks gauge
+		cortex_blocks_meta_total_chunks{user="user1"} 30
+		cortex_blocks_meta_total_chunks{user="user2"} 50
+		cortex_blocks_meta_total_chunks{user="user3"} 70
+
+		# HELP cortex_blocks_meta_cache_hit_ratio Ratio of block metadata served from the in-memory or disk cache in the last synchronization of a tenant.
+		# TYPE cortex_blocks_meta_cache_hit_ratio gauge
+		cortex_blocks_meta_cache_hit_ratio{user="user1"} 0.3
+		cortex_blocks_meta_cache_hit_ratio{user="user2"} 0.5
+		cortex_blocks_meta_cache_hit_ratio{user="user3"} 0.7
+
+		# HELP cortex_blocks_meta_filters Number of metadata filters run in the last synchronization.
+		# TYPE cortex_blocks_meta_filters gauge
+		cortex_blocks_meta_filters 7
+
+		# HELP cortex_blocks_meta_filters_duration_seconds Cumulative duration of the metadata filters run on each synchronization in seconds.
+		# TYPE cortex_blocks_meta_filters_duration_seconds histogram
+		cortex_blocks_meta_filters_duration_seconds_bucket{le="0.001"} 0
+		cortex_blocks_meta_filters_duration_seconds_bucket{le="0.01"} 3
+		cortex_blocks_meta_filters_duration_seconds_bucket{le="0.1"} 3
+		cortex_blocks_meta_filters_duration_seconds_bucket{le="+Inf"} 3
+		cortex_blocks_meta_filters_duration_seconds_sum 0.015
+		cortex_blocks_meta_filters_duration_seconds_count 3
+
+		# HELP cortex_blocks_meta_load_duration_seconds Duration of the download of a single block meta.json from the object storage in seconds.
+		# TYPE cortex_blocks_meta_load_duration_seconds histogram
+		cortex_blocks_meta_load_duration_seconds_bucket{le="0.1"} 0
+		cortex_blocks_meta_load_duration_seconds_bucket{le="1"} 6
+		cortex_blocks_meta_load_duration_seconds_bucket{le="+Inf"} 6
+		cortex_blocks_meta_load_duration_seconds_sum 3
+		cortex_blocks_meta_load_duration_seconds_count 6
+
+		# HELP cortex_blocks_meta_newly_marked_for_deletion_total Total number of blocks found marked for deletion which were not marked for deletion in the previous sync.
+		# TYPE cortex_blocks_meta_newly_marked_for_deletion_total counter
+		cortex_blocks_meta_newly_marked_for_deletion_total 150
 `))
 	require.NoError(t, err)
 }
@@ -66,21 +130,42 @@ func populateMetadataFetcherMetrics(base float64) *prometheus.Registry {
 	m.syncs.Add(base * 1)
 	m.syncFailures.Add(base * 2)
 	m.syncDuration.Observe(3)
-	m.syncConsistencyDelay.Set(300)
+	m.syncConsistencyDelay.Set(base * 60)
 
 	m.synced.WithLabelValues("corrupted-meta-json").Set(base * 5)
 	m.synced.WithLabelValues("loaded").Set(base * 6)
 	m.synced.WithLabelValues("too-fresh").Set(base * 7)
 
+	m.blockSize.Observe(base * 1024 * 1024)
+
+	m.totalSeries.Set(base * 100)
+	m.totalSamples.Set(base * 1000)
+	m.totalChunks.Set(base * 10)
+	m.cacheHitRatio.Set(base / 10)
+	m.filters.Set(base)
+	m.filtersDuration.Observe(base / 1000)
+	m.loadDuration.Observe(0.2)
+	m.loadDuration.Observe(0.8)
+	m.newlyMarkedForDeletion.Add(base * 10)
+
 	return reg
 }
 
 type metadataFetcherMetricsMock struct {
-	syncs                prometheus.Counter
-	syncFailures         prometheus.Counter
-	syncDuration         prometheus.Histogram
-	syncConsistencyDelay prometheus.Gauge
-	synced               *prometheus.GaugeVec
+	syncs                  prometheus.Counter
+	syncFailures           prometheus.Counter
+	syncDuration           prometheus.Histogram
+	syncConsistencyDelay   prometheus.Gauge
+	synced                 *prometheus.GaugeVec
+	blockSize              prometheus.Histogram
+	totalSeries            prometheus.Gauge
+	totalSamples           prometheus.Gauge
+	totalChunks            prometheus.Gauge
+	cacheHitRatio          prometheus.Gauge
+	filters                prometheus.Gauge
+	filtersDuration        prometheus.Histogram
+	loadDuration           prometheus.Histogram
+	newlyMarkedForDeletion prometheus.Counter
 }
 
 func newMetadataFetcherMetricsMock(reg prometheus.Registerer) *metadataFetcherMetricsMock {
@@ -111,6 +196,54 @@ func newMetadataFetcherMetricsMock(reg prometheus.Registerer) *metadataFetcherMe
 		Name:      "synced",
 		Help:      "Number of block metadata synced",
 	}, []string{"state"})
+	m.blockSize = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Subsystem: "blocks_meta",
+		Name:      "block_size_bytes",
+		Help:      "Size of the blocks in bytes, observed when their metadata is loaded from the object storage",
+		Buckets:   []float64{1024 * 1024, 4 * 1024 * 1024, 16 * 1024 * 1024},
+	})
+	m.totalSeries = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: "blocks_meta",
+		Name:      "total_series",
+		Help:      "Total number of series across all loaded blocks",
+	})
+	m.totalSamples = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: "blocks_meta",
+		Name:      "total_samples",
+		Help:      "Total number of samples across all loaded blocks",
+	})
+	m.totalChunks = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: "blocks_meta",
+		Name:      "total_chunks",
+		Help:      "Total number of chunks across all loaded blocks",
+	})
+	m.cacheHitRatio = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: "blocks_meta",
+		Name:      "cache_hit_ratio",
+		Help:      "Ratio of block metadata served from the in-memory or disk cache, out of all block metadata loaded in the last synchronization",
+	})
+	m.filters = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Subsystem: "blocks_meta",
+		Name:      "filters",
+		Help:      "Number of metadata filters run in the last synchronization",
+	})
+	m.filtersDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Subsystem: "blocks_meta",
+		Name:      "filters_duration_seconds",
+		Help:      "Cumulative duration of the metadata filters run on each synchronization in seconds",
+		Buckets:   []float64{0.001, 0.01, 0.1},
+	})
+	m.loadDuration = promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+		Subsystem: "blocks_meta",
+		Name:      "load_duration_seconds",
+		Help:      "Duration of the download of a single block meta.json from the object storage in seconds",
+		Buckets:   []float64{0.1, 1},
+	})
+	m.newlyMarkedForDeletion = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+		Subsystem: "blocks_meta",
+		Name:      "newly_marked_for_deletion_total",
+		Help:      "Total number of blocks found marked for deletion which were not marked for deletion in the previous sync",
+	})
 
 	return &m
 }
@@ -198,3 +198,38 @@ func GetBlockSizeBytes(b *metadata.Meta) uint64 {
 	}
 	return size
 }
+
+// Gap is a time range not covered by any block. Like block time ranges, MinTime is inclusive and MaxTime is exclusive.
+type Gap struct {
+	MinTime int64
+	MaxTime int64
+}
+
+// FindGaps returns the time ranges not covered by any of the blocks, between the min time of the oldest block
+// and the max time of the newest one, sorted by time.
+func FindGaps(metas map[ulid.ULID]*metadata.Meta) []Gap {
+	blocks := make([]*metadata.Meta, 0, len(metas))
+	for _, b := range metas {
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].MinTime < blocks[j].MinTime
+	})
+
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	// The end of the time range covered so far. Overlapping and adjacent blocks extend it.
+	var gaps []Gap
+	coveredUntil := blocks[0].MaxTime
+	for _, b := range blocks[1:] {
+		if b.MinTime > coveredUntil {
+			gaps = append(gaps, Gap{MinTime: coveredUntil, MaxTime: b.MinTime})
+		}
+		if b.MaxTime > coveredUntil {
+			coveredUntil = b.MaxTime
+		}
+	}
+	return gaps
+}
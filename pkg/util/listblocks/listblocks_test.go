@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package listblocks
+
+import (
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/metadata"
+)
+
+func TestFindGaps(t *testing.T) {
+	newMetas := func(ranges ...[2]int64) map[ulid.ULID]*metadata.Meta {
+		metas := make(map[ulid.ULID]*metadata.Meta, len(ranges))
+		for i, r := range ranges {
+			id := ulid.MustNew(uint64(i), nil)
+			metas[id] = &metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: id, MinTime: r[0], MaxTime: r[1]}}
+		}
+		return metas
+	}
+
+	tests := map[string]struct {
+		metas    map[ulid.ULID]*metadata.Meta
+		expected []Gap
+	}{
+		"no blocks": {
+			metas: newMetas(),
+		},
+		"single block": {
+			metas: newMetas([2]int64{0, 10}),
+		},
+		"adjacent blocks": {
+			metas: newMetas([2]int64{10, 20}, [2]int64{0, 10}, [2]int64{20, 30}),
+		},
+		"overlapping blocks": {
+			metas: newMetas([2]int64{0, 15}, [2]int64{10, 20}, [2]int64{5, 30}, [2]int64{20, 25}),
+		},
+		"gaps between blocks": {
+			metas:    newMetas([2]int64{0, 10}, [2]int64{40, 50}, [2]int64{15, 20}),
+			expected: []Gap{{MinTime: 10, MaxTime: 15}, {MinTime: 20, MaxTime: 40}},
+		},
+		"gap after a block covered by a larger one": {
+			metas:    newMetas([2]int64{0, 30}, [2]int64{10, 20}, [2]int64{35, 40}),
+			expected: []Gap{{MinTime: 30, MaxTime: 35}},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, FindGaps(testData.metas))
+		})
+	}
+}
@@ -18,10 +18,12 @@ import (
 	"github.com/grafana/dskit/flagext"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/relabel"
+	"golang.org/x/exp/slices"
 	"golang.org/x/time/rate"
 	"gopkg.in/yaml.v3"
 
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
 )
 
@@ -55,6 +57,10 @@ const (
 	MinCompactorPartialBlockDeletionDelay = 4 * time.Hour
 )
 
+// QueryResultResponseFormats are the supported values of the query_result_response_format limit.
+// They must match the formats supported by the query-frontend.
+var QueryResultResponseFormats = []string{"json", "protobuf"}
+
 // LimitError are errors that do not comply with the limits specified.
 type LimitError string
 
@@ -126,6 +132,7 @@ type Limits struct {
 	ResultsCacheTTL                        model.Duration `yaml:"results_cache_ttl" json:"results_cache_ttl" category:"experimental"`
 	ResultsCacheTTLForOutOfOrderTimeWindow model.Duration `yaml:"results_cache_ttl_for_out_of_order_time_window" json:"results_cache_ttl_for_out_of_order_time_window" category:"experimental"`
 	MaxQueryExpressionSizeBytes            int            `yaml:"max_query_expression_size_bytes" json:"max_query_expression_size_bytes" category:"experimental"`
+	QueryResultResponseFormat              string         `yaml:"query_result_response_format" json:"query_result_response_format" doc:"nocli|description=Format to use when retrieving query results from queriers for the tenant. Supported values: json, protobuf. If empty, the format configured via -query-frontend.query-result-response-format is used." category:"experimental"`
 
 	// Cardinality
 	CardinalityAnalysisEnabled                    bool `yaml:"cardinality_analysis_enabled" json:"cardinality_analysis_enabled"`
@@ -144,15 +151,22 @@ type Limits struct {
 	StoreGatewayTenantShardSize int `yaml:"store_gateway_tenant_shard_size" json:"store_gateway_tenant_shard_size"`
 
 	// Compactor.
-	CompactorBlocksRetentionPeriod        model.Duration `yaml:"compactor_blocks_retention_period" json:"compactor_blocks_retention_period"`
-	CompactorSplitAndMergeShards          int            `yaml:"compactor_split_and_merge_shards" json:"compactor_split_and_merge_shards"`
-	CompactorSplitGroups                  int            `yaml:"compactor_split_groups" json:"compactor_split_groups"`
-	CompactorTenantShardSize              int            `yaml:"compactor_tenant_shard_size" json:"compactor_tenant_shard_size"`
-	CompactorPartialBlockDeletionDelay    model.Duration `yaml:"compactor_partial_block_deletion_delay" json:"compactor_partial_block_deletion_delay"`
-	CompactorBlockUploadEnabled           bool           `yaml:"compactor_block_upload_enabled" json:"compactor_block_upload_enabled"`
-	CompactorBlockUploadValidationEnabled bool           `yaml:"compactor_block_upload_validation_enabled" json:"compactor_block_upload_validation_enabled"`
-	CompactorBlockUploadVerifyChunks      bool           `yaml:"compactor_block_upload_verify_chunks" json:"compactor_block_upload_verify_chunks"`
-	CompactorBlockUploadMaxBlockSizeBytes int64          `yaml:"compactor_block_upload_max_block_size_bytes" json:"compactor_block_upload_max_block_size_bytes" category:"advanced"`
+	CompactorBlocksRetentionPeriod           model.Duration          `yaml:"compactor_blocks_retention_period" json:"compactor_blocks_retention_period"`
+	CompactorSplitAndMergeShards             int                     `yaml:"compactor_split_and_merge_shards" json:"compactor_split_and_merge_shards"`
+	CompactorSplitGroups                     int                     `yaml:"compactor_split_groups" json:"compactor_split_groups"`
+	CompactorTenantShardSize                 int                     `yaml:"compactor_tenant_shard_size" json:"compactor_tenant_shard_size"`
+	CompactorPartialBlockDeletionDelay       model.Duration          `yaml:"compactor_partial_block_deletion_delay" json:"compactor_partial_block_deletion_delay"`
+	CompactorBlockUploadEnabled              bool                    `yaml:"compactor_block_upload_enabled" json:"compactor_block_upload_enabled"`
+	CompactorBlockUploadValidationEnabled    bool                    `yaml:"compactor_block_upload_validation_enabled" json:"compactor_block_upload_validation_enabled"`
+	CompactorBlockUploadVerifyChunks         bool                    `yaml:"compactor_block_upload_verify_chunks" json:"compactor_block_upload_verify_chunks"`
+	CompactorBlockUploadMaxBlockSizeBytes    int64                   `yaml:"compactor_block_upload_max_block_size_bytes" json:"compactor_block_upload_max_block_size_bytes" category:"advanced"`
+	CompactorBlockUploadValidators           flagext.StringSliceCSV  `yaml:"compactor_block_upload_validators" json:"compactor_block_upload_validators" category:"experimental"`
+	CompactorBlockUploadMaxUncompactedBlocks int                     `yaml:"compactor_block_upload_max_uncompacted_blocks" json:"compactor_block_upload_max_uncompacted_blocks" category:"experimental"`
+	CompactorBlockUploadMinAge               model.Duration          `yaml:"compactor_block_upload_min_age" json:"compactor_block_upload_min_age" category:"experimental"`
+	CompactorBlockUploadMaxFiles             int                     `yaml:"compactor_block_upload_max_files" json:"compactor_block_upload_max_files" category:"experimental"`
+	CompactorBlockUploadMaxFileSizeBytes     int64                   `yaml:"compactor_block_upload_max_file_size_bytes" json:"compactor_block_upload_max_file_size_bytes" category:"experimental"`
+	CompactorBlockUploadAllowedLabels        flagext.StringSliceCSV  `yaml:"compactor_block_upload_allowed_external_labels" json:"compactor_block_upload_allowed_external_labels" category:"experimental"`
+	CompactorBlockRanges                     mimir_tsdb.DurationList `yaml:"compactor_block_ranges" json:"compactor_block_ranges" doc:"nocli|description=List of compaction time ranges for the tenant. Each range must be divisible by the previous one. If empty, the ranges configured via -compactor.block-ranges are used." category:"experimental"`
 
 	// This config doesn't have a CLI flag registered here because they're registered in
 	// their own original config struct.
@@ -250,6 +264,12 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.CompactorBlockUploadValidationEnabled, "compactor.block-upload-validation-enabled", true, "Enable block upload validation for the tenant.")
 	f.BoolVar(&l.CompactorBlockUploadVerifyChunks, "compactor.block-upload-verify-chunks", true, "Verify chunks when uploading blocks via the upload API for the tenant.")
 	f.Int64Var(&l.CompactorBlockUploadMaxBlockSizeBytes, "compactor.block-upload-max-block-size-bytes", 0, "Maximum size in bytes of a block that is allowed to be uploaded or validated. 0 = no limit.")
+	f.IntVar(&l.CompactorBlockUploadMaxUncompactedBlocks, "compactor.block-upload-max-uncompacted-blocks", 0, "Maximum number of blocks not compacted yet of the tenant, above which new block uploads are rejected until compaction catches up. The number of blocks is read from the tenant's bucket index, so it can lag behind by the bucket index update interval. 0 = no limit.")
+	f.IntVar(&l.CompactorBlockUploadMaxFiles, "compactor.block-upload-max-files", 0, "Maximum number of files, including the meta file, of a block that is allowed to be uploaded. 0 = no limit.")
+	f.Var(&l.CompactorBlockUploadAllowedLabels, "compactor.block-upload-allowed-external-labels", "Comma-separated list of additional external labels which are preserved in the blocks uploaded by the tenant. Blocks with any other external label, besides the ones used by Mimir, are rejected.")
+	f.Int64Var(&l.CompactorBlockUploadMaxFileSizeBytes, "compactor.block-upload-max-file-size-bytes", 0, "Maximum size in bytes of a block file that is allowed to be uploaded. Uploads of larger files are rejected with status code 413. 0 = no limit.")
+	f.Var(&l.CompactorBlockUploadMinAge, "compactor.block-upload-min-age", "Minimum time since the upload of a block has been started before its upload can be completed. Requests completing the upload of a block earlier are rejected, and can be retried after the time returned in the Retry-After header. 0 = disabled.")
+	f.Var(&l.CompactorBlockUploadValidators, "compactor.block-upload-validators", "Comma-separated list of names of the validators to run on the metadata of the blocks uploaded by the tenant, when their upload is started. Validators are registered by the projects embedding the compactor, and configuring a validator which isn't registered is a configuration error.")
 
 	// Query-frontend.
 	f.Var(&l.MaxTotalQueryLength, maxTotalQueryLengthFlag, "Limit the total query time range (end - start time). This limit is enforced in the query-frontend on the received query.")
@@ -332,6 +352,19 @@ func (l *Limits) validate() error {
 		}
 	}
 
+	if l.QueryResultResponseFormat != "" && !slices.Contains(QueryResultResponseFormats, l.QueryResultResponseFormat) {
+		return fmt.Errorf("invalid query_result_response_format: unknown format '%s'. Supported values: %s", l.QueryResultResponseFormat, strings.Join(QueryResultResponseFormats, ", "))
+	}
+
+	for i, r := range l.CompactorBlockRanges {
+		if r <= 0 {
+			return fmt.Errorf("invalid compactor_block_ranges: %s is not a positive duration", r)
+		}
+		if i > 0 && r%l.CompactorBlockRanges[i-1] != 0 {
+			return fmt.Errorf("invalid compactor_block_ranges: %s is not divisible by %s", r, l.CompactorBlockRanges[i-1])
+		}
+	}
+
 	return nil
 }
 
@@ -635,6 +668,12 @@ func (o *Overrides) CompactorSplitGroups(userID string) int {
 	return o.getOverridesForUser(userID).CompactorSplitGroups
 }
 
+// CompactorBlockRanges returns the compaction time ranges for a given user. Empty if the user has no
+// specific ranges, in which case the compactor ranges are used.
+func (o *Overrides) CompactorBlockRanges(userID string) mimir_tsdb.DurationList {
+	return o.getOverridesForUser(userID).CompactorBlockRanges
+}
+
 // CompactorPartialBlockDeletionDelay returns the partial block deletion delay time period for a given user,
 // and whether the configured value was valid. If the value wasn't valid, the returned delay is the default one
 // and the caller is responsible to warn the Mimir operator about it.
@@ -669,6 +708,36 @@ func (o *Overrides) CompactorBlockUploadMaxBlockSizeBytes(userID string) int64 {
 	return o.getOverridesForUser(userID).CompactorBlockUploadMaxBlockSizeBytes
 }
 
+// CompactorBlockUploadValidators returns the names of the validators to run on the blocks uploaded by a given tenant.
+func (o *Overrides) CompactorBlockUploadValidators(tenantID string) []string {
+	return o.getOverridesForUser(tenantID).CompactorBlockUploadValidators
+}
+
+// CompactorBlockUploadMaxUncompactedBlocks returns the maximum number of blocks not compacted yet above which block uploads are rejected for a given tenant.
+func (o *Overrides) CompactorBlockUploadMaxUncompactedBlocks(tenantID string) int {
+	return o.getOverridesForUser(tenantID).CompactorBlockUploadMaxUncompactedBlocks
+}
+
+// CompactorBlockUploadMinAge returns the minimum time since the upload of a block has been started before its upload can be completed for a given tenant.
+func (o *Overrides) CompactorBlockUploadMinAge(tenantID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(tenantID).CompactorBlockUploadMinAge)
+}
+
+// CompactorBlockUploadMaxFiles returns the maximum number of files of a block that is allowed to be uploaded for a given tenant.
+func (o *Overrides) CompactorBlockUploadMaxFiles(tenantID string) int {
+	return o.getOverridesForUser(tenantID).CompactorBlockUploadMaxFiles
+}
+
+// CompactorBlockUploadAllowedLabels returns the additional external labels preserved in the blocks uploaded by a given tenant.
+func (o *Overrides) CompactorBlockUploadAllowedLabels(tenantID string) []string {
+	return o.getOverridesForUser(tenantID).CompactorBlockUploadAllowedLabels
+}
+
+// CompactorBlockUploadMaxFileSizeBytes returns the maximum size in bytes of a block file that is allowed to be uploaded for a given tenant.
+func (o *Overrides) CompactorBlockUploadMaxFileSizeBytes(tenantID string) int64 {
+	return o.getOverridesForUser(tenantID).CompactorBlockUploadMaxFileSizeBytes
+}
+
 // MetricRelabelConfigs returns the metric relabel configs for a given user.
 func (o *Overrides) MetricRelabelConfigs(userID string) []*relabel.Config {
 	return o.getOverridesForUser(userID).MetricRelabelConfigs
@@ -817,6 +886,12 @@ func (o *Overrides) ResultsCacheTTL(user string) time.Duration {
 	return time.Duration(o.getOverridesForUser(user).ResultsCacheTTL)
 }
 
+// QueryResultResponseFormat returns the format to use when retrieving query results from queriers for the tenant.
+// An empty string means the query-frontend configured format should be used.
+func (o *Overrides) QueryResultResponseFormat(user string) string {
+	return o.getOverridesForUser(user).QueryResultResponseFormat
+}
+
 func (o *Overrides) ResultsCacheTTLForOutOfOrderTimeWindow(user string) time.Duration {
 	return time.Duration(o.getOverridesForUser(user).ResultsCacheTTLForOutOfOrderTimeWindow)
 }
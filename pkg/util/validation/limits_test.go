@@ -21,6 +21,7 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 )
 
 func TestOverridesManager_GetOverrides(t *testing.T) {
@@ -622,6 +623,46 @@ metric_relabel_configs:
 	})
 }
 
+func TestQueryResultResponseFormatLoadingFromYaml(t *testing.T) {
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	for _, format := range append([]string{""}, QueryResultResponseFormats...) {
+		t.Run(fmt.Sprintf("valid format %q", format), func(t *testing.T) {
+			limits := Limits{}
+			require.NoError(t, yaml.Unmarshal([]byte(fmt.Sprintf(`query_result_response_format: %q`, format)), &limits))
+			assert.Equal(t, format, limits.QueryResultResponseFormat)
+		})
+	}
+
+	t.Run("unknown format", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`query_result_response_format: protobuff`), &limits)
+		require.ErrorContains(t, err, "invalid query_result_response_format: unknown format 'protobuff'. Supported values: json, protobuf")
+	})
+}
+
+func TestCompactorBlockRangesLoadingFromYaml(t *testing.T) {
+	SetDefaultLimitsForYAMLUnmarshalling(Limits{})
+
+	t.Run("valid ranges", func(t *testing.T) {
+		limits := Limits{}
+		require.NoError(t, yaml.Unmarshal([]byte(`compactor_block_ranges: [2h, 4h, 24h]`), &limits))
+		assert.Equal(t, mimir_tsdb.DurationList{2 * time.Hour, 4 * time.Hour, 24 * time.Hour}, limits.CompactorBlockRanges)
+	})
+
+	t.Run("range not divisible by the previous one", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`compactor_block_ranges: [2h, 3h]`), &limits)
+		require.ErrorContains(t, err, "invalid compactor_block_ranges: 3h0m0s is not divisible by 2h0m0s")
+	})
+
+	t.Run("non positive range", func(t *testing.T) {
+		limits := Limits{}
+		err := yaml.Unmarshal([]byte(`compactor_block_ranges: [0s]`), &limits)
+		require.ErrorContains(t, err, "invalid compactor_block_ranges: 0s is not a positive duration")
+	})
+}
+
 type structExtension struct {
 	Foo int `yaml:"foo" json:"foo"`
 }
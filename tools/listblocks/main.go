@@ -36,6 +36,7 @@ type config struct {
 	showCompactionLevel bool
 	showBlockSize       bool
 	showStats           bool
+	showGaps            bool
 	splitCount          int
 	minTime             flagext.Time
 	maxTime             flagext.Time
@@ -60,6 +61,7 @@ func main() {
 	flag.Var(&cfg.maxTime, "max-time", "If set, only blocks with MaxTime <= this value are printed")
 	flag.BoolVar(&cfg.useUlidTimeForMinTimeCheck, "use-ulid-time-for-min-time-check", false, "If true, meta.json files for blocks with ULID time before min-time are not loaded. This may incorrectly skip blocks that have data from the future (minT/maxT higher than ULID).")
 	flag.BoolVar(&cfg.showStats, "show-stats", false, "Show block stats (number of series, chunks, samples)")
+	flag.BoolVar(&cfg.showGaps, "show-gaps", false, "Show the time ranges not covered by any block, after the blocks")
 	flag.Parse()
 
 	if cfg.userID == "" {
@@ -85,6 +87,42 @@ func main() {
 	}
 
 	printMetas(metas, deletedTimes, cfg)
+
+	if cfg.showGaps {
+		printGaps(metas, deletedTimes, cfg)
+	}
+}
+
+// nolint:errcheck
+//
+//goland:noinspection GoUnhandledErrorResult
+func printGaps(metas map[ulid.ULID]*metadata.Meta, deletedTimes map[ulid.ULID]time.Time, cfg config) {
+	// Deleted blocks don't cover their time range anymore.
+	existing := make(map[ulid.ULID]*metadata.Meta, len(metas))
+	for id, b := range metas {
+		if deletedTimes[id].IsZero() {
+			existing[id] = b
+		}
+	}
+
+	tabber := tabwriter.NewWriter(os.Stdout, 1, 4, 3, ' ', 0)
+	defer tabber.Flush()
+
+	fmt.Fprintln(tabber)
+	fmt.Fprintln(tabber, "Gap Min Time\tGap Max Time\tDuration\t")
+	for _, g := range listblocks.FindGaps(existing) {
+		if !time.Time(cfg.minTime).IsZero() && util.TimeFromMillis(g.MaxTime).Before(time.Time(cfg.minTime)) {
+			continue
+		}
+		if !time.Time(cfg.maxTime).IsZero() && util.TimeFromMillis(g.MinTime).After(time.Time(cfg.maxTime)) {
+			continue
+		}
+
+		fmt.Fprintf(tabber, "%v\t", util.TimeFromMillis(g.MinTime).UTC().Format(time.RFC3339))
+		fmt.Fprintf(tabber, "%v\t", util.TimeFromMillis(g.MaxTime).UTC().Format(time.RFC3339))
+		fmt.Fprintf(tabber, "%v\t", util.TimeFromMillis(g.MaxTime).Sub(util.TimeFromMillis(g.MinTime)))
+		fmt.Fprintln(tabber)
+	}
 }
 
 // nolint:errcheck